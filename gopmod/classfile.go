@@ -17,17 +17,30 @@
 package gopmod
 
 import (
+	"context"
+	"fmt"
+	"go/parser"
+	"go/token"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
 	"github.com/goplus/mod"
 	"github.com/goplus/mod/modcache"
 	"github.com/goplus/mod/modfetch"
 	"github.com/goplus/mod/modfile"
 	"github.com/goplus/mod/modload"
-	"github.com/qiniu/x/errors"
 	"golang.org/x/mod/module"
+	"golang.org/x/mod/semver"
 )
 
 type Class = modfile.Class
 type Project = modfile.Project
+type Import = modfile.Import
 
 var (
 	SpxProject = &Project{
@@ -49,25 +62,49 @@ var (
 	}
 )
 
+func init() {
+	registerSourceExts(SpxProject)
+	registerSourceExts(GshProject)
+	modfetch.RegisterSourceExt(".gmx") // old style
+}
+
+// registerSourceExts registers plain exts of project c, so that directories
+// containing only its classfiles are recognized as packages by modfetch.
+func registerSourceExts(c *Project) {
+	if !modfile.IsExtPattern(c.Ext) {
+		modfetch.RegisterSourceExt(c.Ext)
+	}
+	for _, w := range c.Works {
+		if !modfile.IsExtPattern(w.Ext) {
+			modfetch.RegisterSourceExt(w.Ext)
+		}
+	}
+}
+
+// Aliases of sentinel errors of package mod, kept for compatibility.
 var (
 	ErrNotFound        = mod.ErrNotFound
-	ErrNotClassFileMod = errors.New("not a classfile module")
+	ErrNotClassFileMod = mod.ErrNotClassFileMod
+	ErrNotClassFile    = mod.ErrNotClassFile
 )
 
 // IsNotFound returns a boolean indicating whether the error is known to
 // report that a module or package does not exist. It is satisfied by
-// ErrNotFound.
+// ErrNotFound and errors wrapping it.
+//
+// Deprecated: Use mod.IsNotFound instead.
 func IsNotFound(err error) bool {
-	return errors.Err(err) == ErrNotFound
+	return mod.IsNotFound(err)
 }
 
 // -----------------------------------------------------------------------------
 
 // ClassKind checks a fname is a known classfile or not.
 // If it is, then it checks the fname is a project file or not.
+// A file excluded by its project (see Project.IsExcluded) isn't a classfile.
 func (p *Module) ClassKind(fname string) (isProj, ok bool) {
 	ext := modfile.ClassExt(fname)
-	if c, ok := p.projs[ext]; ok {
+	if c, ok := p.lookupFile(fname); ok && !c.IsExcluded(fname) {
 		return c.IsProj(ext, fname), true
 	}
 	return
@@ -75,61 +112,407 @@ func (p *Module) ClassKind(fname string) (isProj, ok bool) {
 
 // IsClass checks ext is a known classfile or not.
 func (p *Module) IsClass(ext string) (ok bool) {
-	_, ok = p.projs[ext]
+	_, ok = p.lookupProj(ext)
 	return
 }
 
 // LookupClass lookups a classfile by ext.
 func (p *Module) LookupClass(ext string) (c *Project, ok bool) {
+	return p.lookupProj(ext)
+}
+
+func (p *Module) lookupProj(ext string) (c *Project, ok bool) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.lookupProjLocked(ext)
+}
+
+func (p *Module) lookupProjLocked(ext string) (c *Project, ok bool) {
+	if c, ok = p.overrides[ext]; ok {
+		return
+	}
 	c, ok = p.projs[ext]
 	return
 }
 
+// lookupFile lookups the classfile project of fname by its ext, and then by
+// ext patterns (see modfile.IsExtPattern) in lexical order.
+func (p *Module) lookupFile(fname string) (c *Project, ok bool) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if c, ok = p.lookupProjLocked(modfile.ClassExt(fname)); ok || p.matcher == nil {
+		return
+	}
+	for _, pattern := range p.matcher.patterns {
+		if modfile.MatchExt(pattern, fname) {
+			if c, ok = p.lookupProjLocked(pattern); ok {
+				return
+			}
+		}
+	}
+	return
+}
+
+// OverrideClass registers a classfile project that takes precedence over
+// classfiles imported by ImportClasses, eg. a locally-developed classfile
+// which isn't declared in any gop.mod yet. It doesn't change any file.
+func (p *Module) OverrideClass(proj *Project) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.overrides == nil {
+		p.overrides = make(map[string]*Project)
+	}
+	p.overrides[proj.Ext] = proj
+	for _, w := range proj.Works {
+		p.overrides[w.Ext] = proj
+	}
+	p.updateMatcherLocked()
+	if p.srcs == nil {
+		p.srcs = make(map[*Project]*ClassSource)
+	}
+	p.srcs[proj] = &ClassSource{Kind: SourceOverride}
+}
+
+// RemoveClassOverride removes the overriding project (registered by
+// OverrideClass) which provides the classfile ext.
+func (p *Module) RemoveClassOverride(ext string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	proj, ok := p.overrides[ext]
+	if !ok {
+		return
+	}
+	for k, c := range p.overrides {
+		if c == proj {
+			delete(p.overrides, k)
+		}
+	}
+	delete(p.srcs, proj)
+	p.updateMatcherLocked()
+}
+
+// ImportsForFile returns all packages to import automatically for the
+// classfile fname: package paths of its project (PkgPaths), the auto-imported
+// packages (Import), and then packages of the prototype class of its work
+// class (eg. `class .spx Sprite spx.Game`). Packages are deduplicated by
+// path, and if a package is imported more than once, the first explicit
+// alias wins. The package name of a prototype class is resolved to an alias
+// or a package of its project first, and then of other projects known by
+// this module.
+// ImportClasses should be called before calling this method.
+func (p *Module) ImportsForFile(fname string) (imports []Import, err error) {
+	fname = filepath.Base(fname)
+	ext := modfile.ClassExt(fname)
+	c, ok := p.lookupFile(fname)
+	if !ok {
+		return nil, ErrNotClassFile
+	}
+	idx := make(map[string]int, len(c.PkgPaths)+len(c.Import))
+	add := func(name, path string) {
+		if i, ok := idx[path]; ok {
+			if imports[i].Name == "" {
+				imports[i].Name = name
+			}
+			return
+		}
+		idx[path] = len(imports)
+		imports = append(imports, Import{Name: name, Path: path})
+	}
+	for _, pkgPath := range c.PkgPaths {
+		add("", pkgPath)
+	}
+	for _, imp := range c.Import {
+		add(imp.Name, imp.Path)
+	}
+	w := c.WorkForFile(fname)
+	if w == nil || w.Project == "" || c.IsProj(ext, fname) {
+		return
+	}
+	sym, err := modfile.ParseSymbol(w.Project)
+	if err != nil {
+		return nil, err
+	}
+	var projs []*Project
+	for _, pkg := range symbolPkgs(sym, nil) {
+		name, path, ok := resolvePkg(c, pkg)
+		if !ok {
+			if projs == nil {
+				projs = p.SortedProjects()
+			}
+			for _, proj := range projs {
+				if name, path, ok = resolvePkg(proj, pkg); ok {
+					break
+				}
+			}
+		}
+		if !ok {
+			return nil, fmt.Errorf("%s: unknown package %s of prototype class %s", fname, pkg, w.Project)
+		}
+		add(name, path)
+	}
+	return
+}
+
+// symbolPkgs appends package names qualifying sym and its type arguments.
+func symbolPkgs(sym *modfile.Symbol, pkgs []string) []string {
+	if sym.PkgQualifier != "" {
+		pkgs = append(pkgs, sym.PkgQualifier)
+	}
+	for _, arg := range sym.TypeArgs {
+		pkgs = symbolPkgs(arg, pkgs)
+	}
+	return pkgs
+}
+
+// resolvePkg resolves package name pkg to an aliased auto-imported package
+// of project c, or a package of c named pkg.
+func resolvePkg(c *Project, pkg string) (name, path string, ok bool) {
+	for _, imp := range c.Import {
+		if imp.Name == pkg {
+			return imp.Name, imp.Path, true
+		}
+	}
+	for _, pkgPath := range c.PkgPaths {
+		if pkgName(pkgPath) == pkg {
+			return "", pkgPath, true
+		}
+	}
+	for _, imp := range c.Import {
+		if imp.Name == "" && pkgName(imp.Path) == pkg {
+			return "", imp.Path, true
+		}
+	}
+	return
+}
+
+// pkgName returns the default package name of pkgPath, that is, its last
+// element without a major version suffix, eg. "spx" for
+// "github.com/goplus/spx/v2".
+func pkgName(pkgPath string) string {
+	if prefix, pathMajor, ok := module.SplitPathVersion(pkgPath); ok && pathMajor != "" {
+		pkgPath = prefix
+	}
+	return path.Base(pkgPath)
+}
+
+// ClassfileDoc returns documentation of the classfile specified by ext.
+// It reads classfile.md in the classfile package directory (the first
+// package path of the project) if present, or the package documentation
+// in its doc.go otherwise. It returns ErrNotFound if there is no doc.
+// ImportClasses should be called before calling this method.
+func (p *Module) ClassfileDoc(ext string) (doc string, err error) {
+	c, ok := p.lookupProj(ext)
+	if !ok {
+		return "", ErrNotClassFile
+	}
+	if len(c.PkgPaths) == 0 {
+		return "", ErrNotFound
+	}
+	pkg, err := p.Lookup(c.PkgPaths[0])
+	if err != nil {
+		return
+	}
+	if b, e := modcache.ReadFile(filepath.Join(pkg.Dir, "classfile.md")); e == nil {
+		return string(b), nil
+	}
+	docFile := filepath.Join(pkg.Dir, "doc.go")
+	src, e := modcache.ReadFile(docFile)
+	if e != nil {
+		return "", ErrNotFound
+	}
+	f, e := parser.ParseFile(token.NewFileSet(), docFile, src, parser.PackageClauseOnly|parser.ParseComments)
+	if e == nil && f.Doc != nil {
+		if doc = strings.TrimSpace(f.Doc.Text()); doc != "" {
+			return
+		}
+	}
+	return "", ErrNotFound
+}
+
+// A ClassConfig is the resolved classfile configuration of a source file.
+type ClassConfig struct {
+	Project  *Project
+	Class    *Class   // the work class, nil if the file is a project file
+	IsProj   bool     // the file is a project file
+	Prefix   string   // method-name prefix (work class first, then project default)
+	Embedded bool     // the class instance is embedded in the project
+	Tags     []string // Go build tags required by the file (project tags, then work class tags)
+}
+
+// ClassConfigFor returns the resolved classfile configuration of fname.
+// It returns ErrNotClassFile if fname isn't a known classfile, or is excluded
+// by its project.
+func (p *Module) ClassConfigFor(fname string) (*ClassConfig, error) {
+	fname = filepath.Base(fname)
+	ext := modfile.ClassExt(fname)
+	c, ok := p.lookupFile(fname)
+	if !ok || c.IsExcluded(fname) {
+		return nil, ErrNotClassFile
+	}
+	ret := &ClassConfig{Project: c, IsProj: c.IsProj(ext, fname), Prefix: c.Prefix, Tags: c.Tags}
+	if ret.IsProj {
+		return ret, nil
+	}
+	if w := c.WorkForFile(fname); w != nil {
+		ret.Class = w
+		if w.Prefix != "" {
+			ret.Prefix = w.Prefix
+		}
+		ret.Embedded = w.Embedded || c.Embedded
+		ret.Tags = mergeTags(c.Tags, w.Tags)
+	}
+	return ret, nil
+}
+
+func mergeTags(a, b []string) []string {
+	if len(b) == 0 {
+		return a
+	}
+	ret := append([]string(nil), a...)
+	for _, tag := range b {
+		found := false
+		for _, v := range a {
+			if v == tag {
+				found = true
+				break
+			}
+		}
+		if !found {
+			ret = append(ret, tag)
+		}
+	}
+	return ret
+}
+
+// A Classfile is a classfile source file of a module.
+type Classfile struct {
+	Path   string   // absolute path of the file
+	Proj   *Project // project of the classfile
+	IsProj bool     // a project file or a work file
+}
+
+// Classfiles walks this module and returns all classfile source files
+// grouped by their projects. Directories named vendor or testdata, those
+// beginning with "." or "_", and nested modules are skipped, so are files
+// excluded by their projects (see modfile.Project.IsExcluded).
+// ImportClasses should be called before calling this method.
+func (p *Module) Classfiles() (ret map[*Project][]*Classfile, err error) {
+	root := p.Root()
+	if root == "" {
+		return nil, ErrNotFound
+	}
+	ret = make(map[*Project][]*Classfile)
+	err = filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		name := d.Name()
+		if d.IsDir() {
+			if path == root {
+				return nil
+			}
+			if name == "vendor" || name == "testdata" || strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_") {
+				return filepath.SkipDir
+			}
+			if _, e := os.Lstat(filepath.Join(path, "go.mod")); e == nil { // nested module
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		ext := modfile.ClassExt(name)
+		if c, ok := p.lookupFile(name); ok && !c.IsExcluded(name) {
+			ret[c] = append(ret[c], &Classfile{Path: path, Proj: c, IsProj: c.IsProj(ext, name)})
+		}
+		return nil
+	})
+	return
+}
+
 // ImportClasses imports all classfiles found in this module (from go.mod/gop.mod).
+// Classfiles are imported into a new index which replaces the current one
+// when all of them are imported, so that concurrent lookups never see a
+// partially built index. importClass (if any) is called without any lock held.
+// Projects claiming the same ext are resolved by the precedence rules of
+// modfile.ResolveExt, and then (if they are of different modules) by the
+// conflict policy (see SetConflictPolicy), which may fail with a
+// *ConflictError.
 func (p *Module) ImportClasses(importClass ...func(c *Project)) (err error) {
 	var impcls func(c *Project)
 	if importClass != nil {
 		impcls = importClass[0]
 	}
-	p.projs = make(map[string]*Project)
-	p.importClass(TestProject, impcls)
-	p.importClass(GshProject, impcls)
-	p.importClass(SpxProject, impcls)
-	p.projs[".gmx"] = SpxProject // old style
+	p.mu.RLock()
+	policy := p.policy
+	p.mu.RUnlock()
+	idx := &classIndex{
+		projs:  make(map[string]*Project),
+		srcs:   make(map[*Project]*ClassSource),
+		impcls: impcls,
+		policy: policy,
+	}
+	defer func() {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		for c, src := range p.srcs {
+			if src.Kind == SourceOverride {
+				idx.srcs[c] = src
+			}
+		}
+		p.projs, p.srcs = idx.projs, idx.srcs
+		p.updateMatcherLocked()
+	}()
+	builtin := &ClassSource{Kind: SourceBuiltin}
+	idx.add(TestProject, builtin)
+	idx.add(GshProject, builtin)
+	idx.add(SpxProject, builtin)
+	idx.projs[".gmx"] = SpxProject // old style
 	opt := p.Opt
+	if opt == nil {
+		return
+	}
 	for _, c := range opt.Projects {
-		p.importClass(c, impcls)
+		if err = idx.add(c, newClassSource(SourceMain, module.Version{Path: p.Path()}, opt, c)); err != nil {
+			return
+		}
 	}
 	for _, classMod := range opt.ClassMods {
-		if err = p.importMod(classMod, impcls); err != nil {
+		if err = p.importMod(idx, classMod); err != nil {
 			return
 		}
 	}
 	return
 }
 
-func (p *Module) importMod(modPath string, imcls func(c *Project)) (err error) {
+func (p *Module) importMod(idx *classIndex, modPath string) (err error) {
 	mod, ok := p.LookupDepMod(modPath)
 	if !ok {
 		return ErrNotFound
 	}
-	err = p.importClassFrom(mod, imcls)
+	err = importClassFrom(idx, mod)
 	if !IsNotFound(err) {
 		return
 	}
-	mod, err = modfetch.Get(mod.String())
+	mod, err = p.fetchMod(context.Background(), mod)
 	if err != nil {
 		return
 	}
-	return p.importClassFrom(mod, imcls)
+	return importClassFrom(idx, mod)
 }
 
-func (p *Module) importClassFrom(modVer module.Version, impcls func(c *Project)) (err error) {
+func importClassFrom(idx *classIndex, modVer module.Version) (err error) {
 	dir, err := modcache.Path(modVer)
 	if err != nil {
 		return
 	}
-	mod, err := modload.Load(dir)
+	var mod modload.Module
+	if modcache.InPath(dir) {
+		if !modcache.Complete(modVer) {
+			return ErrNotFound
+		}
+		mod, err = loadCachedMod(dir)
+	} else {
+		mod, err = modload.Load(dir)
+	}
 	if err != nil {
 		return
 	}
@@ -138,19 +521,400 @@ func (p *Module) importClassFrom(modVer module.Version, impcls func(c *Project))
 		return ErrNotClassFileMod
 	}
 	for _, c := range projs {
-		p.importClass(c, impcls)
+		if err = idx.add(c, newClassSource(SourceDep, modVer, mod.Opt, c)); err != nil {
+			return
+		}
 	}
 	return
 }
 
-func (p *Module) importClass(c *Project, impcls func(c *Project)) {
-	p.projs[c.Ext] = c
+// A classIndex is an index of classfile projects being built by ImportClasses.
+type classIndex struct {
+	projs  map[string]*Project // ext -> project
+	srcs   map[*Project]*ClassSource
+	impcls func(c *Project)
+	policy ConflictPolicy
+}
+
+// add adds project c declared by src. An ext already claimed by another
+// project is resolved by the precedence rules of modfile.ResolveExt, and then
+// by the conflict policy if the projects are of different modules.
+func (p *classIndex) add(c *Project, src *ClassSource) error {
+	p.srcs[c] = src
+	registerSourceExts(c)
+	if err := p.claim(c.Ext, c, src); err != nil {
+		return err
+	}
 	for _, w := range c.Works {
-		p.projs[w.Ext] = c
+		if err := p.claim(w.Ext, c, src); err != nil {
+			return err
+		}
+	}
+	if p.impcls != nil {
+		p.impcls(c)
+	}
+	return nil
+}
+
+func (p *classIndex) claim(ext string, c *Project, src *ClassSource) error {
+	if old, ok := p.projs[ext]; ok && old != c {
+		orank, rank := modfile.ExtRank(old, ext), modfile.ExtRank(c, ext)
+		if orank > rank {
+			return nil
+		}
+		if orank == rank {
+			osrc := p.srcs[old]
+			if !isConflict(osrc, src) { // the first one wins, like ResolveExt
+				return nil
+			}
+			keep, err := p.policy.resolve(ext, osrc, src)
+			if err != nil || keep {
+				return err
+			}
+		}
+	}
+	p.projs[ext] = c
+	return nil
+}
+
+// isConflict checks if projects declared by a and b conflict when they claim
+// the same ext: builtin projects can always be replaced, and a module can't
+// conflict with itself.
+func isConflict(a, b *ClassSource) bool {
+	if a == nil || a.Kind == SourceBuiltin || b.Kind == SourceBuiltin {
+		return false
+	}
+	return a.Kind != b.Kind || a.Mod.Path != b.Mod.Path
+}
+
+// -----------------------------------------------------------------------------
+
+// A ConflictPolicy decides what ImportClasses does when classfile projects of
+// different modules claim the same ext with the same precedence (see
+// modfile.ResolveExt), eg. two depended modules both provide `.spx` as their
+// project exts. See Module.SetConflictPolicy.
+type ConflictPolicy int
+
+const (
+	// ConflictPreferLast: the project imported last wins silently, that is,
+	// projects of depended modules replace the one of this module, and the
+	// later required module wins. It's the default policy, which is what
+	// ImportClasses always did.
+	ConflictPreferLast ConflictPolicy = iota
+
+	// ConflictPreferMain: the project of this module wins. Conflicts between
+	// depended modules fail with a *ConflictError.
+	ConflictPreferMain
+
+	// ConflictPreferNewest: the project of this module wins, and the project
+	// of the depended module with the newest version wins otherwise. It fails
+	// with a *ConflictError if the versions are the same.
+	ConflictPreferNewest
+
+	// ConflictFail: any conflict fails with a *ConflictError.
+	ConflictFail
+)
+
+// A ConflictError is returned by ImportClasses if classfile projects of
+// different modules claim the same ext and the conflict policy can't resolve
+// it.
+type ConflictError struct {
+	Ext  string
+	Srcs [2]*ClassSource // sources of the conflicting projects, in import order
+}
+
+func (e *ConflictError) Error() string {
+	return fmt.Sprintf("classfile %s is provided by both %v and %v", e.Ext, e.Srcs[0], e.Srcs[1])
+}
+
+// resolve resolves the conflict of ext claimed by old and then by src. It
+// returns keep = true if the project of old wins.
+func (policy ConflictPolicy) resolve(ext string, old, src *ClassSource) (keep bool, err error) {
+	switch policy {
+	case ConflictPreferLast:
+		return false, nil
+	case ConflictPreferMain, ConflictPreferNewest:
+		if old.Kind == SourceMain || src.Kind == SourceMain {
+			return old.Kind == SourceMain, nil
+		}
+		if policy == ConflictPreferNewest {
+			if cmp := semver.Compare(old.Mod.Version, src.Mod.Version); cmp != 0 {
+				return cmp > 0, nil
+			}
+		}
+	}
+	return false, &ConflictError{Ext: ext, Srcs: [2]*ClassSource{old, src}}
+}
+
+// SetConflictPolicy sets the policy resolving conflicting classfile projects
+// (see ConflictPolicy) of subsequent ImportClasses calls.
+func (p *Module) SetConflictPolicy(policy ConflictPolicy) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.policy = policy
+}
+
+// -----------------------------------------------------------------------------
+
+// SourceKind specifies where a classfile project is declared.
+type SourceKind int
+
+const (
+	SourceBuiltin  SourceKind = iota // builtin project, eg. SpxProject
+	SourceMain                       // gop.mod of this module
+	SourceDep                        // gop.mod of a depended module
+	SourceOverride                   // registered by OverrideClass
+)
+
+// A ClassSource describes the provenance of a classfile project.
+type ClassSource struct {
+	Kind SourceKind
+	Mod  module.Version // the module declaring the project (only Path for SourceMain)
+	File string         // the gop.mod file declaring the project (empty if unknown)
+	Line int            // line number of the project statement (0 if unknown)
+}
+
+func newClassSource(kind SourceKind, mod module.Version, opt *modfile.File, c *Project) *ClassSource {
+	src := &ClassSource{Kind: kind, Mod: mod}
+	if opt != nil && opt.Syntax != nil {
+		src.File = opt.Syntax.Name
+	}
+	if c.Syntax != nil {
+		src.Line = c.Syntax.Start.Line
+	}
+	return src
+}
+
+// String returns a description of the source for diagnostics, eg.
+// "builtin", "gop.mod:3" or "github.com/goplus/yap@v0.8.0 (gop.mod:3)".
+func (p *ClassSource) String() string {
+	switch p.Kind {
+	case SourceBuiltin:
+		return "builtin"
+	case SourceOverride:
+		return "override"
+	}
+	pos := filepath.Base(p.File)
+	if p.File == "" {
+		pos = "gop.mod"
+	}
+	if p.Line > 0 {
+		pos += ":" + strconv.Itoa(p.Line)
+	}
+	if p.Kind == SourceDep {
+		return p.Mod.String() + " (" + pos + ")"
+	}
+	return pos
+}
+
+// ClassSource returns where the classfile project providing ext is declared.
+// ImportClasses should be called before calling this method.
+func (p *Module) ClassSource(ext string) (src *ClassSource, ok bool) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	c, ok := p.lookupProjLocked(ext)
+	if ok {
+		src, ok = p.srcs[c]
+	}
+	return
+}
+
+// -----------------------------------------------------------------------------
+
+// A ClassModInfo describes a classfile module imported by ImportClasses.
+type ClassModInfo struct {
+	Mod      module.Version // the module with its resolved version
+	Projects []*Project     // classfile projects provided by the module, in gop.mod order
+	Exts     []string       // classfile exts provided by the module (project ext first, then work exts)
+}
+
+// ClassMods returns classfile modules imported by ImportClasses, in the order
+// they are declared. Builtin projects and projects declared in gop.mod of this
+// module aren't included.
+func (p *Module) ClassMods() []ClassModInfo {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	idx := make(map[string]int) // module path => index in ret
+	var ret []ClassModInfo
+	if opt := p.Opt; opt != nil {
+		for _, path := range opt.ClassMods {
+			if _, ok := idx[path]; !ok {
+				idx[path] = len(ret)
+				ret = append(ret, ClassModInfo{Mod: module.Version{Path: path}})
+			}
+		}
+	}
+	lines := make(map[*Project]int, len(p.srcs))
+	for c, src := range p.srcs {
+		if src.Kind != SourceDep {
+			continue
+		}
+		i, ok := idx[src.Mod.Path]
+		if !ok {
+			continue
+		}
+		ret[i].Mod = src.Mod
+		ret[i].Projects = append(ret[i].Projects, c)
+		lines[c] = src.Line
+	}
+	n := 0
+	for _, info := range ret {
+		if info.Projects == nil { // not imported
+			continue
+		}
+		sort.Slice(info.Projects, func(i, j int) bool {
+			return lines[info.Projects[i]] < lines[info.Projects[j]]
+		})
+		seen := make(map[string]bool)
+		addExt := func(ext string) {
+			if ext != "" && !seen[ext] {
+				seen[ext] = true
+				info.Exts = append(info.Exts, ext)
+			}
+		}
+		for _, c := range info.Projects {
+			addExt(c.Ext)
+			for _, w := range c.Works {
+				addExt(w.Ext)
+			}
+		}
+		ret[n] = info
+		n++
+	}
+	return ret[:n]
+}
+
+// -----------------------------------------------------------------------------
+
+// Exts returns all classfile exts known by this module (including exts of
+// builtin projects and projects registered by OverrideClass), sorted in
+// lexical order. Before ImportClasses is called, only exts of builtin projects
+// and overrides are known.
+func (p *Module) Exts() []string {
+	return append([]string(nil), p.extMatcher().exts...)
+}
+
+// HasClassfileExt checks if ext (eg. ".spx" or "_yap.gox") is a classfile ext
+// known by this module. ext can also be a file name, eg. "main.spx", which is
+// also matched against ext patterns (see modfile.IsExtPattern). Before
+// ImportClasses is called, only exts of builtin projects and overrides are
+// known.
+func (p *Module) HasClassfileExt(ext string) bool {
+	return p.extMatcher().match(ext)
+}
+
+func (p *Module) extMatcher() *extMatcher {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if p.matcher == nil {
+		return builtinMatcher
 	}
-	if impcls != nil {
-		impcls(c)
+	return p.matcher
+}
+
+// updateMatcherLocked rebuilds the ext matcher after classfiles change (by
+// ImportClasses, OverrideClass, etc.).
+func (p *Module) updateMatcherLocked() {
+	projs := p.projs
+	if projs == nil { // classfiles aren't imported yet
+		projs = builtinProjs()
+	}
+	p.matcher = newExtMatcher(projs, p.overrides)
+}
+
+// An extMatcher matches classfile exts known by a module. It's built once
+// classfiles change, and is immutable after that.
+type extMatcher struct {
+	set      map[string]bool
+	exts     []string // sorted exts
+	patterns []string // sorted exts which are ext patterns, see modfile.IsExtPattern
+}
+
+var builtinMatcher = newExtMatcher(builtinProjs())
+
+func builtinProjs() map[string]*Project {
+	projs := map[string]*Project{".gmx": SpxProject}
+	for _, c := range []*Project{TestProject, GshProject, SpxProject} {
+		projs[c.Ext] = c
+		for _, w := range c.Works {
+			projs[w.Ext] = c
+		}
+	}
+	return projs
+}
+
+func newExtMatcher(projs ...map[string]*Project) *extMatcher {
+	m := &extMatcher{set: make(map[string]bool)}
+	for _, v := range projs {
+		for ext := range v {
+			if !m.set[ext] {
+				m.set[ext] = true
+				m.exts = append(m.exts, ext)
+				if modfile.IsExtPattern(ext) {
+					m.patterns = append(m.patterns, ext)
+				}
+			}
+		}
+	}
+	sort.Strings(m.exts)
+	sort.Strings(m.patterns)
+	return m
+}
+
+// match checks if ext is a known classfile ext, or a file name of it.
+func (m *extMatcher) match(ext string) bool {
+	if m.set[ext] {
+		return true
+	}
+	fext := modfile.ClassExt(ext)
+	if fext == ext {
+		return false
+	}
+	if m.set[fext] {
+		return true
+	}
+	for _, pattern := range m.patterns {
+		if modfile.MatchExt(pattern, ext) {
+			return true
+		}
+	}
+	return false
+}
+
+// SortedProjects returns all classfile projects in effect (that is, the ones
+// LookupClass returns for some ext), sorted by their project exts, and then by
+// exts of their first work classes. Projects shadowed by others for all their
+// exts aren't included. ImportClasses should be called before calling this
+// method.
+func (p *Module) SortedProjects() []*Project {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if p.matcher == nil {
+		return nil
+	}
+	seen := make(map[*Project]bool)
+	var projs []*Project
+	for _, ext := range p.matcher.exts {
+		if c, ok := p.lookupProjLocked(ext); ok && !seen[c] {
+			seen[c] = true
+			projs = append(projs, c)
+		}
+	}
+	sort.SliceStable(projs, func(i, j int) bool {
+		a, b := projs[i], projs[j]
+		if a.Ext != b.Ext {
+			return a.Ext < b.Ext
+		}
+		return firstWorkExt(a) < firstWorkExt(b)
+	})
+	return projs
+}
+
+func firstWorkExt(c *Project) string {
+	if len(c.Works) > 0 {
+		return c.Works[0].Ext
 	}
+	return ""
 }
 
 // -----------------------------------------------------------------------------
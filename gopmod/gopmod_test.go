@@ -17,19 +17,35 @@
 package gopmod
 
 import (
+	"archive/zip"
+	"context"
+	"fmt"
 	"log"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
 	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"testing/fstest"
 
 	"github.com/goplus/mod"
+	"github.com/goplus/mod/env"
 	"github.com/goplus/mod/modcache"
+	"github.com/goplus/mod/modfetch"
+	"github.com/goplus/mod/modfile"
 	"github.com/goplus/mod/modload/modtest"
 	"github.com/qiniu/x/errors"
 	"golang.org/x/mod/module"
 )
 
+func TestMain(m *testing.M) {
+	os.Exit(modtest.Main(m))
+}
+
 func TestPkgId(t *testing.T) {
 	mod := New(modtest.GopClass(t))
 	if id, err := mod.PkgId(""); err != ErrInvalidPkgPath || id != "" {
@@ -157,3 +173,961 @@ func TestClassfile2(t *testing.T) {
 		t.Fatal("mod.ClassKind foo.gox: ok?")
 	}
 }
+
+func TestImportsForFile(t *testing.T) {
+	mod := New(modtest.Import(t))
+	if _, err := mod.ImportsForFile("foo_ytest.gox"); err != ErrNotClassFile {
+		t.Fatal("mod.ImportsForFile:", err)
+	}
+	if err := mod.ImportClasses(); err != nil {
+		t.Fatal("mod.ImportClasses:", err)
+	}
+	imports, err := mod.ImportsForFile("foo_ytest.gox")
+	if err != nil {
+		t.Fatal("mod.ImportsForFile:", err)
+	}
+	var ret []string
+	for _, imp := range imports {
+		ret = append(ret, imp.Name+":"+imp.Path)
+	}
+	if v := strings.Join(ret, " "); v != ":github.com/goplus/yap/test :github.com/goplus/yap/ytest/auth/jwt yauth:github.com/goplus/yap/ytest/auth" {
+		t.Fatal("mod.ImportsForFile:", v)
+	}
+	if imports, err = mod.ImportsForFile("foo.spx"); err != nil || len(imports) != 2 {
+		t.Fatal("mod.ImportsForFile foo.spx:", imports, err)
+	}
+}
+
+func TestImportsForFilePrototype(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "go.mod"), []byte("module example.com/foo\n\ngo 1.18\n"), 0666)
+	os.WriteFile(filepath.Join(dir, "gop.mod"), []byte(`gop 1.3
+
+project .gmx Game example.com/foo/game
+import g example.com/foo/game
+
+project _app.gox App example.com/foo/work/v2
+class _w.gox Worker g.Game
+class _v.gox Viewer work.Base
+class _x.gox Other bad.Game
+`), 0666)
+	mod, err := Load(dir)
+	if err != nil {
+		t.Fatal("Load:", err)
+	}
+	if err = mod.ImportClasses(); err != nil {
+		t.Fatal("mod.ImportClasses:", err)
+	}
+	for fname, want := range map[string]string{
+		"a_w.gox":    ":example.com/foo/work/v2 g:example.com/foo/game",
+		"a_v.gox":    ":example.com/foo/work/v2",
+		"main_w.gox": ":example.com/foo/work/v2 g:example.com/foo/game",
+	} {
+		imports, err := mod.ImportsForFile(fname)
+		if err != nil {
+			t.Fatal("mod.ImportsForFile:", fname, err)
+		}
+		var ret []string
+		for _, imp := range imports {
+			ret = append(ret, imp.Name+":"+imp.Path)
+		}
+		if v := strings.Join(ret, " "); v != want {
+			t.Fatal("mod.ImportsForFile:", fname, v)
+		}
+	}
+	if _, err = mod.ImportsForFile("a_x.gox"); err == nil || !strings.Contains(err.Error(), "unknown package bad") {
+		t.Fatal("mod.ImportsForFile a_x.gox:", err)
+	}
+}
+
+func TestClassfileDoc(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "go.mod"), []byte("module example.com/foo\n\ngo 1.18\n"), 0666)
+	os.WriteFile(filepath.Join(dir, "gop.mod"), []byte("gop 1.2\n\nproject _foo.gox App example.com/foo\n"), 0666)
+	os.WriteFile(filepath.Join(dir, "doc.go"), []byte("// Package foo implements the foo classfile.\npackage foo\n"), 0666)
+	mod, err := Load(dir)
+	if err != nil {
+		t.Fatal("Load:", err)
+	}
+	if _, err = mod.ClassfileDoc("_foo.gox"); err != ErrNotClassFile {
+		t.Fatal("mod.ClassfileDoc:", err)
+	}
+	if err = mod.ImportClasses(); err != nil {
+		t.Fatal("mod.ImportClasses:", err)
+	}
+	if doc, err := mod.ClassfileDoc("_foo.gox"); err != nil || doc != "Package foo implements the foo classfile." {
+		t.Fatal("mod.ClassfileDoc:", doc, err)
+	}
+	os.WriteFile(filepath.Join(dir, "classfile.md"), []byte("# foo\n"), 0666)
+	if doc, err := mod.ClassfileDoc("_foo.gox"); err != nil || doc != "# foo\n" {
+		t.Fatal("mod.ClassfileDoc classfile.md:", doc, err)
+	}
+	if _, err := mod.ClassfileDoc(".gsh"); err == nil {
+		t.Fatal("mod.ClassfileDoc .gsh:", err)
+	}
+}
+
+func TestOverrideClass(t *testing.T) {
+	mod := New(modtest.GopCommunity(t))
+	if err := mod.ImportClasses(); err != nil {
+		t.Fatal("mod.ImportClasses:", err)
+	}
+	proj := &Project{
+		Ext: ".gmx", Class: "MyGame", PkgPaths: []string{"github.com/foo/spx"},
+		Works: []*Class{{Ext: ".spx", Class: "MySprite"}},
+	}
+	mod.OverrideClass(proj)
+	if c, ok := mod.LookupClass(".spx"); !ok || c != proj {
+		t.Fatal("mod.LookupClass .spx:", c)
+	}
+	if isProj, ok := mod.ClassKind("foo.spx"); !ok || isProj {
+		t.Fatal("mod.ClassKind foo.spx:", isProj, ok)
+	}
+	if src, ok := mod.ClassSource(".gmx"); !ok || src.Kind != SourceOverride {
+		t.Fatal("mod.ClassSource .gmx:", src)
+	}
+	mod.RemoveClassOverride(".spx")
+	mod.RemoveClassOverride(".spx")
+	if c, ok := mod.LookupClass(".gmx"); !ok || c != SpxProject {
+		t.Fatal("mod.LookupClass .gmx:", c)
+	}
+	if src, ok := mod.ClassSource(".gmx"); !ok || src.Kind != SourceBuiltin {
+		t.Fatal("mod.ClassSource .gmx after RemoveClassOverride:", src)
+	}
+	if err := mod.ImportClasses(); err != nil {
+		t.Fatal("mod.ImportClasses:", err)
+	}
+	if _, ok := mod.srcs[proj]; ok {
+		t.Fatal("mod.ImportClasses: source of the removed override is kept")
+	}
+	if src, ok := mod.ClassSource(".spx"); !ok || src.Kind != SourceBuiltin {
+		t.Fatal("mod.ClassSource .spx after ImportClasses:", src)
+	}
+}
+
+func TestClassExtPattern(t *testing.T) {
+	mod := New(modtest.GopCommunity(t))
+	if err := mod.ImportClasses(); err != nil {
+		t.Fatal("mod.ImportClasses:", err)
+	}
+	proj := &Project{
+		Ext: "_app.gox", Class: "App", PkgPaths: []string{"github.com/foo/yap"},
+		Works: []*Class{{Ext: "*_[a-z]*.gox", Class: "Handler", Prefix: "Http"}},
+	}
+	mod.OverrideClass(proj)
+	if isProj, ok := mod.ClassKind("get_p1.gox"); !ok || isProj {
+		t.Fatal("mod.ClassKind get_p1.gox:", isProj, ok)
+	}
+	if isProj, ok := mod.ClassKind("main_app.gox"); !ok || !isProj {
+		t.Fatal("mod.ClassKind main_app.gox:", isProj, ok)
+	}
+	if _, ok := mod.ClassKind("get_P1.gox"); ok {
+		t.Fatal("mod.ClassKind get_P1.gox: ok?")
+	}
+	if !mod.HasClassfileExt("get_p1.gox") || mod.HasClassfileExt("get_P1.gox") {
+		t.Fatal("mod.HasClassfileExt: ext pattern isn't matched")
+	}
+	cfg, err := mod.ClassConfigFor("a/get_p1.gox")
+	if err != nil || cfg.Project != proj || cfg.Class != proj.Works[0] || cfg.Prefix != "Http" {
+		t.Fatal("mod.ClassConfigFor get_p1.gox:", cfg, err)
+	}
+}
+
+func TestLookupLocal(t *testing.T) {
+	mod := New(modtest.GopClass(t))
+	root := mod.Root()
+	if _, err := mod.Lookup("./foo"); err != ErrInvalidPkgPath {
+		t.Fatal("mod.Lookup ./foo:", err)
+	}
+	if _, err := mod.LookupLocal(root, "fmt"); err != ErrInvalidPkgPath {
+		t.Fatal("mod.LookupLocal fmt:", err)
+	}
+	pkg, err := mod.LookupLocal(filepath.Join(root, "a"), "../b")
+	if err != nil || pkg.Type != PkgtLocal || pkg.Dir != filepath.Join(root, "b") || pkg.ModDir != root {
+		t.Fatal("mod.LookupLocal ../b:", pkg, err)
+	}
+	if _, err = mod.LookupLocal(root, "../b"); err == nil {
+		t.Fatal("mod.LookupLocal: no error?")
+	}
+}
+
+func TestClassfiles(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"go.mod":                "module example.com/foo\n\ngo 1.18\n",
+		"main.spx":              "",
+		"Bar.spx":               "",
+		"sub/foo_test.gox":      "",
+		"sub/foo.go":            "",
+		"vendor/a.spx":          "",
+		"_skip/a.spx":           "",
+		"nested/go.mod":         "module example.com/foo/nested\n",
+		"nested/a.spx":          "",
+		"sub/testdata/main.spx": "",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		os.MkdirAll(filepath.Dir(path), 0777)
+		os.WriteFile(path, []byte(content), 0666)
+	}
+	mod, err := Load(dir)
+	if err != nil {
+		t.Fatal("Load:", err)
+	}
+	if err = mod.ImportClasses(); err != nil {
+		t.Fatal("mod.ImportClasses:", err)
+	}
+	ret, err := mod.Classfiles()
+	if err != nil {
+		t.Fatal("mod.Classfiles:", err)
+	}
+	if len(ret) != 2 || len(ret[SpxProject]) != 2 || len(ret[TestProject]) != 1 {
+		t.Fatal("mod.Classfiles:", ret)
+	}
+	if c := ret[TestProject][0]; c.IsProj || c.Path != filepath.Join(dir, "sub", "foo_test.gox") {
+		t.Fatal("mod.Classfiles:", c)
+	}
+
+	os.WriteFile(filepath.Join(dir, "main.abc"), nil, 0666)
+	os.WriteFile(filepath.Join(dir, "a_gen.abc"), nil, 0666)
+	abc := &Project{Ext: ".abc", Class: "App", Excludes: []string{"*_gen.abc"}}
+	mod.OverrideClass(abc)
+	if ret, err = mod.Classfiles(); err != nil || len(ret[abc]) != 1 || !ret[abc][0].IsProj ||
+		ret[abc][0].Path != filepath.Join(dir, "main.abc") {
+		t.Fatal("mod.Classfiles excluded:", ret[abc], err)
+	}
+	if _, err = Default.Classfiles(); err != ErrNotFound {
+		t.Fatal("Default.Classfiles:", err)
+	}
+	deps := Default.DepMods()
+	deps["example.com/foo"] = module.Version{Path: "example.com/foo", Version: "v1.0.0"}
+	if _, ok := Default.LookupDepMod("example.com/foo"); ok || len(Default.DepMods()) != 0 {
+		t.Fatal("Default.DepMods: not a copy")
+	}
+}
+
+func TestLoadFromZip(t *testing.T) {
+	zipFile := filepath.Join(t.TempDir(), "v1.0.0.zip")
+	f, err := os.Create(zipFile)
+	if err != nil {
+		t.Fatal("os.Create:", err)
+	}
+	zw := zip.NewWriter(f)
+	files := map[string]string{
+		"example.com/foo@v1.0.0/go.mod":  "module example.com/foo\n\ngo 1.18\n",
+		"example.com/foo@v1.0.0/gop.mod": "gop 1.2\n\nproject .gmx Game example.com/foo math\n",
+		"example.com/foo@v1.0.0/foo.go":  "package foo\n",
+	}
+	for name, content := range files {
+		w, _ := zw.Create(name)
+		w.Write([]byte(content))
+	}
+	zw.Close()
+	f.Close()
+
+	modVer := module.Version{Path: "example.com/foo", Version: "v1.0.0"}
+	mod, err := LoadFromZip(zipFile, modVer)
+	if err != nil {
+		t.Fatal("LoadFromZip:", err)
+	}
+	if mod.Path() != "example.com/foo" || !mod.HasGopMod() || len(mod.Projects()) != 1 {
+		t.Fatal("LoadFromZip:", mod.Path(), mod.Projects())
+	}
+	if dir, _ := modcache.Path(modVer); mod.Root() != dir {
+		t.Fatal("LoadFromZip: root", mod.Root())
+	}
+	if _, err = LoadFromZip(zipFile, module.Version{Path: "example.com/bar", Version: "v1.0.0"}); err == nil {
+		t.Fatal("LoadFromZip: no error?")
+	}
+}
+
+func TestIsStale(t *testing.T) {
+	dir := t.TempDir()
+	gomod := filepath.Join(dir, "go.mod")
+	os.WriteFile(gomod, []byte("module example.com/foo\n\ngo 1.18\n"), 0666)
+	mod, err := Load(dir)
+	if err != nil {
+		t.Fatal("Load:", err)
+	}
+	if mod.IsStale() {
+		t.Fatal("IsStale: true")
+	}
+	if ret, err := mod.ReloadIfStale(nil); err != nil || ret != mod {
+		t.Fatal("ReloadIfStale:", ret, err)
+	}
+	os.WriteFile(filepath.Join(dir, "gop.mod"), []byte("gop 1.2\n"), 0666)
+	if !mod.IsStale() {
+		t.Fatal("IsStale: gop.mod created")
+	}
+	var reloaded *Module
+	ret, err := mod.ReloadIfStale(func(mod *Module) { reloaded = mod })
+	if err != nil || ret != reloaded || !ret.HasGopMod() || ret.IsStale() {
+		t.Fatal("ReloadIfStale:", ret, err)
+	}
+	if ret.Fingerprint() == mod.Fingerprint() {
+		t.Fatal("Fingerprint: not recomputed by Reload")
+	}
+
+	ret.SetCacheOnly(true)
+	ret.SetConflictPolicy(ConflictFail)
+	ret.SetToolchain(&env.Gop{Root: dir})
+	os.WriteFile(filepath.Join(dir, "gox.mod"), []byte("gop 1.3\n"), 0666)
+	if !ret.IsStale() {
+		t.Fatal("IsStale: gox.mod created")
+	}
+	if ret, err = ret.Reload(); err != nil || ret.Opt.Gop.Version != "1.3" || ret.IsStale() {
+		t.Fatal("Reload gox.mod:", ret, err)
+	}
+	if !ret.cacheOnly || ret.policy != ConflictFail || ret.toolchain == nil || ret.toolchain.Root != dir {
+		t.Fatal("Reload: settings not kept")
+	}
+	os.Remove(filepath.Join(dir, "gop.mod"))
+	if !ret.IsStale() {
+		t.Fatal("IsStale: gop.mod removed")
+	}
+	os.WriteFile(gomod, []byte("module example.com/bar\n\ngo 1.18\n"), 0666)
+	if !ret.IsStale() {
+		t.Fatal("IsStale: go.mod changed")
+	}
+	if New(ret.Module).IsStale() {
+		t.Fatal("IsStale: New")
+	}
+}
+
+func TestClassConfigFor(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "go.mod"), []byte("module example.com/foo\n\ngo 1.18\n"), 0666)
+	os.WriteFile(filepath.Join(dir, "gop.mod"), []byte(`gop 1.2
+
+project -embed -prefix=On -tags=js -exclude=*_gen.spx .gmx Game example.com/foo
+class .spx Sprite
+class -prefix=Do -tags=js,wasm .spx2 Sprite2
+`), 0666)
+	mod, err := Load(dir)
+	if err != nil {
+		t.Fatal("Load:", err)
+	}
+	if err = mod.ImportClasses(); err != nil {
+		t.Fatal("mod.ImportClasses:", err)
+	}
+	if _, err = mod.ClassConfigFor("foo.txt"); err != ErrNotClassFile {
+		t.Fatal("ClassConfigFor:", err)
+	}
+	cfg, err := mod.ClassConfigFor(filepath.Join(dir, "main.gmx"))
+	if err != nil || !cfg.IsProj || cfg.Class != nil || cfg.Prefix != "On" || cfg.Embedded {
+		t.Fatal("ClassConfigFor main.gmx:", cfg, err)
+	}
+	if len(cfg.Tags) != 1 || cfg.Tags[0] != "js" {
+		t.Fatal("ClassConfigFor main.gmx tags:", cfg.Tags)
+	}
+	if cfg, err = mod.ClassConfigFor("Bar.spx"); err != nil || cfg.IsProj || cfg.Class.Class != "Sprite" || cfg.Prefix != "On" || !cfg.Embedded {
+		t.Fatal("ClassConfigFor Bar.spx:", cfg, err)
+	}
+	if _, err = mod.ClassConfigFor("Bar_gen.spx"); err != ErrNotClassFile {
+		t.Fatal("ClassConfigFor Bar_gen.spx:", err)
+	}
+	if isProj, ok := mod.ClassKind("Bar_gen.spx"); ok || isProj {
+		t.Fatal("ClassKind Bar_gen.spx:", isProj, ok)
+	}
+	if isProj, ok := mod.ClassKind("Bar.spx"); !ok || isProj {
+		t.Fatal("ClassKind Bar.spx:", isProj, ok)
+	}
+	if cfg, err = mod.ClassConfigFor("Bar.spx2"); err != nil || cfg.Prefix != "Do" || !cfg.Embedded || strings.Join(cfg.Tags, ",") != "js,wasm" {
+		t.Fatal("ClassConfigFor Bar.spx2:", cfg, err)
+	}
+}
+
+func TestVirtualModCache(t *testing.T) {
+	modcache.SetFS(fstest.MapFS{
+		"example.com/foo@v1.0.0/go.mod":  {Data: []byte("module example.com/foo\n\ngo 1.18\n")},
+		"example.com/foo@v1.0.0/gop.mod": {Data: []byte("gop 1.2\n\nproject .gmx Game example.com/foo\n")},
+	})
+	defer modcache.SetFS(nil)
+
+	mod, err := LoadMod(module.Version{Path: "example.com/foo", Version: "v1.0.0"})
+	if err != nil {
+		t.Fatal("LoadMod:", err)
+	}
+	if mod.Path() != "example.com/foo" || !mod.HasGopMod() || len(mod.Projects()) != 1 {
+		t.Fatal("LoadMod:", mod.Path(), mod.Projects())
+	}
+	if _, err = loadModFrom(module.Version{Path: "example.com/bar", Version: "v1.0.0"}); !IsNotFound(err) {
+		t.Fatal("loadModFrom:", err)
+	}
+}
+
+func TestLoadModCached(t *testing.T) {
+	var requests int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		http.NotFound(w, r)
+	}))
+	defer ts.Close()
+	t.Setenv("GOPROXY", ts.URL)
+	defer modfetch.SetGoCommandEnabled(true)
+	modfetch.SetGoCommandEnabled(false)
+	modcache.SetFS(fstest.MapFS{
+		"example.com/foo@v1.0.0/go.mod":  {Data: []byte("module example.com/foo\n\ngo 1.18\n\nrequire example.com/bar v1.0.0 //gop:class\n")},
+		"example.com/foo@v1.0.0/gop.mod": {Data: []byte("gop 1.2\n\nproject .gmx Game example.com/foo\n")},
+	})
+	defer modcache.SetFS(nil)
+
+	mod, err := LoadModCached(module.Version{Path: "example.com/foo", Version: "v1.0.0"})
+	if err != nil || mod.Path() != "example.com/foo" {
+		t.Fatal("LoadModCached:", err)
+	}
+	if _, err = LoadModCached(module.Version{Path: "example.com/bar", Version: "v1.0.0"}); !IsNotFound(err) {
+		t.Fatal("LoadModCached example.com/bar:", err)
+	}
+	if err = mod.ImportClasses(); !IsNotFound(err) {
+		t.Fatal("ImportClasses:", err)
+	}
+	if _, _, err = mod.RequiredGopVersion(); !IsNotFound(err) {
+		t.Fatal("RequiredGopVersion:", err)
+	}
+	_, err = mod.ResolveRunner(&Project{Runner: &modfile.Runner{Path: "example.com/baz/cmd/run"}})
+	if e, ok := err.(*RunnerError); !ok || !IsNotFound(e.Err) {
+		t.Fatal("ResolveRunner:", err)
+	}
+	if n := atomic.LoadInt32(&requests); n != 0 {
+		t.Fatal("cache-only: proxy requests", n)
+	}
+	mod.SetCacheOnly(false)
+	if err = mod.ImportClasses(); err == nil || atomic.LoadInt32(&requests) == 0 {
+		t.Fatal("ImportClasses (not cache-only):", err)
+	}
+}
+
+func TestClassConflict(t *testing.T) {
+	modcache.SetFS(fstest.MapFS{
+		"example.com/foo@v1.0.0/go.mod":  {Data: []byte("module example.com/foo\n")},
+		"example.com/foo@v1.0.0/gop.mod": {Data: []byte("gop 1.2\n\nproject .spx Game example.com/foo\n")},
+		"example.com/bar@v1.2.0/go.mod":  {Data: []byte("module example.com/bar\n")},
+		"example.com/bar@v1.2.0/gop.mod": {Data: []byte("gop 1.2\n\nproject .spx Game example.com/bar\n")},
+	})
+	defer modcache.SetFS(nil)
+
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "go.mod"), []byte(`module example.com/main
+
+go 1.18
+
+require (
+	example.com/foo v1.0.0 //gop:class
+	example.com/bar v1.2.0 //gop:class
+)
+`), 0666)
+	mod, err := Load(dir)
+	if err != nil {
+		t.Fatal("Load:", err)
+	}
+	if err = mod.ImportClasses(); err != nil {
+		t.Fatal("ImportClasses (default):", err)
+	}
+	if src, ok := mod.ClassSource(".spx"); !ok || src.Mod.Path != "example.com/bar" {
+		t.Fatal("ClassSource (default):", src)
+	}
+	mod.SetConflictPolicy(ConflictPreferMain)
+	err = mod.ImportClasses()
+	if e, ok := err.(*ConflictError); !ok || e.Ext != ".spx" ||
+		e.Error() != "classfile .spx is provided by both example.com/foo@v1.0.0 (gop.mod:3) and example.com/bar@v1.2.0 (gop.mod:3)" {
+		t.Fatal("ImportClasses:", err)
+	}
+	mod.SetConflictPolicy(ConflictPreferNewest)
+	if err = mod.ImportClasses(); err != nil {
+		t.Fatal("ImportClasses (prefer newest):", err)
+	}
+	if src, ok := mod.ClassSource(".spx"); !ok || src.Mod.Path != "example.com/bar" {
+		t.Fatal("ClassSource (prefer newest):", src)
+	}
+
+	os.WriteFile(filepath.Join(dir, "gop.mod"), []byte("gop 1.2\n\nproject .spx Game example.com/main\n"), 0666)
+	if mod, err = Load(dir); err != nil {
+		t.Fatal("Load:", err)
+	}
+	if err = mod.ImportClasses(); err != nil {
+		t.Fatal("ImportClasses (main, default):", err)
+	}
+	if src, ok := mod.ClassSource(".spx"); !ok || src.Mod.Path != "example.com/bar" {
+		t.Fatal("ClassSource (main, default):", src)
+	}
+	mod.SetConflictPolicy(ConflictPreferNewest)
+	if err = mod.ImportClasses(); err != nil {
+		t.Fatal("ImportClasses (main):", err)
+	}
+	if src, ok := mod.ClassSource(".spx"); !ok || src.Kind != SourceMain {
+		t.Fatal("ClassSource (main):", src)
+	}
+	mod.SetConflictPolicy(ConflictFail)
+	if err = mod.ImportClasses(); err == nil || !strings.HasPrefix(err.Error(), "classfile .spx is provided by both gop.mod:3 and ") {
+		t.Fatal("ImportClasses (fail):", err)
+	}
+}
+
+func TestClassPrecedence(t *testing.T) {
+	modcache.SetFS(fstest.MapFS{
+		"example.com/foo@v1.0.0/go.mod":  {Data: []byte("module example.com/foo\n")},
+		"example.com/foo@v1.0.0/gop.mod": {Data: []byte("gop 1.2\n\nproject .gmx Game example.com/foo\nclass .spx Sprite\n")},
+		"example.com/bar@v1.0.0/go.mod":  {Data: []byte("module example.com/bar\n")},
+		"example.com/bar@v1.0.0/gop.mod": {Data: []byte("gop 1.2\n\nproject .spx Game example.com/bar\n")},
+	})
+	defer modcache.SetFS(nil)
+
+	for _, mods := range [][2]string{{"foo", "bar"}, {"bar", "foo"}} {
+		dir := t.TempDir()
+		os.WriteFile(filepath.Join(dir, "go.mod"), []byte(`module example.com/main
+
+go 1.18
+
+require (
+	example.com/`+mods[0]+` v1.0.0 //gop:class
+	example.com/`+mods[1]+` v1.0.0 //gop:class
+)
+`), 0666)
+		mod, err := Load(dir)
+		if err != nil {
+			t.Fatal("Load:", err)
+		}
+		mod.SetConflictPolicy(ConflictFail)
+		if err = mod.ImportClasses(); err != nil {
+			t.Fatal("ImportClasses:", mods, err)
+		}
+		c, ok := mod.LookupClass(".spx")
+		if !ok || c.PkgPaths[0] != "example.com/bar" {
+			t.Fatal("LookupClass:", mods, c)
+		}
+		gmx, _ := mod.LookupClass(".gmx")
+		if proj, _, _ := modfile.ResolveExt([]*Project{gmx, c}, "a.spx"); proj != c {
+			t.Fatal("ResolveExt:", mods, proj)
+		}
+		if proj, _, _ := modfile.ResolveExt([]*Project{c, gmx}, "a.spx"); proj != c {
+			t.Fatal("ResolveExt:", mods, proj)
+		}
+	}
+}
+
+func TestToolchainPkg(t *testing.T) {
+	gopRoot := t.TempDir()
+	os.MkdirAll(filepath.Join(gopRoot, "ast"), 0777)
+	os.WriteFile(filepath.Join(gopRoot, "go.mod"), []byte("module github.com/goplus/xgo\n\ngo 1.18\n"), 0666)
+
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "go.mod"), []byte("module example.com/foo\n\ngo 1.18\n"), 0666)
+	mod, err := Load(dir)
+	if err != nil {
+		t.Fatal("Load:", err)
+	}
+	const pkgPath = "github.com/goplus/xgo/ast"
+	if pt := mod.PkgType(pkgPath); pt != PkgtExtern {
+		t.Fatal("PkgType:", pt)
+	}
+	if _, err = mod.Lookup(pkgPath); err == nil {
+		t.Fatal("Lookup: no error")
+	}
+	mod.SetToolchain(&env.Gop{Root: gopRoot})
+	if pt := mod.PkgType(pkgPath); pt != PkgtToolchain {
+		t.Fatal("PkgType toolchain:", pt)
+	}
+	pkg, err := mod.Lookup(pkgPath)
+	if err != nil || pkg.Type != PkgtToolchain || pkg.ModPath != "github.com/goplus/xgo" || pkg.ModDir != gopRoot || !pkg.Exists() {
+		t.Fatal("Lookup toolchain:", pkg, err)
+	}
+	if id, err := mod.PkgId(pkgPath); err != nil || id != pkg.Dir {
+		t.Fatal("PkgId toolchain:", id, err)
+	}
+	if pt := mod.PkgType("github.com/goplus/gop/ast"); pt != PkgtExtern {
+		t.Fatal("PkgType github.com/goplus/gop/ast:", pt)
+	}
+
+	os.WriteFile(filepath.Join(dir, "go.mod"), []byte("module example.com/foo\n\ngo 1.18\n\nrequire github.com/goplus/xgo v1.3.0\n"), 0666)
+	if mod, err = Load(dir); err != nil {
+		t.Fatal("Load:", err)
+	}
+	mod.SetToolchain(&env.Gop{Root: gopRoot})
+	if pt := mod.PkgType(pkgPath); pt != PkgtExtern {
+		t.Fatal("PkgType required:", pt)
+	}
+	mod.SetToolchain(nil)
+}
+
+func TestPartialModCache(t *testing.T) {
+	modcache.SetFS(fstest.MapFS{
+		"example.com/foo@v1.0.0/go.mod":                    {Data: []byte("module example.com/foo\n")},
+		"cache/download/example.com/foo/@v/v1.0.0.partial": {},
+	})
+	defer modcache.SetFS(nil)
+
+	mod := module.Version{Path: "example.com/foo", Version: "v1.0.0"}
+	if modcache.Complete(mod) {
+		t.Fatal("modcache.Complete: true")
+	}
+	if _, err := loadModFrom(mod); !IsNotFound(err) {
+		t.Fatal("loadModFrom:", err)
+	}
+}
+
+func TestClassSource(t *testing.T) {
+	modcache.SetFS(fstest.MapFS{
+		"example.com/foo@v1.0.0/go.mod":  {Data: []byte("module example.com/foo\n\ngo 1.18\n")},
+		"example.com/foo@v1.0.0/gop.mod": {Data: []byte("gop 1.2\n\nproject .gmx Game example.com/foo\n")},
+	})
+	defer modcache.SetFS(nil)
+
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "go.mod"), []byte(`module example.com/bar
+
+go 1.18
+
+require example.com/foo v1.0.0 //gop:class
+`), 0666)
+	os.WriteFile(filepath.Join(dir, "gop.mod"), []byte("gop 1.2\n\nproject .yap App example.com/bar\n"), 0666)
+	mod, err := Load(dir)
+	if err != nil {
+		t.Fatal("Load:", err)
+	}
+	if err = mod.ImportClasses(); err != nil {
+		t.Fatal("mod.ImportClasses:", err)
+	}
+	mod.OverrideClass(&Project{Ext: ".ovr", Class: "App"})
+	for ext, want := range map[string]string{
+		".spx": "builtin",
+		".yap": "gop.mod:3",
+		".gmx": "example.com/foo@v1.0.0 (gop.mod:3)",
+		".ovr": "override",
+	} {
+		if src, ok := mod.ClassSource(ext); !ok || src.String() != want {
+			t.Fatal("ClassSource:", ext, src, ok)
+		}
+	}
+	if _, ok := mod.ClassSource(".foo"); ok {
+		t.Fatal("ClassSource .foo: ok?")
+	}
+}
+
+func TestPrefetchClasses(t *testing.T) {
+	modcache.SetFS(fstest.MapFS{
+		"example.com/foo@v1.0.0/go.mod":          {Data: []byte("module example.com/foo\n\ngo 1.18\n")},
+		"example.com/foo@v1.0.0/gop.mod":         {Data: []byte("gop 1.2\n\nproject .gmx Game example.com/foo\nrunner example.com/foo/cmd/run v1.0.0\n")},
+		"example.com/foo@v1.0.0/cmd/run/main.go": {Data: []byte("package main\n")},
+	})
+	defer modcache.SetFS(nil)
+
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "go.mod"), []byte(`module example.com/bar
+
+go 1.18
+
+require example.com/foo v1.0.0 //gop:class
+`), 0666)
+	mod, err := Load(dir)
+	if err != nil {
+		t.Fatal("Load:", err)
+	}
+	if err = mod.PrefetchClasses(context.Background()); err != nil {
+		t.Fatal("PrefetchClasses:", err)
+	}
+	mod.Opt.ClassMods = append(mod.Opt.ClassMods, "example.com/unknown")
+	if err = mod.PrefetchClasses(context.Background()); !IsNotFound(err) {
+		t.Fatal("PrefetchClasses:", err)
+	}
+}
+
+func TestStdlibRoot(t *testing.T) {
+	root := t.TempDir()
+	os.MkdirAll(filepath.Join(root, "src", "fmt"), 0777)
+	RegisterStdlibResolver("mygo", func(version string) (string, error) {
+		if version != "1.0" {
+			t.Fatal("StdlibResolver: version", version)
+		}
+		return root, nil
+	})
+	defer RegisterStdlibResolver("mygo", nil)
+
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "go.mod"), []byte("module example.com/foo\n\ngo 1.18\n"), 0666)
+	os.WriteFile(filepath.Join(dir, "gop.mod"), []byte("gop 1.2\n\ncompiler mygo 1.0\n"), 0666)
+	mod, err := Load(dir)
+	if err != nil {
+		t.Fatal("Load:", err)
+	}
+	if v, err := mod.StdlibRoot(); err != nil || v != root {
+		t.Fatal("StdlibRoot:", v, err)
+	}
+	if pkg, err := mod.Lookup("fmt"); err != nil || pkg.Dir != filepath.Join(root, "src", "fmt") {
+		t.Fatal("Lookup fmt:", pkg, err)
+	}
+	if pkg, err := mod.Lookup("strings"); err != nil || pkg.ModDir != goroot+"/src" {
+		t.Fatal("Lookup strings:", pkg, err)
+	}
+	mod.Opt.Compiler = nil
+	if v, err := mod.StdlibRoot(); err != nil || v != goroot {
+		t.Fatal("StdlibRoot gc:", v, err)
+	}
+}
+
+func TestRequiredGopVersion(t *testing.T) {
+	modcache.SetFS(fstest.MapFS{
+		"example.com/foo@v1.0.0/go.mod":  {Data: []byte("module example.com/foo\n\ngo 1.18\n")},
+		"example.com/foo@v1.0.0/gop.mod": {Data: []byte("gop 1.3\n\nproject .gmx Game example.com/foo\n")},
+		"example.com/bar@v1.0.0/go.mod":  {Data: []byte("module example.com/bar\n\ngo 1.18\n")},
+		"example.com/bar@v1.0.0/gop.mod": {Data: []byte("gop 1.1\n\nproject .yap App example.com/bar\n")},
+	})
+	defer modcache.SetFS(nil)
+
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "go.mod"), []byte(`module example.com/app
+
+go 1.18
+
+require (
+	example.com/bar v1.0.0 //gop:class
+	example.com/foo v1.0.0 //gop:class
+)
+`), 0666)
+	os.WriteFile(filepath.Join(dir, "gop.mod"), []byte("gop 1.2\n"), 0666)
+	mod, err := Load(dir)
+	if err != nil {
+		t.Fatal("Load:", err)
+	}
+	ver, by, err := mod.RequiredGopVersion()
+	if err != nil || ver != "1.3" || by.Path != "example.com/foo" {
+		t.Fatal("RequiredGopVersion:", ver, by, err)
+	}
+	mod.Opt.Gop.Version = "1.4"
+	if ver, by, err = mod.RequiredGopVersion(); err != nil || ver != "1.4" || by.Path != "" {
+		t.Fatal("RequiredGopVersion:", ver, by, err)
+	}
+}
+
+func TestConcurrentModule(t *testing.T) {
+	mod := New(modtest.GopCommunity(t))
+	override := &Project{Ext: "_ovr.gox", Class: "App", PkgPaths: []string{"example.com/ovr"}}
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			switch i % 4 {
+			case 0:
+				mod.ImportClasses()
+			case 1:
+				mod.OverrideClass(override)
+				mod.RemoveClassOverride("_ovr.gox")
+			}
+			mod.DepMods()
+			mod.IsClass("_yap.gox")
+			mod.ClassSource("_yap.gox")
+			mod.ClassConfigFor("foo_yap.gox")
+			mod.Lookup("github.com/goplus/yap")
+		}(i)
+	}
+	wg.Wait()
+	if err := mod.ImportClasses(); err != nil {
+		t.Fatal("ImportClasses:", err)
+	}
+	if !mod.IsClass("_yap.gox") {
+		t.Fatal("IsClass .spx: false")
+	}
+}
+
+func TestClassMods(t *testing.T) {
+	modcache.SetFS(fstest.MapFS{
+		"example.com/foo@v1.0.0/go.mod":  {Data: []byte("module example.com/foo\n\ngo 1.18\n")},
+		"example.com/foo@v1.0.0/gop.mod": {Data: []byte("gop 1.2\n\nproject .gmx Game example.com/foo\nclass .spr .spr2 Sprite\n\nproject _foo.gox App example.com/foo/app\n")},
+	})
+	defer modcache.SetFS(nil)
+
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "go.mod"), []byte(`module example.com/bar
+
+go 1.18
+
+require example.com/foo v1.0.0 //gop:class
+`), 0666)
+	mod, err := Load(dir)
+	if err != nil {
+		t.Fatal("Load:", err)
+	}
+	if ret := mod.ClassMods(); len(ret) != 0 {
+		t.Fatal("ClassMods before ImportClasses:", ret)
+	}
+	if !mod.HasClassfileExt(".spx") || !mod.HasClassfileExt("foo_test.gox") || mod.HasClassfileExt(".spr") {
+		t.Fatal("HasClassfileExt before ImportClasses")
+	}
+	if exts := strings.Join(mod.Exts(), " "); exts != ".gmx .gsh .spx _test.gox" {
+		t.Fatal("Exts before ImportClasses:", exts)
+	}
+	if err = mod.ImportClasses(); err != nil {
+		t.Fatal("mod.ImportClasses:", err)
+	}
+	ret := mod.ClassMods()
+	if len(ret) != 1 || ret[0].Mod.String() != "example.com/foo@v1.0.0" || len(ret[0].Projects) != 2 {
+		t.Fatal("ClassMods:", ret)
+	}
+	if exts := strings.Join(ret[0].Exts, " "); exts != ".gmx .spr .spr2 _foo.gox" {
+		t.Fatal("ClassMods exts:", exts)
+	}
+	if exts := strings.Join(mod.Exts(), " "); exts != ".gmx .gsh .spr .spr2 .spx _foo.gox _test.gox" {
+		t.Fatal("Exts:", exts)
+	}
+	exts := mod.Exts()
+	exts[0] = ".modified"
+	if v := mod.Exts(); v[0] != ".gmx" {
+		t.Fatal("Exts: shared cache", v)
+	}
+	for _, ext := range []string{".spr2", "main.spr", "_foo.gox", "a_foo.gox"} {
+		if !mod.HasClassfileExt(ext) {
+			t.Fatal("HasClassfileExt:", ext)
+		}
+	}
+	if mod.HasClassfileExt(".go") || mod.HasClassfileExt("a_bar.gox") {
+		t.Fatal("HasClassfileExt: not a classfile")
+	}
+	var projs []string
+	for _, c := range mod.SortedProjects() {
+		projs = append(projs, c.Ext+":"+c.Class)
+	}
+	if v := strings.Join(projs, " "); v != ".gmx:Game .gsh:App .spx:Game _foo.gox:App _test.gox:App" {
+		t.Fatal("SortedProjects:", v)
+	}
+	mod.OverrideClass(&Project{Ext: ".abc", Class: "App"})
+	if exts := mod.Exts(); len(exts) != 8 || exts[0] != ".abc" || !mod.HasClassfileExt("main.abc") {
+		t.Fatal("Exts after OverrideClass:", exts)
+	}
+	mod.RemoveClassOverride(".abc")
+	if mod.HasClassfileExt(".abc") || len(mod.Exts()) != 7 {
+		t.Fatal("HasClassfileExt after RemoveClassOverride")
+	}
+}
+
+func TestPackageScan(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "go.mod"), []byte("module example.com/bar\n\ngo 1.18\n"), 0666)
+	os.MkdirAll(filepath.Join(dir, "foo"), 0777)
+	for _, fname := range []string{"a.go", "a_test.go", "_b.go", "c.gop", "main.spx", "Bird.spx", "foo_test.gox", ".x.spx"} {
+		os.WriteFile(filepath.Join(dir, "foo", fname), nil, 0666)
+	}
+	mod, err := Load(dir)
+	if err != nil {
+		t.Fatal("Load:", err)
+	}
+	if err = mod.ImportClasses(); err != nil {
+		t.Fatal("ImportClasses:", err)
+	}
+	pkg, err := mod.Lookup("example.com/bar/foo")
+	if err != nil || !pkg.Exists() {
+		t.Fatal("Lookup foo:", pkg, err)
+	}
+	ret, err := pkg.Scan(mod)
+	if err != nil || !ret.HasGoFiles || !ret.HasGopFiles || len(ret.HasClassFiles) != 2 ||
+		ret.HasClassFiles[".spx"] != 2 || ret.HasClassFiles["_test.gox"] != 1 {
+		t.Fatal("Scan:", ret, err)
+	}
+	if ret, err = pkg.Scan(nil); err != nil || len(ret.HasClassFiles) != 0 {
+		t.Fatal("Scan nil:", ret, err)
+	}
+	if pkg, err = mod.Lookup("example.com/bar/baz"); err != nil || pkg.Exists() {
+		t.Fatal("Lookup baz:", pkg, err)
+	}
+	if _, err = pkg.Scan(mod); err == nil {
+		t.Fatal("Scan baz: no error")
+	}
+}
+
+func TestResolveRunner(t *testing.T) {
+	modcache.SetFS(fstest.MapFS{
+		"example.com/foo@v1.0.0/go.mod":          {Data: []byte("module example.com/foo\n\ngo 1.18\n")},
+		"example.com/foo@v1.0.0/gop.mod":         {Data: []byte("gop 1.2\n\nproject .gmx Game example.com/foo\nrunner example.com/foo/cmd/run v1.0.0\n")},
+		"example.com/foo@v1.0.0/cmd/run/main.go": {Data: []byte("package main\n")},
+		"example.com/foo@v1.0.0/lib/lib.go":      {Data: []byte("package lib\n")},
+		"example.com/foo@v1.0.0/lib/lib_test.go": {Data: []byte("package main\n")},
+	})
+	defer modcache.SetFS(nil)
+
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "go.mod"), []byte(`module example.com/bar
+
+go 1.18
+
+require example.com/foo v1.0.0 //gop:class
+`), 0666)
+	mod, err := Load(dir)
+	if err != nil {
+		t.Fatal("Load:", err)
+	}
+	if err = mod.ImportClasses(); err != nil {
+		t.Fatal("ImportClasses:", err)
+	}
+	proj, ok := mod.LookupClass(".gmx")
+	if !ok {
+		t.Fatal("LookupClass .gmx: not found")
+	}
+	gobin := t.TempDir()
+	t.Setenv("GOBIN", gobin)
+	ret, err := mod.ResolveRunner(proj)
+	if err != nil {
+		t.Fatal("ResolveRunner:", err)
+	}
+	name := filepath.Join(gobin, "run")
+	if runtime.GOOS == "windows" {
+		name += ".exe"
+	}
+	if ret.Mod.Path != "example.com/foo" || ret.Mod.Version != "v1.0.0" || ret.Name != name ||
+		ret.Dir != filepath.Join(ret.ModDir, "cmd", "run") {
+		t.Fatal("ResolveRunner:", ret)
+	}
+	if _, err = mod.ResolveRunner(&Project{}); err != ErrNoRunner {
+		t.Fatal("ResolveRunner no runner:", err)
+	}
+	c, _ := modfile.ParseConstraint("v1.0.0")
+	lib := &Project{Runner: &modfile.Runner{Path: "example.com/foo/lib", Version: "v1.0.0", Constraint: c}}
+	if _, err = mod.ResolveRunner(lib); !errors.Is(err, ErrRunnerNotMain) {
+		t.Fatal("ResolveRunner lib:", err)
+	}
+	none := &Project{Runner: &modfile.Runner{Path: "example.com/foo/none", Version: "v1.0.0", Constraint: c}}
+	if _, err = mod.ResolveRunner(none); !errors.Is(err, ErrRunnerNotFound) || err.Error() !=
+		"runner example.com/foo/none (module example.com/foo@v1.0.0): runner package not found in module" {
+		t.Fatal("ResolveRunner none:", err)
+	}
+}
+
+func TestRunnerName(t *testing.T) {
+	ext := ""
+	if runtime.GOOS == "windows" {
+		ext = ".exe"
+	}
+	for pkgPath, name := range map[string]string{
+		"github.com/goplus/spx/v2/cmd/spxrun": "spxrun",
+		"example.com/foo/v2":                  "foo",
+		"example.com/foo/v0":                  "v0",
+		"example.com/foo/v1":                  "v1",
+		"example.com/foo/v10":                 "foo",
+		"spxrun":                              "spxrun",
+	} {
+		if ret := runnerName(pkgPath); ret != name+ext {
+			t.Fatal("runnerName:", pkgPath, ret)
+		}
+	}
+}
+
+func TestSharedErrors(t *testing.T) {
+	if ErrNotFound != mod.ErrNotFound || ErrNotClassFileMod != mod.ErrNotClassFileMod || ErrNotClassFile != mod.ErrNotClassFile {
+		t.Fatal("sentinel errors aren't shared with package mod")
+	}
+	wrapped := fmt.Errorf("load example.com/foo: %w", mod.ErrNotFound)
+	for _, err := range []error{
+		mod.ErrNotFound,
+		wrapped,
+		errors.NewWith(mod.ErrNotFound, `f()`, -2, "f"),
+	} {
+		if !mod.IsNotFound(err) || !IsNotFound(err) {
+			t.Fatal("IsNotFound:", err)
+		}
+	}
+	if mod.IsNotFound(nil) || mod.IsNotFound(ErrNotClassFile) {
+		t.Fatal("IsNotFound: false positive")
+	}
+	if _, err := Default.ClassConfigFor("a.txt"); !errors.Is(err, mod.ErrNotClassFile) {
+		t.Fatal("ClassConfigFor:", err)
+	}
+}
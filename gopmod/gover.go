@@ -0,0 +1,70 @@
+/*
+ * Copyright (c) 2024 The GoPlus Authors (goplus.org). All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package gopmod
+
+import (
+	"context"
+
+	"github.com/qiniu/x/errors"
+	"golang.org/x/mod/module"
+	"golang.org/x/mod/semver"
+)
+
+// -----------------------------------------------------------------------------
+
+// RequiredGopVersion returns the effective Go+ version requirement of this
+// module: the max version of the gop directive of this module and those of
+// all classfile modules (see Opt.ClassMods). by is the classfile module which
+// requires the version, or zero if it's required by this module itself.
+// Classfile modules not found in GOMODCACHE are downloaded (unless this module
+// is in cache-only mode, see SetCacheOnly).
+func (p *Module) RequiredGopVersion() (ver string, by module.Version, err error) {
+	opt := p.Opt
+	if opt == nil {
+		return
+	}
+	if opt.Gop != nil {
+		ver = opt.Gop.Version
+	}
+	for _, classMod := range opt.ClassMods {
+		mod, ok := p.LookupDepMod(classMod)
+		if !ok {
+			err = errors.NewWith(ErrNotFound, `p.LookupDepMod(classMod)`, -2, "(*gopmod.Module).LookupDepMod", p, classMod)
+			return
+		}
+		dep, e := loadModContext(context.Background(), mod, p.cacheOnly)
+		if e != nil {
+			err = errors.NewWith(e, `loadModContext(context.Background(), mod, p.cacheOnly)`, -2, "gopmod.loadModContext", context.Background(), mod, p.cacheOnly)
+			return
+		}
+		if o := dep.Opt; o != nil && o.Gop != nil && compareGopVersion(o.Gop.Version, ver) > 0 {
+			ver, by = o.Gop.Version, mod
+		}
+	}
+	return
+}
+
+// compareGopVersion compares two Go+ versions, eg. "1.2", "1.2.0". An empty
+// version is lower than any other version.
+func compareGopVersion(a, b string) int {
+	if a == "" || b == "" {
+		return len(a) - len(b)
+	}
+	return semver.Compare("v"+a, "v"+b)
+}
+
+// -----------------------------------------------------------------------------
@@ -17,17 +17,25 @@
 package gopmod
 
 import (
+	"archive/zip"
+	"context"
 	"fmt"
+	"io"
+	"io/fs"
 	"log"
 	"path/filepath"
 	"runtime"
 	"strings"
+	"sync"
 
 	"github.com/goplus/mod/modcache"
 	"github.com/goplus/mod/modfetch"
+	"github.com/goplus/mod/modfile"
 	"github.com/goplus/mod/modload"
 	"github.com/qiniu/x/errors"
 	"golang.org/x/mod/module"
+
+	xmod "github.com/goplus/mod"
 )
 
 var (
@@ -36,18 +44,65 @@ var (
 
 // -----------------------------------------------------------------------------
 
+// A Module is a Go+ module. It's safe for concurrent use by multiple
+// goroutines, except that go.mod and gop.mod (the embedded modload.Module)
+// must not be modified concurrently.
 type Module struct {
 	modload.Module
-	projs    map[string]*Project // ext -> project
-	depmods_ map[string]module.Version
+
+	mu        sync.RWMutex        // protects classes below
+	projs     map[string]*Project // ext -> project, immutable after ImportClasses
+	overrides map[string]*Project // ext -> project, see OverrideClass
+	srcs      map[*Project]*ClassSource
+	matcher   *extMatcher // see HasClassfileExt, nil if classfiles never change
+	policy    ConflictPolicy
+
+	depOnce  sync.Once
+	depmods_ map[string]module.Version // immutable after computed
+
+	stamps []fileStamp // see IsStale
+
+	cacheOnly bool       // see SetCacheOnly
+	toolchain *toolchain // see SetToolchain
+}
+
+// SetCacheOnly makes this module (when on is true) never download anything
+// implicitly: ImportClasses, RequiredGopVersion and ResolveRunner only consult
+// GOMODCACHE (and local directories of replaced modules), and report
+// ErrNotFound for depended modules which aren't there. Modules loaded by
+// LoadModCached are in this mode. It must be called before the module is used
+// by multiple goroutines.
+func (p *Module) SetCacheOnly(on bool) {
+	p.cacheOnly = on
+}
+
+// fetchMod downloads module mod into GOMODCACHE, or returns ErrNotFound if
+// this module is in cache-only mode (see SetCacheOnly).
+func (p *Module) fetchMod(ctx context.Context, mod module.Version) (module.Version, error) {
+	if p.cacheOnly {
+		return mod, ErrNotFound
+	}
+	return modfetch.GetContext(ctx, mod.String())
 }
 
 // DepMods returns all depended modules.
 // If a depended module path is replace to be a local path, it will be canonical to an absolute path.
+// The returned map is a copy, so changing it doesn't change this module.
 func (p *Module) DepMods() map[string]module.Version {
-	if p.depmods_ == nil {
-		p.depmods_ = p.Module.DepMods()
+	deps := p.depMods()
+	ret := make(map[string]module.Version, len(deps))
+	for path, mod := range deps {
+		ret[path] = mod
 	}
+	return ret
+}
+
+// depMods is like DepMods, but the returned map is shared and must not be
+// modified.
+func (p *Module) depMods() map[string]module.Version {
+	p.depOnce.Do(func() {
+		p.depmods_ = p.Module.DepMods()
+	})
 	return p.depmods_
 }
 
@@ -55,11 +110,12 @@ func (p *Module) DepMods() map[string]module.Version {
 type PkgType int
 
 const (
-	PkgtStandard PkgType = iota // a standard Go/Go+ package
-	PkgtModule                  // a package in this module (in standard form)
-	PkgtLocal                   // a package in this module (in relative path form)
-	PkgtExtern                  // an extarnal package
-	PkgtInvalid  = -1           // an invalid package
+	PkgtStandard  PkgType = iota // a standard Go/Go+ package
+	PkgtModule                   // a package in this module (in standard form)
+	PkgtLocal                    // a package in this module (in relative path form)
+	PkgtExtern                   // an extarnal package
+	PkgtToolchain                // a package of the Go+ toolchain module, see SetToolchain
+	PkgtInvalid   = -1           // an invalid package
 )
 
 // IsPkgtStandard checks if a pkgPath is Go standard package or not.
@@ -78,11 +134,14 @@ func (p *Module) PkgType(pkgPath string) PkgType {
 	if pkgPath[0] == '.' {
 		return PkgtLocal
 	}
-	pos := strings.Index(pkgPath, "/")
-	if pos > 0 {
-		pkgPath = pkgPath[:pos]
+	domain := pkgPath
+	if pos := strings.Index(pkgPath, "/"); pos > 0 {
+		domain = pkgPath[:pos]
 	}
-	if strings.Contains(pkgPath, ".") {
+	if strings.Contains(domain, ".") {
+		if p.isToolchainPkg(pkgPath) {
+			return PkgtToolchain
+		}
 		return PkgtExtern
 	}
 	return PkgtStandard
@@ -107,6 +166,9 @@ func (p *Module) PkgId(pkgPath string) (string, error) {
 		domain = pkgPath[:pos]
 	}
 	if strings.Contains(domain, ".") {
+		if p.isToolchainPkg(pkgPath) {
+			return p.lookupToolchain(pkgPath).Dir, nil
+		}
 		pkg, err := p.lookupExternPkg(pkgPath)
 		if err != nil {
 			return "", err
@@ -132,11 +194,61 @@ type Package struct {
 	Real    module.Version // only when Type == PkgtExtern
 }
 
+// Exists reports whether the package directory exists. Lookup doesn't check
+// it, so a package of a found module may not exist actually.
+func (p *Package) Exists() bool {
+	fi, err := modcache.Stat(p.Dir)
+	return err == nil && fi.IsDir()
+}
+
+// A PkgSummary summarizes source files in a package directory.
+type PkgSummary struct {
+	HasGoFiles    bool           // has Go files (test files excluded)
+	HasGopFiles   bool           // has Go+ files (*.gop)
+	HasClassFiles map[string]int // classfile ext => number of classfiles, eg. ".spx" => 3
+}
+
+// Scan scans source files in the package directory (not recursively).
+// Classfiles are recognized by mod, whose ImportClasses should be called
+// before calling this method (classfiles aren't counted if mod is nil).
+// Files whose names begin with "_" or "." are ignored, like the go command
+// does, except classfiles like "_test.gox".
+func (p *Package) Scan(mod *Module) (ret *PkgSummary, err error) {
+	entries, err := modcache.ReadDir(p.Dir)
+	if err != nil {
+		return
+	}
+	ret = &PkgSummary{HasClassFiles: make(map[string]int)}
+	for _, e := range entries {
+		fname := e.Name()
+		if e.IsDir() || strings.HasPrefix(fname, ".") {
+			continue
+		}
+		if mod != nil {
+			if ext := modfile.ClassExt(fname); ext != "" && mod.IsClass(ext) {
+				ret.HasClassFiles[ext]++
+				continue
+			}
+		}
+		if strings.HasPrefix(fname, "_") {
+			continue
+		}
+		switch filepath.Ext(fname) {
+		case ".go":
+			if !strings.HasSuffix(fname, "_test.go") {
+				ret.HasGoFiles = true
+			}
+		case ".gop":
+			ret.HasGopFiles = true
+		}
+	}
+	return
+}
+
 func (p *Module) Lookup(pkgPath string) (pkg *Package, err error) {
 	switch pt := p.PkgType(pkgPath); pt {
 	case PkgtStandard:
-		modDir := goroot + "/src"
-		pkg = &Package{Type: PkgtStandard, ModDir: modDir, Dir: filepath.Join(modDir, pkgPath)}
+		pkg = p.lookupStd(pkgPath)
 	case PkgtModule:
 		modPath := p.Path()
 		modDir := p.Root()
@@ -144,16 +256,38 @@ func (p *Module) Lookup(pkgPath string) (pkg *Package, err error) {
 		pkg = &Package{Type: PkgtModule, ModPath: modPath, ModDir: modDir, Dir: dir}
 	case PkgtExtern:
 		return p.lookupExternPkg(pkgPath)
+	case PkgtToolchain:
+		pkg = p.lookupToolchain(pkgPath)
+	case PkgtLocal: // local package: please use LookupLocal
+		return nil, ErrInvalidPkgPath
 	default:
 		log.Panicln("Module.Lookup:", pkgPath, "unsupported pkgType:", pt)
 	}
 	return
 }
 
+// LookupLocal lookups a local package (in relative path form, eg. "./foo",
+// "../bar") relative to the directory base. The package must be in this module.
+func (p *Module) LookupLocal(base, relPath string) (pkg *Package, err error) {
+	if p.PkgType(relPath) != PkgtLocal {
+		return nil, ErrInvalidPkgPath
+	}
+	modDir := p.Root()
+	dir := filepath.Join(base, filepath.FromSlash(relPath))
+	if a, e := filepath.Abs(dir); e == nil {
+		dir = a
+	}
+	rel, err := filepath.Rel(modDir, dir)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return nil, fmt.Errorf("local package %s is outside of module %s", relPath, p.Path())
+	}
+	return &Package{Type: PkgtLocal, ModPath: p.Path(), ModDir: modDir, Dir: dir}, nil
+}
+
 // lookupExternPkg lookups a external package from depended modules.
 // If modVer.Path is replace to be a local path, it will be canonical to an absolute path.
 func (p *Module) lookupExternPkg(pkgPath string) (pkg *Package, err error) {
-	for path, real := range p.DepMods() {
+	for path, real := range p.depMods() {
 		if isPkgInMod(pkgPath, path) {
 			if modDir, e := modcache.Path(real); e == nil {
 				modPath := path
@@ -172,7 +306,7 @@ func (p *Module) lookupExternPkg(pkgPath string) (pkg *Package, err error) {
 // LookupDepMod lookups a depended module.
 // If modVer.Path is replace to be a local path, it will be canonical to an absolute path.
 func (p *Module) LookupDepMod(modPath string) (modVer module.Version, ok bool) {
-	deps := p.DepMods()
+	deps := p.depMods()
 	modVer, ok = deps[modPath]
 	return
 }
@@ -188,7 +322,9 @@ func Load(dir string) (*Module, error) {
 	if err != nil {
 		return nil, errors.NewWith(err, `modload.Load(dir)`, -2, "modload.Load", dir)
 	}
-	return New(mod), nil
+	p := New(mod)
+	p.stamp()
+	return p, nil
 }
 
 // LoadFrom loads a module from specified go.mod file and an optional gop.mod file.
@@ -197,21 +333,52 @@ func LoadFrom(gomod, gopmod string) (*Module, error) {
 	if err != nil {
 		return nil, errors.NewWith(err, `modload.LoadFrom(gomod, gopmod)`, -2, "modload.LoadFrom", gomod, gopmod)
 	}
+	p := New(mod)
+	p.stamp()
+	return p, nil
+}
+
+// LoadOverlay loads a module from a local directory like Load, but reads module
+// files from the overlay first (see modload.LoadOverlay). The module is never
+// stale, since its files may not be on disk.
+func LoadOverlay(dir string, overlay modload.Overlay) (*Module, error) {
+	mod, err := modload.LoadOverlay(dir, overlay)
+	if err != nil {
+		return nil, errors.NewWith(err, `modload.LoadOverlay(dir, overlay)`, -2, "modload.LoadOverlay", dir, overlay)
+	}
 	return New(mod), nil
 }
 
 // LoadMod loads a module from a versioned module path.
 // If we only want to load a Go modfile, pass env parameter as nil.
 func LoadMod(mod module.Version) (p *Module, err error) {
+	return loadModContext(context.Background(), mod, false)
+}
+
+// LoadModCached loads a module from a versioned module path like LoadMod, but
+// it only consults GOMODCACHE (it never downloads anything or runs the go
+// command) and returns ErrNotFound if the module isn't there. The returned
+// module is in cache-only mode, see SetCacheOnly.
+func LoadModCached(mod module.Version) (p *Module, err error) {
+	return loadModContext(context.Background(), mod, true)
+}
+
+func loadModContext(ctx context.Context, mod module.Version, cacheOnly bool) (p *Module, err error) {
 	p, err = loadModFrom(mod)
-	if !IsNotFound(err) {
+	if p != nil {
+		p.cacheOnly = cacheOnly
+	}
+	if !IsNotFound(err) || cacheOnly {
 		return
 	}
-	mod, err = modfetch.Get(mod.String())
+	mod, err = modfetch.GetContext(ctx, mod.String())
 	if err != nil {
 		return
 	}
-	return loadModFrom(mod)
+	if p, err = loadModFrom(mod); p != nil {
+		p.cacheOnly = cacheOnly
+	}
+	return
 }
 
 func loadModFrom(mod module.Version) (p *Module, err error) {
@@ -219,7 +386,69 @@ func loadModFrom(mod module.Version) (p *Module, err error) {
 	if err != nil {
 		return
 	}
-	return Load(dir)
+	if !modcache.InPath(dir) {
+		return Load(dir)
+	}
+	if !modcache.Complete(mod) { // not extracted yet, or extraction is interrupted
+		return nil, ErrNotFound
+	}
+	ret, err := loadCachedMod(dir)
+	if err != nil {
+		return
+	}
+	return New(ret), nil
+}
+
+// loadCachedMod loads a module in GOMODCACHE, which may be a virtual module
+// cache (see modcache.SetFS).
+func loadCachedMod(dir string) (modload.Module, error) {
+	return modload.LoadFromEx(filepath.Join(dir, "go.mod"), filepath.Join(dir, xmod.GoxModfile), modcache.ReadFile)
+}
+
+// LoadFromZip loads a module from its zip archive (eg. the one in the download
+// cache of GOMODCACHE) without extracting it. Only go.mod and gop.mod are read
+// from the archive, and the module root is where the archive would be
+// extracted to in GOMODCACHE.
+func LoadFromZip(zipPath string, mod module.Version) (p *Module, err error) {
+	zr, err := zip.OpenReader(zipPath)
+	if err != nil {
+		return
+	}
+	defer zr.Close()
+
+	dir, err := modcache.Path(mod)
+	if err != nil {
+		return
+	}
+	gomod, gopmod := filepath.Join(dir, "go.mod"), filepath.Join(dir, xmod.GoxModfile)
+	files := make(map[string]*zip.File, 2)
+	prefix := mod.Path + "@" + mod.Version + "/"
+	for _, f := range zr.File {
+		switch f.Name {
+		case prefix + "go.mod":
+			files[gomod] = f
+		default:
+			if name := strings.TrimPrefix(f.Name, prefix); xmod.IsModfileName(name) {
+				files[filepath.Join(dir, name)] = f
+			}
+		}
+	}
+	ret, err := modload.LoadFromEx(gomod, gopmod, func(name string) ([]byte, error) {
+		f, ok := files[name]
+		if !ok {
+			return nil, fs.ErrNotExist
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return nil, err
+		}
+		defer rc.Close()
+		return io.ReadAll(rc)
+	})
+	if err != nil {
+		return
+	}
+	return New(ret), nil
 }
 
 type MissingError struct {
@@ -233,8 +462,17 @@ func (e *MissingError) Error() string {
 
 // -----------------------------------------------------------------------------
 
-// Default represents the default gop.mod object.
-var Default = New(modload.Default)
+// NewDefault returns a new default module (a module without go.mod and
+// gop.mod), see modload.NewDefault.
+func NewDefault(goVer, gopVer string) *Module {
+	return New(modload.NewDefault(goVer, gopVer))
+}
+
+// Default represents the default gop.mod object. It's shared by all users and
+// must be treated as read-only: use NewDefault to get a module that can be
+// modified. Its accessors (eg. Projects and DepMods) return copies, which can
+// be modified freely.
+var Default = NewDefault("", "")
 
 var goroot = runtime.GOROOT()
 
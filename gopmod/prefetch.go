@@ -0,0 +1,132 @@
+/*
+ * Copyright (c) 2024 The GoPlus Authors (goplus.org). All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package gopmod
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/goplus/mod/modfetch"
+	"github.com/goplus/mod/modfile"
+	"github.com/qiniu/x/errors"
+	"golang.org/x/mod/module"
+)
+
+// -----------------------------------------------------------------------------
+
+// prefetchConcurrency is the maximum number of concurrent downloads of
+// PrefetchClasses.
+const prefetchConcurrency = 8
+
+// PrefetchClasses downloads all classfile modules of this module (see
+// Opt.ClassMods) and runners of all projects concurrently, so that later
+// ImportClasses and builds don't download them one by one. Modules already
+// in GOMODCACHE aren't downloaded again.
+//
+// A runner is resolved to the version specified by its constraint if it's
+// exact, or the required version of its module if it satisfies the
+// constraint, or the latest version otherwise.
+func (p *Module) PrefetchClasses(ctx context.Context) error {
+	opt := p.Opt
+	if opt == nil {
+		return nil
+	}
+	var (
+		mu    sync.Mutex
+		errs  errors.List
+		projs = append([]*Project(nil), opt.Projects...)
+	)
+	addErr := func(err error) {
+		mu.Lock()
+		errs.Add(err)
+		mu.Unlock()
+	}
+	depmods := p.depMods()
+	classMods := opt.ClassMods
+	forEach(len(classMods), func(i int) {
+		mod, ok := depmods[classMods[i]]
+		if !ok {
+			addErr(fmt.Errorf("classfile module %s: %w", classMods[i], ErrNotFound))
+			return
+		}
+		m, err := loadModContext(ctx, mod, false)
+		if err != nil {
+			addErr(errors.NewWith(err, `loadModContext(ctx, mod, false)`, -2, "gopmod.loadModContext", ctx, mod, false))
+			return
+		}
+		mu.Lock()
+		projs = append(projs, m.Projects()...)
+		mu.Unlock()
+	})
+
+	var runners []string
+	seen := make(map[string]bool)
+	for _, proj := range projs {
+		if r := proj.Runner; r != nil {
+			pkgPathVer := r.Path + "@" + runnerQuery(r, depmods)
+			if !seen[pkgPathVer] {
+				seen[pkgPathVer] = true
+				runners = append(runners, pkgPathVer)
+			}
+		}
+	}
+	forEach(len(runners), func(i int) {
+		if _, _, err := modfetch.GetPkgContext(ctx, runners[i], ""); err != nil {
+			addErr(errors.NewWith(err, `modfetch.GetPkgContext(ctx, runners[i], "")`, -2, "modfetch.GetPkgContext", ctx, runners[i], ""))
+		}
+	})
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return errs.ToError()
+}
+
+// runnerQuery returns the version query to download runner r.
+func runnerQuery(r *modfile.Runner, depmods map[string]module.Version) string {
+	if cmps := r.Constraint.Comparisons; len(cmps) == 1 && cmps[0].Op == "=" {
+		return cmps[0].Version
+	}
+	query, best := "latest", ""
+	for modPath, mod := range depmods { // the innermost module wins
+		if len(modPath) > len(best) && isPkgInMod(r.Path, modPath) && r.Constraint.Match(mod.Version) {
+			query, best = mod.Version, modPath
+		}
+	}
+	return query
+}
+
+// forEach calls fn(0), ..., fn(n-1) concurrently, with at most
+// prefetchConcurrency calls at a time, and waits for all of them.
+func forEach(n int, fn func(i int)) {
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, prefetchConcurrency)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			fn(i)
+		}(i)
+	}
+	wg.Wait()
+}
+
+// -----------------------------------------------------------------------------
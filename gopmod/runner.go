@@ -0,0 +1,203 @@
+/*
+ * Copyright (c) 2024 The GoPlus Authors (goplus.org). All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package gopmod
+
+import (
+	"context"
+	"fmt"
+	"go/build"
+	"go/parser"
+	"go/token"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/goplus/mod/modcache"
+	"github.com/goplus/mod/modfetch"
+	"github.com/goplus/mod/modfile"
+	"github.com/qiniu/x/errors"
+	"golang.org/x/mod/module"
+)
+
+// -----------------------------------------------------------------------------
+
+var (
+	ErrNoRunner       = errors.New("project has no runner")
+	ErrRunnerNotFound = errors.New("runner package not found in module")
+	ErrRunnerNotMain  = errors.New("runner package isn't a main package")
+)
+
+// A RunnerError is returned by ResolveRunner if the runner of a project can't
+// be resolved or built.
+type RunnerError struct {
+	Runner *modfile.Runner
+	Mod    module.Version // module of the runner package (empty if unknown)
+	Err    error
+}
+
+func (e *RunnerError) Error() string {
+	if e.Mod.Path != "" {
+		return fmt.Sprintf("runner %s (module %v): %v", e.Runner.Path, e.Mod, e.Err)
+	}
+	return fmt.Sprintf("runner %s: %v", e.Runner.Path, e.Err)
+}
+
+func (e *RunnerError) Unwrap() error {
+	return e.Err
+}
+
+// A RunnerInfo describes a resolved runner, ie. everything needed to build it,
+// eg.
+//
+//	go build -o <Name> .  (in directory Dir)
+type RunnerInfo struct {
+	Runner *modfile.Runner
+	Mod    module.Version // module of the runner package (Version is empty if it's replaced with a local directory)
+	ModDir string         // root directory of Mod
+	Dir    string         // directory of the runner package
+	Name   string         // path of the runner binary where `go install` writes it, eg. "$GOPATH/bin/spxrun" ("spxrun.exe" on Windows)
+}
+
+// ResolveRunner resolves the runner of project proj, see ResolveRunnerContext.
+func (p *Module) ResolveRunner(proj *Project) (*RunnerInfo, error) {
+	return p.ResolveRunnerContext(context.Background(), proj)
+}
+
+// ResolveRunnerContext resolves the runner of project proj: it locates the
+// module of the runner package in GOMODCACHE (downloading it if needed), and
+// checks the package is a main package. The module is the required one if
+// its version satisfies the runner constraint (or it's replaced with a local
+// directory), otherwise it's resolved the same way as PrefetchClasses does.
+// Nothing is downloaded if this module is in cache-only mode (see
+// SetCacheOnly): a runner module not in GOMODCACHE is reported as ErrNotFound.
+//
+// It returns ErrNoRunner if proj has no runner, or a *RunnerError (which may
+// wrap ErrRunnerNotFound or ErrRunnerNotMain) if the runner can't be used.
+func (p *Module) ResolveRunnerContext(ctx context.Context, proj *Project) (ret *RunnerInfo, err error) {
+	r := proj.Runner
+	if r == nil {
+		return nil, ErrNoRunner
+	}
+	depmods := p.depMods()
+	mod, relPath, ok := runnerMod(r, depmods)
+	if ok {
+		if mod.Version != "" && !modcache.Complete(mod) {
+			mod, err = p.fetchMod(ctx, mod)
+		}
+	} else if p.cacheOnly {
+		err = ErrNotFound
+	} else {
+		mod, relPath, err = modfetch.GetPkgContext(ctx, r.Path+"@"+runnerQuery(r, depmods), "")
+	}
+	if err != nil {
+		return nil, &RunnerError{Runner: r, Err: err}
+	}
+	if mod.Version != "" && !r.Constraint.Match(mod.Version) {
+		return nil, &RunnerError{Runner: r, Mod: mod, Err: fmt.Errorf("version %s doesn't satisfy %s", mod.Version, r.Version)}
+	}
+	modDir, err := modcache.Path(mod)
+	if err != nil {
+		return nil, &RunnerError{Runner: r, Mod: mod, Err: err}
+	}
+	dir := modDir
+	if relPath != "" {
+		dir = filepath.Join(modDir, filepath.FromSlash(relPath))
+	}
+	switch isMain, found := scanMainPkg(dir); {
+	case !found:
+		return nil, &RunnerError{Runner: r, Mod: mod, Err: ErrRunnerNotFound}
+	case !isMain:
+		return nil, &RunnerError{Runner: r, Mod: mod, Err: ErrRunnerNotMain}
+	}
+	return &RunnerInfo{Runner: r, Mod: mod, ModDir: modDir, Dir: dir, Name: filepath.Join(binDir(), runnerName(r.Path))}, nil
+}
+
+// runnerMod returns the required module (the innermost one) containing the
+// runner package, if its version satisfies the runner constraint or it's
+// replaced with a local directory.
+func runnerMod(r *modfile.Runner, depmods map[string]module.Version) (mod module.Version, relPath string, ok bool) {
+	best := ""
+	for modPath, real := range depmods {
+		if len(modPath) > len(best) && isPkgInMod(r.Path, modPath) && (real.Version == "" || r.Constraint.Match(real.Version)) {
+			mod, best, ok = real, modPath, true
+		}
+	}
+	if ok {
+		relPath = strings.TrimPrefix(r.Path[len(best):], "/")
+	}
+	return
+}
+
+// scanMainPkg checks if dir has Go files (test files excluded), and if they
+// are of package main.
+func scanMainPkg(dir string) (isMain, found bool) {
+	entries, err := modcache.ReadDir(dir)
+	if err != nil {
+		return
+	}
+	for _, e := range entries {
+		fname := e.Name()
+		if e.IsDir() || !strings.HasSuffix(fname, ".go") || strings.HasSuffix(fname, "_test.go") ||
+			strings.HasPrefix(fname, "_") || strings.HasPrefix(fname, ".") {
+			continue
+		}
+		file := filepath.Join(dir, fname)
+		src, err := modcache.ReadFile(file)
+		if err != nil {
+			continue
+		}
+		f, err := parser.ParseFile(token.NewFileSet(), file, src, parser.PackageClauseOnly)
+		if err != nil {
+			continue
+		}
+		found = true
+		if f.Name.Name == "main" {
+			return true, true
+		}
+	}
+	return
+}
+
+// runnerName returns the binary file name of runner package pkgPath, the same
+// way `go install` names it, eg. "spxrun" for github.com/goplus/spx/v2/cmd/spxrun.
+func runnerName(pkgPath string) string {
+	name := path.Base(pkgPath)
+	if prefix, pathMajor, ok := module.SplitPathVersion(pkgPath); ok && strings.HasPrefix(pathMajor, "/") {
+		name = path.Base(prefix)
+	}
+	if runtime.GOOS == "windows" {
+		name += ".exe"
+	}
+	return name
+}
+
+// binDir returns the directory `go install` writes binaries to: $GOBIN, or
+// $GOPATH/bin (the first entry of GOPATH).
+func binDir() string {
+	if gobin := os.Getenv("GOBIN"); gobin != "" {
+		return gobin
+	}
+	gopath := filepath.SplitList(build.Default.GOPATH)
+	if len(gopath) == 0 {
+		return "bin"
+	}
+	return filepath.Join(gopath[0], "bin")
+}
+
+// -----------------------------------------------------------------------------
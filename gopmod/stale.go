@@ -0,0 +1,145 @@
+/*
+ * Copyright (c) 2024 The GoPlus Authors (goplus.org). All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package gopmod
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"os"
+	"path/filepath"
+	"time"
+
+	xmod "github.com/goplus/mod"
+)
+
+// -----------------------------------------------------------------------------
+
+// fileStamp records the state of a file when a module is loaded.
+type fileStamp struct {
+	path    string
+	exists  bool
+	size    int64
+	modTime time.Time
+	hash    []byte // sha256 of file content
+}
+
+func newFileStamp(path string) (ret fileStamp) {
+	ret.path = path
+	fi, err := os.Stat(path)
+	if err != nil {
+		return
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return
+	}
+	h := sha256.Sum256(data)
+	ret.exists, ret.size, ret.modTime, ret.hash = true, fi.Size(), fi.ModTime(), h[:]
+	return
+}
+
+func (p *fileStamp) changed() bool {
+	fi, err := os.Stat(p.path)
+	if err != nil {
+		return p.exists
+	}
+	if !p.exists || fi.Size() != p.size {
+		return true
+	}
+	if fi.ModTime().Equal(p.modTime) {
+		return false
+	}
+	data, err := os.ReadFile(p.path)
+	if err != nil {
+		return true
+	}
+	h := sha256.Sum256(data)
+	return !bytes.Equal(h[:], p.hash)
+}
+
+// stamp captures the state of go.mod, go.sum and gop.mod files of this module.
+// All candidates of gop.mod (see mod.ModfileCandidates) are captured, even if
+// they don't exist, so that creating one of them makes the module stale.
+func (p *Module) stamp() {
+	gomod := p.Modfile()
+	if gomod == "" {
+		return
+	}
+	files := []string{gomod, filepath.Join(filepath.Dir(gomod), "go.sum")}
+	files = append(files, xmod.ModfileCandidates(p.gopmodFile())...)
+	p.stamps = make([]fileStamp, len(files))
+	for i, file := range files {
+		p.stamps[i] = newFileStamp(file)
+	}
+}
+
+// gopmodFile returns the gop.mod file to load this module from again: the
+// preferred name in the module root (see mod.ModfileNames) if this module is
+// loaded from one of them or has no gop.mod file, or the gop.mod file loaded.
+func (p *Module) gopmodFile() string {
+	if opt := p.Opt; opt != nil && opt.Syntax != nil {
+		if file := opt.Syntax.Name; !xmod.IsModfileName(filepath.Base(file)) {
+			return file
+		}
+	}
+	return filepath.Join(filepath.Dir(p.Modfile()), xmod.GoxModfile)
+}
+
+// IsStale reports whether go.mod, gop.mod or go.sum of this module changed on
+// disk since the module was loaded by Load or LoadFrom. Modules that aren't
+// loaded from disk (eg. created by New or LoadFromZip) are never stale.
+func (p *Module) IsStale() bool {
+	for i := range p.stamps {
+		if p.stamps[i].changed() {
+			return true
+		}
+	}
+	return false
+}
+
+// Reload loads this module again from disk. Classes imported by ImportClasses
+// and overrides set by OverrideClass are not kept by the new module, while
+// settings (see SetCacheOnly, SetToolchain and SetConflictPolicy) are.
+func (p *Module) Reload() (*Module, error) {
+	ret, err := LoadFrom(p.Modfile(), p.gopmodFile())
+	if err != nil {
+		return nil, err
+	}
+	ret.cacheOnly, ret.toolchain = p.cacheOnly, p.toolchain
+	p.mu.RLock()
+	ret.policy = p.policy
+	p.mu.RUnlock()
+	return ret, nil
+}
+
+// ReloadIfStale reloads this module if it is stale, and calls onReload (if
+// not nil) with the new module. It returns this module itself if not stale.
+func (p *Module) ReloadIfStale(onReload func(mod *Module)) (*Module, error) {
+	if !p.IsStale() {
+		return p, nil
+	}
+	ret, err := p.Reload()
+	if err != nil {
+		return nil, err
+	}
+	if onReload != nil {
+		onReload(ret)
+	}
+	return ret, nil
+}
+
+// -----------------------------------------------------------------------------
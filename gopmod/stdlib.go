@@ -0,0 +1,99 @@
+/*
+ * Copyright (c) 2024 The GoPlus Authors (goplus.org). All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package gopmod
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/qiniu/x/errors"
+)
+
+// -----------------------------------------------------------------------------
+
+// A StdlibResolver returns the root directory (like GOROOT) of the standard
+// library of a compiler of the specified version. version can be empty if it's
+// unknown.
+type StdlibResolver func(version string) (root string, err error)
+
+var (
+	stdlibMu        sync.RWMutex
+	stdlibResolvers = map[string]StdlibResolver{
+		"llgo":   envStdlibResolver("LLGO_ROOT"),
+		"tinygo": envStdlibResolver("TINYGOROOT"),
+	}
+)
+
+// RegisterStdlibResolver registers the StdlibResolver of the compiler name
+// (eg. "llgo", "tinygo"). If resolve is nil, the resolver of the compiler is
+// removed and GOROOT is used.
+//
+// By default, the root of llgo is $LLGO_ROOT and the root of tinygo is
+// $TINYGOROOT.
+func RegisterStdlibResolver(compiler string, resolve StdlibResolver) {
+	stdlibMu.Lock()
+	defer stdlibMu.Unlock()
+	if resolve == nil {
+		delete(stdlibResolvers, compiler)
+	} else {
+		stdlibResolvers[compiler] = resolve
+	}
+}
+
+func envStdlibResolver(key string) StdlibResolver {
+	return func(version string) (string, error) {
+		if root := os.Getenv(key); root != "" {
+			return root, nil
+		}
+		return "", errors.New("$" + key + " is not set")
+	}
+}
+
+// StdlibRoot returns the root directory of the standard library of the
+// compiler of this module (see Opt.Compiler), or GOROOT if the compiler is
+// gc or its StdlibResolver isn't registered.
+func (p *Module) StdlibRoot() (string, error) {
+	var name, version string
+	if opt := p.Opt; opt != nil && opt.Compiler != nil {
+		name, version = opt.Compiler.Name, opt.Compiler.Version
+	}
+	stdlibMu.RLock()
+	resolve, ok := stdlibResolvers[name]
+	stdlibMu.RUnlock()
+	if !ok {
+		return goroot, nil
+	}
+	return resolve(version)
+}
+
+// lookupStd lookups a standard package. The standard library of the compiler
+// (see StdlibRoot) takes precedence over the one in GOROOT, since alternative
+// compilers (eg. tinygo) only override part of the standard library.
+func (p *Module) lookupStd(pkgPath string) *Package {
+	if root, err := p.StdlibRoot(); err == nil && root != goroot {
+		modDir := filepath.Join(root, "src")
+		dir := filepath.Join(modDir, pkgPath)
+		if fi, err := os.Stat(dir); err == nil && fi.IsDir() {
+			return &Package{Type: PkgtStandard, ModDir: modDir, Dir: dir}
+		}
+	}
+	modDir := goroot + "/src"
+	return &Package{Type: PkgtStandard, ModDir: modDir, Dir: filepath.Join(modDir, pkgPath)}
+}
+
+// -----------------------------------------------------------------------------
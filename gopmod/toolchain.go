@@ -0,0 +1,84 @@
+/*
+ * Copyright (c) 2024 The GoPlus Authors (goplus.org). All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package gopmod
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/goplus/mod/env"
+	"golang.org/x/mod/modfile"
+)
+
+// -----------------------------------------------------------------------------
+
+// defaultToolchainMod is the module path of the Go+ toolchain if it can't be
+// read from go.mod of its root directory.
+const defaultToolchainMod = "github.com/goplus/gop"
+
+// toolchain is the Go+ toolchain module, see SetToolchain.
+type toolchain struct {
+	Path string // module path, eg. "github.com/goplus/gop"
+	Root string // root directory (GOPROOT)
+}
+
+// SetToolchain sets the Go+ toolchain (gop.Root is its root directory, ie.
+// GOPROOT), whose own module provides packages not provided by any depended
+// module, eg. github.com/goplus/gop/ast when this module doesn't require
+// github.com/goplus/gop: such packages are classified as PkgtToolchain and
+// Lookup finds them in gop.Root. A nil gop (or an empty gop.Root) removes the
+// toolchain. It must be called before the module is used by multiple
+// goroutines.
+func (p *Module) SetToolchain(gop *env.Gop) {
+	if gop == nil || gop.Root == "" {
+		p.toolchain = nil
+		return
+	}
+	tc := &toolchain{Path: defaultToolchainMod, Root: gop.Root}
+	if a, err := filepath.Abs(tc.Root); err == nil {
+		tc.Root = a
+	}
+	if data, err := os.ReadFile(filepath.Join(tc.Root, "go.mod")); err == nil {
+		if path := modfile.ModulePath(data); path != "" {
+			tc.Path = path
+		}
+	}
+	p.toolchain = tc
+}
+
+// isToolchainPkg checks if pkgPath is a package of the toolchain module which
+// isn't provided by any depended module.
+func (p *Module) isToolchainPkg(pkgPath string) bool {
+	tc := p.toolchain
+	if tc == nil || !isPkgInMod(pkgPath, tc.Path) {
+		return false
+	}
+	for path := range p.depMods() {
+		if isPkgInMod(pkgPath, path) {
+			return false
+		}
+	}
+	return true
+}
+
+func (p *Module) lookupToolchain(pkgPath string) *Package {
+	tc := p.toolchain
+	dir := tc.Root + pkgPath[len(tc.Path):]
+	return &Package{Type: PkgtToolchain, ModPath: tc.Path, ModDir: tc.Root, Dir: dir}
+}
+
+// -----------------------------------------------------------------------------
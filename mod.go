@@ -17,16 +17,29 @@
 package mod
 
 import (
+	"errors"
+	"io/fs"
 	"os"
 	"path/filepath"
 	"strings"
 	"syscall"
 )
 
+// Sentinel errors shared by packages of this module, so that errors.Is checks
+// work the same way regardless of which package returns them.
 var (
-	ErrNotFound = syscall.ENOENT
+	ErrNotFound        = syscall.ENOENT
+	ErrNotClassFileMod = errors.New("not a classfile module")
+	ErrNotClassFile    = errors.New("not a classfile")
 )
 
+// IsNotFound returns a boolean indicating whether the error is known to
+// report that a module or package does not exist. It is satisfied by
+// ErrNotFound, fs.ErrNotExist and errors wrapping them.
+func IsNotFound(err error) bool {
+	return errors.Is(err, ErrNotFound) || errors.Is(err, fs.ErrNotExist)
+}
+
 // -----------------------------------------------------------------------------
 
 func FindGoMod(dirFrom string) (dir, file string, err error) {
@@ -54,12 +67,72 @@ func GOMOD(dirFrom string) (file string, err error) {
 	return
 }
 
+// GOPMOD returns the gop.mod file of the module containing dirFrom, see
+// ResolveModfile. The file may not exist.
 func GOPMOD(dirFrom string) (file string, err error) {
 	dir, _, err := FindGoMod(dirFrom)
 	if err != nil {
 		return
 	}
-	return filepath.Join(dir, "gop.mod"), nil
+	file, _ = ResolveModfile(dir)
+	return
+}
+
+// -----------------------------------------------------------------------------
+
+// Names of the gop.mod file of a module. GoxModfile is preferred if both of
+// them exist, and GopModfile is the name of a newly created one.
+const (
+	GoxModfile = "gox.mod"
+	GopModfile = "gop.mod"
+)
+
+var modfileNames = [...]string{GoxModfile, GopModfile}
+
+// ModfileNames returns names of the gop.mod file in order of preference.
+func ModfileNames() []string {
+	return []string{GoxModfile, GopModfile}
+}
+
+// IsModfileName reports whether name is one of ModfileNames().
+func IsModfileName(name string) bool {
+	for _, v := range modfileNames {
+		if v == name {
+			return true
+		}
+	}
+	return false
+}
+
+// ResolveModfile returns the gop.mod file of module directory dir: the first
+// file of ModfileNames() existing in dir, or dir/gop.mod if none of them
+// exists. found reports whether the returned file exists.
+func ResolveModfile(dir string) (file string, found bool) {
+	for _, name := range modfileNames {
+		file = filepath.Join(dir, name)
+		if fi, e := os.Stat(file); e == nil && !fi.IsDir() {
+			return file, true
+		}
+	}
+	return filepath.Join(dir, GopModfile), false
+}
+
+// ModfileCandidates returns files to try (in order) when loading gop.mod file
+// gopmod: gopmod itself, followed by the other files of ModfileNames() in the
+// same directory as fallbacks if the name of gopmod is one of them.
+func ModfileCandidates(gopmod string) []string {
+	dir, name := filepath.Split(gopmod)
+	if !IsModfileName(name) {
+		return []string{gopmod}
+	}
+	ret := make([]string, 1, len(modfileNames))
+	ret[0] = gopmod
+	for _, v := range modfileNames {
+		if v != name {
+			ret = append(ret, dir+v)
+		}
+	}
+	return ret
 }
 
 // -----------------------------------------------------------------------------
@@ -17,10 +17,7 @@
 package modcache
 
 import (
-	"bytes"
 	"errors"
-	"log"
-	"os/exec"
 	"path/filepath"
 	"strings"
 
@@ -33,18 +30,6 @@ var (
 	GOMODCACHE = getGOMODCACHE()
 )
 
-func getGOMODCACHE() string {
-	var buf bytes.Buffer
-	var stderr bytes.Buffer
-	cmd := exec.Command("go", "env", "GOMODCACHE")
-	cmd.Stdout = &buf
-	cmd.Stderr = &stderr
-	if err := cmd.Run(); err != nil {
-		log.Panicln("GOMODCACHE not found:", err)
-	}
-	return strings.TrimRight(buf.String(), "\n")
-}
-
 // -----------------------------------------------------------------------------
 
 var (
@@ -53,6 +38,11 @@ var (
 
 // DownloadCachePath returns download cache path of a versioned module.
 func DownloadCachePath(mod module.Version) (string, error) {
+	return downloadFile(mod, "zip")
+}
+
+// downloadFile returns path of the file GOMODCACHE/cache/download/<module>/@v/<version>.<suffix>.
+func downloadFile(mod module.Version, suffix string) (string, error) {
 	if mod.Version == "" {
 		return mod.Path, ErrNoNeedToDownload
 	}
@@ -60,7 +50,11 @@ func DownloadCachePath(mod module.Version) (string, error) {
 	if err != nil {
 		return "", err
 	}
-	return filepath.Join(GOMODCACHE, "cache/download", encPath, "@v", mod.Version+".zip"), nil
+	encVer, err := module.EscapeVersion(mod.Version)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(GOMODCACHE, "cache/download", encPath, "@v", encVer+"."+suffix), nil
 }
 
 // Path returns cache dir of a versioned module.
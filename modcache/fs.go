@@ -0,0 +1,93 @@
+/*
+ * Copyright (c) 2024 The GoPlus Authors (goplus.org). All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package modcache
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// -----------------------------------------------------------------------------
+
+var cacheFS fs.FS // nil means the real GOMODCACHE directory
+
+// SetFS sets a virtual module cache (eg. a module cache prefetched in a
+// browser for js/wasm builds). Paths in GOMODCACHE (eg. those returned by
+// Path and DownloadCachePath) are then read from fsys, where they are
+// slash-separated paths relative to GOMODCACHE. SetFS(nil) restores the real
+// GOMODCACHE directory.
+func SetFS(fsys fs.FS) {
+	cacheFS = fsys
+}
+
+// FS returns the file system of the module cache: the one set by SetFS, or
+// the real GOMODCACHE directory.
+func FS() fs.FS {
+	if fsys := cacheFS; fsys != nil {
+		return fsys
+	}
+	return os.DirFS(GOMODCACHE)
+}
+
+// Stat returns a FileInfo describing the named file. name is a path in the
+// module cache, see SetFS.
+func Stat(name string) (fs.FileInfo, error) {
+	if fsys := cacheFS; fsys != nil {
+		if rel, ok := relPath(name); ok {
+			return fs.Stat(fsys, rel)
+		}
+	}
+	return os.Stat(name)
+}
+
+// ReadDir reads the named directory. name is a path in the module cache, see
+// SetFS.
+func ReadDir(name string) ([]fs.DirEntry, error) {
+	if fsys := cacheFS; fsys != nil {
+		if rel, ok := relPath(name); ok {
+			return fs.ReadDir(fsys, rel)
+		}
+	}
+	return os.ReadDir(name)
+}
+
+// ReadFile reads the named file. name is a path in the module cache, see
+// SetFS.
+func ReadFile(name string) ([]byte, error) {
+	if fsys := cacheFS; fsys != nil {
+		if rel, ok := relPath(name); ok {
+			return fs.ReadFile(fsys, rel)
+		}
+	}
+	return os.ReadFile(name)
+}
+
+// relPath converts a path in GOMODCACHE to a path of the virtual module cache.
+// Paths outside GOMODCACHE (eg. local replacements) are still read from disk.
+func relPath(name string) (string, bool) {
+	if !InPath(name) {
+		return "", false
+	}
+	rel, err := filepath.Rel(GOMODCACHE, name)
+	if err != nil {
+		return "", false
+	}
+	return filepath.ToSlash(rel), true
+}
+
+// -----------------------------------------------------------------------------
@@ -0,0 +1,38 @@
+//go:build !js && !wasip1
+
+/*
+ * Copyright (c) 2024 The GoPlus Authors (goplus.org). All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package modcache
+
+import (
+	"bytes"
+	"log"
+	"os/exec"
+	"strings"
+)
+
+func getGOMODCACHE() string {
+	var buf bytes.Buffer
+	var stderr bytes.Buffer
+	cmd := exec.Command("go", "env", "GOMODCACHE")
+	cmd.Stdout = &buf
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		log.Panicln("GOMODCACHE not found:", err)
+	}
+	return strings.TrimRight(buf.String(), "\n")
+}
@@ -0,0 +1,183 @@
+/*
+ * Copyright (c) 2024 The GoPlus Authors (goplus.org). All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package modcache
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/mod/module"
+)
+
+// -----------------------------------------------------------------------------
+
+// The go command serializes downloading and extracting a module version by an
+// exclusive OS file lock on GOMODCACHE/cache/download/<module>/@v/<version>.lock.
+// While extracting, it creates a <version>.partial file in the same directory
+// and removes it when the module directory is complete. After a zip file is
+// verified, its hash is recorded in <version>.ziphash.
+//
+// Tools that populate GOMODCACHE should follow the same protocol so that they
+// and the go command never corrupt each other's cache entries.
+
+// LockPath returns path of the lock file of a versioned module.
+func LockPath(mod module.Version) (string, error) {
+	return downloadFile(mod, "lock")
+}
+
+// PartialPath returns path of the file that marks an in-progress extraction
+// of a versioned module.
+func PartialPath(mod module.Version) (string, error) {
+	return downloadFile(mod, "partial")
+}
+
+// ZipHashPath returns path of the file that records the hash of a versioned
+// module's zip file.
+func ZipHashPath(mod module.Version) (string, error) {
+	return downloadFile(mod, "ziphash")
+}
+
+// Lock acquires the lock of a versioned module, blocking until it's available.
+// The lock is compatible with the one the go command uses.
+func Lock(mod module.Version) (unlock func(), err error) {
+	path, err := LockPath(mod)
+	if err != nil {
+		return
+	}
+	if err = os.MkdirAll(filepath.Dir(path), 0777); err != nil {
+		return
+	}
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0666)
+	if err != nil {
+		return
+	}
+	if err = lockFile(f); err != nil {
+		f.Close()
+		return
+	}
+	return func() {
+		unlockFile(f)
+		f.Close()
+	}, nil
+}
+
+// WithLock runs fn while holding the lock of a versioned module.
+func WithLock(mod module.Version, fn func() error) error {
+	unlock, err := Lock(mod)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	return fn()
+}
+
+// Complete reports whether the module directory of a versioned module is
+// completely extracted: the directory exists and the extraction isn't marked
+// as partial (eg. by an extraction interrupted by a crash). A module without
+// version (ie. a local directory) is complete if the directory exists.
+func Complete(mod module.Version) bool {
+	dir, err := Path(mod)
+	if err != nil {
+		return false
+	}
+	if fi, err := Stat(dir); err != nil || !fi.IsDir() {
+		return false
+	}
+	if mod.Version == "" {
+		return true
+	}
+	partial, err := PartialPath(mod)
+	if err != nil {
+		return false
+	}
+	_, err = Stat(partial)
+	return os.IsNotExist(err)
+}
+
+// Extract populates the module directory of a versioned module by calling
+// extract(dir) with the protocol of the go command: it holds the module's
+// lock, marks the extraction as partial until extract succeeds, and does
+// nothing if the directory is already complete.
+func Extract(mod module.Version, extract func(dir string) error) error {
+	return WithLock(mod, func() error {
+		dir, err := Path(mod)
+		if err != nil {
+			return err
+		}
+		partial, err := PartialPath(mod)
+		if err != nil {
+			return err
+		}
+		if _, err := os.Stat(dir); err == nil {
+			if _, err := os.Stat(partial); os.IsNotExist(err) {
+				return nil // already complete
+			}
+			if err = removeAll(dir); err != nil {
+				return err
+			}
+		}
+		if err = os.WriteFile(partial, nil, 0666); err != nil {
+			return err
+		}
+		if err = extract(dir); err != nil {
+			removeAll(dir)
+			return err
+		}
+		return os.Remove(partial)
+	})
+}
+
+// WriteZipHash records the hash (eg. "h1:...") of a versioned module's zip file.
+// It should be called while holding the module's lock.
+func WriteZipHash(mod module.Version, hash string) error {
+	path, err := ZipHashPath(mod)
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err = os.WriteFile(tmp, []byte(hash), 0666); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// ReadZipHash returns the recorded hash of a versioned module's zip file.
+func ReadZipHash(mod module.Version) (string, error) {
+	path, err := ZipHashPath(mod)
+	if err != nil {
+		return "", err
+	}
+	b, err := ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(b)), nil
+}
+
+// removeAll removes a module directory, which the go command makes read-only.
+func removeAll(dir string) error {
+	filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+		if err == nil && d.IsDir() {
+			os.Chmod(path, 0777)
+		}
+		return nil
+	})
+	return os.RemoveAll(dir)
+}
+
+// -----------------------------------------------------------------------------
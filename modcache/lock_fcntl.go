@@ -0,0 +1,77 @@
+//go:build aix || (solaris && !illumos)
+
+/*
+ * Copyright (c) 2024 The GoPlus Authors (goplus.org). All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package modcache
+
+import (
+	"io"
+	"os"
+	"sync"
+	"syscall"
+)
+
+// There is no flock(2) on aix and solaris, so fcntl(2) locks are used instead,
+// like the go command does. Unlike flock locks, fcntl locks are owned by the
+// process rather than the open file, so they don't exclude other goroutines:
+// an in-process mutex per lock file is held along with the fcntl lock.
+
+var (
+	procMu    sync.Mutex
+	procLocks = make(map[string]*sync.Mutex)
+)
+
+func procLock(name string) *sync.Mutex {
+	procMu.Lock()
+	defer procMu.Unlock()
+	mu, ok := procLocks[name]
+	if !ok {
+		mu = new(sync.Mutex)
+		procLocks[name] = mu
+	}
+	return mu
+}
+
+func lockFile(f *os.File) error {
+	mu := procLock(f.Name())
+	mu.Lock()
+	if err := setlkw(f.Fd(), syscall.F_WRLCK); err != nil {
+		mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+func unlockFile(f *os.File) error {
+	err := setlkw(f.Fd(), syscall.F_UNLCK)
+	procLock(f.Name()).Unlock()
+	return err
+}
+
+func setlkw(fd uintptr, typ int16) error {
+	for {
+		err := syscall.FcntlFlock(fd, syscall.F_SETLKW, &syscall.Flock_t{
+			Type:   typ,
+			Whence: io.SeekStart,
+			Start:  0,
+			Len:    0, // all bytes
+		})
+		if err != syscall.EINTR {
+			return err
+		}
+	}
+}
@@ -0,0 +1,121 @@
+/*
+ * Copyright (c) 2024 The GoPlus Authors (goplus.org). All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package modcache
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golang.org/x/mod/module"
+)
+
+func TestExtractConcurrent(t *testing.T) {
+	defer func(old string) { GOMODCACHE = old }(GOMODCACHE)
+	GOMODCACHE = t.TempDir()
+
+	mod := module.Version{Path: "example.com/foo", Version: "v1.0.0"}
+	var calls int32
+	var wg sync.WaitGroup
+	errs := make([]error, 8)
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = Extract(mod, func(dir string) error {
+				if atomic.AddInt32(&calls, 1) != 1 {
+					return errors.New("concurrent extraction")
+				}
+				time.Sleep(10 * time.Millisecond)
+				if err := os.MkdirAll(dir, 0777); err != nil {
+					return err
+				}
+				return os.WriteFile(filepath.Join(dir, "go.mod"), []byte("module example.com/foo\n"), 0666)
+			})
+		}(i)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			t.Fatal("Extract:", err)
+		}
+	}
+	if calls != 1 {
+		t.Fatal("extract calls:", calls)
+	}
+	if !Complete(mod) {
+		t.Fatal("Complete: false")
+	}
+}
+
+func TestExtractPartial(t *testing.T) {
+	defer func(old string) { GOMODCACHE = old }(GOMODCACHE)
+	GOMODCACHE = t.TempDir()
+
+	mod := module.Version{Path: "example.com/foo", Version: "v1.0.0"}
+	dir, _ := Path(mod)
+	partial, _ := PartialPath(mod)
+
+	// an extraction interrupted by a crash leaves the directory and .partial
+	stale := filepath.Join(dir, "stale.go")
+	os.MkdirAll(dir, 0777)
+	os.WriteFile(stale, nil, 0444)
+	os.Chmod(dir, 0555)
+	os.MkdirAll(filepath.Dir(partial), 0777)
+	os.WriteFile(partial, nil, 0666)
+	if Complete(mod) {
+		t.Fatal("Complete: true with .partial")
+	}
+
+	err := Extract(mod, func(dir string) error {
+		return errors.New("extract failed")
+	})
+	if err == nil || err.Error() != "extract failed" {
+		t.Fatal("Extract:", err)
+	}
+	if _, err = os.Stat(partial); err != nil || Complete(mod) {
+		t.Fatal("failed Extract: .partial removed", err)
+	}
+
+	err = Extract(mod, func(dir string) error {
+		if _, err := os.Stat(dir); !os.IsNotExist(err) {
+			return errors.New("stale directory not removed")
+		}
+		return os.MkdirAll(dir, 0777)
+	})
+	if err != nil {
+		t.Fatal("Extract:", err)
+	}
+	if _, err = os.Stat(stale); !os.IsNotExist(err) {
+		t.Fatal("stale file:", err)
+	}
+	if _, err = os.Stat(partial); !os.IsNotExist(err) || !Complete(mod) {
+		t.Fatal("Extract: not complete", err)
+	}
+
+	// a complete module isn't extracted again
+	err = Extract(mod, func(dir string) error {
+		return errors.New("extracted again")
+	})
+	if err != nil {
+		t.Fatal("Extract:", err)
+	}
+}
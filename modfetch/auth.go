@@ -0,0 +1,195 @@
+/*
+ * Copyright (c) 2024 The GoPlus Authors (goplus.org). All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package modfetch
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+)
+
+// -----------------------------------------------------------------------------
+
+// A CredentialProvider adds credentials to requests sent to a module proxy.
+type CredentialProvider interface {
+	// Apply adds credentials (eg. an Authorization header) to req.
+	// It does nothing if it has no credentials for req.URL.
+	Apply(req *http.Request) error
+}
+
+var (
+	credMutex    sync.RWMutex
+	credProvider CredentialProvider
+	credInited   bool // credProvider is set, by default or by SetCredentialProvider
+)
+
+// SetCredentialProvider sets the credential provider used by proxy requests.
+// If cp is nil, no credentials will be sent.
+// By default, credentials are read from the .netrc file unless GOAUTH=off.
+func SetCredentialProvider(cp CredentialProvider) {
+	credMutex.Lock()
+	defer credMutex.Unlock()
+	credProvider, credInited = cp, true
+}
+
+func getCredentialProvider() CredentialProvider {
+	credMutex.RLock()
+	cp, inited := credProvider, credInited
+	credMutex.RUnlock()
+	if inited {
+		return cp
+	}
+	credMutex.Lock()
+	defer credMutex.Unlock()
+	if !credInited {
+		if os.Getenv("GOAUTH") != "off" {
+			credProvider = NewNetrcProvider(netrcPath())
+		}
+		credInited = true
+	}
+	return credProvider
+}
+
+func applyCredentials(req *http.Request) error {
+	if cp := getCredentialProvider(); cp != nil {
+		return cp.Apply(req)
+	}
+	return nil
+}
+
+// -----------------------------------------------------------------------------
+
+// NetrcLine is a machine entry of a .netrc file.
+type NetrcLine struct {
+	Machine  string
+	Login    string
+	Password string
+}
+
+// NetrcProvider is a CredentialProvider that reads credentials from a .netrc file.
+type NetrcProvider struct {
+	file  string
+	once  sync.Once
+	lines []NetrcLine
+}
+
+// NewNetrcProvider creates a CredentialProvider from the specified .netrc file.
+// The file is read lazily on first use, and a missing file means no credentials.
+func NewNetrcProvider(file string) *NetrcProvider {
+	return &NetrcProvider{file: file}
+}
+
+// Lines returns all machine entries of the .netrc file.
+func (p *NetrcProvider) Lines() []NetrcLine {
+	p.once.Do(func() {
+		if p.file == "" {
+			return
+		}
+		if data, err := os.ReadFile(p.file); err == nil {
+			p.lines = ParseNetrc(string(data))
+		}
+	})
+	return p.lines
+}
+
+// Apply sets basic auth of req if there is a matched machine entry.
+func (p *NetrcProvider) Apply(req *http.Request) error {
+	host := req.URL.Hostname()
+	for _, l := range p.Lines() {
+		if l.Machine == host {
+			req.SetBasicAuth(l.Login, l.Password)
+			break
+		}
+	}
+	return nil
+}
+
+// ParseNetrc parses content of a .netrc file.
+// The default machine and macdef entries are ignored, and so is everything
+// after a "#" where a keyword is expected (a comment).
+func ParseNetrc(data string) []NetrcLine {
+	var nrc []NetrcLine
+	var l NetrcLine
+	inMacro := false
+	for _, line := range strings.Split(data, "\n") {
+		if inMacro {
+			if line == "" {
+				inMacro = false
+			}
+			continue
+		}
+
+		f := strings.Fields(line)
+		i := 0
+		for ; i < len(f)-1; i += 2 {
+			if strings.HasPrefix(f[i], "#") { // comment
+				i = len(f)
+				break
+			}
+			// Reset at each "machine" token.
+			// “The auto-login process searches the .netrc file for a machine token
+			// that matches […]. Once a match is made, the subsequent .netrc tokens
+			// are processed, stopping when the end of file is reached or another
+			// machine or a default token is encountered.”
+			switch f[i] {
+			case "machine":
+				l = NetrcLine{Machine: f[i+1]}
+			case "default":
+				break
+			case "login":
+				l.Login = f[i+1]
+			case "password":
+				l.Password = f[i+1]
+			case "macdef":
+				// “A macro is defined with the specified name; its contents begin with
+				// the next .netrc line and continue until a null line (consecutive
+				// new-line characters) is encountered.”
+				inMacro = true
+			}
+			if l.Machine != "" && l.Login != "" && l.Password != "" {
+				nrc = append(nrc, l)
+				l = NetrcLine{}
+			}
+		}
+
+		if i < len(f) && f[i] == "default" {
+			// “There can be only one default token, and it must be after all machine tokens.”
+			break
+		}
+	}
+	return nrc
+}
+
+func netrcPath() string {
+	if env := os.Getenv("NETRC"); env != "" {
+		return env
+	}
+	dir, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	base := ".netrc"
+	if runtime.GOOS == "windows" {
+		base = "_netrc"
+	}
+	return filepath.Join(dir, base)
+}
+
+// -----------------------------------------------------------------------------
@@ -0,0 +1,172 @@
+/*
+ * Copyright (c) 2024 The GoPlus Authors (goplus.org). All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package modfetch
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseNetrc(t *testing.T) {
+	cases := []struct {
+		name string
+		data string
+		want []NetrcLine
+	}{
+		{"empty", "", nil},
+		{"multiline", "machine api.github.com\n  login user\n  password pwd\n",
+			[]NetrcLine{{"api.github.com", "user", "pwd"}}},
+		{"oneline", "machine oneline login user3 password pwd3\n",
+			[]NetrcLine{{"oneline", "user3", "pwd3"}}},
+		{"incomplete", "machine incomplete\npassword none\n\nmachine justlogin\n  login user\n", nil},
+		{"macdef", "machine ignore.host macdef ignore\n  login nobody\n  password nothing\n\nmachine test.host login user2 password pwd2\n",
+			[]NetrcLine{{"test.host", "user2", "pwd2"}}},
+		{"macdef after entry", "machine hasmacro.too macdef ignore-next-lines login user4 password pwd4\n  login nobody\n  password nothing\n",
+			[]NetrcLine{{"hasmacro.too", "user4", "pwd4"}}},
+		{"default", "machine a.com login a password pa\ndefault\nlogin anonymous\npassword gopher\n\nmachine after.default login oops password too-late\n",
+			[]NetrcLine{{"a.com", "a", "pa"}}},
+		{"comment", "# machine commented login x password y\nmachine b.com login b password p#b # trailing comment\n",
+			[]NetrcLine{{"b.com", "b", "p#b"}}},
+	}
+	for _, c := range cases {
+		if got := ParseNetrc(c.data); !reflect.DeepEqual(got, c.want) {
+			t.Fatalf("ParseNetrc %s: got %v, want %v", c.name, got, c.want)
+		}
+	}
+}
+
+func TestNetrcProvider(t *testing.T) {
+	file := filepath.Join(t.TempDir(), ".netrc")
+	os.WriteFile(file, []byte("machine example.com login user password pwd\n"), 0600)
+	p := NewNetrcProvider(file)
+	req, _ := http.NewRequest("GET", "https://example.com/foo/@v/list", nil)
+	if err := p.Apply(req); err != nil {
+		t.Fatal("Apply:", err)
+	}
+	if user, pwd, ok := req.BasicAuth(); !ok || user != "user" || pwd != "pwd" {
+		t.Fatal("Apply: basic auth", user, pwd, ok)
+	}
+	req, _ = http.NewRequest("GET", "https://other.com/foo/@v/list", nil)
+	if p.Apply(req); req.Header.Get("Authorization") != "" {
+		t.Fatal("Apply: unmatched machine")
+	}
+	if lines := NewNetrcProvider(filepath.Join(t.TempDir(), "missing")).Lines(); lines != nil {
+		t.Fatal("Lines: missing file", lines)
+	}
+}
+
+func resetCredentialProvider() {
+	credMutex.Lock()
+	credProvider, credInited = nil, false
+	credMutex.Unlock()
+}
+
+func TestCredentials(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, _, ok := r.BasicAuth(); !ok {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte(`{"Version":"v1.0.0"}`))
+	}))
+	defer ts.Close()
+	u, _ := url.Parse(ts.URL)
+	netrc := filepath.Join(t.TempDir(), ".netrc")
+	os.WriteFile(netrc, []byte("machine "+u.Hostname()+" login user password pwd\n"), 0600)
+	t.Setenv("NETRC", netrc)
+	defer resetCredentialProvider()
+
+	ctx := context.Background()
+	repo, err := newProxyRepo(ts.URL, "example.com/foo")
+	if err != nil {
+		t.Fatal("newProxyRepo:", err)
+	}
+	resetCredentialProvider()
+	if _, err = repo.Stat(ctx, "v1.0.0"); err != nil {
+		t.Fatal("Stat with .netrc:", err)
+	}
+
+	t.Setenv("GOAUTH", "off")
+	resetCredentialProvider()
+	if _, err = repo.Stat(ctx, "v1.0.0"); err == nil || !strings.Contains(err.Error(), "401") {
+		t.Fatal("Stat GOAUTH=off:", err)
+	}
+
+	SetCredentialProvider(NewNetrcProvider(netrc))
+	if _, err = repo.Stat(ctx, "v1.0.0"); err != nil {
+		t.Fatal("Stat SetCredentialProvider:", err)
+	}
+}
+
+func TestSetCredentialProvider(t *testing.T) {
+	resetCredentialProvider()
+	defer resetCredentialProvider()
+	t.Setenv("NETRC", filepath.Join(t.TempDir(), ".netrc"))
+	cp := NewNetrcProvider("")
+	done := make(chan struct{})
+	go func() {
+		getCredentialProvider()
+		close(done)
+	}()
+	SetCredentialProvider(cp)
+	<-done
+	if getCredentialProvider() != CredentialProvider(cp) {
+		t.Fatal("SetCredentialProvider: overwritten by the default provider")
+	}
+}
+
+func TestCheckResponse(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasSuffix(r.URL.Path, "v1.0.0.info"):
+			http.NotFound(w, r)
+		case strings.HasSuffix(r.URL.Path, "v1.1.0.info"):
+			w.WriteHeader(http.StatusGone)
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer ts.Close()
+
+	repo, err := newProxyRepo(ts.URL, "example.com/foo")
+	if err != nil {
+		t.Fatal("newProxyRepo:", err)
+	}
+	ctx := context.Background()
+	for _, c := range []struct {
+		version  string
+		notExist bool
+	}{
+		{"v1.0.0", true},
+		{"v1.1.0", true},
+		{"v1.2.0", false},
+	} {
+		_, err := repo.Stat(ctx, c.version)
+		if err == nil || errors.Is(err, fs.ErrNotExist) != c.notExist {
+			t.Fatal("Stat:", c.version, err)
+		}
+	}
+}
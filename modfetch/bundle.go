@@ -0,0 +1,204 @@
+/*
+ * Copyright (c) 2024 The GoPlus Authors (goplus.org). All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package modfetch
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/goplus/mod/modcache"
+	"golang.org/x/mod/module"
+	"golang.org/x/mod/semver"
+)
+
+// -----------------------------------------------------------------------------
+
+// Bundle writes the .info, .mod and .zip files of modules mods into directory
+// dir, which is laid out as a module proxy (like GOMODCACHE/cache/download),
+// so that it can be copied to an air-gapped machine and used by LoadBundle.
+// Files are copied from GOMODCACHE if possible, and are downloaded from the
+// module proxy otherwise. Versions of mods must be canonical.
+//
+// The @v/list file of each module lists all versions in the bundle, so a
+// bundle can be populated by several calls of Bundle.
+func Bundle(mods []module.Version, dir string) error {
+	return BundleContext(context.Background(), mods, dir)
+}
+
+// BundleContext is like Bundle but with a context.
+func BundleContext(ctx context.Context, mods []module.Version, dir string) (err error) {
+	vers := make(map[string][]string) // module path => versions
+	for _, mod := range mods {
+		if err = bundleMod(ctx, mod, dir); err != nil {
+			return
+		}
+		vers[mod.Path] = append(vers[mod.Path], mod.Version)
+	}
+	for path, list := range vers {
+		if err = addBundleVersions(dir, path, list); err != nil {
+			return
+		}
+	}
+	return
+}
+
+func bundleMod(ctx context.Context, mod module.Version, dir string) (err error) {
+	if !semver.IsValid(mod.Version) || module.CanonicalVersion(mod.Version) != mod.Version {
+		return fmt.Errorf("%v: version isn't canonical", mod)
+	}
+	encPath, err := module.EscapePath(mod.Path)
+	if err != nil {
+		return
+	}
+	encVer, err := module.EscapeVersion(mod.Version)
+	if err != nil {
+		return
+	}
+	vdir := filepath.Join(dir, filepath.FromSlash(encPath), "@v")
+	if err = os.MkdirAll(vdir, 0755); err != nil {
+		return
+	}
+	cached, _ := modcache.DownloadCachePath(mod) // the .zip file in GOMODCACHE
+	cached = strings.TrimSuffix(cached, ".zip")
+	var repo *proxyRepo
+	for _, ext := range []string{".info", ".mod", ".zip"} {
+		file := filepath.Join(vdir, encVer+ext)
+		if _, e := os.Stat(file); e == nil { // already in the bundle
+			continue
+		}
+		if cached != "" {
+			if data, e := modcache.ReadFile(cached + ext); e == nil {
+				if err = writeFileAtomic(file, data); err != nil {
+					return
+				}
+				continue
+			}
+		}
+		if repo == nil {
+			proxy, e := ProxyURLFor(mod.Path)
+			if e != nil {
+				return e
+			}
+			if repo, err = newProxyRepo(proxy, mod.Path); err != nil {
+				return
+			}
+		}
+		if err = bundleFromProxy(ctx, repo, mod.Version, file, "@v/"+encVer+ext); err != nil {
+			return
+		}
+	}
+	return
+}
+
+func bundleFromProxy(ctx context.Context, repo *proxyRepo, version, file, path string) (err error) {
+	if !strings.HasSuffix(path, ".zip") {
+		data, err := repo.getBytes(ctx, path)
+		if err != nil {
+			return repo.versionError(version, err)
+		}
+		return writeFileAtomic(file, data)
+	}
+	f, err := os.CreateTemp(filepath.Dir(file), filepath.Base(file)+".*.tmp")
+	if err != nil {
+		return
+	}
+	_, err = repo.ZipWith(ctx, f, version, nil)
+	if e := f.Close(); err == nil {
+		err = e
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), file)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+	return
+}
+
+// addBundleVersions adds versions of module path to its @v/list file.
+func addBundleVersions(dir, path string, vers []string) error {
+	encPath, err := module.EscapePath(path)
+	if err != nil {
+		return err
+	}
+	listFile := filepath.Join(dir, filepath.FromSlash(encPath), "@v", "list")
+	if data, e := os.ReadFile(listFile); e == nil {
+		vers = append(vers, strings.Fields(string(data))...)
+	}
+	semver.Sort(vers)
+	var b strings.Builder
+	for i, v := range vers {
+		if i == 0 || v != vers[i-1] {
+			b.WriteString(v)
+			b.WriteByte('\n')
+		}
+	}
+	return writeFileAtomic(listFile, []byte(b.String()))
+}
+
+// LoadBundle makes modules in bundle dir (see Bundle) fetched from the bundle
+// instead of module proxies: it adds a proxy route (see AddProxyRoute) of each
+// module in the bundle, whose proxy is the bundle as a file:// URL. It returns
+// the modules (with all their versions) in the bundle.
+func LoadBundle(dir string) (mods []module.Version, err error) {
+	if dir, err = filepath.Abs(dir); err != nil {
+		return
+	}
+	proxy := "file://" + filepath.ToSlash(dir)
+	if !strings.HasPrefix(proxy, "file:///") { // eg. C:/bundle on Windows
+		proxy = "file:///" + proxy[len("file://"):]
+	}
+	err = filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || d.Name() != "list" || filepath.Base(filepath.Dir(path)) != "@v" {
+			return err
+		}
+		rel, err := filepath.Rel(dir, filepath.Dir(filepath.Dir(path)))
+		if err != nil {
+			return err
+		}
+		modPath, err := module.UnescapePath(filepath.ToSlash(rel))
+		if err != nil {
+			return nil // not a module directory
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		for _, v := range strings.Fields(string(data)) {
+			mods = append(mods, module.Version{Path: modPath, Version: v})
+		}
+		AddProxyRoute(modPath, proxy)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(mods, func(i, j int) bool {
+		if mods[i].Path != mods[j].Path {
+			return mods[i].Path < mods[j].Path
+		}
+		return semver.Compare(mods[i].Version, mods[j].Version) < 0
+	})
+	return
+}
+
+// -----------------------------------------------------------------------------
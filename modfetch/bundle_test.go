@@ -0,0 +1,104 @@
+/*
+ * Copyright (c) 2024 The GoPlus Authors (goplus.org). All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package modfetch
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"errors"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/goplus/mod/modcache"
+	"golang.org/x/mod/module"
+)
+
+func TestBundle(t *testing.T) {
+	var zipData bytes.Buffer
+	zw := zip.NewWriter(&zipData)
+	for name, data := range map[string]string{
+		"example.com/foo@v1.0.0/go.mod": "module example.com/foo\n",
+		"example.com/foo@v1.0.0/foo.go": "package foo\n",
+	} {
+		w, _ := zw.Create(name)
+		w.Write([]byte(data))
+	}
+	zw.Close()
+	files := map[string]string{
+		"/example.com/foo/@v/v1.0.0.info": `{"Version":"v1.0.0","Time":"2024-01-01T00:00:00Z"}`,
+		"/example.com/foo/@v/v1.0.0.mod":  "module example.com/foo\n",
+		"/example.com/foo/@v/v1.0.0.zip":  zipData.String(),
+	}
+	requests := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if data, ok := files[r.URL.Path]; ok {
+			w.Write([]byte(data))
+			return
+		}
+		http.NotFound(w, r)
+	}))
+	defer ts.Close()
+	t.Setenv("GOPROXY", ts.URL)
+	t.Setenv("GOSUMDB", "off")
+
+	cache := modcache.GOMODCACHE
+	defer func() {
+		modcache.GOMODCACHE = cache
+	}()
+	modcache.GOMODCACHE = t.TempDir()
+
+	dir := t.TempDir()
+	mods := []module.Version{{Path: "example.com/foo", Version: "v1.0.0"}}
+	if err := Bundle(mods, dir); err != nil {
+		t.Fatal("Bundle:", err)
+	}
+	if err := Bundle(mods, dir); err != nil || requests != 3 {
+		t.Fatal("Bundle again:", requests, err)
+	}
+	if b, _ := os.ReadFile(filepath.Join(dir, "example.com", "foo", "@v", "list")); string(b) != "v1.0.0\n" {
+		t.Fatal("Bundle: list", string(b))
+	}
+	if err := Bundle([]module.Version{{Path: "example.com/foo", Version: "v1.0"}}, dir); err == nil {
+		t.Fatal("Bundle: no error for non-canonical version")
+	}
+
+	ts.Close() // the bundle works without the proxy
+	defer SetProxyRoutes(nil)
+	loaded, err := LoadBundle(dir)
+	if err != nil || len(loaded) != 1 || loaded[0] != mods[0] {
+		t.Fatal("LoadBundle:", loaded, err)
+	}
+	defer SetGoCommandEnabled(true)
+	SetGoCommandEnabled(false)
+	mod, err := GetContext(context.Background(), "example.com/foo@v1.0.0")
+	if err != nil || mod != mods[0] {
+		t.Fatal("GetContext:", mod, err)
+	}
+	if _, err = os.Stat(filepath.Join(modcache.GOMODCACHE, "example.com", "foo@v1.0.0", "foo.go")); err != nil {
+		t.Fatal("GetContext: not extracted", err)
+	}
+	repo, _ := newProxyRepo(ProxyFor("example.com/foo"), "example.com/foo")
+	if _, err = repo.Stat(context.Background(), "v1.1.0"); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatal("Stat nonexistent:", err)
+	}
+}
@@ -0,0 +1,200 @@
+/*
+ * Copyright (c) 2024 The GoPlus Authors (goplus.org). All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package modfetch
+
+import (
+	"context"
+	"encoding/xml"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/mod/module"
+)
+
+// -----------------------------------------------------------------------------
+
+// knownModRoot returns the module root of pkgPath (without version) for
+// well-known hosting domains, whose repository root has a fixed depth.
+func knownModRoot(pkgPath string) (modPath string, ok bool) {
+	parts := strings.Split(pkgPath, "/")
+	n := 0
+	switch parts[0] {
+	case "github.com", "bitbucket.org", "gitee.com", "golang.org":
+		n = 3
+	case "gopkg.in": // gopkg.in/yaml.v3, gopkg.in/user/pkg.v1
+		n = 2
+		if len(parts) > 1 && !strings.Contains(parts[1], ".") {
+			n = 3
+		}
+	default:
+		return
+	}
+	if len(parts) < n {
+		return pkgPath, true
+	}
+	if len(parts) > n && parts[0] != "gopkg.in" {
+		if _, pathMajor, ok := module.SplitPathVersion(strings.Join(parts[:n+1], "/")); ok && pathMajor != "" {
+			n++
+		}
+	}
+	return strings.Join(parts[:n], "/"), true
+}
+
+const (
+	discoveryTimeout = 30 * time.Second
+
+	// maxModRootDepth is the max number of path elements of a module root
+	// discovered from the module proxy, which limits requests sent by
+	// proxyModRoot for a deep pkgPath.
+	maxModRootDepth = 5
+)
+
+var modRoots sync.Map // pkgPath => modPath ("" if pkgPath has no known module root)
+
+// lookupModRoot discovers the module root of pkgPath (without version) from
+// the module proxy, or from <meta name="go-import"> tags if GOPROXY is direct.
+// Nothing is looked up if GOPROXY is off. Both hits and misses are cached,
+// unless the lookup is interrupted by ctx.
+func lookupModRoot(ctx context.Context, pkgPath string) (modPath string, ok bool) {
+	if v, ok := modRoots.Load(pkgPath); ok {
+		modPath = v.(string)
+		return modPath, modPath != ""
+	}
+	ctx, cancel := context.WithTimeout(ctx, discoveryTimeout)
+	defer cancel()
+	goproxy := ProxyFor(pkgPath)
+	if proxy, err := firstProxyURL(goproxy); err == nil {
+		modPath, ok = proxyModRoot(ctx, proxy, pkgPath)
+	} else if isDirectProxy(goproxy) {
+		modPath, ok = metaModRoot(ctx, pkgPath)
+	} else { // GOPROXY=off
+		return "", false
+	}
+	if ok || ctx.Err() == nil {
+		modRoots.Store(pkgPath, modPath)
+	}
+	return
+}
+
+// isDirectProxy checks if goproxy (a GOPROXY list without any proxy URL)
+// allows direct connections to the origin, ie. "direct" comes before "off".
+func isDirectProxy(goproxy string) bool {
+	for _, proxy := range strings.FieldsFunc(goproxy, func(c rune) bool { return c == ',' || c == '|' }) {
+		switch strings.TrimSpace(proxy) {
+		case "direct":
+			return true
+		case "off":
+			return false
+		}
+	}
+	return false
+}
+
+// proxyModRoot finds the longest prefix of pkgPath that is a module known by
+// the module proxy. Only prefixes of at most maxModRootDepth path elements are
+// tried, and each prefix costs up to two requests.
+func proxyModRoot(ctx context.Context, proxy, pkgPath string) (string, bool) {
+	prefix := pkgPath
+	if parts := strings.SplitN(pkgPath, "/", maxModRootDepth+1); len(parts) > maxModRootDepth {
+		prefix = strings.Join(parts[:maxModRootDepth], "/")
+	}
+	for ; strings.Contains(prefix, "/"); prefix = prefix[:strings.LastIndexByte(prefix, '/')] {
+		if ctx.Err() != nil {
+			break
+		}
+		repo, err := newProxyRepo(proxy, prefix)
+		if err != nil {
+			continue
+		}
+		if vers, err := repo.Versions(ctx, ""); err == nil && len(vers.List) > 0 {
+			return prefix, true
+		}
+		if _, err := repo.Latest(ctx); err == nil {
+			return prefix, true
+		}
+	}
+	return "", false
+}
+
+// metaModRoot finds the repository root of pkgPath from the go-import meta
+// tag of https://pkgPath?go-get=1, eg.
+//
+//	<meta name="go-import" content="example.com/foo git https://code.example.com/foo">
+func metaModRoot(ctx context.Context, pkgPath string) (string, bool) {
+	req, err := http.NewRequestWithContext(ctx, "GET", "https://"+pkgPath+"?go-get=1", nil)
+	if err != nil {
+		return "", false
+	}
+	applyHeaders(req)
+	resp, err := httpClient(pkgPath).Do(req)
+	if err != nil {
+		return "", false
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", false
+	}
+	return parseMetaGoImport(resp.Body, pkgPath)
+}
+
+func parseMetaGoImport(r io.Reader, pkgPath string) (root string, ok bool) {
+	d := xml.NewDecoder(r)
+	d.CharsetReader = func(charset string, input io.Reader) (io.Reader, error) {
+		return input, nil
+	}
+	d.Strict = false
+	for {
+		t, err := d.RawToken()
+		if err != nil {
+			return root, root != ""
+		}
+		if e, ok := t.(xml.EndElement); ok && strings.EqualFold(e.Name.Local, "head") {
+			return root, root != ""
+		}
+		e, ok := t.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		if strings.EqualFold(e.Name.Local, "body") {
+			return root, root != ""
+		}
+		if !strings.EqualFold(e.Name.Local, "meta") || attrValue(e.Attr, "name") != "go-import" {
+			continue
+		}
+		if f := strings.Fields(attrValue(e.Attr, "content")); len(f) == 3 {
+			if prefix := f[0]; pkgPath == prefix || strings.HasPrefix(pkgPath, prefix+"/") {
+				if len(prefix) > len(root) {
+					root = prefix
+				}
+			}
+		}
+	}
+}
+
+func attrValue(attrs []xml.Attr, name string) string {
+	for _, a := range attrs {
+		if strings.EqualFold(a.Name.Local, name) {
+			return a.Value
+		}
+	}
+	return ""
+}
+
+// -----------------------------------------------------------------------------
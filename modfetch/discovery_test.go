@@ -0,0 +1,199 @@
+/*
+ * Copyright (c) 2024 The GoPlus Authors (goplus.org). All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package modfetch
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestKnownModRoot(t *testing.T) {
+	for pkgPath, want := range map[string]string{
+		"github.com/goplus/mod/modfetch":     "github.com/goplus/mod",
+		"github.com/goplus/spx/v2/cmd/spx":   "github.com/goplus/spx/v2",
+		"github.com/goplus/spx/v1/cmd":       "github.com/goplus/spx",
+		"github.com/goplus":                  "github.com/goplus",
+		"bitbucket.org/foo/bar/baz":          "bitbucket.org/foo/bar",
+		"golang.org/x/mod/v10/zip":           "golang.org/x/mod/v10",
+		"gopkg.in/yaml.v3":                   "gopkg.in/yaml.v3",
+		"gopkg.in/yaml.v3/sub":               "gopkg.in/yaml.v3",
+		"gopkg.in/user/pkg.v1/sub":           "gopkg.in/user/pkg.v1",
+		"gitee.com/foo/bar/v0/x":             "gitee.com/foo/bar",
+		"example.com/foo":                    "",
+		"gitlab.com/group/subgroup/repo/pkg": "",
+	} {
+		modPath, ok := knownModRoot(pkgPath)
+		if ok != (want != "") || modPath != want {
+			t.Fatal("knownModRoot:", pkgPath, modPath, ok)
+		}
+	}
+}
+
+func TestParseMetaGoImport(t *testing.T) {
+	const html = `<!DOCTYPE html>
+<html><head>
+<meta name="go-import" content="example.com/foo git https://code.example.com/foo">
+<meta name="go-import" content="example.com/foo/sub git https://code.example.com/sub">
+<meta name="go-import" content="example.com/other git https://code.example.com/other">
+<meta name="go-import" content="example.com/bad">
+</head>
+<body><meta name="go-import" content="example.com/foo/sub/x git https://code.example.com/x"></body>
+</html>`
+	for pkgPath, want := range map[string]string{
+		"example.com/foo/a":       "example.com/foo",
+		"example.com/foo":         "example.com/foo",
+		"example.com/foo/sub/x/y": "example.com/foo/sub",
+		"example.com/foobar":      "",
+		"example.com/bad":         "",
+	} {
+		root, ok := parseMetaGoImport(strings.NewReader(html), pkgPath)
+		if ok != (want != "") || root != want {
+			t.Fatal("parseMetaGoImport:", pkgPath, root, ok)
+		}
+	}
+}
+
+func TestSplitDiscovery(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/split.example.com/group/repo/@v/list":
+			w.Write([]byte("v1.0.0\n"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+	t.Setenv("GOPROXY", ts.URL)
+	t.Setenv("GOFLAGS", "")
+
+	for pkgPath, want := range map[string][2]string{
+		"split.example.com/group/repo/a/b@v1.0.0": {"split.example.com/group/repo@v1.0.0", "a/b"},
+		"split.example.com/group/repo":            {"split.example.com/group/repo", ""},
+		"split.example.com/unknown/pkg":           {"split.example.com/unknown/pkg", ""},
+		"github.com/goplus/mod/modfetch":          {"github.com/goplus/mod", "modfetch"},
+		"fmt":                                     {"", "fmt"},
+	} {
+		modPath, relPath := SplitContext(context.Background(), pkgPath, "")
+		if modPath != want[0] || relPath != want[1] {
+			t.Fatal("SplitContext:", pkgPath, modPath, relPath)
+		}
+	}
+	if modPath, relPath := Split("split.example.com/group/repo/a/b", ""); modPath != "split.example.com/group/repo/a/b" || relPath != "" {
+		t.Fatal("Split offline:", modPath, relPath)
+	}
+	if modPath, relPath := Split("example.com/foo/bar", "example.com/foo"); modPath != "example.com/foo" || relPath != "bar" {
+		t.Fatal("Split with modBase:", modPath, relPath)
+	}
+}
+
+type countingTransport struct {
+	n int32
+}
+
+func (p *countingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	atomic.AddInt32(&p.n, 1)
+	if err := req.Context().Err(); err != nil {
+		return nil, err
+	}
+	return &http.Response{
+		StatusCode: http.StatusNotFound,
+		Body:       http.NoBody,
+		Request:    req,
+	}, nil
+}
+
+func TestSplitNoNetwork(t *testing.T) {
+	rt := new(countingTransport)
+	SetTransport(rt)
+	defer SetTransport(nil)
+	t.Setenv("GOFLAGS", "")
+	ctx := context.Background()
+
+	t.Setenv("GOPROXY", "https://proxy.example.com")
+	if modPath, _ := Split("split.example.com/foo/bar", ""); modPath != "split.example.com/foo/bar" {
+		t.Fatal("Split:", modPath)
+	}
+	if n := atomic.LoadInt32(&rt.n); n != 0 {
+		t.Fatal("Split: requests sent", n)
+	}
+
+	t.Setenv("GOPROXY", "off")
+	if modPath, _ := SplitContext(ctx, "off.example.com/foo/bar", ""); modPath != "off.example.com/foo/bar" {
+		t.Fatal("SplitContext off:", modPath)
+	}
+	if n := atomic.LoadInt32(&rt.n); n != 0 {
+		t.Fatal("SplitContext off: requests sent", n)
+	}
+
+	t.Setenv("GOPROXY", "direct")
+	if modPath, _ := SplitContext(ctx, "direct.example.com/foo/bar", ""); modPath != "direct.example.com/foo/bar" {
+		t.Fatal("SplitContext direct:", modPath)
+	}
+	if n := atomic.LoadInt32(&rt.n); n != 1 {
+		t.Fatal("SplitContext direct: requests sent", n)
+	}
+}
+
+func TestSplitMaxDepth(t *testing.T) {
+	rt := new(countingTransport)
+	SetTransport(rt)
+	defer SetTransport(nil)
+	t.Setenv("GOPROXY", "https://proxy.example.com")
+	t.Setenv("GOFLAGS", "")
+
+	pkgPath := "deep.example.com/a/b/c/d/e/f/g/h"
+	if modPath, _ := SplitContext(context.Background(), pkgPath, ""); modPath != pkgPath {
+		t.Fatal("SplitContext:", modPath)
+	}
+	if n := atomic.LoadInt32(&rt.n); n != 2*(maxModRootDepth-1) {
+		t.Fatal("SplitContext: requests sent", n)
+	}
+}
+
+func TestSplitNegativeCache(t *testing.T) {
+	rt := new(countingTransport)
+	SetTransport(rt)
+	defer SetTransport(nil)
+	t.Setenv("GOPROXY", "https://proxy.example.com")
+	t.Setenv("GOFLAGS", "")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if modPath, _ := SplitContext(ctx, "neg.example.com/foo/bar", ""); modPath != "neg.example.com/foo/bar" {
+		t.Fatal("SplitContext canceled:", modPath)
+	}
+	if _, ok := modRoots.Load("neg.example.com/foo/bar"); ok {
+		t.Fatal("SplitContext canceled: miss cached")
+	}
+
+	ctx = context.Background()
+	SplitContext(ctx, "neg.example.com/foo/bar", "")
+	n := atomic.LoadInt32(&rt.n)
+	if n == 0 {
+		t.Fatal("SplitContext: no requests sent")
+	}
+	if modPath, _ := SplitContext(ctx, "neg.example.com/foo/bar", ""); modPath != "neg.example.com/foo/bar" {
+		t.Fatal("SplitContext cached:", modPath)
+	}
+	if m := atomic.LoadInt32(&rt.n); m != n {
+		t.Fatal("SplitContext cached: requests sent", m-n)
+	}
+}
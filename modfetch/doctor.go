@@ -0,0 +1,264 @@
+/*
+ * Copyright (c) 2024 The GoPlus Authors (goplus.org). All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package modfetch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"golang.org/x/mod/modfile"
+	"golang.org/x/mod/module"
+)
+
+// -----------------------------------------------------------------------------
+
+// ProbeModule is the well-known module requested by CheckProxy. Change it to
+// a module the proxy serves if the proxy only serves private modules.
+var ProbeModule = module.Version{Path: "golang.org/x/mod", Version: "v0.1.0"}
+
+// A ProxyCheck is the result of CheckProxy.
+type ProxyCheck struct {
+	URL     string        // the module proxy (password redacted)
+	Latency time.Duration // round-trip time of the first probe request
+	Err     error         // nil if the proxy works
+}
+
+// OK reports whether the proxy works.
+func (p *ProxyCheck) OK() bool {
+	return p.Err == nil
+}
+
+func (p *ProxyCheck) String() string {
+	if p.Err != nil {
+		return p.URL + ": " + p.Err.Error()
+	}
+	return fmt.Sprintf("%s: ok (%v)", p.URL, p.Latency.Round(time.Millisecond))
+}
+
+// CheckProxy checks the module proxy proxyURL (https, http, file or unix, see
+// GOPROXY) by requesting ProbeModule:
+//   - HEAD $module/@v/list checks the proxy is reachable and measures the
+//     latency (GET is used instead if the proxy doesn't allow HEAD);
+//   - $module/@v/$version.info and $module/@v/$version.mod check the proxy
+//     speaks the GOPROXY protocol: the requested version and module path
+//     must be returned.
+func CheckProxy(ctx context.Context, proxyURL string) *ProxyCheck {
+	ret := &ProxyCheck{URL: proxyURL}
+	repo, err := newProxyRepo(proxyURL, ProbeModule.Path)
+	if err != nil {
+		ret.Err = err
+		return ret
+	}
+	ret.URL = repo.redactedURL
+	start := time.Now()
+	resp, err := repo.request(ctx, "HEAD", "@v/list")
+	if isHTTPStatus(err, http.StatusMethodNotAllowed) {
+		start = time.Now()
+		resp, err = repo.request(ctx, "GET", "@v/list")
+	}
+	ret.Latency = time.Since(start)
+	if err != nil {
+		ret.Err = repo.versionError("", err)
+		return ret
+	}
+	resp.Body.Close()
+	ret.Err = repo.checkProtocol(ctx, ProbeModule.Version)
+	return ret
+}
+
+// checkProtocol checks responses of the .info and .mod files of version.
+func (p *proxyRepo) checkProtocol(ctx context.Context, version string) error {
+	if _, err := p.Stat(ctx, version); err != nil {
+		return err
+	}
+	data, err := p.GoMod(ctx, version)
+	if err != nil {
+		return err
+	}
+	if path := modfile.ModulePath(data); path != p.path {
+		return p.versionError(version, fmt.Errorf("invalid response from proxy %q: go.mod declares module %q", p.redactedURL, path))
+	}
+	return nil
+}
+
+func isHTTPStatus(err error, code int) bool {
+	var e *httpError
+	return errors.As(err, &e) && e.statusCode == code
+}
+
+// -----------------------------------------------------------------------------
+
+// A ProxyEntry is an element of a module proxy list (see GOPROXY).
+type ProxyEntry struct {
+	URL string // a proxy URL, "direct" or "off"
+
+	// FallbackOnError is true if the next entry is tried on any error (the
+	// entry is followed by "|"), not only on 404 and 410 (followed by ",").
+	FallbackOnError bool
+}
+
+// parseProxyList parses a module proxy list in the same form as GOPROXY. An
+// empty list means "https://proxy.golang.org,direct", like the go command.
+func parseProxyList(goproxy string) (list []ProxyEntry) {
+	if strings.TrimSpace(goproxy) == "" {
+		goproxy = defaultProxyURL + ",direct"
+	}
+	for goproxy != "" {
+		var entry ProxyEntry
+		if i := strings.IndexAny(goproxy, ",|"); i >= 0 {
+			entry = ProxyEntry{URL: goproxy[:i], FallbackOnError: goproxy[i] == '|'}
+			goproxy = goproxy[i+1:]
+		} else {
+			entry.URL, goproxy = goproxy, ""
+		}
+		if entry.URL = strings.TrimSpace(entry.URL); entry.URL != "" {
+			list = append(list, entry)
+		}
+	}
+	return
+}
+
+// A Diagnosis describes how a module is downloaded when it isn't found in
+// GOMODCACHE, see Doctor.
+type Diagnosis struct {
+	Module  string       // the module (or package) path
+	Route   *ProxyRoute  // the proxy route matching Module (see SetProxyRoutes), nil if none
+	Proxy   string       // the effective module proxy list: Route.Proxy, or GOPROXY if Route is nil
+	Chain   []ProxyEntry // Proxy parsed
+	Private []string     // patterns of GOPRIVATE matching Module
+	NoProxy []string     // patterns of GONOPROXY (GOPRIVATE if unset) matching Module
+
+	// Source tells which source would serve Module: Strategy is StrategyProxy
+	// (the go command is disabled), StrategyGoCommand or StrategyDirect, and
+	// Proxy is the module proxy used if any. It is zero if Err isn't nil.
+	Source Report
+
+	Err      error    // why Module can't be downloaded, eg. ErrGoCommandDisabled
+	Warnings []string // possible misconfigurations
+}
+
+// Doctor diagnoses how module (or package) modPath is downloaded when it isn't
+// found in GOMODCACHE: the effective module proxy chain (taking proxy routes
+// into account), GOPRIVATE and GONOPROXY patterns matching modPath, and which
+// source would serve it. It doesn't access the network: use CheckProxy to
+// check proxies of the chain.
+func Doctor(modPath string) *Diagnosis {
+	ret := &Diagnosis{Module: modPath, Proxy: os.Getenv("GOPROXY")}
+	if r, ok := matchRoute(modPath); ok {
+		ret.Route, ret.Proxy = &r, r.Proxy
+	}
+	ret.Chain = parseProxyList(ret.Proxy)
+	private := os.Getenv("GOPRIVATE")
+	noproxy := os.Getenv("GONOPROXY")
+	if noproxy == "" {
+		noproxy = private
+	}
+	ret.Private = matchedPatterns(private, modPath)
+	ret.NoProxy = matchedPatterns(noproxy, modPath)
+
+	sum := SumCheckFor(modPath)
+	if ret.Private != nil && sum == SumVerified {
+		ret.Warnings = append(ret.Warnings, fmt.Sprintf(
+			"%s matches GOPRIVATE, but it is verified by the checksum database because GONOSUMDB is set", modPath))
+	}
+	if !GoCommandEnabled() {
+		proxy, err := firstProxyURL(ret.Proxy)
+		if err != nil {
+			ret.Err = fmt.Errorf("%w: can't download %s without a module proxy", ErrGoCommandDisabled, modPath)
+			return ret
+		}
+		ret.Source = Report{Strategy: StrategyProxy, Proxy: proxy, Sum: sum}
+		if ret.NoProxy != nil {
+			ret.Warnings = append(ret.Warnings, fmt.Sprintf(
+				"%s matches GONOPROXY, but it is downloaded from %s because the go command is disabled", modPath, proxy))
+		}
+		return ret
+	}
+	if ret.NoProxy != nil {
+		ret.Source = Report{Strategy: StrategyDirect, Sum: sum}
+		return ret
+	}
+	if len(ret.Chain) == 0 { // eg. GOPROXY=" , "
+		ret.Err = fmt.Errorf("empty GOPROXY=%q: no module proxy or direct in the list", ret.Proxy)
+		return ret
+	}
+	switch first := ret.Chain[0].URL; first {
+	case "direct":
+		ret.Source = Report{Strategy: StrategyDirect, Sum: sum}
+	case "off":
+		ret.Err = fmt.Errorf("module lookup disabled by GOPROXY=%s", ret.Proxy)
+	default:
+		ret.Source = Report{Strategy: StrategyGoCommand, Proxy: first, Sum: sum}
+	}
+	return ret
+}
+
+// matchedPatterns returns patterns of a comma-separated list (in the form of
+// GOPRIVATE) matching modPath.
+func matchedPatterns(patterns, modPath string) (ret []string) {
+	for _, pattern := range strings.Split(patterns, ",") {
+		if pattern = strings.TrimSpace(pattern); pattern != "" && module.MatchPrefixPatterns(pattern, modPath) {
+			ret = append(ret, pattern)
+		}
+	}
+	return
+}
+
+// String returns a human-readable report of the diagnosis, eg.
+//
+//	module:    example.com/foo
+//	proxy:     https://goproxy.cn,direct
+//	source:    go-command (https://goproxy.cn), sum verified
+func (p *Diagnosis) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "module:    %s\n", p.Module)
+	switch {
+	case p.Route != nil:
+		fmt.Fprintf(&b, "proxy:     %s (route %s)\n", p.Proxy, p.Route.Pattern)
+	case strings.TrimSpace(p.Proxy) == "":
+		fmt.Fprintf(&b, "proxy:     %s,direct (default)\n", defaultProxyURL)
+	default:
+		fmt.Fprintf(&b, "proxy:     %s\n", p.Proxy)
+	}
+	if p.Private != nil {
+		fmt.Fprintf(&b, "GOPRIVATE: %s\n", strings.Join(p.Private, ","))
+	}
+	if p.NoProxy != nil {
+		fmt.Fprintf(&b, "GONOPROXY: %s\n", strings.Join(p.NoProxy, ","))
+	}
+	if p.Err != nil {
+		fmt.Fprintf(&b, "error:     %v\n", p.Err)
+	} else {
+		src := p.Source
+		if src.Proxy != "" {
+			fmt.Fprintf(&b, "source:    %v (%s), sum %v\n", src.Strategy, src.Proxy, src.Sum)
+		} else {
+			fmt.Fprintf(&b, "source:    %v, sum %v\n", src.Strategy, src.Sum)
+		}
+	}
+	for _, w := range p.Warnings {
+		fmt.Fprintf(&b, "warning:   %s\n", w)
+	}
+	return b.String()
+}
+
+// -----------------------------------------------------------------------------
@@ -21,12 +21,13 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"log"
 	"net/url"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"strings"
+	"sync"
+	"time"
 
 	xmod "github.com/goplus/mod"
 	"github.com/goplus/mod/modcache"
@@ -53,39 +54,141 @@ func SetDebug(flags dbgFlags) {
 
 // -----------------------------------------------------------------------------
 
+// An AmbiguousError is returned by GetPkg if a package is found in multiple
+// modules (eg. a module and its nested module).
+type AmbiguousError struct {
+	PkgPath string
+	Mods    []module.Version // candidate modules, longest module path first
+}
+
+func (e *AmbiguousError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "ambiguous import: found package %s in multiple modules:", e.PkgPath)
+	for _, mod := range e.Mods {
+		b.WriteString("\n\t")
+		b.WriteString(mod.Path)
+		if mod.Version != "" {
+			b.WriteString(" ")
+			b.WriteString(mod.Version)
+		}
+	}
+	return b.String()
+}
+
+// parseAmbiguous parses the ambiguous import error reported by the go command:
+//
+//	ambiguous import: found package example.com/a/b in multiple modules:
+//		example.com/a v1.0.0 (/path/to/example.com/a@v1.0.0/b)
+//		example.com/a/b v0.1.0 (/path/to/example.com/a/b@v0.1.0)
+func parseAmbiguous(data string, pkgPath string) *AmbiguousError {
+	prefix := "ambiguous import: found package " + pkgPath + " in multiple modules:\n"
+	pos := strings.Index(data, prefix)
+	if pos < 0 {
+		return nil
+	}
+	ret := &AmbiguousError{PkgPath: pkgPath}
+	for _, line := range strings.Split(data[pos+len(prefix):], "\n") {
+		if !strings.HasPrefix(line, "\t") {
+			break
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			break
+		}
+		mod := module.Version{Path: fields[0]}
+		if len(fields) > 1 && !strings.HasPrefix(fields[1], "(") {
+			mod.Version = fields[1]
+		}
+		ret.Mods = append(ret.Mods, mod)
+	}
+	if len(ret.Mods) < 2 {
+		return nil
+	}
+	return ret
+}
+
 // GetPkg downloads the module that contains pkgPath to GOMODCACHE.
+// It returns an *AmbiguousError if pkgPath is found in multiple modules.
+//
+// Deprecated: Use GetPkgContext instead.
 func GetPkg(pkgPathVer, modBase string) (modVer module.Version, relPath string, err error) {
+	return GetPkgContext(context.Background(), pkgPathVer, modBase)
+}
+
+// GetPkgContext downloads the module that contains pkgPath to GOMODCACHE.
+// It returns an *AmbiguousError if pkgPath is found in multiple modules.
+// Canceling ctx kills the go command and aborts requests to module proxies.
+func GetPkgContext(ctx context.Context, pkgPathVer, modBase string) (modVer module.Version, relPath string, err error) {
+	modVer, relPath, _, err = GetPkgContextEx(ctx, pkgPathVer, modBase)
+	return
+}
+
+// GetPkgContextEx is like GetPkgContext but it also reports how the package
+// is resolved.
+func GetPkgContextEx(ctx context.Context, pkgPathVer, modBase string) (modVer module.Version, relPath string, rep Report, err error) {
 	var ver string
+	defer func() {
+		if err == nil {
+			recordResolution(pkgPathVer, modVer, relPath, rep)
+		}
+	}()
 	var pkgPath string = pkgPathVer
 	if pos := strings.IndexByte(pkgPath, '@'); pos > 0 {
 		pkgPath, ver = pkgPath[:pos], pkgPath[pos+1:]
 	}
-	if debugVerbose {
-		log.Println("modfetch.GetPkg", pkgPathVer, modBase)
+	logDebug("modfetch.GetPkg", Field{"pkg", pkgPathVer}, Field{"modBase", modBase})
+	if err = negcache.lookup(pkgPathVer); err != nil {
+		logDebug("negative cache hit", append([]Field{{"pkg", pkgPathVer}}, errField(err)...)...)
+		return
 	}
 	semIsValid := semver.IsValid(ver)
 	if semIsValid {
 		modVer, relPath, err = lookupListFromCache(pkgPath, "@"+ver)
 		if err == nil {
+			rep.Strategy = StrategyCache
+			return
+		}
+		var e *AmbiguousError
+		if errors.As(err, &e) { // the go command would report the same
 			return
 		}
 	}
-	var stdout, stderr bytes.Buffer
-	cmd := exec.Command("go", "install", "-x", pkgPathVer)
-	if debugVerbose {
-		log.Println("==>", cmd)
+	if !GoCommandEnabled() {
+		modVer, relPath, rep, err = getPkgFromProxy(ctx, pkgPath, ver)
+		if err != nil && ctx.Err() == nil {
+			negcache.add(pkgPathVer, err)
+		}
+		return
 	}
+	rep = goCommandReport(pkgPath)
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "go", "install", "-x", pkgPathVer)
+	cmd.Env = goEnv(pkgPath)
+	logDebug("exec", Field{"cmd", cmd.String()})
+	start := time.Now()
 	cmd.Stdout = &stdout
 	cmd.Stderr = &stderr
+	hookExec(cmd)
 	cmd.Run()
-	proxy, pkg, found := foundBestRepo(stderr.String(), pkgPath)
+	if err = ctx.Err(); err != nil {
+		return
+	}
+	if e := parseAmbiguous(stderr.String(), pkgPath); e != nil {
+		err = e
+		negcache.add(pkgPathVer, err)
+		return
+	}
+	var proxy, pkg string
+	var found bool
+	proxy, pkg, found = foundBestRepo(stderr.String(), pkgPath)
 	var foundVer string
 	if semIsValid {
 		foundVer = "@" + ver
 	}
 	if found {
+		rep.Proxy = proxy
 		if !semIsValid {
-			if rev, err := foundRevInfo(proxy, pkg, ver); err == nil {
+			if rev, err := foundRevInfo(ctx, proxy, pkg, ver); err == nil {
 				foundVer = "@" + rev.Version
 			}
 		}
@@ -96,33 +199,138 @@ func GetPkg(pkgPathVer, modBase string) (modVer module.Version, relPath string,
 	} else {
 		modVer, relPath, err = lookupListFromCache(pkgPath, foundVer)
 	}
-	if debugVerbose {
-		log.Println("==>", modVer, relPath, err)
+	logDebug("modfetch.GetPkg done", append([]Field{
+		{"pkg", pkgPathVer}, {"module", modVer.Path}, {"version", modVer.Version}, {"relPath", relPath},
+		{"proxy", rep.Proxy}, {"duration", time.Since(start)},
+	}, errField(err)...)...)
+	if err != nil {
+		negcache.add(pkgPathVer, err)
+	}
+	return
+}
+
+// getPkgFromProxy downloads the module containing pkgPath (its module root is
+// found by SplitContext) from the module proxy without running the go command.
+func getPkgFromProxy(ctx context.Context, pkgPath, ver string) (modVer module.Version, relPath string, rep Report, err error) {
+	modPath, _ := SplitContext(ctx, pkgPath, "")
+	if modPath == "" {
+		err = fmt.Errorf("gop: %v is not a module package", pkgPath)
+		return
+	}
+	if ver != "" {
+		modPath += "@" + ver
+	}
+	mod, rep, err := getFromProxy(ctx, modPath)
+	if err != nil {
+		return
 	}
+	modVer, relPath, err = lookupListFromCache(pkgPath, "@"+mod.Version)
 	return
 }
 
 func lookupListFromCache(pkgPath string, ver string) (modVer module.Version, relPath string, err error) {
+	var found []module.Version // modules containing pkgPath as a package
+	var first bool
 	list := strings.Split(pkgPath, "/")
 	for i := len(list); i > 0; i-- {
 		modPath := strings.Join(list[:i], "/") + ver
-		_, modVer, err = lookupFromCache(modPath)
-		if err == nil {
-			encPath, _ := module.EscapePath(modVer.Path)
-			modRoot := filepath.Join(modcache.GOMODCACHE, encPath+"@"+modVer.Version, filepath.Join(list[i:]...))
-			if _, e := os.Stat(modRoot); e != nil {
-				err = fmt.Errorf("gop: module %v found, but does not contain package %v", modVer.Path, pkgPath)
+		var mod module.Version
+		if _, mod, err = lookupFromCache(modPath); err != nil {
+			continue
+		}
+		encPath, _ := module.EscapePath(mod.Path)
+		modRoot := filepath.Join(modcache.GOMODCACHE, encPath+"@"+mod.Version, filepath.Join(list[i:]...))
+		if !first {
+			if _, e := modcache.Stat(modRoot); e != nil {
+				err = fmt.Errorf("gop: module %v found, but does not contain package %v", mod.Path, pkgPath)
 				return
 			}
-			relPath = strings.Join(list[i:], "/")
-			return
+			modVer, relPath, first = mod, strings.Join(list[i:], "/"), true
+		}
+		if hasPkgFiles(modRoot) {
+			found = append(found, mod)
 		}
 	}
-	return
+	if !first {
+		return
+	}
+	if len(found) > 1 {
+		return module.Version{}, "", &AmbiguousError{PkgPath: pkgPath, Mods: found}
+	}
+	return modVer, relPath, nil
+}
+
+// hasPkgFiles checks if dir contains any source file (so it is a package
+// rather than a directory only containing subpackages, docs, etc.).
+func hasPkgFiles(dir string) bool {
+	fis, err := modcache.ReadDir(dir)
+	if err != nil {
+		return false
+	}
+	for _, fi := range fis {
+		if !fi.IsDir() && isSourceFile(fi.Name()) {
+			return true
+		}
+	}
+	return false
+}
+
+var (
+	srcExtsMu sync.RWMutex
+	srcExts   = []string{".go", ".gop", ".gox"}
+)
+
+// RegisterSourceExt registers exts (eg. ".spx") of classfiles, so that a
+// directory containing such files is recognized as a package. Files of the
+// exts ".go", ".gop" and ".gox" (eg. "get_yap.gox") are always recognized.
+func RegisterSourceExt(exts ...string) {
+	srcExtsMu.Lock()
+	defer srcExtsMu.Unlock()
+	for _, ext := range exts {
+		if ext != "" && !isSourceFileLocked(ext) {
+			srcExts = append(srcExts, ext)
+		}
+	}
+}
+
+// isSourceFile checks if fname is a source file name, see RegisterSourceExt.
+func isSourceFile(fname string) bool {
+	srcExtsMu.RLock()
+	defer srcExtsMu.RUnlock()
+	return isSourceFileLocked(fname)
+}
+
+func isSourceFileLocked(fname string) bool {
+	for _, ext := range srcExts {
+		if strings.HasSuffix(fname, ext) {
+			return true
+		}
+	}
+	return false
 }
 
 // Split splits a pkgPath into modPath and its relPath to module root.
+// The module root is derived from well-known hosting rules (eg. github.com).
+// Split doesn't access the network: for other domains, pkgPath itself is
+// treated as the module path. Use SplitContext to discover their module roots.
 func Split(pkgPath, modBase string) (modPath, relPath string) {
+	return splitWith(pkgPath, modBase, nil)
+}
+
+// SplitContext is like Split but discovers the module root of pkgPath from the
+// network if the domain of pkgPath isn't a well-known hosting: from the module
+// proxy (trying at most a few prefixes of pkgPath, see maxModRootDepth), or
+// from <meta name="go-import"> tags if GOPROXY is direct. Nothing is looked up
+// if GOPROXY is off. Discovery is canceled by ctx, and it takes at most 30s.
+// Results are cached, so each module root is discovered only once. If the
+// module root can't be discovered, pkgPath itself is treated as the module path.
+func SplitContext(ctx context.Context, pkgPath, modBase string) (modPath, relPath string) {
+	return splitWith(pkgPath, modBase, func(path string) (string, bool) {
+		return lookupModRoot(ctx, path)
+	})
+}
+
+func splitWith(pkgPath, modBase string, lookup func(path string) (string, bool)) (modPath, relPath string) {
 	if modBase != "" && strings.HasPrefix(pkgPath, modBase) {
 		n := len(modBase)
 		if len(pkgPath) == n {
@@ -132,27 +340,29 @@ func Split(pkgPath, modBase string) (modPath, relPath string) {
 			return modBase, pkgPath[n+1:]
 		}
 	}
-	parts := strings.SplitN(pkgPath, "/", 4)
+	parts := strings.SplitN(pkgPath, "/", 2)
 	if !strings.Contains(parts[0], ".") { // standard package
 		return "", pkgPath
 	}
 	switch parts[0] {
 	case ".", "..": // local package
 		return modBase, pkgPath
-	case "github.com", "golang.org":
-		if len(parts) > 3 {
-			relPath = parts[3]
-			if pos := strings.IndexByte(relPath, '@'); pos > 0 {
-				parts[2] += relPath[pos:]
-				relPath = relPath[:pos]
-			}
-			modPath = strings.Join(parts[:3], "/")
-		} else {
-			modPath = pkgPath
-		}
-		return
 	}
-	panic("TODO: modfetch.Split - unexpected pkgPath: " + pkgPath)
+	path, ver := pkgPath, ""
+	if pos := strings.IndexByte(path, '@'); pos > 0 {
+		path, ver = path[:pos], path[pos:]
+	}
+	modPath, ok := knownModRoot(path)
+	if !ok && lookup != nil {
+		modPath, ok = lookup(path)
+	}
+	if !ok {
+		modPath = path
+	}
+	if len(path) > len(modPath) {
+		relPath = path[len(modPath)+1:]
+	}
+	return modPath + ver, relPath
 }
 
 // -----------------------------------------------------------------------------
@@ -162,48 +372,77 @@ var (
 )
 
 // Get downloads a modPath to GOMODCACHE.
+//
+// Deprecated: Use GetContext instead.
 func Get(modPath string, noCache ...bool) (mod module.Version, err error) {
-	if debugVerbose {
-		log.Println("modfetch.Get", modPath)
+	return GetContext(context.Background(), modPath, noCache...)
+}
+
+// GetContext downloads a modPath to GOMODCACHE.
+// Canceling ctx kills the go command.
+func GetContext(ctx context.Context, modPath string, noCache ...bool) (mod module.Version, err error) {
+	mod, _, err = GetContextEx(ctx, modPath, noCache != nil && noCache[0])
+	return
+}
+
+// GetContextEx is like GetContext but it also reports how the module is
+// resolved. The version queries "upgrade" and "patch" are resolved as if the
+// module isn't required, use GetQueryContext to specify the current version.
+func GetContextEx(ctx context.Context, modPath string, noCache bool) (mod module.Version, rep Report, err error) {
+	if pos := strings.IndexByte(modPath, '@'); pos > 0 && IsUpgradeQuery(modPath[pos+1:]) {
+		return GetQueryContext(ctx, modPath, "", noCache)
 	}
+	defer func() {
+		if err == nil {
+			recordResolution(modPath, mod, "", rep)
+		}
+	}()
+	logDebug("modfetch.Get", Field{"module", modPath})
 	if modPath == "" {
 		err = errEmptyModPath
 		return
 	}
-	if noCache == nil || !noCache[0] {
+	if !noCache {
 		mod, err = getFromCache(modPath)
 		if err != xmod.ErrNotFound {
+			rep.Strategy = StrategyCache
 			return
 		}
 	}
+	if !GoCommandEnabled() {
+		return getFromProxy(ctx, modPath)
+	}
+	rep = goCommandReport(modPath)
 	var stdout, stderr bytes.Buffer
 	var modPathVer = modPath
 	if strings.IndexByte(modPath, '@') < 0 {
 		modPathVer += "@latest"
 	}
-	cmd := exec.Command("go", "get", modPathVer)
-	if debugVerbose {
-		log.Println("==>", cmd)
-	}
+	cmd := exec.CommandContext(ctx, "go", "get", modPathVer)
+	cmd.Env = goEnv(modPath)
+	logDebug("exec", Field{"cmd", cmd.String()})
 	cmd.Stdout = &stdout
 	cmd.Stderr = &stderr
+	hookExec(cmd)
 	cmd.Run()
+	if err = ctx.Err(); err != nil {
+		return
+	}
 	if stderr.Len() > 0 {
 		mod, err = getResult(stderr.String())
 		if err != xmod.ErrNotFound {
-			if debugVerbose {
-				log.Println("modfetch.Get ret:", err)
-			}
+			logDebug("modfetch.Get done", append([]Field{
+				{"module", mod.Path}, {"version", mod.Version},
+			}, errField(err)...)...)
 			return
 		}
 	}
-	return getFromCache(modPath)
+	mod, err = getFromCache(modPath)
+	return
 }
 
 func getResult(data string) (mod module.Version, err error) {
-	if debugVerbose {
-		log.Println("modfetch.getResult:", data)
-	}
+	logDebug("go get output", Field{"output", data})
 	// go: downloading github.com/xushiwei/foogop v0.1.0
 	const downloading = "go: downloading "
 	if strings.HasPrefix(data, downloading) {
@@ -239,6 +478,9 @@ func getFromCache(modPath string) (modVer module.Version, err error) {
 }
 
 func lookupFromCache(modPath string) (modRoot string, mod module.Version, err error) {
+	defer func() {
+		hookCache(modPath, err)
+	}()
 	mod.Path = modPath
 	pos := strings.IndexByte(modPath, '@')
 	if pos > 0 {
@@ -250,14 +492,13 @@ func lookupFromCache(modPath string) (modRoot string, mod module.Version, err er
 	}
 	modRoot = filepath.Join(modcache.GOMODCACHE, encPath+"@"+mod.Version)
 	if pos > 0 { // has version
-		fi, e := os.Stat(modRoot)
-		if e != nil || !fi.IsDir() {
+		if !modcache.Complete(mod) {
 			err = xmod.ErrNotFound
 		}
 		return
 	}
 	dir, fname := filepath.Split(modRoot)
-	fis, err := os.ReadDir(dir)
+	fis, err := modcache.ReadDir(dir)
 	if err != nil {
 		err = errors.Unwrap(err)
 		return
@@ -267,7 +508,7 @@ func lookupFromCache(modPath string) (modRoot string, mod module.Version, err er
 		if fi.IsDir() {
 			if name := fi.Name(); strings.HasPrefix(name, fname) {
 				ver := name[len(fname):]
-				if semver.Compare(mod.Version, ver) < 0 {
+				if semver.Compare(mod.Version, ver) < 0 && modcache.Complete(module.Version{Path: mod.Path, Version: ver}) {
 					modRoot, mod.Version, err = dir+name, ver, nil
 				}
 			}
@@ -307,15 +548,15 @@ func foundBestRepo(data string, pkgPath string) (proxy string, best string, foun
 	return
 }
 
-func foundRevInfo(proxy string, pkg string, rev string) (*RevInfo, error) {
+func foundRevInfo(ctx context.Context, proxy string, pkg string, rev string) (*RevInfo, error) {
 	repo, err := newProxyRepo(proxy, pkg)
 	if err != nil {
 		return nil, err
 	}
 	if rev == "latest" {
-		return repo.Latest(context.Background())
+		return repo.Latest(ctx)
 	}
-	return repo.Stat(context.Background(), rev)
+	return repo.Stat(ctx, rev)
 }
 
 // -----------------------------------------------------------------------------
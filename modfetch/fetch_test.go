@@ -0,0 +1,209 @@
+/*
+ * Copyright (c) 2024 The GoPlus Authors (goplus.org). All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package modfetch
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/goplus/mod/modcache"
+	"golang.org/x/mod/module"
+)
+
+func TestParseAmbiguous(t *testing.T) {
+	const stderr = `go: downloading example.com/a v1.0.0
+ambiguous import: found package example.com/a/b in multiple modules:
+	example.com/a v1.0.0 (/path/to/example.com/a@v1.0.0/b)
+	example.com/a/b v0.1.0 (/path/to/example.com/a/b@v0.1.0)
+	example.com/a/b/c (/path/to/local)
+`
+	e := parseAmbiguous(stderr, "example.com/a/b")
+	if e == nil || len(e.Mods) != 3 || e.Mods[0] != (module.Version{Path: "example.com/a", Version: "v1.0.0"}) ||
+		e.Mods[2] != (module.Version{Path: "example.com/a/b/c"}) {
+		t.Fatal("parseAmbiguous:", e)
+	}
+	if v := e.Error(); v != `ambiguous import: found package example.com/a/b in multiple modules:
+	example.com/a v1.0.0
+	example.com/a/b v0.1.0
+	example.com/a/b/c` {
+		t.Fatal("AmbiguousError:", v)
+	}
+	for _, data := range []string{
+		"",
+		"ambiguous import: found package example.com/x in multiple modules:\n\texample.com/a v1.0.0\n\texample.com/b v1.0.0\n",
+		"ambiguous import: found package example.com/a/b in multiple modules:\n\texample.com/a v1.0.0\n",
+	} {
+		if e := parseAmbiguous(data, "example.com/a/b"); e != nil {
+			t.Fatal("parseAmbiguous:", data, e)
+		}
+	}
+}
+
+func TestAmbiguousFromCache(t *testing.T) {
+	cache := modcache.GOMODCACHE
+	defer func() {
+		modcache.GOMODCACHE = cache
+	}()
+	modcache.GOMODCACHE = t.TempDir()
+	for _, file := range []string{
+		"example.com/a@v1.0.0/b/b.go",
+		"example.com/a@v1.0.0/c/c.go",
+		"example.com/a@v1.0.0/d/e/e.go",
+		"example.com/a/b@v1.0.0/b.go",
+		"example.com/a/d@v1.0.0/go.mod",
+	} {
+		path := filepath.Join(modcache.GOMODCACHE, file)
+		os.MkdirAll(filepath.Dir(path), 0777)
+		os.WriteFile(path, []byte("package x\n"), 0666)
+	}
+
+	_, _, err := lookupListFromCache("example.com/a/b", "@v1.0.0")
+	var e *AmbiguousError
+	if !errors.As(err, &e) || len(e.Mods) != 2 || e.Mods[0].Path != "example.com/a/b" || e.Mods[1].Path != "example.com/a" {
+		t.Fatal("lookupListFromCache ambiguous:", err)
+	}
+	if _, _, err = GetPkgContext(context.Background(), "example.com/a/b@v1.0.0", ""); !errors.As(err, &e) {
+		t.Fatal("GetPkgContext ambiguous:", err)
+	}
+	mod, relPath, err := lookupListFromCache("example.com/a/c", "@v1.0.0")
+	if err != nil || mod.Path != "example.com/a" || relPath != "c" {
+		t.Fatal("lookupListFromCache:", mod, relPath, err)
+	}
+	// a directory only containing docs isn't a package
+	for _, file := range []string{
+		"example.com/r@v1.0.0/go.mod",
+		"example.com/r@v1.0.0/x/README.md",
+		"example.com/r@v1.0.0/x/LICENSE.txt",
+		"example.com/r@v1.0.0/x/.gitignore",
+		"example.com/r/x@v1.0.0/x.go",
+	} {
+		path := filepath.Join(modcache.GOMODCACHE, file)
+		os.MkdirAll(filepath.Dir(path), 0777)
+		os.WriteFile(path, []byte("package x\n"), 0666)
+	}
+	if mod, _, err := lookupListFromCache("example.com/r/x", "@v1.0.0"); err != nil || mod.Path != "example.com/r/x" {
+		t.Fatal("lookupListFromCache README only:", mod, err)
+	}
+	if hasPkgFiles(filepath.Join(modcache.GOMODCACHE, "example.com/r@v1.0.0/x")) {
+		t.Fatal("hasPkgFiles: README only")
+	}
+	os.WriteFile(filepath.Join(modcache.GOMODCACHE, "example.com/r@v1.0.0/x/main.spx"), nil, 0666)
+	if hasPkgFiles(filepath.Join(modcache.GOMODCACHE, "example.com/r@v1.0.0/x")) {
+		t.Fatal("hasPkgFiles: unregistered classfile ext")
+	}
+	RegisterSourceExt(".spx")
+	if !hasPkgFiles(filepath.Join(modcache.GOMODCACHE, "example.com/r@v1.0.0/x")) {
+		t.Fatal("hasPkgFiles: registered classfile ext")
+	}
+
+	// the innermost module example.com/a/d doesn't contain example.com/a/d/e
+	_, _, err = lookupListFromCache("example.com/a/d/e", "@v1.0.0")
+	if err == nil || !strings.Contains(err.Error(), "does not contain package") {
+		t.Fatal("lookupListFromCache:", err)
+	}
+}
+
+func TestResolutionLog(t *testing.T) {
+	cache := modcache.GOMODCACHE
+	defer func() {
+		modcache.GOMODCACHE = cache
+		SetResolutionLog(nil)
+	}()
+	modcache.GOMODCACHE = t.TempDir()
+	download := filepath.Join(modcache.GOMODCACHE, "cache", "download", "example.com", "foo", "@v")
+	os.MkdirAll(download, 0777)
+	os.WriteFile(filepath.Join(download, "v1.0.0.ziphash"), []byte("h1:zip=\n"), 0666)
+	os.WriteFile(filepath.Join(download, "v1.0.0.mod"), []byte("module example.com/foo\n"), 0666)
+	os.MkdirAll(filepath.Join(modcache.GOMODCACHE, "example.com", "foo@v1.0.0", "sub"), 0777)
+	os.WriteFile(filepath.Join(modcache.GOMODCACHE, "example.com", "foo@v1.0.0", "sub", "a.go"), []byte("package sub\n"), 0666)
+
+	log := NewResolutionLog()
+	SetResolutionLog(log)
+	ctx := context.Background()
+	if _, err := GetContext(ctx, "example.com/foo@v1.0.0"); err != nil {
+		t.Fatal("GetContext:", err)
+	}
+	if _, _, err := GetPkgContext(ctx, "example.com/foo/sub@v1.0.0", ""); err != nil {
+		t.Fatal("GetPkgContext:", err)
+	}
+	ret := log.Resolutions()
+	want := []Resolution{
+		{Request: "example.com/foo/sub@v1.0.0", Path: "example.com/foo", Version: "v1.0.0", RelPath: "sub", Strategy: StrategyCache,
+			Hash: "h1:zip=", GoModHash: "h1:tJ2YS1a8pyA3nrypRdbsq6Ias2I/0YUVbjNBUoLstcw="},
+		{Request: "example.com/foo@v1.0.0", Path: "example.com/foo", Version: "v1.0.0", Strategy: StrategyCache,
+			Hash: "h1:zip=", GoModHash: "h1:tJ2YS1a8pyA3nrypRdbsq6Ias2I/0YUVbjNBUoLstcw="},
+	}
+	if len(ret) != 2 || ret[0] != want[0] || ret[1] != want[1] {
+		t.Fatal("Resolutions:", ret)
+	}
+
+	var b strings.Builder
+	if err := log.WriteJSON(&b); err != nil {
+		t.Fatal("WriteJSON:", err)
+	}
+	if !strings.Contains(b.String(), `"strategy": "cache"`) {
+		t.Fatal("WriteJSON:", b.String())
+	}
+	read, err := ReadResolutions(strings.NewReader(b.String()))
+	if err != nil || len(read) != 2 || read[0] != want[0] || read[1] != want[1] {
+		t.Fatal("ReadResolutions:", read, err)
+	}
+}
+
+func TestGetContextCanceled(t *testing.T) {
+	cache := modcache.GOMODCACHE
+	defer func() {
+		modcache.GOMODCACHE = cache
+		SetGoCommandEnabled(true)
+	}()
+	modcache.GOMODCACHE = t.TempDir()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := GetContext(ctx, "example.com/foo@v1.0.0"); err != context.Canceled {
+		t.Fatal("GetContext canceled:", err)
+	}
+	if _, _, err := GetPkgContext(ctx, "example.com/foo/bar@v1.0.0", ""); err != context.Canceled {
+		t.Fatal("GetPkgContext canceled:", err)
+	}
+
+	done := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select { // a stalled proxy
+		case <-r.Context().Done():
+		case <-done:
+		}
+	}))
+	defer ts.Close()
+	defer close(done)
+	t.Setenv("GOPROXY", ts.URL)
+	t.Setenv("GOFLAGS", "")
+	SetGoCommandEnabled(false)
+
+	ctx, cancel = context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := GetContext(ctx, "example.com/foo@v1.0.0"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatal("GetContext deadline:", err)
+	}
+}
@@ -0,0 +1,115 @@
+/*
+ * Copyright (c) 2024 The GoPlus Authors (goplus.org). All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package modfetch
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/goplus/mod/modcache"
+	"golang.org/x/mod/module"
+
+	gomodfile "golang.org/x/mod/modfile"
+)
+
+// -----------------------------------------------------------------------------
+
+// A ModulePathError is returned by LoadGoMod if go.mod of a module version
+// declares another module path.
+type ModulePathError struct {
+	Mod      module.Version
+	Declared string // module path declared by go.mod, empty if there is no module directive
+}
+
+func (e *ModulePathError) Error() string {
+	if e.Declared == "" {
+		return fmt.Sprintf("%v: go.mod has no module directive", e.Mod)
+	}
+	return fmt.Sprintf("%v: go.mod declares its path as %s, but was required as %s", e.Mod, e.Declared, e.Mod.Path)
+}
+
+var gomods struct {
+	mu    sync.Mutex
+	files map[module.Version]*gomodfile.File
+}
+
+// LoadGoMod returns the parsed go.mod file of a versioned module. go.mod is
+// read from GOMODCACHE if it's there, or fetched from the module proxy (see
+// ProxyURLFor) otherwise. It checks the module path declared by go.mod, and
+// returns a *ModulePathError if it doesn't match mod.Path.
+//
+// Parsed files are cached in memory by module version, so the result is
+// shared and must not be modified.
+func LoadGoMod(ctx context.Context, mod module.Version) (*gomodfile.File, error) {
+	gomods.mu.Lock()
+	f, ok := gomods.files[mod]
+	gomods.mu.Unlock()
+	if ok {
+		return f, nil
+	}
+	data, err := readGoMod(ctx, mod)
+	if err != nil {
+		return nil, err
+	}
+	if f, err = parseGoMod(mod, data); err != nil {
+		return nil, err
+	}
+	gomods.mu.Lock()
+	defer gomods.mu.Unlock()
+	if gomods.files == nil {
+		gomods.files = make(map[module.Version]*gomodfile.File)
+	}
+	gomods.files[mod] = f
+	return f, nil
+}
+
+func readGoMod(ctx context.Context, mod module.Version) ([]byte, error) {
+	if zipFile, err := modcache.DownloadCachePath(mod); err == nil {
+		if data, err := modcache.ReadFile(strings.TrimSuffix(zipFile, ".zip") + ".mod"); err == nil {
+			return data, nil
+		}
+	}
+	proxy, err := ProxyURLFor(mod.Path)
+	if err != nil {
+		return nil, err
+	}
+	repo, err := newProxyRepo(proxy, mod.Path)
+	if err != nil {
+		return nil, err
+	}
+	return repo.GoMod(ctx, mod.Version)
+}
+
+// parseGoMod parses go.mod of mod and checks its module path.
+func parseGoMod(mod module.Version, data []byte) (*gomodfile.File, error) {
+	f, err := gomodfile.ParseLax(mod.String()+"/go.mod", data, nil)
+	if err != nil {
+		return nil, err
+	}
+	declared := ""
+	if f.Module != nil {
+		declared = f.Module.Mod.Path
+	}
+	if declared != mod.Path {
+		return nil, &ModulePathError{Mod: mod, Declared: declared}
+	}
+	return f, nil
+}
+
+// -----------------------------------------------------------------------------
@@ -0,0 +1,50 @@
+/*
+ * Copyright (c) 2024 The GoPlus Authors (goplus.org). All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package modfetch
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"testing/fstest"
+
+	"github.com/goplus/mod/modcache"
+	"golang.org/x/mod/module"
+)
+
+func TestLoadGoMod(t *testing.T) {
+	modcache.SetFS(fstest.MapFS{
+		"cache/download/example.com/foo/@v/v1.0.0.mod": {Data: []byte("module example.com/foo\n\ngo 1.21\n")},
+		"cache/download/example.com/bar/@v/v1.0.0.mod": {Data: []byte("module example.com/baz\n")},
+	})
+	defer modcache.SetFS(nil)
+
+	ctx := context.Background()
+	foo := module.Version{Path: "example.com/foo", Version: "v1.0.0"}
+	f, err := LoadGoMod(ctx, foo)
+	if err != nil || f.Go.Version != "1.21" {
+		t.Fatal("LoadGoMod:", err)
+	}
+	if f2, err := LoadGoMod(ctx, foo); err != nil || f2 != f {
+		t.Fatal("LoadGoMod: not cached", err)
+	}
+	_, err = LoadGoMod(ctx, module.Version{Path: "example.com/bar", Version: "v1.0.0"})
+	var e *ModulePathError
+	if !errors.As(err, &e) || e.Declared != "example.com/baz" {
+		t.Fatal("LoadGoMod bar:", err)
+	}
+}
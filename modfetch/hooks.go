@@ -0,0 +1,82 @@
+/*
+ * Copyright (c) 2024 The GoPlus Authors (goplus.org). All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package modfetch
+
+import (
+	"net/http"
+	"os/exec"
+	"time"
+)
+
+// -----------------------------------------------------------------------------
+
+// Hooks are callbacks invoked during module resolution, so that integrators
+// can attach tracing or metrics. Any of them can be nil.
+type Hooks struct {
+	// OnRequestStart is called before sending a request to a module proxy.
+	OnRequestStart func(req *http.Request)
+
+	// OnRequestEnd is called after a request to a module proxy is done.
+	// resp is nil if err is not nil.
+	OnRequestEnd func(req *http.Request, resp *http.Response, err error, elapsed time.Duration)
+
+	// OnCacheHit is called when modPath (maybe with @version) is found in GOMODCACHE.
+	OnCacheHit func(modPath string)
+
+	// OnCacheMiss is called when modPath (maybe with @version) isn't found in GOMODCACHE.
+	OnCacheMiss func(modPath string)
+
+	// OnExec is called before running a go command.
+	OnExec func(cmd *exec.Cmd)
+}
+
+var hooks Hooks
+
+// SetHooks sets hooks invoked during module resolution.
+func SetHooks(h Hooks) {
+	hooks = h
+}
+
+func hookRequestStart(req *http.Request) {
+	if fn := hooks.OnRequestStart; fn != nil {
+		fn(req)
+	}
+}
+
+func hookRequestEnd(req *http.Request, resp *http.Response, err error, start time.Time) {
+	if fn := hooks.OnRequestEnd; fn != nil {
+		fn(req, resp, err, time.Since(start))
+	}
+}
+
+func hookCache(modPath string, err error) {
+	if err == nil {
+		if fn := hooks.OnCacheHit; fn != nil {
+			fn(modPath)
+		}
+	} else if fn := hooks.OnCacheMiss; fn != nil {
+		fn(modPath)
+	}
+}
+
+func hookExec(cmd *exec.Cmd) {
+	if fn := hooks.OnExec; fn != nil {
+		fn(cmd)
+	}
+}
+
+// -----------------------------------------------------------------------------
@@ -0,0 +1,81 @@
+/*
+ * Copyright (c) 2024 The GoPlus Authors (goplus.org). All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package modfetch
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/goplus/mod/modcache"
+)
+
+func TestHooks(t *testing.T) {
+	cache := modcache.GOMODCACHE
+	defer func() {
+		modcache.GOMODCACHE = cache
+		SetHooks(Hooks{})
+	}()
+	modcache.GOMODCACHE = t.TempDir()
+	os.MkdirAll(filepath.Join(modcache.GOMODCACHE, "example.com", "foo@v1.0.0"), 0777)
+
+	var events []string
+	SetHooks(Hooks{
+		OnRequestStart: func(req *http.Request) {
+			events = append(events, "start "+req.URL.Path)
+		},
+		OnRequestEnd: func(req *http.Request, resp *http.Response, err error, elapsed time.Duration) {
+			if err == nil && elapsed >= 0 {
+				events = append(events, "end "+resp.Status)
+			}
+		},
+		OnCacheHit: func(modPath string) {
+			events = append(events, "hit "+modPath)
+		},
+		OnCacheMiss: func(modPath string) {
+			events = append(events, "miss "+modPath)
+		},
+		OnExec: func(cmd *exec.Cmd) {
+			events = append(events, "exec "+strings.Join(cmd.Args, " "))
+		},
+	})
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("v1.0.0\n"))
+	}))
+	defer ts.Close()
+	repo, err := newProxyRepo(ts.URL, "example.com/foo")
+	if err != nil {
+		t.Fatal("newProxyRepo:", err)
+	}
+	if _, err = repo.Versions(context.Background(), ""); err != nil {
+		t.Fatal("Versions:", err)
+	}
+	getFromCache("example.com/foo@v1.0.0")
+	getFromCache("example.com/bar@v1.0.0")
+	hookExec(exec.Command("go", "version"))
+	if v := strings.Join(events, "; "); v != "start /example.com/foo/@v/list; end 200 OK; "+
+		"hit example.com/foo@v1.0.0; miss example.com/bar@v1.0.0; exec go version" {
+		t.Fatal("events:", v)
+	}
+}
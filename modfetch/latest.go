@@ -0,0 +1,217 @@
+/*
+ * Copyright (c) 2024 The GoPlus Authors (goplus.org). All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package modfetch
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/mod/module"
+	"golang.org/x/mod/semver"
+)
+
+// -----------------------------------------------------------------------------
+
+// A VersionInfo is a version of a module, with its commit (or publish) time if
+// known.
+type VersionInfo struct {
+	Version string
+	Time    time.Time // zero if unknown
+}
+
+// SelectOptions specifies the policy of SelectLatest.
+type SelectOptions struct {
+	// Allowed reports whether a version can be selected at all, eg. it isn't
+	// excluded by go.mod. All versions are allowed if it is nil.
+	Allowed func(version string) bool
+
+	// Retracted reports whether a version is retracted. Retracted versions are
+	// selected only if all allowed versions are retracted.
+	Retracted func(version string) bool
+}
+
+// SelectLatest selects the best version as "latest" from versions, using the
+// same policy as the go command:
+//   - the highest release version, if any;
+//   - otherwise, the highest pre-release version, if any;
+//   - otherwise, the pseudo-version of the newest commit. The commit time is
+//     Time of a version if it's known, or derived from the pseudo-version.
+//
+// Invalid or non-canonical versions are ignored. opts can be nil.
+func SelectLatest(versions []VersionInfo, opts *SelectOptions) (latest VersionInfo, ok bool) {
+	if opts == nil {
+		opts = new(SelectOptions)
+	}
+	allowed := versions[:0:0]
+	for _, v := range versions {
+		if v.Version == module.CanonicalVersion(v.Version) && v.Version != "" && (opts.Allowed == nil || opts.Allowed(v.Version)) {
+			allowed = append(allowed, v)
+		}
+	}
+	if opts.Retracted != nil {
+		var kept []VersionInfo
+		for _, v := range allowed {
+			if !opts.Retracted(v.Version) {
+				kept = append(kept, v)
+			}
+		}
+		if kept != nil {
+			allowed = kept
+		}
+	}
+	var release, prerelease VersionInfo
+	for _, v := range allowed {
+		switch {
+		case module.IsPseudoVersion(v.Version):
+		case semver.Prerelease(v.Version) == "":
+			if release.Version == "" || semver.Compare(v.Version, release.Version) > 0 {
+				release = v
+			}
+		default:
+			if prerelease.Version == "" || semver.Compare(v.Version, prerelease.Version) > 0 {
+				prerelease = v
+			}
+		}
+	}
+	if release.Version != "" {
+		return release, true
+	}
+	if prerelease.Version != "" {
+		return prerelease, true
+	}
+	return latestByTime(allowed)
+}
+
+// latestByTime selects the newest version by commit time. The commit time of
+// a version is its Time, or derived from it if it's a pseudo-version. Versions
+// without a known time are ignored.
+func latestByTime(versions []VersionInfo) (latest VersionInfo, ok bool) {
+	var bestTime time.Time
+	for _, v := range versions {
+		t := v.Time
+		if t.IsZero() && module.IsPseudoVersion(v.Version) {
+			t, _ = module.PseudoVersionTime(v.Version)
+		}
+		if t.IsZero() {
+			continue
+		}
+		if bestTime.Before(t) || (t.Equal(bestTime) && semver.Compare(v.Version, latest.Version) > 0) {
+			bestTime, latest, ok = t, v, true
+		}
+	}
+	return
+}
+
+// -----------------------------------------------------------------------------
+
+// LatestConcurrency is the maximum number of concurrent queries of LatestAll.
+const LatestConcurrency = 8
+
+// A LatestResult is the latest version of a module reported by LatestAll.
+type LatestResult struct {
+	Path    string
+	Current string    // the current version (empty if it isn't specified)
+	Latest  string    // the latest version (empty if Err isn't nil)
+	Time    time.Time // commit time of Latest (zero if unknown)
+	Err     error
+}
+
+// Outdated reports whether the latest version is higher than the current one.
+func (p *LatestResult) Outdated() bool {
+	return p.Err == nil && p.Current != "" && semver.Compare(p.Latest, p.Current) > 0
+}
+
+// LatestAll queries the latest versions of modules mods concurrently (at most
+// LatestConcurrency queries at a time), eg. for a `gop mod outdated` command.
+// Each item of mods is a module path, or path@version where version is the
+// current version of the module. The latest version is queried by @latest of
+// the module proxy (see ProxyURLFor), falling back to the versions of @v/list
+// (see SelectLatest) if the proxy doesn't support @latest. Results are in the order of mods, and errors are
+// reported per module.
+func LatestAll(ctx context.Context, mods []string) []LatestResult {
+	ret := make([]LatestResult, len(mods))
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, LatestConcurrency)
+	for i, mod := range mods {
+		r := &ret[i]
+		r.Path = mod
+		if pos := strings.IndexByte(mod, '@'); pos >= 0 {
+			r.Path, r.Current = mod[:pos], mod[pos+1:]
+		}
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			r.Latest, r.Time, r.Err = latestOf(ctx, r.Path)
+		}()
+	}
+	wg.Wait()
+	return ret
+}
+
+func latestOf(ctx context.Context, path string) (ver string, t time.Time, err error) {
+	if err = module.CheckPath(path); err != nil {
+		return
+	}
+	proxy, err := ProxyURLFor(path)
+	if err != nil {
+		return
+	}
+	repo, err := newProxyRepo(proxy, path)
+	if err != nil {
+		return
+	}
+	data, err := repo.getBytes(ctx, "@latest")
+	if err == nil {
+		info := new(RevInfo)
+		if err = json.Unmarshal(data, info); err != nil {
+			err = repo.versionError("", fmt.Errorf("invalid response from proxy %q: %w", repo.redactedURL, err))
+			return
+		}
+		return info.Version, info.Time, nil
+	}
+	if !errors.Is(err, fs.ErrNotExist) {
+		return "", t, repo.versionError("", err)
+	}
+	vers, err := repo.Versions(ctx, "")
+	if err != nil {
+		return
+	}
+	infos := make([]VersionInfo, len(vers.List))
+	for i, v := range vers.List {
+		infos[i] = VersionInfo{Version: v, Time: vers.Time[v]}
+	}
+	if latest, ok := SelectLatest(infos, nil); ok {
+		return latest.Version, latest.Time, nil
+	}
+	info, err := repo.latest(ctx) // no tagged versions
+	if err != nil {
+		return
+	}
+	return info.Version, info.Time, nil
+}
+
+// -----------------------------------------------------------------------------
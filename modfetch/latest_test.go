@@ -0,0 +1,150 @@
+/*
+ * Copyright (c) 2024 The GoPlus Authors (goplus.org). All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package modfetch
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestSelectLatest(t *testing.T) {
+	t1 := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	t2 := time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)
+	vers := func(list ...string) []VersionInfo {
+		ret := make([]VersionInfo, len(list))
+		for i, v := range list {
+			ret[i] = VersionInfo{Version: v}
+		}
+		return ret
+	}
+	retracted := func(list ...string) *SelectOptions {
+		return &SelectOptions{Retracted: func(v string) bool {
+			for _, r := range list {
+				if r == v {
+					return true
+				}
+			}
+			return false
+		}}
+	}
+	tests := []struct {
+		name     string
+		versions []VersionInfo
+		opts     *SelectOptions
+		want     string
+	}{
+		{"release", vers("v1.0.0", "v1.2.0", "v1.10.0-rc1", "v1.1.0"), nil, "v1.2.0"},
+		{"prerelease", vers("v1.0.0-rc1", "v1.0.0-rc2", "v0.0.0-20240101000000-abcdefabcdef"), nil, "v1.0.0-rc2"},
+		{"pseudo", vers("v0.0.0-20240101000000-abcdefabcdef", "v0.0.0-20240201000000-abcdefabcdef", "bad"), nil, "v0.0.0-20240201000000-abcdefabcdef"},
+		{"timestamp", []VersionInfo{
+			{Version: "v0.0.0-20240301000000-abcdefabcdef", Time: t1},
+			{Version: "v0.0.0-20240101000000-abcdefabcdef", Time: t2},
+		}, nil, "v0.0.0-20240101000000-abcdefabcdef"},
+		{"retracted", vers("v1.0.0", "v1.1.0", "v1.2.0-rc1"), retracted("v1.1.0"), "v1.0.0"},
+		{"retracted-prerelease", vers("v1.0.0-rc1", "v1.0.0-rc2"), retracted("v1.0.0-rc2"), "v1.0.0-rc1"},
+		{"all-retracted", vers("v1.0.0", "v1.1.0"), retracted("v1.0.0", "v1.1.0"), "v1.1.0"},
+		{"allowed", vers("v1.0.0", "v1.1.0"), &SelectOptions{Allowed: func(v string) bool { return v != "v1.1.0" }}, "v1.0.0"},
+		{"none", vers("bad", "v1"), nil, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := SelectLatest(tt.versions, tt.opts)
+			if got.Version != tt.want || ok != (tt.want != "") {
+				t.Fatal("SelectLatest:", got, ok)
+			}
+		})
+	}
+}
+
+func TestResolveQuery(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/example.com/foo/@v/list":
+			w.Write([]byte("v1.0.0\nv1.0.1\nv1.1.0\nv1.1.2\nv1.2.0-rc1\n"))
+		case "/example.com/bar/@v/list":
+			w.Write(nil)
+		case "/example.com/bar/@latest":
+			w.Write([]byte(`{"Version":"v0.0.0-20240101000000-abcdefabcdef"}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+	t.Setenv("GOPROXY", ts.URL)
+
+	ctx := context.Background()
+	cases := []struct {
+		path, query, current, want string
+	}{
+		{"example.com/foo", "upgrade", "", "v1.1.2"},
+		{"example.com/foo", "upgrade", "v1.0.0", "v1.1.2"},
+		{"example.com/foo", "upgrade", "v1.2.0-rc1", "v1.2.0-rc1"},
+		{"example.com/foo", "patch", "v1.0.0", "v1.0.1"},
+		{"example.com/foo", "patch", "v1.1.0", "v1.1.2"},
+		{"example.com/foo", "patch", "v1.3.0", "v1.3.0"},
+		{"example.com/foo", "patch", "", "v1.1.2"},
+		{"example.com/bar", "upgrade", "", "v0.0.0-20240101000000-abcdefabcdef"},
+	}
+	for _, c := range cases {
+		if ver, err := ResolveQuery(ctx, c.path, c.query, c.current); err != nil || ver != c.want {
+			t.Fatal("ResolveQuery:", c, ver, err)
+		}
+	}
+	if _, err := ResolveQuery(ctx, "example.com/foo", "latest", ""); err == nil {
+		t.Fatal("ResolveQuery latest: no error")
+	}
+	if _, err := ResolveQuery(ctx, "example.com/foo", "patch", "1.0"); err == nil {
+		t.Fatal("ResolveQuery invalid current: no error")
+	}
+}
+
+func TestLatestAll(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/example.com/foo/@latest":
+			w.Write([]byte(`{"Version":"v1.2.0","Time":"2024-01-01T00:00:00Z"}`))
+		case "/example.com/bar/@v/list":
+			w.Write([]byte("v0.1.0\nv0.2.0\n"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+	t.Setenv("GOPROXY", ts.URL)
+
+	ret := LatestAll(context.Background(), []string{
+		"example.com/foo@v1.0.0", "example.com/bar@v0.2.0", "example.com/baz", "example.com/foo",
+	})
+	if len(ret) != 4 {
+		t.Fatal("LatestAll:", ret)
+	}
+	if r := ret[0]; r.Path != "example.com/foo" || r.Current != "v1.0.0" || r.Latest != "v1.2.0" || r.Time.Year() != 2024 || !r.Outdated() {
+		t.Fatal("LatestAll foo:", r)
+	}
+	if r := ret[1]; r.Latest != "v0.2.0" || r.Err != nil || r.Outdated() {
+		t.Fatal("LatestAll bar:", r)
+	}
+	if r := ret[2]; r.Path != "example.com/baz" || r.Err == nil || r.Outdated() {
+		t.Fatal("LatestAll baz:", r)
+	}
+	if r := ret[3]; r.Current != "" || r.Latest != "v1.2.0" || r.Outdated() {
+		t.Fatal("LatestAll foo (no current):", r)
+	}
+}
@@ -0,0 +1,135 @@
+/*
+ * Copyright (c) 2024 The GoPlus Authors (goplus.org). All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package modfetch
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// -----------------------------------------------------------------------------
+
+// A LogLevel is the severity of a log record.
+type LogLevel int
+
+const (
+	LevelDebug LogLevel = iota // details of module resolution, eg. go commands to run
+	LevelInfo
+	LevelWarn
+	LevelError // eg. security errors of the checksum database
+)
+
+var levelNames = [...]string{
+	LevelDebug: "DEBUG",
+	LevelInfo:  "INFO",
+	LevelWarn:  "WARN",
+	LevelError: "ERROR",
+}
+
+func (l LogLevel) String() string {
+	if l >= 0 && int(l) < len(levelNames) {
+		return levelNames[l]
+	}
+	return "LogLevel(" + strconv.Itoa(int(l)) + ")"
+}
+
+// A Field is a key-value pair of a log record. Common keys are "module",
+// "version", "pkg", "proxy", "duration", "cmd" and "err".
+type Field struct {
+	Key   string
+	Value interface{}
+}
+
+// A Logger receives log records of module resolution, so that embedders can
+// route them into their own logging or telemetry system.
+type Logger interface {
+	Log(level LogLevel, msg string, fields ...Field)
+}
+
+// A LoggerFunc is a function which implements Logger.
+type LoggerFunc func(level LogLevel, msg string, fields ...Field)
+
+func (f LoggerFunc) Log(level LogLevel, msg string, fields ...Field) {
+	f(level, msg, fields...)
+}
+
+var (
+	loggerMu sync.RWMutex
+	logger   Logger // custom logger (nil if not set)
+)
+
+// SetLogger sets the logger of module resolution. If l is nil, the default
+// logger is used, which writes records with the standard log package: debug
+// records are written only if DbgFlagVerbose is set (see SetDebug).
+func SetLogger(l Logger) {
+	loggerMu.Lock()
+	defer loggerMu.Unlock()
+	logger = l
+}
+
+func logRecord(level LogLevel, msg string, fields ...Field) {
+	loggerMu.RLock()
+	l := logger
+	loggerMu.RUnlock()
+	if l != nil {
+		l.Log(level, msg, fields...)
+		return
+	}
+	if level == LevelDebug && !debugVerbose {
+		return
+	}
+	log.Println(formatRecord(level, msg, fields))
+}
+
+func logDebug(msg string, fields ...Field) {
+	logRecord(LevelDebug, msg, fields...)
+}
+
+// formatRecord formats a log record in the form of `msg key=value ...`,
+// prefixed by the level unless it's a debug or info record.
+func formatRecord(level LogLevel, msg string, fields []Field) string {
+	var b strings.Builder
+	if level >= LevelWarn {
+		b.WriteString(level.String())
+		b.WriteByte(' ')
+	}
+	b.WriteString(msg)
+	for _, f := range fields {
+		v := fmt.Sprint(f.Value)
+		if v == "" || strings.ContainsAny(v, " \t\n\"=") {
+			v = strconv.Quote(v)
+		}
+		b.WriteByte(' ')
+		b.WriteString(f.Key)
+		b.WriteByte('=')
+		b.WriteString(v)
+	}
+	return b.String()
+}
+
+// errField returns an "err" field of err, or nothing if err is nil.
+func errField(err error) []Field {
+	if err == nil {
+		return nil
+	}
+	return []Field{{"err", err}}
+}
+
+// -----------------------------------------------------------------------------
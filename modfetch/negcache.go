@@ -0,0 +1,194 @@
+/*
+ * Copyright (c) 2024 The GoPlus Authors (goplus.org). All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package modfetch
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	xmod "github.com/goplus/mod"
+)
+
+// -----------------------------------------------------------------------------
+
+// DefaultNegativeCacheTTL is a reasonable ttl for SetNegativeCache.
+const DefaultNegativeCacheTTL = time.Minute
+
+type negEntry struct {
+	expire time.Time
+	err    error
+}
+
+// negCache caches not-found lookups (keyed by pkgPath@ver) for a short time,
+// so repeated lookups of unresolvable packages don't hammer module proxies.
+// Other failures (network errors, ambiguous imports, etc.) are not cached.
+type negCache struct {
+	mu      sync.Mutex
+	entries map[string]negEntry
+	ttl     time.Duration
+	dir     string // optional on-disk cache directory
+}
+
+var negcache = new(negCache) // disabled by default
+
+// SetNegativeCache configures the cache of package lookups that failed because
+// the package was not found (the error is fs.ErrNotExist or xmod.ErrNotFound).
+// ttl is how long a failure is remembered, and ttl <= 0 (the default) disables
+// the cache. If dir is not empty, failures are also persisted in dir so that
+// they are shared between processes.
+func SetNegativeCache(ttl time.Duration, dir string) {
+	p := negcache
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.ttl, p.dir, p.entries = ttl, dir, nil
+}
+
+// ClearNegativeCache forgets all remembered failures (in memory and on disk).
+// Only the entry files written by the cache are removed from the cache
+// directory, the directory itself and other files in it are left in place.
+func ClearNegativeCache() {
+	p := negcache
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.entries = nil
+	if p.dir != "" {
+		p.removeFiles()
+	}
+}
+
+func (p *negCache) lookup(key string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.ttl <= 0 {
+		return nil
+	}
+	now := time.Now()
+	if e, ok := p.entries[key]; ok {
+		if now.Before(e.expire) {
+			return e.err
+		}
+		delete(p.entries, key)
+	}
+	if p.dir != "" {
+		if e, ok := p.readFile(key); ok && now.Before(e.expire) {
+			p.set(key, e)
+			return e.err
+		}
+	}
+	return nil
+}
+
+func (p *negCache) add(key string, err error) {
+	if !errors.Is(err, fs.ErrNotExist) {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.ttl <= 0 {
+		return
+	}
+	e := negEntry{expire: time.Now().Add(p.ttl), err: err}
+	p.set(key, e)
+	if p.dir != "" {
+		p.writeFile(key, e)
+	}
+}
+
+func (p *negCache) set(key string, e negEntry) {
+	if p.entries == nil {
+		p.entries = make(map[string]negEntry)
+	}
+	p.entries[key] = e
+}
+
+// negCacheExt is the extension of entry files in the on-disk cache.
+const negCacheExt = ".negcache"
+
+func (p *negCache) file(key string) string {
+	h := sha256.Sum256([]byte(key))
+	return filepath.Join(p.dir, hex.EncodeToString(h[:])+negCacheExt)
+}
+
+func (p *negCache) removeFiles() {
+	entries, err := os.ReadDir(p.dir)
+	if err != nil {
+		return
+	}
+	for _, e := range entries {
+		if name := e.Name(); !e.IsDir() && strings.HasSuffix(name, negCacheExt) {
+			os.Remove(filepath.Join(p.dir, name))
+		}
+	}
+}
+
+// notExistError is a not-found error loaded from the on-disk cache.
+type notExistError struct {
+	msg string
+}
+
+func (e *notExistError) Error() string {
+	return e.msg
+}
+
+func (e *notExistError) Is(target error) bool {
+	return target == fs.ErrNotExist
+}
+
+// on-disk format: "<expire unix nano>\n<error message>"
+// The error message is empty if the error is xmod.ErrNotFound, otherwise the
+// error is loaded as a *notExistError.
+func (p *negCache) writeFile(key string, e negEntry) {
+	msg := ""
+	if e.err != xmod.ErrNotFound {
+		msg = e.err.Error()
+	}
+	os.MkdirAll(p.dir, 0755)
+	data := strconv.FormatInt(e.expire.UnixNano(), 10) + "\n" + msg
+	os.WriteFile(p.file(key), []byte(data), 0644)
+}
+
+func (p *negCache) readFile(key string) (e negEntry, ok bool) {
+	b, err := os.ReadFile(p.file(key))
+	if err != nil {
+		return
+	}
+	parts := strings.SplitN(string(b), "\n", 2)
+	if len(parts) != 2 {
+		return
+	}
+	expire, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return
+	}
+	e.expire = time.Unix(0, expire)
+	if parts[1] == "" {
+		e.err = xmod.ErrNotFound
+	} else {
+		e.err = &notExistError{parts[1]}
+	}
+	return e, true
+}
+
+// -----------------------------------------------------------------------------
@@ -0,0 +1,108 @@
+/*
+ * Copyright (c) 2024 The GoPlus Authors (goplus.org). All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package modfetch
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	xmod "github.com/goplus/mod"
+)
+
+func TestNegCache(t *testing.T) {
+	p := new(negCache)
+	p.add("a@v1", xmod.ErrNotFound)
+	if err := p.lookup("a@v1"); err != nil {
+		t.Fatal("disabled cache:", err)
+	}
+
+	p.ttl = time.Hour
+	httpErr := &httpError{status: "410 Gone", statusCode: 410}
+	netErr := fmt.Errorf("dial tcp: connection refused")
+	p.add("a@v1", xmod.ErrNotFound)
+	p.add("b@v1", httpErr)
+	p.add("c@v1", netErr)
+	p.add("d@v1", &AmbiguousError{PkgPath: "d"})
+	if err := p.lookup("a@v1"); err != xmod.ErrNotFound {
+		t.Fatal("lookup a:", err)
+	}
+	if err := p.lookup("b@v1"); err != httpErr {
+		t.Fatal("lookup b:", err)
+	}
+	for _, key := range []string{"c@v1", "d@v1", "e@v1"} {
+		if err := p.lookup(key); err != nil {
+			t.Fatal("lookup", key, err)
+		}
+	}
+
+	p.entries["a@v1"] = negEntry{expire: time.Now().Add(-time.Second), err: xmod.ErrNotFound}
+	if err := p.lookup("a@v1"); err != nil {
+		t.Fatal("expired:", err)
+	}
+}
+
+func TestNegCacheDir(t *testing.T) {
+	dir := t.TempDir()
+	p := &negCache{ttl: time.Hour, dir: dir}
+	p.add("a@v1", xmod.ErrNotFound)
+	p.add("b@v1", &httpError{status: "404 Not Found", statusCode: 404})
+
+	// a new process shares the cache through dir
+	q := &negCache{ttl: time.Hour, dir: dir}
+	if err := q.lookup("a@v1"); err != xmod.ErrNotFound {
+		t.Fatal("lookup a:", err)
+	}
+	err := q.lookup("b@v1")
+	if !errors.Is(err, fs.ErrNotExist) || err.Error() != "reading: 404 Not Found" {
+		t.Fatal("lookup b:", err)
+	}
+	if err := q.lookup("c@v1"); err != nil {
+		t.Fatal("lookup c:", err)
+	}
+
+	q.writeFile("a@v1", negEntry{expire: time.Now().Add(-time.Second), err: xmod.ErrNotFound})
+	r := &negCache{ttl: time.Hour, dir: dir}
+	if err := r.lookup("a@v1"); err != nil {
+		t.Fatal("expired:", err)
+	}
+}
+
+func TestClearNegativeCache(t *testing.T) {
+	dir := t.TempDir()
+	other := filepath.Join(dir, "other.txt")
+	if err := os.WriteFile(other, []byte("keep"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	SetNegativeCache(time.Hour, dir)
+	defer SetNegativeCache(0, "")
+	negcache.add("a@v1", xmod.ErrNotFound)
+	ClearNegativeCache()
+	if err := negcache.lookup("a@v1"); err != nil {
+		t.Fatal("lookup after clear:", err)
+	}
+	if _, err := os.Stat(negcache.file("a@v1")); !os.IsNotExist(err) {
+		t.Fatal("entry file not removed:", err)
+	}
+	if _, err := os.Stat(other); err != nil {
+		t.Fatal("other file removed:", err)
+	}
+}
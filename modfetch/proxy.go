@@ -5,6 +5,7 @@
 package modfetch
 
 import (
+	"archive/zip"
 	"context"
 	"encoding/json"
 	"errors"
@@ -13,15 +14,60 @@ import (
 	"io/fs"
 	"net/http"
 	"net/url"
+	"os"
 	pathpkg "path"
+	"path/filepath"
+	"runtime"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"golang.org/x/mod/module"
 	"golang.org/x/mod/semver"
+	"golang.org/x/mod/sumdb/dirhash"
 )
 
+// An Origin describes the provenance of a given repo method result.
+// Caching layers can use it to check cheaply whether the result remains
+// up-to-date without downloading it again.
+type Origin struct {
+	VCS    string `json:",omitempty"` // "git" etc
+	URL    string `json:",omitempty"` // URL of repository
+	Subdir string `json:",omitempty"` // subdirectory in repo
+
+	// If TagSum is non-empty, then the resolution of this module version
+	// depends on the set of tags present in the repo, specifically the tags
+	// of the form TagPrefix + a valid semver version.
+	// If the matching repo tags and their commit hashes still hash to TagSum,
+	// the Origin is still valid (at least as far as the tags are concerned).
+	// The exact checksum is up to the proxy implementation.
+	TagPrefix string `json:",omitempty"`
+	TagSum    string `json:",omitempty"`
+
+	// If Ref is non-empty, then the resolution of this module version
+	// depends on Ref resolving to the revision identified by Hash.
+	// If Ref still resolves to Hash, the Origin is still valid (at least as far as Ref is concerned).
+	// For Git, the Ref is a full ref like "refs/heads/main" or "refs/tags/v1.2.3",
+	// and the Hash is the Git object hash the ref maps to.
+	// Other VCS might choose differently, but the idea is that Ref is the name
+	// with a mutable meaning while Hash is a name with an immutable meaning.
+	Ref  string `json:",omitempty"`
+	Hash string `json:",omitempty"`
+
+	// If RepoSum is non-empty, then the resolution of this module version
+	// failed due to the repo being available but the version not being present.
+	// This depends on the entire state of the repo, which RepoSum summarizes.
+	// For Git, this is a hash of all the refs and their hashes.
+	RepoSum string `json:",omitempty"`
+}
+
+// Checkable reports whether the Origin contains anything that can be checked.
+// If not, the Origin is purely informational.
+func (o *Origin) Checkable() bool {
+	return o != nil && (o.TagSum != "" || o.Ref != "" || o.Hash != "" || o.RepoSum != "")
+}
+
 // A RevInfo describes a single revision in a module repository.
 type RevInfo struct {
 	Version string    // suggested version string for this revision
@@ -31,11 +77,17 @@ type RevInfo struct {
 	// but they are not recorded when talking about module versions.
 	Name  string `json:"-"` // complete ID in underlying repository
 	Short string `json:"-"` // shortened ID, for use in pseudo-version
+
+	Origin *Origin `json:",omitempty"` // provenance of reuse
 }
 
 // A Versions describes the available versions in a module repository.
 type Versions struct {
 	List []string // semver versions
+
+	// Time holds timestamps of versions if the proxy reports them in its
+	// @v/list response (eg. Athens), or nil otherwise.
+	Time map[string]time.Time
 }
 
 // ErrNoCommits is an error equivalent to fs.ErrNotExist indicating that a given
@@ -55,38 +107,66 @@ type proxyRepo struct {
 	url         *url.URL
 	path        string
 	redactedURL string
+	socket      string // unix socket of the proxy, eg. /var/run/athens.sock (empty if not unix://)
 
 	listLatestOnce sync.Once
 	listLatest     *RevInfo
 	listLatestErr  error
 }
 
+// unixSocketHost is the placeholder host of requests to a proxy listening on
+// a unix socket.
+const unixSocketHost = "unix"
+
 func newProxyRepo(baseURL, path string) (*proxyRepo, error) {
-	base, err := url.Parse(baseURL)
+	base, err := parseProxyURL(baseURL)
 	if err != nil {
 		return nil, err
 	}
+	redactedURL := base.Redacted()
+	socket := ""
 	switch base.Scheme {
 	case "http", "https":
 		// ok
 	case "file":
 		if *base != (url.URL{Scheme: base.Scheme, Path: base.Path, RawPath: base.RawPath}) {
-			return nil, fmt.Errorf("invalid file:// proxy URL with non-path elements: %s", base.Redacted())
+			return nil, fmt.Errorf("invalid file:// proxy URL with non-path elements: %s", redactedURL)
+		}
+	case "unix":
+		if base.Host != "" || base.Path == "" || base.RawQuery != "" || base.Fragment != "" {
+			return nil, fmt.Errorf("invalid unix:// proxy URL (must be unix:///path/to/socket): %s", redactedURL)
 		}
+		socket = base.Path
+		base = &url.URL{Scheme: "http", Host: unixSocketHost}
 	case "":
-		return nil, fmt.Errorf("invalid proxy URL missing scheme: %s", base.Redacted())
+		return nil, fmt.Errorf("invalid proxy URL missing scheme: %s", redactedURL)
 	default:
-		return nil, fmt.Errorf("invalid proxy URL scheme (must be https, http, file): %s", base.Redacted())
+		return nil, fmt.Errorf("invalid proxy URL scheme (must be https, http, file, unix): %s", redactedURL)
 	}
 
 	enc, err := module.EscapePath(path)
 	if err != nil {
 		return nil, err
 	}
-	redactedURL := base.Redacted()
 	base.Path = strings.TrimSuffix(base.Path, "/") + "/" + enc
 	base.RawPath = strings.TrimSuffix(base.RawPath, "/") + "/" + pathEscape(enc)
-	return &proxyRepo{base, path, redactedURL, sync.Once{}, nil, nil}, nil
+	return &proxyRepo{url: base, path: path, redactedURL: redactedURL, socket: socket}, nil
+}
+
+// parseProxyURL parses a module proxy URL. Unlike url.Parse, it also accepts
+// an IPv6 zone which isn't escaped as "%25", eg. http://[fe80::1%eth0]:3000.
+func parseProxyURL(rawURL string) (*url.URL, error) {
+	if i := strings.Index(rawURL, "://["); i > 0 {
+		start := i + len("://[")
+		if n := strings.IndexByte(rawURL[start:], ']'); n > 0 {
+			host := rawURL[start : start+n]
+			if pos := strings.IndexByte(host, '%'); pos >= 0 && !strings.HasPrefix(host[pos:], "%25") {
+				pos += start
+				rawURL = rawURL[:pos] + "%25" + rawURL[pos+1:]
+			}
+		}
+	}
+	return url.Parse(rawURL)
 }
 
 func (p *proxyRepo) ModulePath() string {
@@ -130,17 +210,97 @@ func (p *proxyRepo) getBytes(ctx context.Context, path string) ([]byte, error) {
 }
 
 func (p *proxyRepo) getBody(ctx context.Context, path string) (r io.ReadCloser, err error) {
+	resp, err := p.getResponse(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+func (p *proxyRepo) getResponse(ctx context.Context, path string) (resp *http.Response, err error) {
+	return p.request(ctx, "GET", path)
+}
+
+// request sends a method (GET or HEAD) request of path to the proxy.
+func (p *proxyRepo) request(ctx context.Context, method, path string) (resp *http.Response, err error) {
 	fullPath := pathpkg.Join(p.url.Path, path)
 
 	target := *p.url
 	target.Path = fullPath
 	target.RawPath = pathpkg.Join(target.RawPath, pathEscape(path))
+	if target.Scheme == "file" {
+		return fileResponse(&target)
+	}
 
-	resp, err := http.Get(target.String())
+	req, err := http.NewRequestWithContext(ctx, method, target.String(), nil)
 	if err != nil {
 		return nil, err
 	}
-	return resp.Body, nil
+	applyHeaders(req)
+	if err = applyCredentials(req); err != nil {
+		return nil, err
+	}
+	start := time.Now()
+	hookRequestStart(req)
+	resp, err = httpClientFor(p.path, p.socket).Do(req)
+	hookRequestEnd(req, resp, err, start)
+	logDebug("proxy request", append([]Field{
+		{"module", p.path}, {"proxy", p.redactedURL}, {"path", path}, {"duration", time.Since(start)},
+	}, errField(err)...)...)
+	if err != nil {
+		return nil, err
+	}
+	if err = checkResponse(resp, &target); err != nil {
+		// drain (a small) error body, so that the connection can be reused
+		io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+		resp.Body.Close()
+		return nil, err
+	}
+	return resp, nil
+}
+
+// fileResponse returns the content of a file of a file:// proxy as a response.
+// A file that doesn't exist is reported as 404, like the go command does.
+func fileResponse(target *url.URL) (*http.Response, error) {
+	name := filepath.FromSlash(target.Path)
+	if runtime.GOOS == "windows" { // eg. file:///C:/proxy
+		name = strings.TrimPrefix(name, `\`)
+	}
+	f, err := os.Open(name)
+	if err == nil {
+		var fi fs.FileInfo
+		if fi, err = f.Stat(); err == nil && !fi.IsDir() {
+			return &http.Response{Status: "200 OK", StatusCode: 200, Body: f, ContentLength: fi.Size()}, nil
+		}
+		f.Close()
+	}
+	if err == nil || errors.Is(err, fs.ErrNotExist) {
+		err = &httpError{status: "404 Not Found", statusCode: 404}
+	}
+	return nil, &url.Error{Op: "get", URL: target.Redacted(), Err: err}
+}
+
+// checkResponse returns an error if resp is not a successful response.
+// 404 and 410 are reported as fs.ErrNotExist, like the go command does.
+func checkResponse(resp *http.Response, target *url.URL) error {
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+	err := &httpError{status: resp.Status, statusCode: resp.StatusCode}
+	return &url.Error{Op: "get", URL: target.Redacted(), Err: err}
+}
+
+type httpError struct {
+	status     string
+	statusCode int
+}
+
+func (e *httpError) Error() string {
+	return "reading: " + e.status
+}
+
+func (e *httpError) Is(target error) bool {
+	return target == fs.ErrNotExist && (e.statusCode == 404 || e.statusCode == 410)
 }
 
 func (p *proxyRepo) Versions(ctx context.Context, prefix string) (*Versions, error) {
@@ -152,18 +312,27 @@ func (p *proxyRepo) Versions(ctx context.Context, prefix string) (*Versions, err
 		return nil, p.versionError("", err)
 	}
 	var list []string
+	var times map[string]time.Time
 	allLine := strings.Split(string(data), "\n")
 	for _, line := range allLine {
 		f := strings.Fields(line)
 		if len(f) >= 1 && semver.IsValid(f[0]) && strings.HasPrefix(f[0], prefix) && !module.IsPseudoVersion(f[0]) {
 			list = append(list, f[0])
+			if len(f) >= 2 {
+				if t, err := time.Parse(time.RFC3339, f[1]); err == nil {
+					if times == nil {
+						times = make(map[string]time.Time)
+					}
+					times[f[0]] = t
+				}
+			}
 		}
 	}
 	p.listLatestOnce.Do(func() {
 		p.listLatest, p.listLatestErr = p.latestFromList(ctx, allLine)
 	})
 	semver.Sort(list)
-	return &Versions{List: list}, nil
+	return &Versions{List: list, Time: times}, nil
 }
 
 func (p *proxyRepo) latest(ctx context.Context) (*RevInfo, error) {
@@ -180,40 +349,31 @@ func (p *proxyRepo) latest(ctx context.Context) (*RevInfo, error) {
 }
 
 func (p *proxyRepo) latestFromList(ctx context.Context, allLine []string) (*RevInfo, error) {
-	var (
-		bestTime    time.Time
-		bestVersion string
-	)
+	var versions []VersionInfo
 	for _, line := range allLine {
 		f := strings.Fields(line)
 		if len(f) >= 1 && semver.IsValid(f[0]) {
 			// If the proxy includes timestamps, prefer the timestamp it reports.
 			// Otherwise, derive the timestamp from the pseudo-version.
-			var (
-				ft time.Time
-			)
+			v := VersionInfo{Version: f[0]}
 			if len(f) >= 2 {
-				ft, _ = time.Parse(time.RFC3339, f[1])
-			} else if module.IsPseudoVersion(f[0]) {
-				ft, _ = module.PseudoVersionTime(f[0])
-			} else {
+				v.Time, _ = time.Parse(time.RFC3339, f[1])
+			} else if !module.IsPseudoVersion(f[0]) {
 				// Repo.Latest promises that this method is only called where there are
 				// no tagged versions. Ignore any tagged versions that were added in the
 				// meantime.
 				continue
 			}
-			if bestTime.Before(ft) {
-				bestTime = ft
-				bestVersion = f[0]
-			}
+			versions = append(versions, v)
 		}
 	}
-	if bestVersion == "" {
+	best, ok := latestByTime(versions)
+	if !ok {
 		return nil, p.versionError("", ErrNoCommits)
 	}
 
 	// Call Stat to get all the other fields, including Origin information.
-	return p.Stat(ctx, bestVersion)
+	return p.Stat(ctx, best.Version)
 }
 
 func (p *proxyRepo) Stat(ctx context.Context, rev string) (*RevInfo, error) {
@@ -269,35 +429,164 @@ func (p *proxyRepo) GoMod(ctx context.Context, version string) ([]byte, error) {
 	return data, nil
 }
 
-const maxZipFile = 500 << 20 // maximum size of downloaded zip file
+const DefaultMaxZipSize = 500 << 20 // default maximum size of downloaded zip file
+
+var maxZipSize int64 = DefaultMaxZipSize // accessed atomically
+
+// SetMaxZipSize sets the maximum size of downloaded zip files.
+// If n <= 0, DefaultMaxZipSize is used.
+func SetMaxZipSize(n int64) {
+	if n <= 0 {
+		n = DefaultMaxZipSize
+	}
+	atomic.StoreInt64(&maxZipSize, n)
+}
+
+// ZipOptions represents options of downloading a module zip file.
+type ZipOptions struct {
+	MaxSize int64 // maximum size of the zip file; 0 means the global limit (see SetMaxZipSize)
+	// Hash computes the h1: hash of the zip file. It's computed after the
+	// download finishes, since it needs random access to the zip file (its
+	// central directory is at the end): the zip file is read back from dst if
+	// dst is a readable *os.File (or another io.ReaderAt and io.Seeker),
+	// otherwise a copy is spooled to a temporary file while streaming.
+	Hash bool
+
+	// Dir is the directory the zip file is written to. If it's not empty,
+	// available disk space (and the cache quota if Dir is in GOMODCACHE, see
+	// SetCacheQuota) is checked against Content-Length before streaming, and
+	// an *InsufficientSpaceError is returned if it isn't enough.
+	Dir string
+}
+
+// ZipResult represents the result of downloading a module zip file.
+type ZipResult struct {
+	Size int64  // size of the zip file
+	Hash string // h1: hash of the zip file, only if ZipOptions.Hash is set
+}
+
+// A TooLargeError is returned when a zip file exceeds the size limit.
+type TooLargeError struct {
+	Size  int64 // observed size: Content-Length if known, or bytes read before the limit was hit
+	Limit int64
+}
+
+func (e *TooLargeError) Error() string {
+	return fmt.Sprintf("downloaded zip file too large (%d bytes, limit %d bytes)", e.Size, e.Limit)
+}
 
 func (p *proxyRepo) Zip(ctx context.Context, dst io.Writer, version string) error {
+	_, err := p.ZipWith(ctx, dst, version, nil)
+	return err
+}
+
+func (p *proxyRepo) ZipWith(ctx context.Context, dst io.Writer, version string, opts *ZipOptions) (ret *ZipResult, err error) {
 	if version != module.CanonicalVersion(version) {
-		return p.versionError(version, fmt.Errorf("internal error: version passed to Zip is not canonical"))
+		return nil, p.versionError(version, fmt.Errorf("internal error: version passed to Zip is not canonical"))
+	}
+	if opts == nil {
+		opts = new(ZipOptions)
+	}
+	limit := opts.MaxSize
+	if limit <= 0 {
+		limit = atomic.LoadInt64(&maxZipSize)
 	}
 
 	encVer, err := module.EscapeVersion(version)
 	if err != nil {
-		return p.versionError(version, err)
+		return nil, p.versionError(version, err)
 	}
 	path := "@v/" + encVer + ".zip"
-	body, err := p.getBody(ctx, path)
+	resp, err := p.getResponse(ctx, path)
 	if err != nil {
-		return p.versionError(version, err)
+		return nil, p.versionError(version, err)
 	}
+	body := resp.Body
 	defer body.Close()
 
-	lr := &io.LimitedReader{R: body, N: maxZipFile + 1}
-	if _, err := io.Copy(dst, lr); err != nil {
+	if resp.ContentLength > limit {
+		return nil, p.versionError(version, &TooLargeError{Size: resp.ContentLength, Limit: limit})
+	}
+	if opts.Dir != "" && resp.ContentLength > 0 {
+		if err = checkSpace(opts.Dir, resp.ContentLength); err != nil {
+			return nil, p.versionError(version, err)
+		}
+	}
+	lr := &io.LimitedReader{R: body, N: limit + 1}
+	var r io.Reader = lr
+	var zr io.ReaderAt // where the zip file is read back to compute its hash
+	var off int64      // offset of the zip file in zr
+	if opts.Hash {
+		var ok bool
+		if zr, off, ok = readBack(dst); !ok {
+			tmp, e := os.CreateTemp("", "modzip-*.tmp")
+			if e != nil {
+				return nil, p.versionError(version, e)
+			}
+			defer func() {
+				tmp.Close()
+				os.Remove(tmp.Name())
+			}()
+			zr, r = tmp, io.TeeReader(lr, tmp)
+		}
+	}
+	n, err := io.Copy(dst, r)
+	if err != nil {
 		// net/http doesn't add context to Body errors, so add it here.
 		// (See https://go.dev/issue/52727.)
-		err = &url.Error{Op: "read", URL: pathpkg.Join(p.redactedURL, path), Err: err}
-		return p.versionError(version, err)
+		err = &url.Error{Op: "read", URL: strings.TrimSuffix(p.redactedURL, "/") + "/" + path, Err: err}
+		return nil, p.versionError(version, err)
 	}
 	if lr.N <= 0 {
-		return p.versionError(version, fmt.Errorf("downloaded zip file too large"))
+		return nil, p.versionError(version, &TooLargeError{Size: n, Limit: limit})
+	}
+	if opts.Dir != "" {
+		addUsage(opts.Dir, n)
+	}
+	ret = &ZipResult{Size: n}
+	if zr != nil {
+		if ret.Hash, err = hashZip(io.NewSectionReader(zr, off, n), n); err != nil {
+			return nil, p.versionError(version, err)
+		}
 	}
-	return nil
+	return ret, nil
+}
+
+// readBack returns dst as an io.ReaderAt and the current offset of dst, if
+// what is written to dst can be read back.
+func readBack(dst io.Writer) (r io.ReaderAt, off int64, ok bool) {
+	f, ok := dst.(interface {
+		io.ReaderAt
+		io.Seeker
+	})
+	if !ok {
+		return
+	}
+	off, err := f.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil, 0, false
+	}
+	if _, err = f.ReadAt(make([]byte, 1), 0); err != nil && err != io.EOF { // eg. a write-only file
+		return nil, 0, false
+	}
+	return f, off, true
+}
+
+// hashZip computes the h1: hash of a module zip file of the specified size.
+func hashZip(r io.ReaderAt, size int64) (string, error) {
+	z, err := zip.NewReader(r, size)
+	if err != nil {
+		return "", err
+	}
+	files := make([]string, 0, len(z.File))
+	zfiles := make(map[string]*zip.File, len(z.File))
+	for _, file := range z.File {
+		files = append(files, file.Name)
+		zfiles[file.Name] = file
+	}
+	return dirhash.Hash1(files, func(name string) (io.ReadCloser, error) {
+		return zfiles[name].Open()
+	})
 }
 
 // pathEscape escapes s so it can be used in a path.
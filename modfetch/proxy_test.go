@@ -0,0 +1,428 @@
+/*
+ * Copyright (c) 2024 The GoPlus Authors (goplus.org). All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package modfetch
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/mod/sumdb/dirhash"
+)
+
+func TestParseProxyURL(t *testing.T) {
+	cases := []struct {
+		raw, host, zone string
+	}{
+		{"http://[::1]:3000", "::1", ""},
+		{"http://[fe80::1%eth0]:3000/proxy", "fe80::1%eth0", "eth0"},
+		{"http://[fe80::1%25eth0]:3000", "fe80::1%eth0", "eth0"},
+		{"https://goproxy.cn", "goproxy.cn", ""},
+	}
+	for _, c := range cases {
+		u, err := parseProxyURL(c.raw)
+		if err != nil || u.Hostname() != c.host {
+			t.Fatal("parseProxyURL:", c.raw, u, err)
+		}
+	}
+	repo, err := newProxyRepo("http://[fe80::1%eth0]:3000/proxy/", "example.com/foo")
+	if err != nil || repo.url.String() != "http://[fe80::1%25eth0]:3000/proxy/example.com/foo" {
+		t.Fatal("newProxyRepo:", repo, err)
+	}
+	for _, raw := range []string{"unix://host/athens.sock", "unix://", "unix:///athens.sock?x=1", "ftp://goproxy.cn"} {
+		if _, err := newProxyRepo(raw, "example.com/foo"); err == nil {
+			t.Fatal("newProxyRepo: no error?", raw)
+		}
+	}
+}
+
+func TestUnixSocketProxy(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("unix sockets")
+	}
+	dir, err := os.MkdirTemp("", "proxy") // keep the socket path short
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	socket := filepath.Join(dir, "athens.sock")
+	ln, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Skip("listen unix:", err)
+	}
+	srv := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/example.com/foo/@v/list" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte("v1.0.0\nv1.1.0\n"))
+	})}
+	go srv.Serve(ln)
+	defer srv.Close()
+
+	repo, err := newProxyRepo("unix://"+socket, "example.com/foo")
+	if err != nil {
+		t.Fatal("newProxyRepo:", err)
+	}
+	if repo.redactedURL != "unix://"+socket {
+		t.Fatal("newProxyRepo: redactedURL", repo.redactedURL)
+	}
+	vers, err := repo.Versions(context.Background(), "")
+	if err != nil || len(vers.List) != 2 || vers.List[1] != "v1.1.0" {
+		t.Fatal("Versions:", vers, err)
+	}
+	if httpClientFor("example.com/foo", socket) != httpClientFor("example.com/bar", socket) {
+		t.Fatal("httpClientFor: client of socket not cached")
+	}
+}
+
+func TestLogger(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("v1.0.0\n"))
+	}))
+	defer ts.Close()
+
+	var records []string
+	SetLogger(LoggerFunc(func(level LogLevel, msg string, fields ...Field) {
+		records = append(records, formatRecord(level, msg, fields))
+	}))
+	defer SetLogger(nil)
+
+	repo, err := newProxyRepo(ts.URL, "example.com/foo")
+	if err != nil {
+		t.Fatal("newProxyRepo:", err)
+	}
+	if _, err = repo.Versions(context.Background(), ""); err != nil {
+		t.Fatal("Versions:", err)
+	}
+	if len(records) != 1 || !strings.HasPrefix(records[0], "proxy request module=example.com/foo proxy="+ts.URL+" path=@v/list duration=") {
+		t.Fatal("records:", records)
+	}
+	fields := []Field{{"sumdb", "sum.golang.org"}, {"err", errors.New("bad sum")}}
+	if v := formatRecord(LevelError, "verify", fields); v != `ERROR verify sumdb=sum.golang.org err="bad sum"` {
+		t.Fatal("formatRecord:", v)
+	}
+	if v := LogLevel(10).String(); v != "LogLevel(10)" {
+		t.Fatal("LogLevel.String:", v)
+	}
+}
+
+func TestConnPool(t *testing.T) {
+	var mu sync.Mutex
+	conns := 0
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasSuffix(r.URL.Path, ".info") {
+			http.NotFound(w, r)
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+		w.Write([]byte(`{"Version":"v1.0.0"}`))
+	}))
+	ts.Config.ConnState = func(c net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			mu.Lock()
+			conns++
+			mu.Unlock()
+		}
+	}
+	ts.Start()
+	defer ts.Close()
+
+	defer SetMaxConnsPerHost(0)
+	SetMaxConnsPerHost(0)
+	tr, ok := httpClient("example.com/foo").Transport.(*http.Transport)
+	if !ok || !tr.ForceAttemptHTTP2 || tr.MaxIdleConnsPerHost != DefaultMaxIdleConnsPerHost || tr.MaxConnsPerHost != 0 {
+		t.Fatal("httpClient: transport", tr)
+	}
+	repo, err := newProxyRepo(ts.URL, "example.com/foo")
+	if err != nil {
+		t.Fatal("newProxyRepo:", err)
+	}
+	ctx := context.Background()
+	for i := 0; i < 3; i++ {
+		if _, err = repo.Stat(ctx, "v1.0.0"); err != nil {
+			t.Fatal("Stat:", err)
+		}
+		if _, err = repo.GoMod(ctx, "v1.0.0"); !errors.Is(err, fs.ErrNotExist) {
+			t.Fatal("GoMod:", err)
+		}
+	}
+	mu.Lock()
+	n := conns
+	mu.Unlock()
+	if n != 1 {
+		t.Fatal("keep-alive: connections", n)
+	}
+
+	SetMaxConnsPerHost(1)
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := repo.Stat(ctx, "v1.0.0"); err != nil {
+				t.Error("Stat:", err)
+			}
+		}()
+	}
+	wg.Wait()
+	mu.Lock()
+	defer mu.Unlock()
+	if conns != 2 {
+		t.Fatal("SetMaxConnsPerHost(1): connections", conns)
+	}
+}
+
+func TestCheckProxy(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mode, path, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+		if r.Method == "HEAD" && mode == "nohead" {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		switch path {
+		case "golang.org/x/mod/@v/list":
+			w.Write([]byte("v0.1.0\n"))
+		case "golang.org/x/mod/@v/v0.1.0.info":
+			w.Write([]byte(`{"Version":"v0.1.0"}`))
+		case "golang.org/x/mod/@v/v0.1.0.mod":
+			if mode == "badmod" {
+				w.Write([]byte("module example.com/foo\n"))
+			} else {
+				w.Write([]byte("module golang.org/x/mod\n"))
+			}
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	ctx := context.Background()
+	for _, mode := range []string{"good", "nohead"} {
+		if ret := CheckProxy(ctx, ts.URL+"/"+mode); !ret.OK() || ret.Latency <= 0 || !strings.HasSuffix(ret.String(), ")") {
+			t.Fatal("CheckProxy:", mode, ret)
+		}
+	}
+	if ret := CheckProxy(ctx, ts.URL+"/badmod"); ret.OK() || !strings.Contains(ret.Err.Error(), `go.mod declares module "example.com/foo"`) {
+		t.Fatal("CheckProxy badmod:", ret)
+	}
+	if ret := CheckProxy(ctx, "ftp://example.com"); ret.OK() {
+		t.Fatal("CheckProxy ftp:", ret)
+	}
+
+	dir := t.TempDir()
+	vdir := filepath.Join(dir, "golang.org", "x", "mod", "@v")
+	os.MkdirAll(vdir, 0777)
+	os.WriteFile(filepath.Join(vdir, "list"), []byte("v0.1.0\n"), 0666)
+	os.WriteFile(filepath.Join(vdir, "v0.1.0.info"), []byte(`{"Version":"v0.1.0"}`), 0666)
+	if ret := CheckProxy(ctx, "file://"+filepath.ToSlash(dir)); ret.OK() || !errors.Is(ret.Err, fs.ErrNotExist) {
+		t.Fatal("CheckProxy file:// without .mod:", ret)
+	}
+	os.WriteFile(filepath.Join(vdir, "v0.1.0.mod"), []byte("module golang.org/x/mod\n"), 0666)
+	if runtime.GOOS != "windows" {
+		if ret := CheckProxy(ctx, "file://"+dir); !ret.OK() {
+			t.Fatal("CheckProxy file://:", ret)
+		}
+	}
+}
+
+func TestDoctor(t *testing.T) {
+	for _, env := range []string{"GOPROXY", "GOPRIVATE", "GONOPROXY", "GONOSUMDB", "GOSUMDB", "GOFLAGS"} {
+		t.Setenv(env, "")
+	}
+	defer SetProxyRoutes(nil)
+	defer SetGoCommandEnabled(true)
+
+	d := Doctor("example.com/foo")
+	if d.Err != nil || d.Source.Strategy != StrategyGoCommand || d.Source.Proxy != defaultProxyURL || d.Source.Sum != SumVerified {
+		t.Fatal("Doctor default:", d)
+	}
+	if len(d.Chain) != 2 || d.Chain[1].URL != "direct" || !strings.Contains(d.String(), "(default)") {
+		t.Fatal("Doctor default chain:", d.Chain)
+	}
+
+	t.Setenv("GOPROXY", "https://goproxy.cn|https://goproxy.io,direct")
+	t.Setenv("GOPRIVATE", "*.corp.com, example.com/private")
+	d = Doctor("git.corp.com/foo")
+	if len(d.Chain) != 3 || !d.Chain[0].FallbackOnError || d.Chain[1].FallbackOnError || d.Chain[1].URL != "https://goproxy.io" {
+		t.Fatal("Doctor chain:", d.Chain)
+	}
+	if strings.Join(d.Private, " ") != "*.corp.com" || strings.Join(d.NoProxy, " ") != "*.corp.com" ||
+		d.Source.Strategy != StrategyDirect || d.Source.Sum != SumSkippedPrivate || d.Warnings != nil {
+		t.Fatal("Doctor private:", d)
+	}
+	if s := d.String(); !strings.Contains(s, "GOPRIVATE: *.corp.com\n") || !strings.Contains(s, "source:    direct-vcs, sum skipped-private\n") {
+		t.Fatal("Doctor.String:", s)
+	}
+	t.Setenv("GONOSUMDB", "example.com/other")
+	if d = Doctor("git.corp.com/foo"); len(d.Warnings) != 1 {
+		t.Fatal("Doctor GONOSUMDB:", d.Warnings)
+	}
+
+	t.Setenv("GOPROXY", " , ")
+	d = Doctor("example.com/foo")
+	if len(d.Chain) != 0 || d.Err == nil || !strings.Contains(d.Err.Error(), "empty GOPROXY") {
+		t.Fatal("Doctor empty GOPROXY:", d)
+	}
+	if d = Doctor("git.corp.com/foo"); d.Err != nil || d.Source.Strategy != StrategyDirect {
+		t.Fatal("Doctor empty GOPROXY private:", d)
+	}
+	t.Setenv("GOPROXY", "https://goproxy.cn|https://goproxy.io,direct")
+
+	AddProxyRoute("github.com/mycorp/*", "off")
+	d = Doctor("github.com/mycorp/foo")
+	if d.Route == nil || d.Proxy != "off" || d.Err == nil || d.Source.Strategy != 0 || !strings.Contains(d.String(), "error:") {
+		t.Fatal("Doctor route off:", d)
+	}
+
+	SetGoCommandEnabled(false)
+	if d = Doctor("github.com/mycorp/foo"); !errors.Is(d.Err, ErrGoCommandDisabled) {
+		t.Fatal("Doctor go command disabled:", d)
+	}
+	d = Doctor("git.corp.com/foo")
+	if d.Err != nil || d.Source.Strategy != StrategyProxy || d.Source.Proxy != "https://goproxy.cn" || len(d.Warnings) != 2 {
+		t.Fatal("Doctor proxy:", d)
+	}
+}
+
+func TestZipWith(t *testing.T) {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, name := range []string{"example.com/foo@v1.0.0/go.mod", "example.com/foo@v1.0.0/foo.go"} {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal("zip.Create:", err)
+		}
+		w.Write([]byte("module example.com/foo\n"))
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal("zip.Close:", err)
+	}
+	data := buf.Bytes()
+	zipfile := filepath.Join(t.TempDir(), "foo.zip")
+	if err := os.WriteFile(zipfile, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	want, err := dirhash.HashZip(zipfile, dirhash.Hash1)
+	if err != nil {
+		t.Fatal("dirhash.HashZip:", err)
+	}
+
+	chunked := false
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if chunked {
+			w.(http.Flusher).Flush() // no Content-Length
+		} else {
+			w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+		}
+		w.Write(data)
+	}))
+	defer ts.Close()
+
+	ctx := context.Background()
+	repo, err := newProxyRepo(ts.URL, "example.com/foo")
+	if err != nil {
+		t.Fatal("newProxyRepo:", err)
+	}
+	var out bytes.Buffer
+	ret, err := repo.ZipWith(ctx, &out, "v1.0.0", &ZipOptions{Hash: true})
+	if err != nil {
+		t.Fatal("ZipWith:", err)
+	}
+	if ret.Size != int64(len(data)) || ret.Hash != want || !bytes.Equal(out.Bytes(), data) {
+		t.Fatal("ZipWith:", ret.Size, ret.Hash, want)
+	}
+
+	for _, flag := range []int{os.O_RDWR, os.O_WRONLY} { // read back, or spooled
+		f, err := os.OpenFile(filepath.Join(t.TempDir(), "out.zip"), flag|os.O_CREATE, 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.Write([]byte("head"))
+		ret, err = repo.ZipWith(ctx, f, "v1.0.0", &ZipOptions{Hash: true})
+		f.Close()
+		if err != nil || ret.Size != int64(len(data)) || ret.Hash != want {
+			t.Fatal("ZipWith file:", flag, ret, err)
+		}
+	}
+
+	var tooLarge *TooLargeError
+	_, err = repo.ZipWith(ctx, io.Discard, "v1.0.0", &ZipOptions{MaxSize: 10})
+	if !errors.As(err, &tooLarge) || tooLarge.Size != int64(len(data)) || tooLarge.Limit != 10 {
+		t.Fatal("ZipWith (Content-Length):", err)
+	}
+
+	SetMaxZipSize(10)
+	defer SetMaxZipSize(0)
+	chunked = true
+	_, err = repo.ZipWith(ctx, io.Discard, "v1.0.0", &ZipOptions{Hash: true})
+	if !errors.As(err, &tooLarge) || tooLarge.Size != 11 || tooLarge.Limit != 10 {
+		t.Fatal("ZipWith (streamed):", err)
+	}
+}
+
+func TestOrigin(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/example.com/foo/@v/list":
+			w.Write([]byte("v1.0.0 2024-01-02T03:04:05Z\nv1.1.0\nv0.9.0 bad-time\n"))
+		case "/example.com/foo/@v/v1.0.0.info":
+			w.Write([]byte(`{"Version":"v1.0.0","Time":"2024-01-02T03:04:05Z","Origin":{"VCS":"git","URL":"https://example.com/foo","Ref":"refs/tags/v1.0.0","Hash":"abc"}}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	ctx := context.Background()
+	repo, err := newProxyRepo(ts.URL, "example.com/foo")
+	if err != nil {
+		t.Fatal("newProxyRepo:", err)
+	}
+	vers, err := repo.Versions(ctx, "")
+	if err != nil {
+		t.Fatal("Versions:", err)
+	}
+	if strings.Join(vers.List, " ") != "v0.9.0 v1.0.0 v1.1.0" || len(vers.Time) != 1 ||
+		!vers.Time["v1.0.0"].Equal(time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)) {
+		t.Fatal("Versions:", vers)
+	}
+	info, err := repo.Stat(ctx, "v1.0.0")
+	if err != nil {
+		t.Fatal("Stat:", err)
+	}
+	if o := info.Origin; o == nil || o.VCS != "git" || o.Ref != "refs/tags/v1.0.0" || o.Hash != "abc" || !o.Checkable() {
+		t.Fatal("Stat: Origin", o)
+	}
+	if (&Origin{VCS: "git", URL: "https://example.com/foo"}).Checkable() || (*Origin)(nil).Checkable() {
+		t.Fatal("Checkable: informational origin")
+	}
+}
@@ -0,0 +1,104 @@
+/*
+ * Copyright (c) 2024 The GoPlus Authors (goplus.org). All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package modfetch
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"golang.org/x/mod/module"
+	"golang.org/x/mod/semver"
+)
+
+// -----------------------------------------------------------------------------
+
+// IsUpgradeQuery reports whether query is a version query of the go command
+// depending on the current version of a module, ie. "upgrade" or "patch".
+func IsUpgradeQuery(query string) bool {
+	return query == "upgrade" || query == "patch"
+}
+
+// ResolveQuery resolves a version query of module path, which is "upgrade" or
+// "patch", against current (the version currently required, or "" if the
+// module isn't required) and versions listed by the module proxy, the same way
+// the go command does:
+//   - "upgrade" is like "latest", but current is selected if it's higher than
+//     the latest version (eg. current is a pre-release or a pseudo-version);
+//   - "patch" selects the latest version with the same major and minor version
+//     as current (or current if there is no higher one). It's equivalent to
+//     "upgrade" if current is "".
+func ResolveQuery(ctx context.Context, path, query, current string) (ver string, err error) {
+	if !IsUpgradeQuery(query) {
+		return "", fmt.Errorf("invalid version query %s@%s: must be upgrade or patch", path, query)
+	}
+	if current != "" && !semver.IsValid(current) {
+		return "", fmt.Errorf("invalid current version %s of %s", current, path)
+	}
+	proxy, err := ProxyURLFor(path)
+	if err != nil {
+		return
+	}
+	repo, err := newProxyRepo(proxy, path)
+	if err != nil {
+		return
+	}
+	prefix := ""
+	if query == "patch" && current != "" {
+		prefix = semver.MajorMinor(current) + "."
+	}
+	vers, err := repo.Versions(ctx, prefix)
+	if err != nil {
+		return
+	}
+	infos := make([]VersionInfo, len(vers.List))
+	for i, v := range vers.List {
+		infos[i] = VersionInfo{Version: v, Time: vers.Time[v]}
+	}
+	latest, ok := SelectLatest(infos, nil)
+	switch {
+	case ok:
+		ver = latest.Version
+	case prefix == "": // no tagged versions
+		info, e := repo.Latest(ctx)
+		if e != nil {
+			return "", e
+		}
+		ver = info.Version
+	}
+	if current != "" && semver.Compare(current, ver) > 0 {
+		ver = current
+	}
+	return
+}
+
+// GetQueryContext is like GetContextEx, but modPath can also be in the form
+// path@upgrade or path@patch, whose version query is resolved against current
+// (see ResolveQuery). It's the building block of `gop get -u`.
+func GetQueryContext(ctx context.Context, modPath, current string, noCache bool) (mod module.Version, rep Report, err error) {
+	if pos := strings.IndexByte(modPath, '@'); pos > 0 && IsUpgradeQuery(modPath[pos+1:]) {
+		path := modPath[:pos]
+		ver, e := ResolveQuery(ctx, path, modPath[pos+1:], current)
+		if e != nil {
+			return mod, rep, e
+		}
+		modPath = path + "@" + ver
+	}
+	return GetContextEx(ctx, modPath, noCache)
+}
+
+// -----------------------------------------------------------------------------
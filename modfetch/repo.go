@@ -0,0 +1,57 @@
+/*
+ * Copyright (c) 2024 The GoPlus Authors (goplus.org). All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package modfetch
+
+import (
+	"context"
+	"io"
+)
+
+// -----------------------------------------------------------------------------
+
+// A Repo represents a module repository served by a module proxy.
+type Repo interface {
+	// ModulePath returns the module path.
+	ModulePath() string
+
+	// Versions lists all known versions with the given prefix.
+	// Pseudo-versions are not included.
+	Versions(ctx context.Context, prefix string) (*Versions, error)
+
+	// Stat returns information about the revision rev.
+	Stat(ctx context.Context, rev string) (*RevInfo, error)
+
+	// Latest returns the latest revision on the default branch.
+	Latest(ctx context.Context) (*RevInfo, error)
+
+	// GoMod returns the go.mod file for the given version.
+	GoMod(ctx context.Context, version string) (data []byte, err error)
+
+	// Zip writes a zip file for the given version to dst.
+	Zip(ctx context.Context, dst io.Writer, version string) error
+
+	// ZipWith is like Zip but it can specify a size limit and compute the
+	// h1: hash of the zip file while streaming.
+	ZipWith(ctx context.Context, dst io.Writer, version string, opts *ZipOptions) (*ZipResult, error)
+}
+
+// NewRepo returns a Repo of the module path served by the module proxy proxyURL.
+func NewRepo(proxyURL, path string) (Repo, error) {
+	return newProxyRepo(proxyURL, path)
+}
+
+// -----------------------------------------------------------------------------
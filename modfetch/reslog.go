@@ -0,0 +1,112 @@
+/*
+ * Copyright (c) 2024 The GoPlus Authors (goplus.org). All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package modfetch
+
+import (
+	"encoding/json"
+	"io"
+	"sort"
+	"sync"
+
+	"github.com/goplus/mod/modcache"
+	"golang.org/x/mod/module"
+)
+
+// -----------------------------------------------------------------------------
+
+// A Resolution records a resolution performed by Get or GetPkg.
+type Resolution struct {
+	Request   string   `json:"request"`             // requested path, maybe with @version
+	Path      string   `json:"path"`                // resolved module path
+	Version   string   `json:"version"`             // resolved module version
+	RelPath   string   `json:"relPath,omitempty"`   // package path relative to module root (GetPkg only)
+	Proxy     string   `json:"proxy,omitempty"`     // module proxy used to resolve, if known
+	Strategy  Strategy `json:"strategy,omitempty"`  // how the request is resolved
+	Sum       SumCheck `json:"sum,omitempty"`       // how the download is checked
+	Hash      string   `json:"hash,omitempty"`      // h1: hash of module zip, if known
+	GoModHash string   `json:"goModHash,omitempty"` // h1: hash of go.mod, if known
+}
+
+// A ResolutionLog records resolutions performed by Get and GetPkg, so that
+// builds can be audited and replayed. Use SetResolutionLog to enable it.
+type ResolutionLog struct {
+	mu   sync.Mutex
+	list map[string]Resolution // request => resolution
+}
+
+// NewResolutionLog creates an empty resolution log.
+func NewResolutionLog() *ResolutionLog {
+	return &ResolutionLog{list: make(map[string]Resolution)}
+}
+
+var reslog *ResolutionLog
+
+// SetResolutionLog sets the log to record resolutions into (nil disables
+// recording).
+func SetResolutionLog(log *ResolutionLog) {
+	reslog = log
+}
+
+// Resolutions returns all recorded resolutions, sorted by request.
+func (p *ResolutionLog) Resolutions() []Resolution {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	ret := make([]Resolution, 0, len(p.list))
+	for _, r := range p.list {
+		ret = append(ret, r)
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].Request < ret[j].Request
+	})
+	return ret
+}
+
+// WriteJSON writes recorded resolutions as an indented JSON array. The output
+// only depends on the recorded resolutions (not on the order they happened).
+func (p *ResolutionLog) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "\t")
+	return enc.Encode(p.Resolutions())
+}
+
+// ReadResolutions reads resolutions written by WriteJSON.
+func ReadResolutions(r io.Reader) (ret []Resolution, err error) {
+	err = json.NewDecoder(r).Decode(&ret)
+	return
+}
+
+func (p *ResolutionLog) add(r Resolution) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.list[r.Request] = r
+}
+
+func recordResolution(request string, mod module.Version, relPath string, rep Report) {
+	log := reslog
+	if log == nil {
+		return
+	}
+	r := Resolution{
+		Request: request, Path: mod.Path, Version: mod.Version, RelPath: relPath,
+		Proxy: rep.Proxy, Strategy: rep.Strategy, Sum: rep.Sum,
+	}
+	r.Hash, _ = modcache.ReadZipHash(mod)
+	r.GoModHash = goModHash(mod)
+	log.add(r)
+}
+
+// -----------------------------------------------------------------------------
@@ -0,0 +1,117 @@
+/*
+ * Copyright (c) 2024 The GoPlus Authors (goplus.org). All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package modfetch
+
+import (
+	"os"
+	"strings"
+	"sync"
+
+	"golang.org/x/mod/module"
+)
+
+// -----------------------------------------------------------------------------
+
+// A ProxyRoute routes modules matching Pattern to Proxy.
+type ProxyRoute struct {
+	// Pattern is a comma-separated list of glob patterns of module path
+	// prefixes, in the same form as GOPRIVATE, eg. "github.com/mycorp/*".
+	Pattern string
+
+	// Proxy is a module proxy list in the same form as GOPROXY, eg.
+	// "https://athens.mycorp.com" or "https://goproxy.cn,direct".
+	Proxy string
+}
+
+var (
+	routeMu sync.RWMutex
+	routes  []ProxyRoute
+)
+
+// SetProxyRoutes sets routing rules of module proxies, which take precedence
+// over GOPROXY. The first matched route of a module wins, and GOPROXY is used
+// if no route matches. Routes are also applied to the go command run by Get
+// and GetPkg.
+func SetProxyRoutes(rs []ProxyRoute) {
+	routeMu.Lock()
+	defer routeMu.Unlock()
+	routes = append([]ProxyRoute(nil), rs...)
+}
+
+// AddProxyRoute appends a routing rule of module proxies, see SetProxyRoutes.
+func AddProxyRoute(pattern, proxy string) {
+	routeMu.Lock()
+	defer routeMu.Unlock()
+	routes = append(routes, ProxyRoute{Pattern: pattern, Proxy: proxy})
+}
+
+// lookupRoute returns the proxy list of the first route matching modPath.
+func lookupRoute(modPath string) (proxy string, ok bool) {
+	r, ok := matchRoute(modPath)
+	return r.Proxy, ok
+}
+
+// matchRoute returns the first route matching modPath.
+func matchRoute(modPath string) (route ProxyRoute, ok bool) {
+	routeMu.RLock()
+	defer routeMu.RUnlock()
+	for _, r := range routes {
+		if module.MatchPrefixPatterns(r.Pattern, modPath) {
+			return r, true
+		}
+	}
+	return
+}
+
+// ProxyFor returns the module proxy list (in the same form as GOPROXY) used
+// to fetch module (or package) modPath: the proxy of the first matched route
+// (see SetProxyRoutes), or GOPROXY otherwise.
+func ProxyFor(modPath string) string {
+	if proxy, ok := lookupRoute(modPath); ok {
+		return proxy
+	}
+	return os.Getenv("GOPROXY")
+}
+
+// ProxyURLFor is like ProxyURL but for module (or package) modPath, taking
+// routes (see SetProxyRoutes) into account.
+func ProxyURLFor(modPath string) (string, error) {
+	return firstProxyURL(ProxyFor(modPath))
+}
+
+// goEnv returns environment variables of the go command fetching modPath, or
+// nil if the environment of the current process can be used as is.
+func goEnv(modPath string) []string {
+	if proxy, ok := lookupRoute(modPath); ok {
+		return append(os.Environ(), "GOPROXY="+proxy)
+	}
+	return nil
+}
+
+func firstProxyURL(goproxy string) (string, error) {
+	if goproxy == "" {
+		return defaultProxyURL, nil
+	}
+	for _, proxy := range strings.FieldsFunc(goproxy, func(c rune) bool { return c == ',' || c == '|' }) {
+		if proxy = strings.TrimSpace(proxy); proxy != "" && proxy != "direct" && proxy != "off" {
+			return proxy, nil
+		}
+	}
+	return "", ErrNoProxy
+}
+
+// -----------------------------------------------------------------------------
@@ -0,0 +1,72 @@
+/*
+ * Copyright (c) 2024 The GoPlus Authors (goplus.org). All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package modfetch
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestProxyRoutes(t *testing.T) {
+	t.Setenv("GOPROXY", "https://goproxy.io,direct")
+	defer SetProxyRoutes(nil)
+	SetProxyRoutes([]ProxyRoute{
+		{Pattern: "github.com/mycorp/*,example.com/private", Proxy: "https://athens.mycorp.com"},
+		{Pattern: "github.com/mycorp", Proxy: "https://never.used"},
+	})
+	AddProxyRoute("example.com/direct", "direct")
+
+	cases := []struct {
+		modPath string
+		proxy   string
+		url     string
+		err     error
+	}{
+		{"github.com/mycorp/foo", "https://athens.mycorp.com", "https://athens.mycorp.com", nil},
+		{"github.com/mycorp/foo/bar", "https://athens.mycorp.com", "https://athens.mycorp.com", nil},
+		{"example.com/private/pkg", "https://athens.mycorp.com", "https://athens.mycorp.com", nil},
+		{"github.com/mycorp", "https://never.used", "https://never.used", nil},
+		{"example.com/direct", "direct", "", ErrNoProxy},
+		{"github.com/other/foo", "https://goproxy.io,direct", "https://goproxy.io", nil},
+	}
+	for _, c := range cases {
+		if proxy := ProxyFor(c.modPath); proxy != c.proxy {
+			t.Fatal("ProxyFor:", c.modPath, proxy)
+		}
+		url, err := ProxyURLFor(c.modPath)
+		if url != c.url || !errors.Is(err, c.err) {
+			t.Fatal("ProxyURLFor:", c.modPath, url, err)
+		}
+	}
+
+	if env := goEnv("github.com/mycorp/foo"); len(env) == 0 || env[len(env)-1] != "GOPROXY=https://athens.mycorp.com" {
+		t.Fatal("goEnv:", env)
+	}
+	if env := goEnv("github.com/other/foo"); env != nil {
+		t.Fatal("goEnv: unexpected env for unrouted module")
+	}
+
+	SetProxyRoutes(nil)
+	if url, err := ProxyURLFor("github.com/mycorp/foo"); err != nil || url != "https://goproxy.io" {
+		t.Fatal("ProxyURLFor after reset:", url, err)
+	}
+	t.Setenv("GOPROXY", "")
+	if url, err := ProxyURLFor("github.com/mycorp/foo"); err != nil || !strings.HasPrefix(url, "https://") {
+		t.Fatal("ProxyURLFor with empty GOPROXY:", url, err)
+	}
+}
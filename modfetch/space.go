@@ -0,0 +1,145 @@
+/*
+ * Copyright (c) 2024 The GoPlus Authors (goplus.org). All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package modfetch
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/goplus/mod/modcache"
+)
+
+// -----------------------------------------------------------------------------
+
+// ErrInsufficientSpace is returned (wrapped in an *InsufficientSpaceError) if
+// there isn't enough disk space or cache quota to download a zip file.
+var ErrInsufficientSpace = errors.New("insufficient disk space")
+
+// An InsufficientSpaceError describes the shortage of disk space or cache
+// quota found before downloading a zip file.
+type InsufficientSpaceError struct {
+	Dir   string // directory the zip file would be written to
+	Need  int64  // size of the zip file
+	Avail int64  // available disk space, or remaining cache quota if Quota is set
+	Quota bool   // the cache quota (see SetCacheQuota) is exceeded
+}
+
+func (e *InsufficientSpaceError) Error() string {
+	if e.Quota {
+		return fmt.Sprintf("module cache quota exceeded: need %d bytes, %d bytes left", e.Need, e.Avail)
+	}
+	return fmt.Sprintf("insufficient disk space in %s: need %d bytes, %d bytes available", e.Dir, e.Need, e.Avail)
+}
+
+func (e *InsufficientSpaceError) Is(target error) bool {
+	return target == ErrInsufficientSpace
+}
+
+type cacheQuota struct {
+	mu    sync.Mutex
+	limit int64 // 0 means no quota
+	used  int64 // -1 if not computed yet
+}
+
+var quota = &cacheQuota{used: -1}
+
+// SetCacheQuota sets the maximum total size (in bytes) of the zip files in
+// GOMODCACHE/cache/download. Zip files which would be written into GOMODCACHE
+// (see ZipOptions.Dir) are rejected if the quota would be exceeded. Only zip
+// files are counted: .mod/.info files and extracted module directories are
+// not. n <= 0 means no quota (the default).
+//
+// The size of existing zip files is computed by walking GOMODCACHE once, when
+// the quota is checked for the first time, and then it's updated as zip files
+// are downloaded.
+func SetCacheQuota(n int64) {
+	if n < 0 {
+		n = 0
+	}
+	quota.mu.Lock()
+	defer quota.mu.Unlock()
+	quota.limit, quota.used = n, -1
+}
+
+// usage returns the quota and the size of zip files in GOMODCACHE. The module
+// cache is walked without holding p.mu if the size isn't computed yet.
+func (p *cacheQuota) usage() (limit, used int64) {
+	p.mu.Lock()
+	limit, used = p.limit, p.used
+	p.mu.Unlock()
+	if limit == 0 || used >= 0 {
+		return
+	}
+	n := zipsSize(filepath.Join(modcache.GOMODCACHE, "cache", "download"))
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.used < 0 {
+		p.used = n
+	}
+	return p.limit, p.used
+}
+
+// checkSpace checks if there is enough disk space (and cache quota if dir is
+// in GOMODCACHE) to write size bytes into dir.
+func checkSpace(dir string, size int64) error {
+	if avail, ok := modcache.DiskFree(dir); ok && avail < size {
+		return &InsufficientSpaceError{Dir: dir, Need: size, Avail: avail}
+	}
+	if !modcache.InPath(dir) {
+		return nil
+	}
+	limit, used := quota.usage()
+	if limit == 0 {
+		return nil
+	}
+	if left := limit - used; left < size {
+		return &InsufficientSpaceError{Dir: dir, Need: size, Avail: left, Quota: true}
+	}
+	return nil
+}
+
+// addUsage records a zip file of size bytes written into dir.
+func addUsage(dir string, size int64) {
+	if !modcache.InPath(dir) {
+		return
+	}
+	p := quota
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.used >= 0 {
+		p.used += size
+	}
+}
+
+// zipsSize returns the total size of zip files in dir (recursively).
+func zipsSize(dir string) (n int64) {
+	filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err == nil && d.Type().IsRegular() && strings.HasSuffix(path, ".zip") {
+			if fi, e := d.Info(); e == nil {
+				n += fi.Size()
+			}
+		}
+		return nil
+	})
+	return
+}
+
+// -----------------------------------------------------------------------------
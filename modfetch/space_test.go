@@ -0,0 +1,89 @@
+/*
+ * Copyright (c) 2024 The GoPlus Authors (goplus.org). All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package modfetch
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/goplus/mod/modcache"
+)
+
+func TestCacheQuota(t *testing.T) {
+	cache := modcache.GOMODCACHE
+	defer func() {
+		modcache.GOMODCACHE = cache
+		SetCacheQuota(0)
+	}()
+	modcache.GOMODCACHE = t.TempDir()
+	dir := filepath.Join(modcache.GOMODCACHE, "cache", "download", "example.com", "foo", "@v")
+	os.MkdirAll(dir, 0777)
+	os.WriteFile(filepath.Join(dir, "v1.0.0.zip"), make([]byte, 100), 0666)
+	os.WriteFile(filepath.Join(dir, "v1.0.0.mod"), make([]byte, 1000), 0666) // not counted
+	os.MkdirAll(filepath.Join(modcache.GOMODCACHE, "example.com", "foo@v1.0.0"), 0777)
+	os.WriteFile(filepath.Join(modcache.GOMODCACHE, "example.com", "foo@v1.0.0", "a.go"), make([]byte, 1000), 0666)
+
+	if err := checkSpace(dir, 1000); err != nil {
+		t.Fatal("checkSpace without quota:", err)
+	}
+	SetCacheQuota(150)
+	if err := checkSpace(dir, 40); err != nil {
+		t.Fatal("checkSpace:", err)
+	}
+	var e *InsufficientSpaceError
+	err := checkSpace(dir, 60)
+	if !errors.As(err, &e) || !e.Quota || e.Need != 60 || e.Avail != 50 || !errors.Is(err, ErrInsufficientSpace) {
+		t.Fatal("checkSpace:", err)
+	}
+	if v := err.Error(); v != "module cache quota exceeded: need 60 bytes, 50 bytes left" {
+		t.Fatal("InsufficientSpaceError:", v)
+	}
+	addUsage(dir, 40)
+	if err = checkSpace(dir, 20); !errors.As(err, &e) || e.Avail != 10 {
+		t.Fatal("checkSpace after addUsage:", err)
+	}
+	addUsage(t.TempDir(), 1000) // not in GOMODCACHE
+	if err = checkSpace(dir, 10); err != nil {
+		t.Fatal("checkSpace:", err)
+	}
+	if err = checkSpace(t.TempDir(), 1000); err != nil {
+		t.Fatal("checkSpace outside GOMODCACHE:", err)
+	}
+
+	SetCacheQuota(1000) // recomputed from GOMODCACHE
+	if err = checkSpace(dir, 901); !errors.As(err, &e) || e.Avail != 900 {
+		t.Fatal("checkSpace after SetCacheQuota:", err)
+	}
+}
+
+func TestDiskSpace(t *testing.T) {
+	dir := t.TempDir()
+	avail, ok := modcache.DiskFree(dir)
+	if !ok {
+		t.Skip("disk free space unknown")
+	}
+	var e *InsufficientSpaceError
+	err := checkSpace(dir, avail+1<<40)
+	if !errors.As(err, &e) || e.Quota || e.Dir != dir || !errors.Is(err, ErrInsufficientSpace) {
+		t.Fatal("checkSpace:", err)
+	}
+	if err = checkSpace(dir, 1); err != nil {
+		t.Fatal("checkSpace:", err)
+	}
+}
@@ -0,0 +1,247 @@
+/*
+ * Copyright (c) 2024 The GoPlus Authors (goplus.org). All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package modfetch
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+
+	"github.com/goplus/mod/modcache"
+	"golang.org/x/mod/module"
+
+	modzip "golang.org/x/mod/zip"
+)
+
+// -----------------------------------------------------------------------------
+
+// A Strategy tells how a module (or package) is resolved by Get or GetPkg.
+type Strategy int
+
+const (
+	StrategyCache     Strategy = iota + 1 // found in GOMODCACHE
+	StrategyProxy                         // downloaded from a module proxy directly (the go command is disabled)
+	StrategyGoCommand                     // downloaded by the go command from a module proxy
+	StrategyDirect                        // downloaded by the go command from VCS directly (no module proxy is usable)
+)
+
+var strategyNames = [...]string{
+	StrategyCache:     "cache",
+	StrategyProxy:     "proxy",
+	StrategyGoCommand: "go-command",
+	StrategyDirect:    "direct-vcs",
+}
+
+// String returns the name of the strategy, eg. "cache" or "go-command".
+func (s Strategy) String() string {
+	if s > 0 && int(s) < len(strategyNames) {
+		return strategyNames[s]
+	}
+	return ""
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (s Strategy) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (s *Strategy) UnmarshalText(text []byte) error {
+	for i, name := range strategyNames {
+		if name != "" && name == string(text) {
+			*s = Strategy(i)
+			return nil
+		}
+	}
+	if len(text) == 0 {
+		*s = 0
+		return nil
+	}
+	return fmt.Errorf("unknown strategy: %s", text)
+}
+
+// A Report describes how a module (or package) is resolved by GetContextEx
+// or GetPkgContextEx.
+type Report struct {
+	Strategy Strategy
+	Proxy    string   // module proxy used to resolve, if known
+	Sum      SumCheck // how the download is checked (zero if nothing is downloaded)
+}
+
+// -----------------------------------------------------------------------------
+
+// ErrGoCommandDisabled is returned if a module isn't found in GOMODCACHE and
+// there is no module proxy to download it from while the go command is
+// disabled (see SetGoCommandEnabled).
+var ErrGoCommandDisabled = errors.New("go command is disabled")
+
+var goCommandDisabled int32
+
+// SetGoCommandEnabled enables or disables running the go command (enabled by
+// default). While it's disabled, Get and GetPkg never start subprocesses:
+// modules not in GOMODCACHE are downloaded from the module proxy directly
+// (see ProxyURLFor) and extracted to GOMODCACHE the same way the go command
+// does, and ErrGoCommandDisabled is returned if GOPROXY (or the matched proxy
+// route) is "direct" or "off".
+//
+// Modules downloaded directly are verified against the checksum database
+// (see SumCheckFor) the same way the go command does.
+func SetGoCommandEnabled(enabled bool) {
+	var v int32
+	if !enabled {
+		v = 1
+	}
+	atomic.StoreInt32(&goCommandDisabled, v)
+}
+
+// GoCommandEnabled reports whether running the go command is enabled.
+func GoCommandEnabled() bool {
+	return atomic.LoadInt32(&goCommandDisabled) == 0
+}
+
+// goCommandReport returns the report of resolving modPath by the go command.
+func goCommandReport(modPath string) Report {
+	sum := SumCheckFor(modPath)
+	if _, err := ProxyURLFor(modPath); err != nil {
+		return Report{Strategy: StrategyDirect, Sum: sum}
+	}
+	return Report{Strategy: StrategyGoCommand, Sum: sum}
+}
+
+// getFromProxy downloads modPath (maybe with @version) from the module proxy
+// of modPath to GOMODCACHE without running the go command.
+func getFromProxy(ctx context.Context, modPath string) (mod module.Version, rep Report, err error) {
+	path, query := modPath, "latest"
+	if pos := strings.IndexByte(modPath, '@'); pos > 0 {
+		path, query = modPath[:pos], modPath[pos+1:]
+	}
+	proxy, err := ProxyURLFor(path)
+	if err != nil {
+		err = fmt.Errorf("%w: can't download %s without a module proxy", ErrGoCommandDisabled, path)
+		return
+	}
+	rep = Report{Strategy: StrategyProxy, Proxy: proxy}
+	mod, rep.Sum, err = downloadFromProxy(ctx, proxy, path, query)
+	return
+}
+
+// downloadFromProxy resolves path@query (query is a version or "latest") by
+// the module proxy and populates GOMODCACHE with the .info, .mod, .zip and
+// .ziphash files and the extracted module directory. Downloads are verified
+// against the checksum database if SumCheckFor(path) is SumVerified. Only the
+// zip file counts toward the cache quota (see SetCacheQuota).
+func downloadFromProxy(ctx context.Context, proxy, path, query string) (mod module.Version, sum SumCheck, err error) {
+	repo, err := newProxyRepo(proxy, path)
+	if err != nil {
+		return
+	}
+	var info *RevInfo
+	if query == "latest" {
+		info, err = repo.Latest(ctx)
+	} else {
+		info, err = repo.Stat(ctx, query)
+	}
+	if err != nil {
+		return
+	}
+	mod = module.Version{Path: path, Version: info.Version}
+	zipFile, err := modcache.DownloadCachePath(mod)
+	if err != nil {
+		return
+	}
+	err = modcache.Extract(mod, func(dir string) error {
+		sum = SumCheckFor(path)
+		return downloadZip(ctx, repo, info, zipFile, dir, sum == SumVerified)
+	})
+	return
+}
+
+func downloadZip(ctx context.Context, repo *proxyRepo, info *RevInfo, zipFile, dir string, verify bool) (err error) {
+	mod := module.Version{Path: repo.path, Version: info.Version}
+	base := strings.TrimSuffix(zipFile, ".zip")
+	var h1, goModH1 string
+	if verify {
+		if h1, goModH1, err = lookupSums(mod); err != nil {
+			return
+		}
+	}
+	gomod, err := repo.GoMod(ctx, mod.Version)
+	if err != nil {
+		return
+	}
+	if _, err = parseGoMod(mod, gomod); err != nil {
+		return
+	}
+	if verify {
+		if h, e := hashGoMod(gomod); e != nil || h != goModH1 {
+			return &SumMismatchError{Mod: mod, GoMod: true, Downloaded: h, SumDB: goModH1}
+		}
+	}
+	if err = writeFileAtomic(base+".mod", gomod); err != nil {
+		return
+	}
+	data, err := json.Marshal(info)
+	if err != nil {
+		return
+	}
+	if err = writeFileAtomic(base+".info", data); err != nil {
+		return
+	}
+	if _, e := os.Stat(zipFile); e != nil {
+		f, e := os.CreateTemp(filepath.Dir(zipFile), filepath.Base(zipFile)+".*.tmp")
+		if e != nil {
+			return e
+		}
+		ret, e := repo.ZipWith(ctx, f, mod.Version, &ZipOptions{Hash: true, Dir: filepath.Dir(zipFile)})
+		if e2 := f.Close(); e == nil {
+			e = e2
+		}
+		if e == nil && verify && ret.Hash != h1 {
+			e = &SumMismatchError{Mod: mod, Downloaded: ret.Hash, SumDB: h1}
+		}
+		if e == nil {
+			e = os.Rename(f.Name(), zipFile)
+		}
+		if e != nil {
+			os.Remove(f.Name())
+			return e
+		}
+		if err = modcache.WriteZipHash(mod, ret.Hash); err != nil {
+			return
+		}
+	} else if verify {
+		if h, _ := modcache.ReadZipHash(mod); h != h1 {
+			return &SumMismatchError{Mod: mod, Downloaded: h, SumDB: h1}
+		}
+	}
+	return modzip.Unzip(dir, mod, zipFile)
+}
+
+func writeFileAtomic(name string, data []byte) error {
+	tmp := name + ".tmp"
+	if err := os.WriteFile(tmp, data, 0666); err != nil {
+		return err
+	}
+	return os.Rename(tmp, name)
+}
+
+// -----------------------------------------------------------------------------
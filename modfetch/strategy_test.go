@@ -0,0 +1,136 @@
+/*
+ * Copyright (c) 2024 The GoPlus Authors (goplus.org). All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package modfetch
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/goplus/mod/modcache"
+	"golang.org/x/mod/module"
+
+	modzip "golang.org/x/mod/zip"
+)
+
+func TestStrategy(t *testing.T) {
+	for _, s := range []Strategy{StrategyCache, StrategyProxy, StrategyGoCommand, StrategyDirect} {
+		b, err := json.Marshal(s)
+		if err != nil {
+			t.Fatal("Marshal:", err)
+		}
+		var v Strategy
+		if err = json.Unmarshal(b, &v); err != nil || v != s {
+			t.Fatal("Unmarshal:", string(b), v, err)
+		}
+	}
+	if v := StrategyDirect.String(); v != "direct-vcs" {
+		t.Fatal("String:", v)
+	}
+	if v := Strategy(100).String(); v != "" {
+		t.Fatal("String:", v)
+	}
+	var v Strategy
+	if err := v.UnmarshalText([]byte("unknown")); err == nil {
+		t.Fatal("UnmarshalText: no error")
+	}
+}
+
+func TestGetFromProxy(t *testing.T) {
+	cache := modcache.GOMODCACHE
+	defer func() {
+		modcache.GOMODCACHE = cache
+		SetGoCommandEnabled(true)
+		SetCacheQuota(0)
+	}()
+	modcache.GOMODCACHE = t.TempDir()
+	SetGoCommandEnabled(false)
+
+	zips := make(map[string][]byte)
+	for _, path := range []string{"example.com/foo", "example.com/bar"} {
+		dir := t.TempDir()
+		os.WriteFile(filepath.Join(dir, "go.mod"), []byte("module "+path+"\n"), 0666)
+		os.WriteFile(filepath.Join(dir, "a.go"), []byte("package a\n"), 0666)
+		var b bytes.Buffer
+		if err := modzip.CreateFromDir(&b, module.Version{Path: path, Version: "v1.0.0"}, dir); err != nil {
+			t.Fatal("CreateFromDir:", err)
+		}
+		zips[path] = b.Bytes()
+	}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		pos := strings.Index(r.URL.Path, "/@v/")
+		if pos < 0 {
+			http.NotFound(w, r)
+			return
+		}
+		path, file := r.URL.Path[1:pos], r.URL.Path[pos+4:]
+		switch file {
+		case "v1.0.0.info":
+			w.Write([]byte(`{"Version":"v1.0.0"}`))
+		case "v1.0.0.mod":
+			w.Write([]byte("module " + path + "\n"))
+		case "v1.0.0.zip":
+			w.Write(zips[path])
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	t.Setenv("GOPROXY", ts.URL)
+	t.Setenv("GOSUMDB", "off")
+	t.Setenv("GOFLAGS", "")
+
+	ctx := context.Background()
+	mod, rep, err := GetContextEx(ctx, "example.com/foo@v1.0.0", false)
+	if err != nil || rep.Strategy != StrategyProxy || rep.Proxy != ts.URL {
+		t.Fatal("GetContextEx:", mod, rep, err)
+	}
+	if !modcache.Complete(mod) {
+		t.Fatal("GetContextEx: not extracted")
+	}
+	if _, rep, err = GetContextEx(ctx, "example.com/foo@v1.0.0", false); err != nil || rep.Strategy != StrategyCache {
+		t.Fatal("GetContextEx cached:", rep, err)
+	}
+
+	// the zip of example.com/foo is counted, but not its extracted directory
+	SetCacheQuota(int64(len(zips["example.com/foo"]) + len(zips["example.com/bar"]) - 1))
+	_, _, err = GetContextEx(ctx, "example.com/bar@v1.0.0", false)
+	var e *InsufficientSpaceError
+	if !errors.As(err, &e) || !e.Quota || e.Avail != int64(len(zips["example.com/bar"])-1) {
+		t.Fatal("GetContextEx over quota:", err)
+	}
+	if modcache.Complete(module.Version{Path: "example.com/bar", Version: "v1.0.0"}) {
+		t.Fatal("GetContextEx over quota: extracted")
+	}
+	SetCacheQuota(0)
+	if _, rep, err = GetContextEx(ctx, "example.com/bar@v1.0.0", false); err != nil || rep.Strategy != StrategyProxy {
+		t.Fatal("GetContextEx:", rep, err)
+	}
+
+	t.Setenv("GOPROXY", "off")
+	if _, _, err = GetContextEx(ctx, "example.com/baz@v1.0.0", false); !errors.Is(err, ErrGoCommandDisabled) {
+		t.Fatal("GetContextEx without proxy:", err)
+	}
+}
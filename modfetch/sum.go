@@ -0,0 +1,126 @@
+/*
+ * Copyright (c) 2024 The GoPlus Authors (goplus.org). All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package modfetch
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/goplus/mod/modcache"
+	"golang.org/x/mod/module"
+	"golang.org/x/mod/sumdb/dirhash"
+)
+
+// -----------------------------------------------------------------------------
+
+const defaultProxyURL = "https://proxy.golang.org"
+
+var (
+	ErrNoProxy = errors.New("no module proxy available")
+)
+
+// ProxyURL returns the first module proxy of GOPROXY (skipping "direct" and
+// "off"), or https://proxy.golang.org if GOPROXY isn't set.
+func ProxyURL() (string, error) {
+	return firstProxyURL(os.Getenv("GOPROXY"))
+}
+
+// Hashes returns the h1: hashes of a module zip and its go.mod, ie. hashes of
+// the two go.sum lines of mod. They are read from GOMODCACHE if possible, and
+// are computed by downloading from the module proxy (see ProxyURL) otherwise.
+func Hashes(ctx context.Context, mod module.Version) (h1, goModH1 string, err error) {
+	h1, goModH1 = CachedHashes(mod)
+	if h1 != "" && goModH1 != "" {
+		return
+	}
+	proxy, err := ProxyURLFor(mod.Path)
+	if err != nil {
+		return
+	}
+	repo, err := newProxyRepo(proxy, mod.Path)
+	if err != nil {
+		return
+	}
+	if goModH1 == "" {
+		data, e := repo.GoMod(ctx, mod.Version)
+		if e != nil {
+			return "", "", e
+		}
+		if goModH1, err = hashGoMod(data); err != nil {
+			return
+		}
+	}
+	if h1 == "" {
+		ret, e := repo.ZipWith(ctx, io.Discard, mod.Version, &ZipOptions{Hash: true})
+		if e != nil {
+			return "", "", e
+		}
+		h1 = ret.Hash
+	}
+	return
+}
+
+// CachedHashes returns the h1: hashes of a module zip and its go.mod like
+// Hashes, but only reads them from GOMODCACHE: a hash is empty if it isn't
+// there. Nothing is downloaded.
+func CachedHashes(mod module.Version) (h1, goModH1 string) {
+	h1, _ = modcache.ReadZipHash(mod)
+	goModH1 = goModHash(mod)
+	return
+}
+
+// SumLines returns the go.sum lines of mod, see Hashes.
+func SumLines(ctx context.Context, mod module.Version) ([]string, error) {
+	h1, goModH1, err := Hashes(ctx, mod)
+	if err != nil {
+		return nil, err
+	}
+	return []string{
+		mod.Path + " " + mod.Version + " " + h1,
+		mod.Path + " " + mod.Version + "/go.mod " + goModH1,
+	}, nil
+}
+
+// goModHash returns the h1: hash of go.mod of mod if it is in the download
+// cache of GOMODCACHE.
+func goModHash(mod module.Version) string {
+	zipFile, err := modcache.DownloadCachePath(mod)
+	if err != nil {
+		return ""
+	}
+	data, err := modcache.ReadFile(strings.TrimSuffix(zipFile, ".zip") + ".mod")
+	if err != nil {
+		return ""
+	}
+	h, err := hashGoMod(data)
+	if err != nil {
+		return ""
+	}
+	return h
+}
+
+func hashGoMod(data []byte) (string, error) {
+	return dirhash.Hash1([]string{"go.mod"}, func(string) (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(data)), nil
+	})
+}
+
+// -----------------------------------------------------------------------------
@@ -0,0 +1,286 @@
+/*
+ * Copyright (c) 2024 The GoPlus Authors (goplus.org). All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package modfetch
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/goplus/mod/modcache"
+	"golang.org/x/mod/module"
+	"golang.org/x/mod/sumdb"
+)
+
+// -----------------------------------------------------------------------------
+
+// A SumCheck tells whether a downloaded module is checked against the
+// checksum database (see GOSUMDB).
+type SumCheck int
+
+const (
+	SumVerified       SumCheck = iota + 1 // verified by the checksum database
+	SumSkippedPrivate                     // not looked up: the module matches GONOSUMDB (or GOPRIVATE)
+	SumUnverified                         // not looked up: the checksum database is disabled
+)
+
+var sumCheckNames = [...]string{
+	SumVerified:       "verified",
+	SumSkippedPrivate: "skipped-private",
+	SumUnverified:     "unverified",
+}
+
+// String returns the name of the decision, eg. "verified".
+func (s SumCheck) String() string {
+	if s > 0 && int(s) < len(sumCheckNames) {
+		return sumCheckNames[s]
+	}
+	return ""
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (s SumCheck) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (s *SumCheck) UnmarshalText(text []byte) error {
+	for i, name := range sumCheckNames {
+		if name != "" && name == string(text) {
+			*s = SumCheck(i)
+			return nil
+		}
+	}
+	if len(text) == 0 {
+		*s = 0
+		return nil
+	}
+	return fmt.Errorf("unknown sum check: %s", text)
+}
+
+// SumCheckFor returns how downloads of module modPath are checked, the same
+// way the go command does:
+//   - SumUnverified if GOSUMDB is "off" (or GOFLAGS has -insecure);
+//   - SumSkippedPrivate if modPath matches GONOSUMDB (GOPRIVATE by default);
+//   - SumVerified otherwise.
+func SumCheckFor(modPath string) SumCheck {
+	if os.Getenv("GOSUMDB") == "off" || hasGoFlag("-insecure") {
+		return SumUnverified
+	}
+	nosumdb := os.Getenv("GONOSUMDB")
+	if nosumdb == "" {
+		nosumdb = os.Getenv("GOPRIVATE")
+	}
+	if module.MatchPrefixPatterns(nosumdb, modPath) {
+		return SumSkippedPrivate
+	}
+	return SumVerified
+}
+
+func hasGoFlag(flag string) bool {
+	for _, f := range strings.Fields(os.Getenv("GOFLAGS")) {
+		if f == flag || strings.HasPrefix(f, flag+"=") && f[len(flag)+1:] != "false" {
+			return true
+		}
+	}
+	return false
+}
+
+// -----------------------------------------------------------------------------
+
+// A SumMismatchError is returned if a downloaded module doesn't match the
+// checksum database.
+type SumMismatchError struct {
+	Mod        module.Version
+	GoMod      bool   // go.mod (instead of the module zip) mismatches
+	Downloaded string // h1: hash of the downloaded content
+	SumDB      string // h1: hash recorded in the checksum database
+}
+
+func (e *SumMismatchError) Error() string {
+	ver := e.Mod.Version
+	if e.GoMod {
+		ver += "/go.mod"
+	}
+	return fmt.Sprintf("verifying %s@%s: checksum mismatch\n\tdownloaded: %s\n\tsumdb:      %s", e.Mod.Path, ver, e.Downloaded, e.SumDB)
+}
+
+// known checksum databases: name => key
+var knownSumDBs = map[string]string{
+	"sum.golang.org": "sum.golang.org+033de0ae+Ac4zctda0e5eza+HJyk9SxEdh+s3Ly6Ar6Ai0mDMu0fKq",
+}
+
+// parseSumDB parses GOSUMDB in the form "name[+key] [url]".
+func parseSumDB(gosumdb string) (name, key, url string, err error) {
+	if gosumdb == "" {
+		gosumdb = "sum.golang.org"
+	}
+	f := strings.Fields(gosumdb)
+	if len(f) == 0 || len(f) > 2 {
+		return "", "", "", fmt.Errorf("invalid GOSUMDB: %s", gosumdb)
+	}
+	if pos := strings.IndexByte(f[0], '+'); pos > 0 {
+		name, key = f[0][:pos], f[0]
+	} else {
+		name = f[0]
+		if name == "sum.golang.google.cn" { // mirror of sum.golang.org
+			key, url = knownSumDBs["sum.golang.org"], "https://sum.golang.google.cn"
+		} else if key = knownSumDBs[name]; key == "" {
+			return "", "", "", fmt.Errorf("invalid GOSUMDB: missing key of %s", name)
+		}
+	}
+	if len(f) == 2 {
+		url = f[1]
+	} else if url == "" {
+		url = "https://" + name
+	}
+	return name, key, strings.TrimSuffix(url, "/"), nil
+}
+
+var (
+	sumdbMu      sync.Mutex
+	sumdbClients map[string]*sumdb.Client // GOSUMDB => client
+)
+
+func sumdbClient() (*sumdb.Client, error) {
+	gosumdb := os.Getenv("GOSUMDB")
+	sumdbMu.Lock()
+	defer sumdbMu.Unlock()
+	if c, ok := sumdbClients[gosumdb]; ok {
+		return c, nil
+	}
+	name, key, url, err := parseSumDB(gosumdb)
+	if err != nil {
+		return nil, err
+	}
+	c := sumdb.NewClient(&sumdbOps{name: name, key: key, url: url})
+	if sumdbClients == nil {
+		sumdbClients = make(map[string]*sumdb.Client)
+	}
+	sumdbClients[gosumdb] = c
+	return c, nil
+}
+
+// lookupSums returns the h1: hashes of a module zip and its go.mod recorded
+// in the checksum database.
+func lookupSums(mod module.Version) (h1, goModH1 string, err error) {
+	c, err := sumdbClient()
+	if err != nil {
+		return
+	}
+	if h1, err = lookupSum(c, mod.Path, mod.Version); err != nil {
+		return
+	}
+	goModH1, err = lookupSum(c, mod.Path, mod.Version+"/go.mod")
+	return
+}
+
+func lookupSum(c *sumdb.Client, path, vers string) (string, error) {
+	lines, err := c.Lookup(path, vers)
+	if err != nil {
+		return "", err
+	}
+	for _, line := range lines {
+		if f := strings.Fields(line); len(f) == 3 {
+			return f[2], nil
+		}
+	}
+	return "", fmt.Errorf("%s@%s: not found in checksum database", path, vers)
+}
+
+// sumdbOps implements sumdb.ClientOps. Tiles are cached in the same directory
+// as the go command does (GOMODCACHE/cache/download/sumdb), while the latest
+// signed tree is only remembered in memory.
+type sumdbOps struct {
+	name, key, url string
+
+	mu     sync.Mutex
+	latest []byte
+}
+
+func (p *sumdbOps) ReadRemote(path string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(context.Background(), "GET", p.url+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	applyHeaders(req)
+	resp, err := httpClient(p.name).Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %s%s: %s", p.url, path, resp.Status)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+func (p *sumdbOps) ReadConfig(file string) ([]byte, error) {
+	if file == "key" {
+		return []byte(p.key), nil
+	}
+	if file == p.name+"/latest" {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		return p.latest, nil
+	}
+	return nil, fmt.Errorf("unknown config %s", file)
+}
+
+func (p *sumdbOps) WriteConfig(file string, old, new []byte) error {
+	if file != p.name+"/latest" {
+		return fmt.Errorf("can't write config %s", file)
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !bytes.Equal(p.latest, old) {
+		return sumdb.ErrWriteConflict
+	}
+	p.latest = new
+	return nil
+}
+
+func (p *sumdbOps) cacheFile(file string) string {
+	return filepath.Join(modcache.GOMODCACHE, "cache", "download", "sumdb", file)
+}
+
+func (p *sumdbOps) ReadCache(file string) ([]byte, error) {
+	return modcache.ReadFile(p.cacheFile(file))
+}
+
+func (p *sumdbOps) WriteCache(file string, data []byte) {
+	name := p.cacheFile(file)
+	if os.MkdirAll(filepath.Dir(name), 0755) == nil {
+		writeFileAtomic(name, data)
+	}
+}
+
+func (p *sumdbOps) Log(msg string) {
+	logDebug(msg, Field{"sumdb", p.name})
+}
+
+func (p *sumdbOps) SecurityError(msg string) {
+	logRecord(LevelError, "SECURITY ERROR: "+msg, Field{"sumdb", p.name})
+}
+
+// -----------------------------------------------------------------------------
@@ -0,0 +1,137 @@
+/*
+ * Copyright (c) 2024 The GoPlus Authors (goplus.org). All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package modfetch
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/goplus/mod/modcache"
+	"golang.org/x/mod/module"
+	"golang.org/x/mod/sumdb"
+	"golang.org/x/mod/sumdb/dirhash"
+	"golang.org/x/mod/sumdb/note"
+
+	modzip "golang.org/x/mod/zip"
+)
+
+func TestSumCheck(t *testing.T) {
+	cache := modcache.GOMODCACHE
+	defer func() {
+		modcache.GOMODCACHE = cache
+		SetGoCommandEnabled(true)
+	}()
+	modcache.GOMODCACHE = t.TempDir()
+	SetGoCommandEnabled(false)
+
+	zips := make(map[string][]byte) // path => module zip
+	sums := make(map[string]string) // path => go.sum lines
+	for _, path := range []string{"example.com/foo", "example.com/bar", "example.com/baz"} {
+		mod := module.Version{Path: path, Version: "v1.0.0"}
+		dir := t.TempDir()
+		gomod := []byte("module " + path + "\n")
+		os.WriteFile(filepath.Join(dir, "go.mod"), gomod, 0666)
+		os.WriteFile(filepath.Join(dir, "a.go"), []byte("package a\n"), 0666)
+		var b bytes.Buffer
+		if err := modzip.CreateFromDir(&b, mod, dir); err != nil {
+			t.Fatal("CreateFromDir:", err)
+		}
+		zipFile := filepath.Join(t.TempDir(), "a.zip")
+		os.WriteFile(zipFile, b.Bytes(), 0666)
+		h1, _ := dirhash.HashZip(zipFile, dirhash.Hash1)
+		goModH1, _ := hashGoMod(gomod)
+		if path == "example.com/bar" { // tampered
+			h1 = "h1:" + strings.Repeat("A", 43) + "="
+		}
+		zips[path] = b.Bytes()
+		sums[path] = fmt.Sprintf("%s v1.0.0 %s\n%s v1.0.0/go.mod %s\n", path, h1, path, goModH1)
+	}
+
+	skey, vkey, err := note.GenerateKey(rand.Reader, "sum.example.com")
+	if err != nil {
+		t.Fatal("GenerateKey:", err)
+	}
+	sumsrv := sumdb.NewServer(sumdb.NewTestServer(skey, func(path, vers string) ([]byte, error) {
+		return []byte(sums[path]), nil
+	}))
+	mux := http.NewServeMux()
+	mux.Handle("/sumdb/", http.StripPrefix("/sumdb", sumsrv))
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		pos := strings.Index(r.URL.Path, "/@v/")
+		if pos < 0 {
+			http.NotFound(w, r)
+			return
+		}
+		path, file := r.URL.Path[1:pos], r.URL.Path[pos+4:]
+		switch file {
+		case "v1.0.0.info":
+			w.Write([]byte(`{"Version":"v1.0.0"}`))
+		case "v1.0.0.mod":
+			w.Write([]byte("module " + path + "\n"))
+		case "v1.0.0.zip":
+			w.Write(zips[path])
+		default:
+			http.NotFound(w, r)
+		}
+	})
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	t.Setenv("GOPROXY", ts.URL)
+	t.Setenv("GOSUMDB", vkey+" "+ts.URL+"/sumdb")
+	t.Setenv("GONOSUMDB", "")
+	t.Setenv("GOPRIVATE", "example.com/baz")
+	t.Setenv("GOFLAGS", "")
+
+	ctx := context.Background()
+	if _, rep, err := GetContextEx(ctx, "example.com/foo@v1.0.0", false); err != nil || rep.Sum != SumVerified {
+		t.Fatal("GetContextEx foo:", rep, err)
+	}
+	_, _, err = GetContextEx(ctx, "example.com/bar@v1.0.0", false)
+	var e *SumMismatchError
+	if !errors.As(err, &e) || e.GoMod || e.Mod.Path != "example.com/bar" {
+		t.Fatal("GetContextEx bar:", err)
+	}
+	if _, rep, err := GetContextEx(ctx, "example.com/baz@v1.0.0", false); err != nil || rep.Sum != SumSkippedPrivate {
+		t.Fatal("GetContextEx baz:", rep, err)
+	}
+	t.Setenv("GOSUMDB", "off")
+	if v := SumCheckFor("example.com/foo"); v != SumUnverified || v.String() != "unverified" {
+		t.Fatal("SumCheckFor:", v)
+	}
+}
+
+func TestParseSumDB(t *testing.T) {
+	if name, key, url, err := parseSumDB(""); err != nil || name != "sum.golang.org" || key != knownSumDBs[name] || url != "https://sum.golang.org" {
+		t.Fatal("parseSumDB:", name, key, url, err)
+	}
+	if name, _, url, err := parseSumDB("sum.golang.google.cn"); err != nil || name != "sum.golang.google.cn" || url != "https://sum.golang.google.cn" {
+		t.Fatal("parseSumDB:", name, url, err)
+	}
+	if _, _, _, err := parseSumDB("sum.example.com"); err == nil {
+		t.Fatal("parseSumDB: no error")
+	}
+}
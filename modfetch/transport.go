@@ -0,0 +1,254 @@
+/*
+ * Copyright (c) 2024 The GoPlus Authors (goplus.org). All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package modfetch
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"net"
+	"net/http"
+	"os"
+	"runtime/debug"
+	"sync"
+
+	"golang.org/x/mod/module"
+)
+
+// -----------------------------------------------------------------------------
+
+// DefaultMaxIdleConnsPerHost is the number of idle (keep-alive) connections
+// kept per proxy host, so that parallel fetches of many small .info and .mod
+// files reuse connections instead of dialing new ones.
+const DefaultMaxIdleConnsPerHost = 16
+
+var (
+	transportMu     sync.Mutex
+	transport       http.RoundTripper // custom transport (nil if not set)
+	tlsConfig       *tls.Config       // custom TLS config (nil if not set)
+	maxConnsPerHost int               // 0 means no limit
+	clients         [2]*http.Client   // cached clients: [secure, insecure]
+
+	socketClients map[string]*http.Client // cached clients of unix sockets
+)
+
+// SetTransport sets the http.RoundTripper used by requests to module proxies
+// (and go-import meta lookups). If rt is nil, a pooled transport derived from
+// http.DefaultTransport is used: connections are kept alive (up to
+// DefaultMaxIdleConnsPerHost idle ones per host) and HTTP/2 is enabled.
+//
+// Note that a custom transport of type other than *http.Transport is used as
+// is: neither SetTLSConfig, SetMaxConnsPerHost nor GOINSECURE takes effect on
+// it.
+func SetTransport(rt http.RoundTripper) {
+	transportMu.Lock()
+	defer transportMu.Unlock()
+	transport, clients, socketClients = rt, [2]*http.Client{}, nil
+}
+
+// SetTLSConfig sets the TLS config of requests to module proxies, eg. to trust
+// the self-signed certificate of a corporate proxy. If cfg is nil, the default
+// TLS config is used.
+func SetTLSConfig(cfg *tls.Config) {
+	transportMu.Lock()
+	defer transportMu.Unlock()
+	tlsConfig, clients, socketClients = cfg, [2]*http.Client{}, nil
+}
+
+// SetMaxConnsPerHost limits the number of concurrent connections (dialing,
+// active and idle ones) to each proxy host. Requests exceeding the limit wait
+// for a connection to be available. n <= 0 means no limit, the default.
+func SetMaxConnsPerHost(n int) {
+	if n < 0 {
+		n = 0
+	}
+	transportMu.Lock()
+	defer transportMu.Unlock()
+	maxConnsPerHost, clients, socketClients = n, [2]*http.Client{}, nil
+}
+
+// SetCABundle trusts certificates of the PEM-encoded CA bundle file caFile in
+// addition to the system certificate pool. It's a shortcut of SetTLSConfig.
+func SetCABundle(caFile string) error {
+	data, err := os.ReadFile(caFile)
+	if err != nil {
+		return err
+	}
+	pool, err := x509.SystemCertPool()
+	if err != nil || pool == nil {
+		pool = x509.NewCertPool()
+	}
+	if !pool.AppendCertsFromPEM(data) {
+		return errors.New("no certificates found in " + caFile)
+	}
+	SetTLSConfig(&tls.Config{RootCAs: pool})
+	return nil
+}
+
+// IsInsecure reports whether TLS verification is skipped when fetching module
+// modPath, that is, modPath matches the GOINSECURE patterns.
+func IsInsecure(modPath string) bool {
+	return module.MatchPrefixPatterns(os.Getenv("GOINSECURE"), modPath)
+}
+
+// httpClientFor returns the http client used to fetch module modPath from a
+// proxy. If socket isn't empty, the proxy listens on the unix socket.
+func httpClientFor(modPath, socket string) *http.Client {
+	if socket == "" {
+		return httpClient(modPath)
+	}
+	transportMu.Lock()
+	defer transportMu.Unlock()
+	if c, ok := socketClients[socket]; ok {
+		return c
+	}
+	rt := newTransport(transport, nil, false)
+	if t, ok := rt.(*http.Transport); ok {
+		t = t.Clone()
+		t.Proxy = nil // never send requests of a local socket to HTTP_PROXY
+		t.DialContext = func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", socket)
+		}
+		rt = t
+	}
+	c := &http.Client{Transport: rt}
+	if socketClients == nil {
+		socketClients = make(map[string]*http.Client)
+	}
+	socketClients[socket] = c
+	return c
+}
+
+// httpClient returns the http client used to fetch module (or package) modPath.
+func httpClient(modPath string) *http.Client {
+	idx := 0
+	if IsInsecure(modPath) {
+		idx = 1
+	}
+	transportMu.Lock()
+	defer transportMu.Unlock()
+	if c := clients[idx]; c != nil {
+		return c
+	}
+	c := &http.Client{Transport: newTransport(transport, tlsConfig, idx == 1)}
+	clients[idx] = c
+	return c
+}
+
+// newTransport returns the transport derived from rt (or the pooled transport
+// if rt is nil) with TLS config cfg, GOINSECURE and SetMaxConnsPerHost applied.
+// transportMu must be held.
+func newTransport(rt http.RoundTripper, cfg *tls.Config, insecure bool) http.RoundTripper {
+	pooled := rt == nil
+	if pooled {
+		rt = http.DefaultTransport
+	}
+	t, ok := rt.(*http.Transport)
+	if !ok {
+		return rt
+	}
+	t = t.Clone()
+	if pooled {
+		t.ForceAttemptHTTP2 = true
+		t.MaxIdleConnsPerHost = DefaultMaxIdleConnsPerHost
+	}
+	if maxConnsPerHost > 0 {
+		t.MaxConnsPerHost = maxConnsPerHost
+	}
+	if cfg != nil {
+		t.TLSClientConfig = cfg.Clone()
+	}
+	if insecure {
+		if t.TLSClientConfig == nil {
+			t.TLSClientConfig = new(tls.Config)
+		}
+		t.TLSClientConfig.InsecureSkipVerify = true
+	}
+	return t
+}
+
+// -----------------------------------------------------------------------------
+
+var (
+	headerMu  sync.RWMutex
+	userAgent string      // empty if not set
+	headers   http.Header // extra headers
+)
+
+// SetUserAgent sets the User-Agent header of requests to module proxies. The
+// default is "gop-mod/<version>", and an empty ua restores the default.
+func SetUserAgent(ua string) {
+	headerMu.Lock()
+	defer headerMu.Unlock()
+	userAgent = ua
+}
+
+// SetHeaders sets extra headers of requests to module proxies, eg. to
+// identify the traffic of a tool. h replaces the previous extra headers.
+func SetHeaders(h http.Header) {
+	headerMu.Lock()
+	defer headerMu.Unlock()
+	headers = h.Clone()
+}
+
+// UserAgent returns the User-Agent header of requests to module proxies.
+func UserAgent() string {
+	headerMu.RLock()
+	defer headerMu.RUnlock()
+	if userAgent != "" {
+		return userAgent
+	}
+	return defaultUserAgent()
+}
+
+var (
+	defaultUA     string
+	defaultUAOnce sync.Once
+)
+
+func defaultUserAgent() string {
+	defaultUAOnce.Do(func() {
+		defaultUA = "gop-mod/" + modVersion()
+	})
+	return defaultUA
+}
+
+// modVersion returns version of this module (github.com/goplus/mod) linked
+// into the running binary, or "devel" if it's unknown.
+func modVersion() string {
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, dep := range info.Deps {
+			if dep.Path == "github.com/goplus/mod" && dep.Version != "" && dep.Version != "(devel)" {
+				return dep.Version
+			}
+		}
+	}
+	return "devel"
+}
+
+func applyHeaders(req *http.Request) {
+	headerMu.RLock()
+	for k, v := range headers {
+		req.Header[k] = append([]string(nil), v...)
+	}
+	headerMu.RUnlock()
+	req.Header.Set("User-Agent", UserAgent())
+}
+
+// -----------------------------------------------------------------------------
@@ -0,0 +1,129 @@
+/*
+ * Copyright (c) 2024 The GoPlus Authors (goplus.org). All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package modfetch
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestInsecureAndTLSConfig(t *testing.T) {
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("v1.0.0\n"))
+	}))
+	ts.Config.ErrorLog = log.New(io.Discard, "", 0) // handshake errors are expected
+	ts.StartTLS()
+	defer ts.Close()
+	defer SetTLSConfig(nil)
+	t.Setenv("GOINSECURE", "")
+
+	ctx := context.Background()
+	versions := func() error {
+		repo, err := newProxyRepo(ts.URL, "example.com/foo")
+		if err != nil {
+			return err
+		}
+		_, err = repo.Versions(ctx, "")
+		return err
+	}
+	if err := versions(); err == nil {
+		t.Fatal("Versions: self-signed certificate accepted")
+	}
+
+	t.Setenv("GOINSECURE", "example.com/bar,example.com/foo")
+	if !IsInsecure("example.com/foo/sub") || IsInsecure("example.com/baz") {
+		t.Fatal("IsInsecure")
+	}
+	if err := versions(); err != nil {
+		t.Fatal("Versions with GOINSECURE:", err)
+	}
+	t.Setenv("GOINSECURE", "")
+
+	pool := x509.NewCertPool()
+	pool.AddCert(ts.Certificate())
+	SetTLSConfig(&tls.Config{RootCAs: pool})
+	if err := versions(); err != nil {
+		t.Fatal("Versions with SetTLSConfig:", err)
+	}
+	SetTLSConfig(nil)
+	if err := versions(); err == nil {
+		t.Fatal("Versions: TLS config not reset")
+	}
+
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ts.Certificate().Raw}), 0666)
+	if err := SetCABundle(caFile); err != nil {
+		t.Fatal("SetCABundle:", err)
+	}
+	if err := versions(); err != nil {
+		t.Fatal("Versions with SetCABundle:", err)
+	}
+	os.WriteFile(caFile, []byte("not a certificate"), 0666)
+	if err := SetCABundle(caFile); err == nil {
+		t.Fatal("SetCABundle: no error for an invalid bundle")
+	}
+	if err := SetCABundle(filepath.Join(t.TempDir(), "nonexist.pem")); err == nil {
+		t.Fatal("SetCABundle: no error for a nonexistent file")
+	}
+}
+
+func TestHeaders(t *testing.T) {
+	var got http.Header
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Clone()
+		w.Write([]byte("v1.0.0\n"))
+	}))
+	defer ts.Close()
+
+	ctx := context.Background()
+	repo, err := newProxyRepo(ts.URL, "example.com/foo")
+	if err != nil {
+		t.Fatal("newProxyRepo:", err)
+	}
+	versions := func() http.Header {
+		if _, err := repo.Versions(ctx, ""); err != nil {
+			t.Fatal("Versions:", err)
+		}
+		return got
+	}
+
+	defer SetHeaders(nil)
+	defer SetUserAgent("")
+	if h := versions(); !strings.HasPrefix(h.Get("User-Agent"), "gop-mod/") || h.Get("User-Agent") != UserAgent() {
+		t.Fatal("default User-Agent:", h.Get("User-Agent"))
+	}
+	SetUserAgent("custom/1.0")
+	SetHeaders(http.Header{"X-Tool": {"mytool"}, "User-Agent": {"ignored"}})
+	if h := versions(); h.Get("User-Agent") != "custom/1.0" || h.Get("X-Tool") != "mytool" {
+		t.Fatal("SetUserAgent/SetHeaders:", h)
+	}
+	SetUserAgent("")
+	SetHeaders(nil)
+	if h := versions(); !strings.HasPrefix(h.Get("User-Agent"), "gop-mod/") || h.Get("X-Tool") != "" {
+		t.Fatal("reset headers:", h)
+	}
+}
@@ -0,0 +1,96 @@
+/*
+ * Copyright (c) 2024 The GoPlus Authors (goplus.org). All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package modfile
+
+import (
+	"strings"
+
+	"github.com/qiniu/x/errors"
+)
+
+// -----------------------------------------------------------------------------
+
+// A Builder builds a gop.mod file with syntax nodes, eg.
+//
+//	f, err := modfile.NewBuilder("gop.mod", "1.2").
+//		Project(".gmx", "Game", "github.com/goplus/spx", "math").
+//		Class(".spx", "Sprite").
+//		Import("", "github.com/goplus/spx/pkg/gdi").
+//		Runner("github.com/goplus/spx/cmd/spxrun", "v1.0.0").
+//		File()
+//
+// Each statement is validated the same way as Parse does.
+type Builder struct {
+	f    *File
+	errs ErrorList
+}
+
+// NewBuilder creates a Builder of a new gop.mod file.
+func NewBuilder(gopmod, gopVer string) *Builder {
+	return &Builder{f: New(gopmod, gopVer)}
+}
+
+// Project adds a project statement. ext and class can be empty (only
+// package paths are specified).
+func (p *Builder) Project(ext, class string, pkgPaths ...string) *Builder {
+	args := make([]string, 0, 2+len(pkgPaths))
+	if ext != "" || class != "" {
+		args = append(args, ext, class)
+	}
+	return p.add("project", append(args, pkgPaths...))
+}
+
+// Class adds a work class statement to the current project.
+// proto is an optional project class of the work class.
+func (p *Builder) Class(ext, class string, proto ...string) *Builder {
+	return p.add("class", append([]string{ext, class}, proto...))
+}
+
+// Import adds an import statement to the current project.
+// name is the optional package alias.
+func (p *Builder) Import(name, pkgPath string) *Builder {
+	if name != "" {
+		return p.add("import", []string{name, pkgPath})
+	}
+	return p.add("import", []string{pkgPath})
+}
+
+// Runner adds a runner statement to the current project.
+func (p *Builder) Runner(pkgPath, version string) *Builder {
+	return p.add("runner", append([]string{pkgPath}, strings.Fields(version)...))
+}
+
+func (p *Builder) add(verb string, args []string) *Builder {
+	line := &Line{Token: append([]string{verb}, args...)}
+	n := len(p.errs)
+	p.f.parseVerb(&p.errs, verb, line, line.Token[1:], true)
+	if len(p.errs) == n {
+		p.f.Syntax.Stmt = append(p.f.Syntax.Stmt, line)
+	}
+	return p
+}
+
+// File returns the built gop.mod file, or an error list if any statement
+// is invalid.
+func (p *Builder) File() (*File, error) {
+	if len(p.errs) > 0 {
+		return nil, errors.NewWith(p.errs, `len(p.errs) > 0`, -1, ">", len(p.errs), 0)
+	}
+	return p.f, nil
+}
+
+// -----------------------------------------------------------------------------
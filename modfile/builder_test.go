@@ -0,0 +1,66 @@
+/*
+ * Copyright (c) 2024 The GoPlus Authors (goplus.org). All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package modfile
+
+import (
+	"testing"
+)
+
+func TestBuilder(t *testing.T) {
+	f, err := NewBuilder("/foo/gop.mod", "1.2").
+		Project(".gmx", "Game", "github.com/goplus/spx", "math").
+		Class(".spx", "Sprite").
+		Class(".spx3", "Sprite", "GameBase").
+		Import("", "github.com/goplus/spx/pkg/gdi").
+		Import("yauth", "github.com/goplus/yap/ytest/auth").
+		Runner("github.com/goplus/spx/cmd/spxrun", ">=v1.0.0 <v2").
+		Project("", "", "github.com/goplus/yap").
+		File()
+	if err != nil {
+		t.Fatal("Builder:", err)
+	}
+	if v := string(Format(f.Syntax)); v != `gop 1.2
+
+project .gmx Game github.com/goplus/spx math
+
+class .spx Sprite
+
+class .spx3 Sprite GameBase
+
+import github.com/goplus/spx/pkg/gdi
+
+import yauth github.com/goplus/yap/ytest/auth
+
+runner github.com/goplus/spx/cmd/spxrun >=v1.0.0 <v2
+
+project github.com/goplus/yap
+` {
+		t.Fatal("Format:", v)
+	}
+	if len(f.Projects) != 2 || len(f.Projects[0].Works) != 2 || f.Projects[0].Runner == nil {
+		t.Fatal("Builder: Projects", f.Projects)
+	}
+	f2, err := Parse("/foo/gop.mod", Format(f.Syntax), nil)
+	if err != nil || len(f2.Projects) != 2 || len(f2.Projects[0].Import) != 2 {
+		t.Fatal("Parse:", err)
+	}
+
+	_, err = NewBuilder("/foo/gop.mod", "1.2").Class(".spx", "Sprite").File()
+	if err == nil {
+		t.Fatal("Builder: no error?")
+	}
+}
@@ -0,0 +1,169 @@
+/*
+ * Copyright (c) 2024 The GoPlus Authors (goplus.org). All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package modfile
+
+// -----------------------------------------------------------------------------
+
+// CloneSyntax returns a deep copy of a file syntax tree, and a function that
+// maps a line of the original tree to its copy (or nil if line is nil or not
+// in the original tree).
+func CloneSyntax(syn *FileSyntax) (ret *FileSyntax, lineOf func(line *Line) *Line) {
+	lines := make(map[*Line]*Line)
+	lineOf = func(line *Line) *Line {
+		return lines[line]
+	}
+	if syn == nil {
+		return
+	}
+	ret = &FileSyntax{Name: syn.Name, Comments: cloneComments(syn.Comments)}
+	ret.Stmt = make([]Expr, len(syn.Stmt))
+	for i, stmt := range syn.Stmt {
+		switch x := stmt.(type) {
+		case *Line:
+			ret.Stmt[i] = cloneLine(x, lines)
+		case *LineBlock:
+			blk := *x
+			blk.Comments = cloneComments(x.Comments)
+			blk.LParen.Comments = cloneComments(x.LParen.Comments)
+			blk.RParen.Comments = cloneComments(x.RParen.Comments)
+			blk.Token = append([]string(nil), x.Token...)
+			blk.Line = make([]*Line, len(x.Line))
+			for j, line := range x.Line {
+				blk.Line[j] = cloneLine(line, lines)
+			}
+			ret.Stmt[i] = &blk
+		case *CommentBlock:
+			cb := *x
+			cb.Comments = cloneComments(x.Comments)
+			ret.Stmt[i] = &cb
+		default:
+			ret.Stmt[i] = stmt
+		}
+	}
+	return
+}
+
+func orLineOf(a, b func(*Line) *Line) func(*Line) *Line {
+	return func(line *Line) *Line {
+		if ret := a(line); ret != nil {
+			return ret
+		}
+		return b(line)
+	}
+}
+
+func cloneLine(line *Line, lines map[*Line]*Line) *Line {
+	ret := *line
+	ret.Comments = cloneComments(line.Comments)
+	ret.Token = append([]string(nil), line.Token...)
+	lines[line] = &ret
+	return &ret
+}
+
+func cloneComments(c Comments) Comments {
+	return Comments{
+		Before: append([]Comment(nil), c.Before...),
+		Suffix: append([]Comment(nil), c.Suffix...),
+		After:  append([]Comment(nil), c.After...),
+	}
+}
+
+// Clone returns a deep copy of this gop.mod file. Changes of the copy (and
+// its syntax tree) don't affect the original file.
+func (f *File) Clone() *File {
+	syn, lineOf := CloneSyntax(f.Syntax)
+	frags := make([]*FileSyntax, len(f.Includes))
+	for i, inc := range f.Includes {
+		frag, fragLineOf := CloneSyntax(inc.Fragment)
+		frags[i], lineOf = frag, orLineOf(lineOf, fragLineOf)
+	}
+	ret := &File{Syntax: syn}
+	for i, inc := range f.Includes {
+		ret.Includes = append(ret.Includes, &Include{Path: inc.Path, File: inc.File, Fragment: frags[i], Syntax: lineOf(inc.Syntax)})
+	}
+	if f.Gop != nil {
+		ret.Gop = &Gop{Version: f.Gop.Version, Syntax: lineOf(f.Gop.Syntax)}
+	}
+	if f.Compiler != nil {
+		cl := *f.Compiler
+		cl.Syntax = lineOf(cl.Syntax)
+		ret.Compiler = &cl
+	}
+	ret.ClassMods = append([]string(nil), f.ClassMods...)
+	for _, c := range f.Classfiles {
+		ret.Classfiles = append(ret.Classfiles, &Classfile{Mod: c.Mod, Syntax: lineOf(c.Syntax)})
+	}
+	for _, e := range f.Extensions {
+		cpy := &Extension{Verb: e.Verb, Args: e.Args, Syntax: lineOf(e.Syntax)}
+		if line := cpy.Syntax; line != nil {
+			cpy.Args = line.Token[len(line.Token)-len(e.Args):]
+		}
+		ret.Extensions = append(ret.Extensions, cpy)
+	}
+	for _, g := range f.Generates {
+		cpy := *g
+		cpy.Args = append([]string(nil), g.Args...)
+		ret.Generates = append(ret.Generates, &cpy)
+	}
+	if f.Projects != nil {
+		ret.Projects = make([]*Project, len(f.Projects))
+		for i, proj := range f.Projects {
+			ret.Projects[i] = proj.clone(lineOf)
+		}
+	}
+	return ret
+}
+
+// Clone returns a copy of this project statement. Changes of the copy don't
+// affect this project, except that syntax lines (Syntax fields) are shared.
+func (p *Project) Clone() *Project {
+	return p.clone(func(line *Line) *Line { return line })
+}
+
+func (p *Project) clone(lineOf func(*Line) *Line) *Project {
+	ret := *p
+	ret.Syntax = lineOf(p.Syntax)
+	ret.PkgPaths = append([]string(nil), p.PkgPaths...)
+	ret.PkgRefs = append([]PkgRef(nil), p.PkgRefs...)
+	ret.Tags = append([]string(nil), p.Tags...)
+	ret.Excludes = append([]string(nil), p.Excludes...)
+	if p.Works != nil {
+		ret.Works = make([]*Class, len(p.Works))
+		for i, w := range p.Works {
+			cpy := *w
+			cpy.Tags = append([]string(nil), w.Tags...)
+			cpy.Syntax = lineOf(w.Syntax)
+			ret.Works[i] = &cpy
+		}
+	}
+	if p.Import != nil {
+		ret.Import = make([]*Import, len(p.Import))
+		for i, imp := range p.Import {
+			cpy := *imp
+			cpy.Syntax = lineOf(imp.Syntax)
+			ret.Import[i] = &cpy
+		}
+	}
+	if p.Runner != nil {
+		cpy := *p.Runner
+		cpy.Syntax = lineOf(p.Runner.Syntax)
+		ret.Runner = &cpy
+	}
+	return &ret
+}
+
+// -----------------------------------------------------------------------------
@@ -0,0 +1,111 @@
+/*
+ * Copyright (c) 2024 The GoPlus Authors (goplus.org). All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package modfile
+
+// -----------------------------------------------------------------------------
+
+// A Flag describes a flag of a gop.mod directive.
+type Flag struct {
+	Name string // eg. "-prefix"
+	Arg  string // argument placeholder, eg. "Xxx" for "-prefix=Xxx" (empty if no argument)
+	Doc  string
+}
+
+// A Directive describes a gop.mod directive, eg. for completion and signature
+// help of editors.
+type Directive struct {
+	Name   string // eg. "project"
+	Usage  string // arguments syntax, eg. "[.projExt ProjClass] classFilePkgPath ..."
+	Flags  []Flag
+	Parent string // the directive it must be declared after (empty if top-level)
+	Once   bool   // it can be declared only once (in a file, or in its parent)
+	Doc    string
+}
+
+// String returns the full syntax of this directive, eg. "import [name] pkgPath".
+func (p *Directive) String() string {
+	return p.Name + " " + p.Usage
+}
+
+var classFlagInfos = []Flag{
+	{Name: "-embed", Doc: "The class instance is embedded in the project."},
+	{Name: "-prefix", Arg: "Xxx", Doc: "Method-name prefix of the class."},
+	{Name: "-tags", Arg: "tag,...", Doc: "Go build tags required by the class, eg. `-tags=js,wasm`."},
+}
+
+var projFlagInfos = append(append([]Flag(nil), classFlagInfos...),
+	Flag{Name: "-exclude", Arg: "pattern", Doc: "File names excluded from the project (can be repeated), eg. `-exclude=*_gen.spx`."},
+)
+
+var directives = []*Directive{
+	{
+		Name: "gop", Usage: "version", Once: true,
+		Doc: "The gop directive declares the Go+ version of this module, eg. `gop 1.2`.",
+	},
+	{
+		Name: "compiler", Usage: "name version", Once: true,
+		Doc: "The compiler directive declares the underlying Go compiler, eg. `compiler llgo 0.9`.",
+	},
+	{
+		Name: "classfile", Usage: "modulePath version",
+		Doc: "The classfile directive requires a classfile module without a require statement in go.mod, eg. `classfile github.com/goplus/spx/v2 v2.0.1`.",
+	},
+	{
+		Name: "include", Usage: "file",
+		Doc: "The include directive inlines directives of a gop.mod fragment (relative to the including file), eg. `include ./classfiles/spx.gopmod`.",
+	},
+	{
+		Name: "project", Usage: "[.projExt ProjClass] classFilePkgPath ...", Flags: projFlagInfos,
+		Doc: "The project directive declares a classfile project and its packages. An optional quoted description can follow.",
+	},
+	{
+		Name: "class", Usage: ".workExt WorkClass [ProjClass]", Flags: classFlagInfos, Parent: "project",
+		Doc: "The class directive declares a work class of the current project. Several exts separated by spaces or commas can share one class. An optional quoted description can follow.",
+	},
+	{
+		Name: "import", Usage: "[name] pkgPath", Parent: "project",
+		Doc: "The import directive declares a package auto-imported by classfiles of the current project.",
+	},
+	{
+		Name: "runner", Usage: "pkgPath versionConstraint...", Parent: "project", Once: true,
+		Doc: "The runner directive declares the program that runs the current project.",
+	},
+}
+
+// Directives returns descriptions of all supported gop.mod directives.
+// Extension directives (see Extension) aren't included.
+// The result shouldn't be modified.
+func Directives() []*Directive {
+	return directives
+}
+
+// LookupDirective returns the description of a gop.mod directive.
+func LookupDirective(name string) (*Directive, bool) {
+	for _, d := range directives {
+		if d.Name == name {
+			return d, true
+		}
+	}
+	return nil, false
+}
+
+func usage(verb string) string {
+	d, _ := LookupDirective(verb)
+	return "usage: " + d.String()
+}
+
+// -----------------------------------------------------------------------------
@@ -0,0 +1,150 @@
+/*
+ * Copyright (c) 2021 The GoPlus Authors (goplus.org). All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package modfile
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/qiniu/x/errors"
+)
+
+// -----------------------------------------------------------------------------
+
+// Markers of a gop.mod block embedded in go.mod.
+const (
+	EmbedBegin = "//gop:begin"
+	EmbedEnd   = "//gop:end"
+)
+
+// ParseEmbedded parses the gop.mod block embedded in a go.mod file, eg.
+//
+//	module example.com/foo
+//
+//	go 1.18
+//
+//	//gop:begin
+//	// gop 1.2
+//	// project .gmx Game github.com/goplus/spx
+//	// class .spx Sprite
+//	//gop:end
+//
+// Each line of the block is a gop.mod line commented out, so that the go
+// command ignores it. Positions of the result refer to lines of go.mod.
+// It returns (nil, nil) if go.mod doesn't have an embedded block.
+func ParseEmbedded(gomod string, data []byte, fix VersionFixer) (*File, error) {
+	return parseEmbedded(gomod, data, fix, nil)
+}
+
+func parseEmbedded(gomod string, data []byte, fix VersionFixer, readFile func(string) ([]byte, error)) (*File, error) {
+	text, ok, err := extractEmbedded(data)
+	if err != nil || !ok {
+		return nil, err
+	}
+	f, err := parseToFileEx(gomod, text, fix, false, readFile)
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// extractEmbedded returns content of the embedded gop.mod block. Lines out of
+// the block (and blank lines in it) are left empty to keep line numbers. Other
+// lines of the block must be comments.
+func extractEmbedded(data []byte) (text []byte, ok bool, err error) {
+	lines := strings.Split(string(data), "\n")
+	var b bytes.Buffer
+	var in bool
+	for i, line := range lines {
+		switch t := strings.TrimSpace(line); {
+		case t == EmbedBegin:
+			if ok {
+				return nil, false, errors.New("go.mod: repeated " + EmbedBegin)
+			}
+			in, ok = true, true
+		case t == EmbedEnd:
+			if !in {
+				return nil, false, errors.New("go.mod: " + EmbedEnd + " without " + EmbedBegin)
+			}
+			in = false
+		case in && strings.HasPrefix(t, "//"):
+			b.WriteString(strings.TrimPrefix(t[2:], " "))
+		case in && t != "":
+			return nil, false, fmt.Errorf("go.mod:%d: %s block line not commented out: %s", i+1, EmbedBegin, t)
+		}
+		b.WriteByte('\n')
+	}
+	if in {
+		return nil, false, errors.New("go.mod: missing " + EmbedEnd)
+	}
+	return b.Bytes(), ok, nil
+}
+
+// FormatEmbedded returns go.mod content gomodData with its embedded gop.mod
+// block replaced by the content of f. The block is appended to go.mod if it
+// doesn't exist.
+func FormatEmbedded(gomodData []byte, f *File) ([]byte, error) {
+	var block bytes.Buffer
+	block.WriteString(EmbedBegin + "\n")
+	for _, line := range strings.Split(strings.TrimRight(string(Format(f.Syntax)), "\n"), "\n") {
+		if line == "" {
+			block.WriteString("//\n")
+		} else {
+			block.WriteString("// " + line + "\n")
+		}
+	}
+	block.WriteString(EmbedEnd + "\n")
+
+	lines := strings.SplitAfter(string(gomodData), "\n")
+	begin, end := -1, -1
+	for i, line := range lines {
+		switch strings.TrimSpace(line) {
+		case EmbedBegin:
+			if begin >= 0 {
+				return nil, errors.New("go.mod: repeated " + EmbedBegin)
+			}
+			begin = i
+		case EmbedEnd:
+			if begin < 0 {
+				return nil, errors.New("go.mod: " + EmbedEnd + " without " + EmbedBegin)
+			}
+			end = i
+		}
+	}
+	var b bytes.Buffer
+	switch {
+	case begin < 0:
+		b.Write(gomodData)
+		if len(gomodData) > 0 && !bytes.HasSuffix(gomodData, []byte("\n\n")) {
+			if !bytes.HasSuffix(gomodData, []byte("\n")) {
+				b.WriteByte('\n')
+			}
+			b.WriteByte('\n')
+		}
+		b.Write(block.Bytes())
+	case end < 0:
+		return nil, errors.New("go.mod: missing " + EmbedEnd)
+	default:
+		b.WriteString(strings.Join(lines[:begin], ""))
+		b.Write(block.Bytes())
+		b.WriteString(strings.Join(lines[end+1:], ""))
+	}
+	return b.Bytes(), nil
+}
+
+// -----------------------------------------------------------------------------
@@ -0,0 +1,159 @@
+/*
+ * Copyright (c) 2021 The GoPlus Authors (goplus.org). All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package modfile
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestEmbedded(t *testing.T) {
+	gomod := `module example.com/foo
+
+go 1.18
+
+//gop:begin
+// gop 1.2
+//
+// project .gmx Game github.com/goplus/spx
+//	class .spx Sprite
+//gop:end
+
+require github.com/goplus/spx v1.0.0
+`
+	f, err := ParseEmbedded("go.mod", []byte(gomod), nil)
+	if err != nil {
+		t.Fatal("ParseEmbedded:", err)
+	}
+	if f.Gop.Version != "1.2" || len(f.Projects) != 1 || len(f.Projects[0].Works) != 1 {
+		t.Fatal("ParseEmbedded:", f.Projects)
+	}
+	if line := f.Projects[0].Syntax.Start.Line; line != 8 {
+		t.Fatal("ParseEmbedded: project line", line)
+	}
+	f.Projects[0].Works[0].Syntax.Token[2] = "Sprite2"
+	b, err := FormatEmbedded([]byte(gomod), f)
+	if err != nil {
+		t.Fatal("FormatEmbedded:", err)
+	}
+	if v := string(b); v != `module example.com/foo
+
+go 1.18
+
+//gop:begin
+// gop 1.2
+//
+// project .gmx Game github.com/goplus/spx
+//
+// class .spx Sprite2
+//gop:end
+
+require github.com/goplus/spx v1.0.0
+` {
+		t.Fatal("FormatEmbedded:", v)
+	}
+
+	if f, err = ParseEmbedded("go.mod", []byte("module example.com/foo\n"), nil); f != nil || err != nil {
+		t.Fatal("ParseEmbedded: no block", f, err)
+	}
+	if b, err = FormatEmbedded([]byte("module example.com/foo\n"), New("go.mod", "1.2")); err != nil || string(b) != "module example.com/foo\n\n//gop:begin\n// gop 1.2\n//gop:end\n" {
+		t.Fatal("FormatEmbedded: append", string(b), err)
+	}
+	for _, text := range []string{
+		"//gop:begin\n// gop 1.2\n",
+		"// gop 1.2\n//gop:end\n",
+		"//gop:begin\n//gop:end\n//gop:begin\n//gop:end\n",
+	} {
+		if _, err = ParseEmbedded("go.mod", []byte(text), nil); err == nil {
+			t.Fatal("ParseEmbedded: no error?", text)
+		}
+	}
+	if _, err = ParseEmbedded("go.mod", []byte("//gop:begin\n// gop 1.2\n\nproject .spx Game github.com/goplus/spx\n//gop:end\n"), nil); err == nil ||
+		!strings.HasPrefix(err.Error(), "go.mod:4: ") {
+		t.Fatal("ParseEmbedded: non-comment line:", err)
+	}
+}
+
+func TestStripGop(t *testing.T) {
+	gomod := `module example.com/foo
+
+go 1.18
+
+gop 1.2
+
+require (
+	github.com/goplus/spx v1.0.0 //gop:class
+	github.com/goplus/yap v0.5.0 // indirect; gop:class
+	golang.org/x/mod v0.13.0 // indirect
+	golang.org/x/net v0.17.0 // gop:classfoo
+)
+
+project .gmx Game github.com/goplus/spx
+
+class .spx Sprite
+
+x-assets ./assets
+`
+	b, err := StripGop([]byte(gomod))
+	if err != nil {
+		t.Fatal("StripGop:", err)
+	}
+	stripped := `module example.com/foo
+
+go 1.18
+
+require (
+	github.com/goplus/spx v1.0.0
+	github.com/goplus/yap v0.5.0 // indirect
+	golang.org/x/mod v0.13.0 // indirect
+	golang.org/x/net v0.17.0 // gop:classfoo
+)
+`
+	if v := string(b); v != stripped {
+		t.Fatal("StripGop:", v)
+	}
+	b, err = MergeGop([]byte(stripped+"\nrequire github.com/qiniu/x v1.13.2\n"), []byte(gomod))
+	if err != nil {
+		t.Fatal("MergeGop:", err)
+	}
+	if v := string(b); v != `module example.com/foo
+
+go 1.18
+
+require (
+	github.com/goplus/spx v1.0.0 //gop:class
+	github.com/goplus/yap v0.5.0 // indirect; gop:class
+	golang.org/x/mod v0.13.0 // indirect
+	golang.org/x/net v0.17.0 // gop:classfoo
+)
+
+require github.com/qiniu/x v1.13.2
+
+gop 1.2
+
+project .gmx Game github.com/goplus/spx
+
+class .spx Sprite
+
+x-assets ./assets
+` {
+		t.Fatal("MergeGop:", v)
+	}
+	if _, err = StripGop([]byte("module (")); err == nil {
+		t.Fatal("StripGop: no error")
+	}
+}
@@ -0,0 +1,183 @@
+/*
+ * Copyright (c) 2021 The GoPlus Authors (goplus.org). All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package modfile
+
+import (
+	"sort"
+	"strings"
+)
+
+// -----------------------------------------------------------------------------
+
+// SortProjects sorts projects in canonical order: by Ext, then Class, then
+// PkgPaths. Projects with the same key keep their relative order. It doesn't
+// change the syntax tree, so the order of statements written by Format is
+// not affected.
+func SortProjects(projs []*Project) {
+	sort.SliceStable(projs, func(i, j int) bool {
+		return projectKey(projs[i]) < projectKey(projs[j])
+	})
+}
+
+// SortWorks sorts work classes in canonical order: by Ext, then Class. Like
+// SortProjects, it doesn't change the syntax tree.
+func SortWorks(works []*Class) {
+	sort.SliceStable(works, func(i, j int) bool {
+		return classKey(works[i]) < classKey(works[j])
+	})
+}
+
+func projectKey(p *Project) string {
+	return p.Ext + "\x00" + p.Class + "\x00" + strings.Join(p.PkgPaths, "\x00")
+}
+
+func classKey(c *Class) string {
+	return c.Ext + "\x00" + c.Class
+}
+
+// Equal reports whether a and b are semantically equal, regardless of
+// comments, formatting and the order of projects, work classes and classfile
+// modules. The order of package paths and imports of a project is significant.
+func Equal(a, b *File) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	if gopVersion(a) != gopVersion(b) || !equalCompiler(a.Compiler, b.Compiler) {
+		return false
+	}
+	if !equalStrings(sortedStrings(a.ClassMods), sortedStrings(b.ClassMods)) {
+		return false
+	}
+	if !equalStrings(classfileKeys(a.Classfiles), classfileKeys(b.Classfiles)) {
+		return false
+	}
+	if len(a.Extensions) != len(b.Extensions) {
+		return false
+	}
+	for i, ext := range a.Extensions {
+		if ext.Verb != b.Extensions[i].Verb || !equalStrings(ext.Args, b.Extensions[i].Args) {
+			return false
+		}
+	}
+	if len(a.Projects) != len(b.Projects) {
+		return false
+	}
+	pa, pb := sortedProjects(a.Projects), sortedProjects(b.Projects)
+	for i, p := range pa {
+		if !equalProject(p, pb[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// pkgVersions returns versions of package paths of project p ("" if a path
+// has no version).
+func pkgVersions(p *Project) []string {
+	vers := make([]string, len(p.PkgPaths))
+	for i, ref := range p.PkgRefs {
+		if i < len(vers) {
+			vers[i] = ref.Version
+		}
+	}
+	return vers
+}
+
+func gopVersion(f *File) string {
+	if f.Gop != nil {
+		return f.Gop.Version
+	}
+	return ""
+}
+
+func equalCompiler(a, b *Compiler) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Name == b.Name && a.Version == b.Version
+}
+
+func equalProject(a, b *Project) bool {
+	if a.Ext != b.Ext || a.Class != b.Class || a.Prefix != b.Prefix || a.Embedded != b.Embedded || a.Doc != b.Doc ||
+		!equalStrings(a.Tags, b.Tags) || !equalStrings(a.Excludes, b.Excludes) {
+		return false
+	}
+	if !equalStrings(a.PkgPaths, b.PkgPaths) || len(a.Works) != len(b.Works) || len(a.Import) != len(b.Import) {
+		return false
+	}
+	if !equalStrings(pkgVersions(a), pkgVersions(b)) {
+		return false
+	}
+	wa, wb := sortedWorks(a.Works), sortedWorks(b.Works)
+	for i, w := range wa {
+		v := wb[i]
+		if w.Ext != v.Ext || w.Class != v.Class || w.Project != v.Project ||
+			w.Prefix != v.Prefix || w.Embedded != v.Embedded || w.Doc != v.Doc || !equalStrings(w.Tags, v.Tags) {
+			return false
+		}
+	}
+	for i, imp := range a.Import {
+		if imp.Name != b.Import[i].Name || imp.Path != b.Import[i].Path {
+			return false
+		}
+	}
+	if a.Runner == nil || b.Runner == nil {
+		return a.Runner == b.Runner
+	}
+	return a.Runner.Path == b.Runner.Path && a.Runner.Version == b.Runner.Version
+}
+
+func sortedProjects(projs []*Project) []*Project {
+	ret := append([]*Project(nil), projs...)
+	SortProjects(ret)
+	return ret
+}
+
+func sortedWorks(works []*Class) []*Class {
+	ret := append([]*Class(nil), works...)
+	SortWorks(ret)
+	return ret
+}
+
+func classfileKeys(classfiles []*Classfile) []string {
+	ret := make([]string, len(classfiles))
+	for i, c := range classfiles {
+		ret[i] = c.Mod.String()
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+func sortedStrings(a []string) []string {
+	ret := append([]string(nil), a...)
+	sort.Strings(ret)
+	return ret
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i, v := range a {
+		if v != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// -----------------------------------------------------------------------------
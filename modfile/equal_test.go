@@ -0,0 +1,84 @@
+/*
+ * Copyright (c) 2021 The GoPlus Authors (goplus.org). All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package modfile
+
+import (
+	"testing"
+)
+
+func TestEqual(t *testing.T) {
+	parse := func(text string) *File {
+		t.Helper()
+		f, err := Parse("gop.mod", []byte(text), nil)
+		if err != nil {
+			t.Fatal("Parse:", err)
+		}
+		return f
+	}
+	a := parse(`gop 1.2
+
+project .yap App github.com/goplus/yap
+class _yap.gox Handler
+
+// spx
+project .gmx Game github.com/goplus/spx math
+class .spx Sprite
+class .spx2 Sprite2
+import github.com/goplus/spx/pkg/gdi
+runner github.com/goplus/spx/cmd/spxrun ^v1.0.0
+`)
+	b := parse(`gop 1.2
+project .gmx Game github.com/goplus/spx math
+class .spx2 Sprite2
+class .spx Sprite
+import github.com/goplus/spx/pkg/gdi
+runner github.com/goplus/spx/cmd/spxrun ^v1.0.0
+project .yap App github.com/goplus/yap
+class _yap.gox Handler
+`)
+	if !Equal(a, b) || !Equal(b, a) || !Equal(nil, nil) || Equal(a, nil) {
+		t.Fatal("Equal: false")
+	}
+	for _, text := range []string{
+		"gop 1.3\nproject .yap App github.com/goplus/yap\nclass _yap.gox Handler\nproject .gmx Game github.com/goplus/spx math\nclass .spx Sprite\nclass .spx2 Sprite2\nimport github.com/goplus/spx/pkg/gdi\nrunner github.com/goplus/spx/cmd/spxrun ^v1.0.0\n",
+		"gop 1.2\nproject .yap App github.com/goplus/yap\nclass _yap.gox Handler\nproject .gmx Game math github.com/goplus/spx\nclass .spx Sprite\nclass .spx2 Sprite2\nimport github.com/goplus/spx/pkg/gdi\nrunner github.com/goplus/spx/cmd/spxrun ^v1.0.0\n",
+		"gop 1.2\nproject .yap App github.com/goplus/yap\nclass _yap.gox Handler\nproject .gmx Game github.com/goplus/spx math\nclass .spx Sprite\nclass -embed .spx2 Sprite2\nimport github.com/goplus/spx/pkg/gdi\nrunner github.com/goplus/spx/cmd/spxrun ^v1.0.0\n",
+		"gop 1.2\nproject .yap App github.com/goplus/yap\nclass _yap.gox Handler\nproject .gmx Game github.com/goplus/spx math\nclass .spx Sprite\nclass .spx2 Sprite2\nimport github.com/goplus/spx/pkg/gdi\n",
+		"gop 1.2\nproject .yap App github.com/goplus/yap\nclass _yap.gox Handler\nproject .gmx Game github.com/goplus/spx math\nclass .spx Sprite\nclass .spx2 Sprite2\nimport github.com/goplus/spx/pkg/gdi\nrunner github.com/goplus/spx/cmd/spxrun ^v1.0.0\nx-assets ./assets\n",
+	} {
+		if Equal(a, parse(text)) {
+			t.Fatal("Equal: true", text)
+		}
+	}
+}
+
+func TestSortProjects(t *testing.T) {
+	projs := []*Project{
+		{Ext: ".yap", Class: "App"},
+		{PkgPaths: []string{"github.com/goplus/yap"}},
+		{Ext: ".gmx", Class: "Game"},
+	}
+	SortProjects(projs)
+	if projs[0].Ext != "" || projs[1].Ext != ".gmx" || projs[2].Ext != ".yap" {
+		t.Fatal("SortProjects:", projs[0], projs[1], projs[2])
+	}
+	works := []*Class{{Ext: ".spx2", Class: "B"}, {Ext: ".spx", Class: "B"}, {Ext: ".spx", Class: "A"}}
+	SortWorks(works)
+	if classKey(works[0]) != ".spx\x00A" || classKey(works[1]) != ".spx\x00B" || works[2].Ext != ".spx2" {
+		t.Fatal("SortWorks:", works[0], works[1], works[2])
+	}
+}
@@ -19,7 +19,9 @@ package modfile
 import (
 	"fmt"
 	"path"
+	"strconv"
 	"strings"
+	"sync"
 
 	"github.com/qiniu/x/errors"
 )
@@ -29,13 +31,33 @@ func isExt(s string) bool {
 	return len(s) > 1 && (s[0] == '_' || s[0] == '.')
 }
 
+// isExtArg checks if s is an ext or an ext pattern, eg. "*_[a-z]*.gox", which
+// may be quoted. A pointer class like "*Sprite" isn't an ext pattern.
+func isExtArg(s string) bool {
+	if strings.HasPrefix(s, `"`) {
+		if t, err := strconv.Unquote(s); err == nil {
+			s = t
+		}
+	}
+	return isExt(s) || (len(s) > 1 && s[0] == '*' && !isSymbol(s))
+}
+
 func parseExt(s *string) (t string, err error) {
 	t, err = parseString(s)
 	if err != nil {
 		goto failed
 	}
-	if isExt(t) {
-		return
+	if isExtArg(t) {
+		if !IsExtPattern(t) {
+			return
+		}
+		if _, err = compileExtPattern(t); err == nil {
+			return
+		}
+		if e, ok := err.(*InvalidExtError); ok {
+			err = e.Err
+		}
+		goto failed
 	}
 	err = errors.New("invalid ext format")
 failed:
@@ -45,6 +67,37 @@ failed:
 	}
 }
 
+// parseExts parses leading exts of a work class statement, which can be
+// separated by spaces or commas, eg. `.spx .spx2` or `.spx,.spx2`. The first
+// argument is always an ext, and parsing stops at the first argument that
+// doesn't look like an ext.
+func parseExts(args []string) (exts, rest []string, err error) {
+	i := 0
+	for ; i < len(args); i++ {
+		if i > 0 && !isExtLike(args[i]) {
+			break
+		}
+		for _, part := range strings.Split(args[i], ",") {
+			if part == "" {
+				continue
+			}
+			ext, e := parseExt(&part)
+			if e != nil {
+				return nil, nil, e
+			}
+			exts = append(exts, ext)
+		}
+	}
+	if exts == nil && len(args) > 0 { // eg. `class , Sprite`
+		return nil, nil, &InvalidExtError{Ext: args[0], Err: errors.New("invalid ext format")}
+	}
+	return exts, args[i:], nil
+}
+
+func isExtLike(s string) bool {
+	return s != "" && (s[0] == '_' || s[0] == '.' || s[0] == ',' || isExtArg(s))
+}
+
 type InvalidExtError struct {
 	Ext string
 	Err error
@@ -73,3 +126,134 @@ func ClassExt(fname string) string {
 	_, ext := SplitFname(fname)
 	return ext
 }
+
+// ResolveExt resolves the project of a classfile fname (a file name without
+// directory) among projects, by the following precedence rules:
+//   - a project whose project ext (Project.Ext) is the ext of fname, or is an
+//     ext pattern matching fname (see IsExtPattern);
+//   - a project who has a work class for fname (see Project.WorkForFile);
+//   - a builtin project (whose Syntax is nil, ie. it isn't declared in a
+//     gop.mod file), by the same rules above.
+//
+// If several projects have the same precedence, the first one wins.
+// isProj reports whether fname is a project file of the resolved project.
+func ResolveExt(projects []*Project, fname string) (proj *Project, isProj, ok bool) {
+	ext := ClassExt(fname)
+	best := -1
+	for _, p := range projects {
+		rank := extRank(p, ext, fname)
+		if rank > best {
+			proj, best = p, rank
+		}
+	}
+	if proj == nil {
+		return nil, false, false
+	}
+	return proj, proj.IsProj(ext, fname), true
+}
+
+// ExtRank returns the precedence of project p providing ext by the rules of
+// ResolveExt, or -1 if p doesn't provide ext. A higher rank takes precedence.
+// An ext pattern is compared literally, ie. ext is an ext of p only if it's
+// the same pattern.
+func ExtRank(p *Project, ext string) (rank int) {
+	return extRank(p, ext, "")
+}
+
+func extRank(p *Project, ext, fname string) (rank int) {
+	switch {
+	case p.Ext == ext || (fname != "" && MatchExt(p.Ext, fname)):
+		rank = 1
+	case p.workFor(ext, fname) != nil:
+		rank = 0
+	default:
+		return -1
+	}
+	if p.Syntax != nil { // not a builtin project
+		rank += 2
+	}
+	return
+}
+
+// -----------------------------------------------------------------------------
+
+// An ExtPattern is a compiled ext pattern, see CompileExtPattern.
+type ExtPattern struct {
+	pattern string // the glob pattern of whole file names
+	literal string // the ext if the pattern has no glob metacharacters
+}
+
+// CompileExtPattern compiles an ext pattern, which is either a plain ext
+// (eg. ".spx" or "_yap.gox"), or a glob of file names (eg. "*_[a-z]*.gox"):
+//   - "*" matches any sequence of characters;
+//   - "?" matches any single character;
+//   - "[...]" matches a character class, eg. "[a-z]" or "[^0-9]";
+//   - "\\c" matches character c literally.
+//
+// A plain ext matches file names whose class ext (see ClassExt) is the ext,
+// so it matches the same files as it does in a class statement. Any other
+// pattern starting with "_" or "." matches the end of file names, as if it
+// had a leading "*". Class and project statements accept ext patterns, eg.
+// `class *_yap.gox Handler`, see MatchExt. A pattern with a character class
+// must be quoted there, eg. `class "*_[a-z]*.gox" Handler`.
+func CompileExtPattern(pattern string) (*ExtPattern, error) {
+	return compileExtPattern(pattern)
+}
+
+// extPatterns caches compiled ext patterns of class and project statements.
+var extPatterns sync.Map // map[string]*ExtPattern
+
+// IsExtPattern checks if ext of a class or project statement is a glob
+// pattern (see CompileExtPattern) rather than a plain ext, eg. "*_[a-z]*.gox".
+func IsExtPattern(ext string) bool {
+	return strings.ContainsAny(ext, `*?[\`)
+}
+
+// MatchExt checks if fname (a file name without directory) is a classfile of
+// ext, which is a plain ext or an ext pattern (see IsExtPattern) of a class or
+// project statement.
+func MatchExt(ext, fname string) bool {
+	if v, ok := extPatterns.Load(ext); ok {
+		return v.(*ExtPattern).Match(fname)
+	}
+	pat, err := compileExtPattern(ext)
+	if err != nil {
+		return false
+	}
+	extPatterns.Store(ext, pat)
+	return pat.Match(fname)
+}
+
+func compileExtPattern(pattern string) (*ExtPattern, error) {
+	if pattern == "" || strings.ContainsAny(pattern, "/\t ") {
+		return nil, &InvalidExtError{Ext: pattern, Err: errors.New("invalid ext pattern")}
+	}
+	glob := pattern
+	if isExt(pattern) {
+		if !strings.ContainsAny(pattern, `*?[\`) {
+			return &ExtPattern{pattern: "*" + pattern, literal: pattern}, nil
+		}
+		glob = "*" + pattern
+	}
+	if _, err := path.Match(glob, ""); err != nil {
+		return nil, &InvalidExtError{Ext: pattern, Err: err}
+	}
+	return &ExtPattern{pattern: glob}, nil
+}
+
+// Match reports whether fname (a file name without directory) matches this
+// pattern.
+func (p *ExtPattern) Match(fname string) bool {
+	if p.literal != "" {
+		return ClassExt(fname) == p.literal
+	}
+	ok, _ := path.Match(p.pattern, fname)
+	return ok
+}
+
+// String returns the glob of whole file names of this pattern, eg. "*.spx".
+func (p *ExtPattern) String() string {
+	return p.pattern
+}
+
+// -----------------------------------------------------------------------------
@@ -17,6 +17,7 @@
 package modfile
 
 import (
+	"strings"
 	"testing"
 )
 
@@ -36,3 +37,136 @@ func TestSplitFname(t *testing.T) {
 		}
 	}
 }
+
+func TestResolveExt(t *testing.T) {
+	line := new(Line)
+	spx := &Project{Ext: ".spx", Class: "Game", Works: []*Class{{Ext: ".spx", Class: "Sprite"}}}
+	gmx := &Project{Ext: ".gmx", Class: "Game", Works: []*Class{{Ext: ".spx", Class: "Sprite"}}, Syntax: line}
+	yap := &Project{Ext: "_yap.gox", Class: "App", Works: []*Class{{Ext: "_yapt.gox", Class: "Case"}}, Syntax: line}
+	yapt := &Project{Ext: "_yapt.gox", Class: "App", Syntax: line}
+	gsh := &Project{Ext: ".gsh", Class: "App"}
+	gsh2 := &Project{Ext: ".gsh", Class: "App2"}
+
+	type testCase struct {
+		projects []*Project
+		fname    string
+		proj     *Project
+		isProj   bool
+	}
+	cases := []testCase{
+		{[]*Project{spx}, "main.spx", spx, true},
+		{[]*Project{spx}, "Bar.spx", spx, false},
+		{[]*Project{spx, gmx}, "Bar.spx", gmx, false},       // work ext > builtin
+		{[]*Project{gmx, spx}, "main.gmx", gmx, true},       // project ext
+		{[]*Project{yap, yapt}, "foo_yapt.gox", yapt, true}, // project ext > work ext
+		{[]*Project{yapt, yap}, "foo_yapt.gox", yapt, true},
+		{[]*Project{yap}, "foo_yapt.gox", yap, false},
+		{[]*Project{gsh, gsh2}, "foo.gsh", gsh, true}, // first one wins
+		{[]*Project{gsh2, gsh}, "foo.gsh", gsh2, true},
+		{[]*Project{spx, gsh}, "foo.gox", nil, false},
+		{nil, "foo.spx", nil, false},
+	}
+	for _, c := range cases {
+		proj, isProj, ok := ResolveExt(c.projects, c.fname)
+		if proj != c.proj || isProj != c.isProj || ok != (c.proj != nil) {
+			t.Fatalf("ResolveExt(%s): expect (%v, %v), got (%v, %v, %v)\n", c.fname, c.proj, c.isProj, proj, isProj, ok)
+		}
+	}
+}
+
+func TestCompileExtPattern(t *testing.T) {
+	cases := []struct {
+		pattern string
+		fname   string
+		ok      bool
+	}{
+		{".spx", "main.spx", true},
+		{".spx", "main.spx2", false},
+		{"_yap.gox", "get_yap.gox", true},
+		{"_yap.gox", "get_myyap.gox", false},
+		{".gox", "foo_app.gox", false},
+		{".gox", "foo.gox", true},
+		{"*_[a-z]*.gox", "get_yap.gox", true},
+		{"*_[a-z]*.gox", "get_Yap.gox", false},
+		{"_[a-z]*.gox", "get_app.gox", true},
+		{"main.sp?", "main.spx", true},
+		{"main.sp?", "foo.spx", false},
+		{"*.[^0-9]*", "a.x1", true},
+		{"*.[^0-9]*", "a.1x", false},
+		{`*\*.gox`, "a*.gox", true},
+	}
+	for _, c := range cases {
+		p, err := CompileExtPattern(c.pattern)
+		if err != nil {
+			t.Fatal("CompileExtPattern:", c.pattern, err)
+		}
+		if ok := p.Match(c.fname); ok != c.ok {
+			t.Fatalf("%s.Match(%s): expect %v, got %v\n", p, c.fname, c.ok, ok)
+		}
+		if ok := MatchExt(c.pattern, c.fname); ok != c.ok {
+			t.Fatalf("MatchExt(%s, %s): expect %v, got %v\n", c.pattern, c.fname, c.ok, ok)
+		}
+	}
+	if MatchExt("", "main.spx") {
+		t.Fatal("MatchExt: empty ext matches")
+	}
+	if p, _ := CompileExtPattern(".spx"); p.String() != "*.spx" {
+		t.Fatal("String:", p)
+	}
+	for _, pattern := range []string{"", "*.[a-", "a/*.spx", ". spx"} {
+		if _, err := CompileExtPattern(pattern); err == nil {
+			t.Fatal("CompileExtPattern: no error?", pattern)
+		}
+	}
+}
+
+func TestParseExtPattern(t *testing.T) {
+	const gopmod = `
+gop 1.2
+
+project *_app.gox App github.com/goplus/yap
+class _yap.gox Handler
+class "*_[a-z]*.gox" Handler
+class .spx2 *Sprite2
+`
+	f, err := Parse("github.com/goplus/yap/gop.mod", []byte(gopmod), nil)
+	if err != nil {
+		t.Fatal("Parse:", err)
+	}
+	proj := f.Projects[0]
+	if proj.Ext != "*_app.gox" || len(proj.Works) != 3 || proj.Works[1].Ext != "*_[a-z]*.gox" || proj.Works[2].Class != "*Sprite2" {
+		t.Fatal("Parse:", proj.Ext, proj.Works)
+	}
+	for _, c := range []struct {
+		fname  string
+		work   int
+		isProj bool
+	}{
+		{"get_yap.gox", 0, false},
+		{"get_p1.gox", 1, false},
+		{"main_app.gox", 1, true},
+		{"get_P1.gox", -1, true},
+		{"a.spx2", 2, false},
+	} {
+		w := proj.WorkForFile(c.fname)
+		if (c.work < 0 && w != nil) || (c.work >= 0 && w != proj.Works[c.work]) {
+			t.Fatal("WorkForFile:", c.fname, w)
+		}
+		if isProj := proj.IsProj(ClassExt(c.fname), c.fname); isProj != c.isProj {
+			t.Fatal("IsProj:", c.fname, isProj)
+		}
+	}
+	if p, isProj, ok := ResolveExt(f.Projects, "main_app.gox"); !ok || p != proj || !isProj {
+		t.Fatal("ResolveExt:", p, isProj, ok)
+	}
+	if _, _, ok := ResolveExt(f.Projects, "get_P1.txt"); ok {
+		t.Fatal("ResolveExt: ok?")
+	}
+	if proj.WorkForExt("_p1.gox") != nil || ExtRank(proj, "*_[a-z]*.gox") != 2 {
+		t.Fatal("WorkForExt/ExtRank: pattern isn't compared literally")
+	}
+	_, err = Parse("gop.mod", []byte("gop 1.2\n\nproject .gmx Game foo\nclass \"*_[a-.gox\" Handler\n"), nil)
+	if err == nil || !strings.Contains(err.Error(), "syntax error in pattern") {
+		t.Fatal("Parse:", err)
+	}
+}
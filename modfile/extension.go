@@ -0,0 +1,69 @@
+/*
+ * Copyright (c) 2024 The GoPlus Authors (goplus.org). All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package modfile
+
+import (
+	"fmt"
+	"strings"
+)
+
+// -----------------------------------------------------------------------------
+
+// An Extension is an extension directive whose verb starts with "x-", eg.
+//
+//	x-assets ./assets
+//
+// Extension directives are accepted both by Parse and ParseLax, so that
+// classfile ecosystems can attach custom metadata to gop.mod. They are kept
+// as is in the syntax tree and written back by Format.
+type Extension struct {
+	Verb   string   // eg. "x-assets"
+	Args   []string // raw tokens (maybe quoted)
+	Syntax *Line    // Syntax.Start is the position of the directive
+}
+
+// IsExtension checks if verb is the verb of an extension directive.
+func IsExtension(verb string) bool {
+	return len(verb) > 2 && strings.HasPrefix(verb, "x-")
+}
+
+// AddExtension adds an extension directive. args are quoted if necessary.
+func (f *File) AddExtension(verb string, args ...string) error {
+	if !IsExtension(verb) {
+		return fmt.Errorf("invalid extension directive: %s", verb)
+	}
+	line := &Line{Token: make([]string, 1, 1+len(args))}
+	line.Token[0] = verb
+	for _, arg := range args {
+		line.Token = append(line.Token, AutoQuote(arg))
+	}
+	f.Syntax.Stmt = append(f.Syntax.Stmt, line)
+	f.Extensions = append(f.Extensions, &Extension{Verb: verb, Args: line.Token[1:], Syntax: line})
+	return nil
+}
+
+// LookupExtensions returns all extension directives of the specified verb.
+func (f *File) LookupExtensions(verb string) (exts []*Extension) {
+	for _, e := range f.Extensions {
+		if e.Verb == verb {
+			exts = append(exts, e)
+		}
+	}
+	return
+}
+
+// -----------------------------------------------------------------------------
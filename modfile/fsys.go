@@ -0,0 +1,67 @@
+/*
+ * Copyright (c) 2021 The GoPlus Authors (goplus.org). All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package modfile
+
+import (
+	"fmt"
+	"io/fs"
+	"path/filepath"
+
+	"github.com/goplus/mod"
+)
+
+// -----------------------------------------------------------------------------
+
+// ParseInModule parses gop.mod of the module whose root directory is the root
+// of fsys, eg. os.DirFS of a module directory, or fs.Sub(zr, "path@version")
+// of a module zip archive zr. It applies the same precedence rules as
+// modload: the first existing file of mod.ModfileNames() (gox.mod, then
+// gop.mod), or the gop.mod block embedded in go.mod (see ParseEmbedded) if
+// none of them exists. Like ParseLax, unknown statements are ignored, and
+// included fragments are read from fsys.
+//
+// It returns an error satisfying mod.IsNotFound if the module has no gop.mod.
+func ParseInModule(fsys fs.FS) (*File, error) {
+	readFile := func(name string) ([]byte, error) {
+		return fs.ReadFile(fsys, filepath.ToSlash(name))
+	}
+	for _, name := range mod.ModfileNames() {
+		if data, err := readFile(name); err == nil {
+			f, err := parseToFileEx(name, data, keepVersion, false, readFile)
+			if err != nil {
+				return nil, err
+			}
+			return f, nil
+		}
+	}
+	data, err := readFile("go.mod")
+	if err != nil {
+		return nil, err
+	}
+	f, err := parseEmbedded("go.mod", data, keepVersion, readFile)
+	if err == nil && f == nil {
+		err = fmt.Errorf("gop.mod: %w", mod.ErrNotFound)
+	}
+	return f, err
+}
+
+// keepVersion is a VersionFixer which keeps versions as is, like modload.
+func keepVersion(path, vers string) (string, error) {
+	return vers, nil
+}
+
+// -----------------------------------------------------------------------------
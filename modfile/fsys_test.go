@@ -0,0 +1,77 @@
+/*
+ * Copyright (c) 2021 The GoPlus Authors (goplus.org). All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package modfile
+
+import (
+	"archive/zip"
+	"bytes"
+	"io/fs"
+	"testing"
+	"testing/fstest"
+
+	"github.com/goplus/mod"
+)
+
+func TestParseInModule(t *testing.T) {
+	fsys := fstest.MapFS{
+		"go.mod":                {Data: []byte("module example.com/foo\n")},
+		"gop.mod":               {Data: []byte("gop 1.2\n\nproject .gmx Game example.com/foo\n")},
+		"gox.mod":               {Data: []byte("gop 1.3\n\ninclude ./classfiles/spx.gopmod\n\nunknown statement\n")},
+		"classfiles/spx.gopmod": {Data: []byte("project .spx Game example.com/foo/spx\n")},
+	}
+	f, err := ParseInModule(fsys)
+	if err != nil || f.Syntax.Name != "gox.mod" || f.Gop.Version != "1.3" || len(f.Projects) != 1 || f.Projects[0].Ext != ".spx" {
+		t.Fatal("ParseInModule gox.mod:", f, err)
+	}
+
+	delete(fsys, "gox.mod")
+	if f, err = ParseInModule(fsys); err != nil || f.Syntax.Name != "gop.mod" || f.Projects[0].Ext != ".gmx" {
+		t.Fatal("ParseInModule gop.mod:", f, err)
+	}
+
+	delete(fsys, "gop.mod")
+	if _, err = ParseInModule(fsys); !mod.IsNotFound(err) {
+		t.Fatal("ParseInModule no gop.mod:", err)
+	}
+	fsys["go.mod"] = &fstest.MapFile{Data: []byte(`module example.com/foo
+
+//gop:begin
+// gop 1.2
+// include ./classfiles/spx.gopmod
+//gop:end
+`)}
+	if f, err = ParseInModule(fsys); err != nil || f.Syntax.Name != "go.mod" || f.Projects[0].Ext != ".spx" {
+		t.Fatal("ParseInModule embedded:", f, err)
+	}
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	w, _ := zw.Create("example.com/foo@v1.0.0/gop.mod")
+	w.Write([]byte("gop 1.2\n\nproject .yap App example.com/foo\n"))
+	zw.Close()
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal("zip.NewReader:", err)
+	}
+	root, err := fs.Sub(zr, "example.com/foo@v1.0.0")
+	if err != nil {
+		t.Fatal("fs.Sub:", err)
+	}
+	if f, err = ParseInModule(root); err != nil || f.Projects[0].Ext != ".yap" {
+		t.Fatal("ParseInModule zip:", f, err)
+	}
+}
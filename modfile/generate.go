@@ -0,0 +1,123 @@
+/*
+ * Copyright (c) 2021 The GoPlus Authors (goplus.org). All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package modfile
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// -----------------------------------------------------------------------------
+
+// GenerateMarker is the comment directive of generate annotations.
+const GenerateMarker = "gop:generate"
+
+// A Generate is a generate annotation, a whole-line comment of gop.mod
+// which specifies a command for `gop generate`, eg.
+//
+//	//gop:generate spxgen ./assets
+//
+// Annotations are comments, so Format keeps them as is.
+type Generate struct {
+	Command string   // "spxgen"
+	Args    []string // ["./assets"]
+	File    string   // name of the file (maybe an include fragment) where the annotation is
+	Pos     Position // position of the comment
+}
+
+// AddGenerate appends a generate annotation to the end of this file.
+func (f *File) AddGenerate(cmd string, args ...string) {
+	words := make([]string, 0, 1+len(args))
+	for _, v := range append([]string{cmd}, args...) {
+		if v == "" || strings.ContainsAny(v, " \t\"'`\\") {
+			v = strconv.Quote(v)
+		}
+		words = append(words, v)
+	}
+	tok := "//" + GenerateMarker + " " + strings.Join(words, " ")
+	f.Syntax.Stmt = append(f.Syntax.Stmt, &CommentBlock{
+		Comments: Comments{Before: []Comment{{Token: tok}}},
+	})
+	f.Generates = append(f.Generates, &Generate{Command: cmd, Args: args, File: f.Syntax.Name})
+}
+
+// parseGenerates parses generate annotations of a statement.
+func (f *File) parseGenerates(errs *ErrorList, x Expr) {
+	f.parseGenerateComments(errs, x.Comment().Before)
+	if x, ok := x.(*LineBlock); ok {
+		for _, line := range x.Line {
+			f.parseGenerateComments(errs, line.Before)
+		}
+		f.parseGenerateComments(errs, x.RParen.Before)
+	}
+}
+
+func (f *File) parseGenerateComments(errs *ErrorList, comments []Comment) {
+	for _, c := range comments {
+		text := strings.TrimPrefix(c.Token, "//")
+		if !strings.HasPrefix(text, GenerateMarker) {
+			continue
+		}
+		text = text[len(GenerateMarker):]
+		if text != "" && text[0] != ' ' && text[0] != '\t' { // eg. //gop:generated
+			continue
+		}
+		words, err := splitGenerate(text)
+		if err == nil && len(words) == 0 {
+			err = errors.New("generate annotation expects a command")
+		}
+		if err != nil {
+			errs.Add(&Error{Filename: f.curFile(), Pos: c.Start, Err: err})
+			continue
+		}
+		f.Generates = append(f.Generates, &Generate{
+			Command: words[0], Args: words[1:], File: f.curFile(), Pos: c.Start,
+		})
+	}
+}
+
+// splitGenerate splits a generate annotation into words, like go generate
+// does: words are separated by spaces, and Go quoted strings are unquoted.
+func splitGenerate(text string) (words []string, err error) {
+	for {
+		text = strings.TrimLeft(text, " \t")
+		if text == "" {
+			return
+		}
+		var word string
+		if text[0] == '"' || text[0] == '`' {
+			var quoted string
+			if quoted, err = strconv.QuotedPrefix(text); err != nil {
+				return nil, errors.New("generate annotation has an invalid quoted string")
+			}
+			if word, err = strconv.Unquote(quoted); err != nil {
+				return
+			}
+			text = text[len(quoted):]
+		} else {
+			pos := strings.IndexAny(text, " \t")
+			if pos < 0 {
+				pos = len(text)
+			}
+			word, text = text[:pos], text[pos:]
+		}
+		words = append(words, word)
+	}
+}
+
+// -----------------------------------------------------------------------------
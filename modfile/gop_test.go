@@ -252,6 +252,58 @@ func TestParse2(t *testing.T) {
 	}
 }
 
+func TestParseMultiExtClass(t *testing.T) {
+	const gopmod = `
+gop 1.2
+
+project .gmx Game github.com/goplus/spx math
+class .spx .spx2 Sprite
+class -embed .spx3,.spx4, .spx5 Sprite GameBase
+`
+	f, err := Parse("gop.mod", []byte(gopmod), nil)
+	if err != nil {
+		t.Fatal("Parse:", err)
+	}
+	works := f.proj().Works
+	if len(works) != 5 {
+		t.Fatal("Parse: works", len(works))
+	}
+	for i, ext := range []string{".spx", ".spx2", ".spx3", ".spx4", ".spx5"} {
+		if w := works[i]; w.Ext != ext || w.Class != "Sprite" {
+			t.Fatal("Parse: work", i, w.Ext, w.Class)
+		}
+	}
+	if w := works[1]; w.ExtIndex != 1 || w.Syntax.Start.Line != 5 || w.Project != "" {
+		t.Fatal("Parse: work .spx2", w.ExtIndex, w.Syntax.Start.Line)
+	}
+	if w := works[4]; w.ExtIndex != 2 || w.Syntax.Start.Line != 6 || w.Project != "GameBase" || !w.Embedded {
+		t.Fatal("Parse: work .spx5", w.ExtIndex, w.Syntax.Start.Line)
+	}
+}
+
+func TestParseClassfile(t *testing.T) {
+	const gopmod = `
+gop 1.2
+
+classfile github.com/goplus/yap v0.8.0
+
+classfile (
+	github.com/goplus/spx/v2 v2.0.1
+)
+`
+	f, err := Parse("gop.mod", []byte(gopmod), nil)
+	if err != nil {
+		t.Fatal("Parse:", err)
+	}
+	if len(f.Classfiles) != 2 || f.Classfiles[0].Mod.String() != "github.com/goplus/yap@v0.8.0" ||
+		f.Classfiles[1].Mod.String() != "github.com/goplus/spx/v2@v2.0.1" || f.Classfiles[1].Syntax.Start.Line != 7 {
+		t.Fatal("Parse: classfiles", f.Classfiles)
+	}
+	if !Equal(f, f.Clone()) {
+		t.Fatal("Equal: false")
+	}
+}
+
 func TestParseErr(t *testing.T) {
 	doTestParseErr(t, `gop.mod:2: unknown directive: module`, `
 module foo
@@ -303,6 +355,14 @@ class .spx
 	doTestParseErr(t, `gop.mod:3: ext . invalid: invalid ext format`, `
 project github.com/goplus/spx math
 class . Sprite
+`)
+	doTestParseErr(t, `gop.mod:3: usage: class .workExt WorkClass [ProjClass]`, `
+project github.com/goplus/spx math
+class .spx .spx2
+`)
+	doTestParseErr(t, `gop.mod:3: ext , invalid: invalid ext format`, `
+project github.com/goplus/spx math
+class , Sprite
 `)
 	doTestParseErr(t, `gop.mod:3: symbol S"prite invalid: unquoted string cannot contain quote`, `
 project github.com/goplus/spx math
@@ -319,6 +379,19 @@ class .spx Sprite .abc
 	doTestParseErr(t, `gop.mod:3: symbol sprite invalid: invalid Go export symbol format`, `
 project github.com/goplus/spx math
 class .spx sprite
+`)
+	doTestParseErr(t, `gop.mod:2: usage: classfile modulePath version`, `
+classfile github.com/goplus/yap
+`)
+	doTestParseErr(t, `gop.mod:2: invalid version v0.8 of github.com/goplus/yap: must be of the form v1.2.3`, `
+classfile github.com/goplus/yap v0.8
+`)
+	doTestParseErr(t, `gop.mod:2: github.com/goplus/spx/v2@v1.0.0: invalid version: should be v2, not v1`, `
+classfile github.com/goplus/spx/v2 v1.0.0
+`)
+	doTestParseErr(t, `gop.mod:3: repeated classfile statement of github.com/goplus/yap`, `
+classfile github.com/goplus/yap v0.8.0
+classfile github.com/goplus/yap v0.9.0
 `)
 	doTestParseErr(t, `gop.mod:3: usage: import [name] pkgPath`, `
 project github.com/goplus/spx math
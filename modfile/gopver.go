@@ -0,0 +1,147 @@
+/*
+ * Copyright (c) 2021 The GoPlus Authors (goplus.org). All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package modfile
+
+import (
+	"fmt"
+
+	"golang.org/x/mod/modfile"
+	"golang.org/x/mod/semver"
+)
+
+// -----------------------------------------------------------------------------
+
+// features is the table of gop.mod features which require a minimum gop
+// version, checked by UnsupportedFeatures.
+var features = []struct {
+	name       string                // eg. "runner"
+	minVersion string                // the gop version introducing the feature
+	uses       func(f *File) []*Line // statements using the feature
+}{
+	{"runner", "1.2", usesRunner},
+	{"-embed", "1.3", usesEmbed},
+	{"class prototype", "1.3", usesPrototype},
+}
+
+func usesRunner(f *File) (lines []*Line) {
+	for _, proj := range f.Projects {
+		if r := proj.Runner; r != nil {
+			lines = append(lines, r.Syntax)
+		}
+	}
+	return
+}
+
+func usesEmbed(f *File) (lines []*Line) {
+	for _, proj := range f.Projects {
+		if proj.Embedded {
+			lines = append(lines, proj.Syntax)
+		}
+		for _, w := range proj.Works {
+			if w.Embedded {
+				lines = append(lines, w.Syntax)
+			}
+		}
+	}
+	return
+}
+
+func usesPrototype(f *File) (lines []*Line) {
+	for _, proj := range f.Projects {
+		for _, w := range proj.Works {
+			if w.Project != "" {
+				lines = append(lines, w.Syntax)
+			}
+		}
+	}
+	return
+}
+
+// A FeatureError reports a feature used by gop.mod which isn't supported by
+// the gop version.
+type FeatureError struct {
+	File       string // the gop.mod file
+	Pos        Position
+	Feature    string // eg. "runner"
+	MinVersion string // the minimum gop version supporting Feature
+	Version    string // the gop version
+}
+
+func (e *FeatureError) Error() string {
+	msg := fmt.Sprintf("%s requires gop %s or later, but gop version is %s", e.Feature, e.MinVersion, e.Version)
+	if e.File == "" {
+		return msg
+	}
+	return fmt.Sprintf("%s:%d: %s", e.File, e.Pos.Line, msg)
+}
+
+// UnsupportedFeatures returns features (runner, -embed and class prototypes)
+// used by this file which gop version ver doesn't support, one FeatureError
+// per statement using them.
+func (f *File) UnsupportedFeatures(ver string) (ret []*FeatureError) {
+	var file string
+	if f.Syntax != nil {
+		file = f.Syntax.Name
+	}
+	for _, feat := range features {
+		if semver.Compare("v"+ver, "v"+feat.minVersion) >= 0 {
+			continue
+		}
+		for _, line := range feat.uses(f) {
+			e := &FeatureError{File: file, Feature: feat.name, MinVersion: feat.minVersion, Version: ver}
+			if line != nil {
+				e.Pos = line.Start
+			}
+			ret = append(ret, e)
+		}
+	}
+	return
+}
+
+// SetGopVersion sets the gop directive of this file to ver, and checks features
+// used by this file are supported by ver (see UnsupportedFeatures). If strict
+// is true, the directive isn't changed and an error (an ErrorList if there are
+// more than one) is returned when any feature isn't supported. Otherwise the
+// directive is changed anyway and unsupported features are returned as
+// warnings.
+func (f *File) SetGopVersion(ver string, strict bool) (warnings []*FeatureError, err error) {
+	if !modfile.GoVersionRE.MatchString(ver) {
+		return nil, fmt.Errorf("invalid gop version '%s': must match format 1.23", ver)
+	}
+	warnings = f.UnsupportedFeatures(ver)
+	if strict && warnings != nil {
+		var errs ErrorList
+		for _, e := range warnings {
+			errs.Add(e)
+		}
+		return nil, errs.ToError()
+	}
+	if f.Gop == nil {
+		f.Gop = &Gop{}
+	}
+	f.Gop.Version = ver
+	if line := f.Gop.Syntax; line != nil {
+		line.Token = []string{"gop", ver}
+	} else if f.Syntax != nil {
+		line = &Line{Token: []string{"gop", ver}}
+		f.Syntax.Stmt = append([]Expr{line}, f.Syntax.Stmt...)
+		f.Gop.Syntax = line
+	}
+	return
+}
+
+// -----------------------------------------------------------------------------
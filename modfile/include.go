@@ -0,0 +1,118 @@
+/*
+ * Copyright (c) 2021 The GoPlus Authors (goplus.org). All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package modfile
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/mod/modfile"
+)
+
+// -----------------------------------------------------------------------------
+
+// An Include is an include statement, which inlines directives of a gop.mod
+// fragment, eg.
+//
+//	include ./classfiles/spx.gopmod
+//
+// Directives of the fragment are parsed as if they were written in place of
+// the include statement, but positions of their syntax nodes (and errors)
+// refer to the fragment. Format keeps the include statement as is.
+//
+// The path must be relative, and fragments (even nested ones) must be in the
+// directory of the including gop.mod file or its subdirectories.
+type Include struct {
+	Path     string      // the path as written, relative to the including file
+	File     string      // name of the fragment file
+	Fragment *FileSyntax // syntax tree of the fragment
+	Syntax   *Line
+}
+
+type parseState struct {
+	files    []string // stack of files being parsed (cleaned): the main file and fragments
+	fix      VersionFixer
+	readFile func(string) ([]byte, error) // reads fragments (os.ReadFile if nil)
+}
+
+// curFile returns name of the file (maybe a fragment) being parsed.
+func (f *File) curFile() string {
+	if ps := f.parsing; ps != nil && len(ps.files) > 1 {
+		return ps.files[len(ps.files)-1]
+	}
+	return f.Syntax.Name
+}
+
+func (f *File) include(errs *ErrorList, line *Line, path string, strict bool) error {
+	ps := f.parsing
+	if ps == nil { // eg. by Builder
+		ps = &parseState{files: []string{filepath.Clean(f.Syntax.Name)}}
+		f.parsing = ps
+		defer func() {
+			f.parsing = nil
+		}()
+	}
+	if filepath.IsAbs(path) || strings.HasPrefix(path, "/") {
+		return fmt.Errorf("include %s: absolute path not allowed", path)
+	}
+	name := filepath.Join(filepath.Dir(f.curFile()), path)
+	root := filepath.Dir(ps.files[0])
+	if !inDir(root, name) {
+		return fmt.Errorf("include %s: path outside of module directory %s", path, root)
+	}
+	for i, file := range ps.files {
+		if file == name {
+			chain := append(ps.files[i:len(ps.files):len(ps.files)], name)
+			return fmt.Errorf("include cycle: %s", strings.Join(chain, " -> "))
+		}
+	}
+	readFile := ps.readFile
+	if readFile == nil {
+		readFile = os.ReadFile
+	}
+	data, err := readFile(name)
+	if err != nil {
+		return err
+	}
+	frag, err := modfile.ParseLax(name, data, ps.fix)
+	if err != nil {
+		return err
+	}
+	f.Includes = append(f.Includes, &Include{Path: path, File: name, Fragment: frag.Syntax, Syntax: line})
+	ps.files = append(ps.files, name)
+	f.parseStmts(errs, frag.Syntax.Stmt, strict)
+	ps.files = ps.files[:len(ps.files)-1]
+	return nil
+}
+
+// inDir checks if file name is in directory root or its subdirectories, after
+// resolving symbolic links (so that a link can't point out of root). Paths that
+// can't be resolved (eg. not existing) are checked as they are.
+func inDir(root, name string) bool {
+	if v, err := filepath.EvalSymlinks(root); err == nil {
+		root = v
+	}
+	if v, err := filepath.EvalSymlinks(name); err == nil {
+		name = v
+	}
+	rel, err := filepath.Rel(root, name)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// -----------------------------------------------------------------------------
@@ -18,6 +18,8 @@ package modfile
 
 import (
 	"fmt"
+	"path"
+	"path/filepath"
 	"regexp"
 	"runtime"
 	"strconv"
@@ -25,21 +27,35 @@ import (
 
 	"github.com/qiniu/x/errors"
 	"golang.org/x/mod/modfile"
+	"golang.org/x/mod/module"
+	"golang.org/x/mod/semver"
 )
 
+// A Compiler is the compiler statement, eg. `compiler llgo 0.9`.
 type Compiler struct {
 	Name    string
 	Version string
+	Syntax  *Line // nil if it comes from the go statement of go.mod, eg. `go 1.18 // llgo 0.9`
 }
 
 // A File is the parsed, interpreted form of a gop.mod file.
 type File struct {
 	Gop       *Gop
-	Compiler  *Compiler // the underlying go compiler in go.mod (not gop.mod)
+	Compiler  *Compiler // the underlying go compiler (from gop.mod, or from go.mod as a fallback)
 	Projects  []*Project
-	ClassMods []string // calc by require statements in go.mod (not gop.mod)
+	ClassMods []string // calc by require statements in go.mod (not gop.mod) and Classfiles
+
+	Classfiles []*Classfile // classfile statements, eg. `classfile github.com/goplus/spx v2.0.1`
+
+	Extensions []*Extension // extension directives, eg. `x-assets ./assets`
+
+	Includes []*Include // include statements (in the order they are parsed), eg. `include ./spx.gopmod`
+
+	Generates []*Generate // generate annotations, eg. `//gop:generate spxgen ./assets`
 
 	Syntax *FileSyntax
+
+	parsing *parseState // non-nil while parsing
 }
 
 func (p *File) addProj(proj *Project) {
@@ -54,15 +70,29 @@ func (p *File) proj() *Project { // current project
 	return p.Projects[n-1]
 }
 
+// A Classfile is the classfile statement, which requires a classfile module
+// directly in gop.mod (without a require statement in go.mod), eg.
+//
+//	classfile github.com/goplus/spx/v2 v2.0.1
+type Classfile struct {
+	Mod    module.Version
+	Syntax *Line
+}
+
 // A Gop is the gop statement.
 type Gop = modfile.Go
 
 // A Class is the work class statement.
 type Class struct {
-	Ext     string // can be "_[class].gox" or ".[class]", eg. "_yap.gox" or ".spx"
-	Class   string // "Sprite"
-	Project string // maybe empty
-	Syntax  *Line
+	Ext      string   // can be "_[class].gox", ".[class]" or an ext pattern, eg. "_yap.gox", ".spx" or "*_[a-z]*.gox"
+	Class    string   // "Sprite"
+	Project  string   // maybe empty
+	Prefix   string   // method-name prefix, set by `-prefix=Xxx` (maybe empty)
+	Embedded bool     // set by `-embed`: the class instance is embedded in the project
+	Tags     []string // Go build tags required by the class, set by `-tags=js,wasm` (maybe empty)
+	Doc      string   // optional description, eg. "A sprite in the game"
+	ExtIndex int      // index of Ext among exts of a multi-ext class line, eg. 1 for .spx2 of `class .spx .spx2 Sprite`
+	Syntax   *Line
 }
 
 // A Import is the import statement.
@@ -74,25 +104,124 @@ type Import struct {
 
 // A Project is the project statement.
 type Project struct {
-	Ext      string    // can be "_[class].gox" or ".[class]", eg. "_yap.gox" or ".gmx"
+	Ext      string    // can be "_[class].gox", ".[class]" or an ext pattern, eg. "_yap.gox" or ".gmx"
 	Class    string    // "Game"
 	Works    []*Class  // work class of classfile
 	PkgPaths []string  // package paths of classfile and optional inline-imported packages.
+	PkgRefs  []PkgRef  // PkgPaths with their optional versions (nil if the project isn't parsed from gop.mod)
 	Import   []*Import // auto-imported packages
+	Runner   *Runner   // maybe nil
+	Prefix   string    // default method-name prefix of work classes, set by `-prefix=Xxx`
+	Embedded bool      // set by `-embed`: work classes are embedded in the project by default
+	Tags     []string  // Go build tags required by the project, set by `-tags=js,wasm` (maybe empty)
+	Excludes []string  // file name patterns excluded from the project, set by `-exclude=*_gen.spx` (maybe empty)
+	Doc      string    // optional description
 	Syntax   *Line
 }
 
-// IsProj checks if a (ext, fname) pair is a project file or not.
+// A PkgRef is a package path of a project statement with an optional version,
+// eg. `github.com/goplus/spx@v1.0.0`. The version is a requirement of the
+// module containing the package, see modload.Module.SyncProjectRequires.
+type PkgRef struct {
+	Path    string
+	Version string // maybe empty
+}
+
+func (p PkgRef) String() string {
+	if p.Version == "" {
+		return p.Path
+	}
+	return p.Path + "@" + p.Version
+}
+
+// IsProj checks if a (ext, fname) pair is a project file or not. A file
+// excluded from the project (see IsExcluded) isn't a project file. A file of
+// the project ext is a project file even if it also matches an ext pattern of
+// a work class (see IsExtPattern).
 func (p *Project) IsProj(ext, fname string) bool {
+	if p.IsExcluded(fname) {
+		return false
+	}
+	if w := p.workFor(ext, fname); w != nil {
+		if w.Ext == p.Ext {
+			return fname == "main"+ext
+		}
+		return MatchExt(p.Ext, fname)
+	}
+	return true
+}
+
+// IsExcluded checks if fname matches any pattern of `-exclude` of the project
+// statement, eg. `project -exclude=*_gen.spx .gmx Game ...`. Such a file isn't
+// a classfile of the project. Patterns are matched against the base name of
+// fname, see path.Match.
+func (p *Project) IsExcluded(fname string) bool {
+	if len(p.Excludes) == 0 {
+		return false
+	}
+	fname = filepath.Base(fname)
+	for _, pattern := range p.Excludes {
+		if ok, _ := path.Match(pattern, fname); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// WorkForExt returns the work class whose ext is ext, or nil if there is none.
+func (p *Project) WorkForExt(ext string) *Class {
+	return p.workFor(ext, "")
+}
+
+// WorkForFile returns the work class of fname (a file name without
+// directory), or nil if there is none. A work class whose ext is the ext of
+// fname takes precedence over the ones whose ext patterns match fname (see
+// IsExtPattern).
+func (p *Project) WorkForFile(fname string) *Class {
+	return p.workFor(ClassExt(fname), fname)
+}
+
+func (p *Project) workFor(ext, fname string) *Class {
 	for _, w := range p.Works {
 		if w.Ext == ext {
-			if ext != p.Ext || fname != "main"+ext {
-				return false
+			return w
+		}
+	}
+	if fname != "" {
+		for _, w := range p.Works {
+			if IsExtPattern(w.Ext) && MatchExt(w.Ext, fname) {
+				return w
 			}
-			break
 		}
 	}
-	return true
+	return nil
+}
+
+// HasPrototype checks if the work class of ext has a prototype, that is, a
+// project class specified by its class statement, eg. `class .spx Sprite Game`.
+func (p *Project) HasPrototype(ext string) bool {
+	w := p.WorkForExt(ext)
+	return w != nil && w.Project != ""
+}
+
+// EmbeddedWorks returns work classes whose instances are embedded in the
+// project, by `-embed` of the class statement or of the project statement.
+func (p *Project) EmbeddedWorks() (works []*Class) {
+	for _, w := range p.Works {
+		if w.Embedded || p.Embedded {
+			works = append(works, w)
+		}
+	}
+	return
+}
+
+// PrefixFor returns the method-name prefix of classfiles of ext: the prefix
+// of its work class if any, or the default prefix of the project otherwise.
+func (p *Project) PrefixFor(ext string) string {
+	if w := p.WorkForExt(ext); w != nil && w.Prefix != "" {
+		return w.Prefix
+	}
+	return p.Prefix
 }
 
 func New(gopmod, gopVer string) *File {
@@ -137,37 +266,59 @@ func ParseLax(file string, data []byte, fix VersionFixer) (*File, error) {
 	return parseToFile(file, data, fix, false)
 }
 
+// ParsePartial is like Parse but it returns the best-effort parsed file even if
+// some directives are invalid: invalid directives are skipped and reported in
+// the returned error (an ErrorList), while valid ones are kept in the file.
+// The returned file is nil only if data has syntax errors.
+func ParsePartial(file string, data []byte, fix VersionFixer) (*File, error) {
+	return parseToFileEx(file, data, fix, true, nil)
+}
+
 func parseToFile(file string, data []byte, fix VersionFixer, strict bool) (parsed *File, err error) {
+	if parsed, err = parseToFileEx(file, data, fix, strict, nil); err != nil {
+		parsed = nil
+	}
+	return
+}
+
+// parseToFileEx parses a gop.mod file. Included fragments are read by
+// readFile (os.ReadFile if nil).
+func parseToFileEx(file string, data []byte, fix VersionFixer, strict bool, readFile func(string) ([]byte, error)) (parsed *File, err error) {
 	f, err := modfile.ParseLax(file, data, fix)
 	if err != nil {
 		err = errors.NewWith(err, `modfile.ParseLax(file, data, fix)`, -2, "modfile.ParseLax", file, data, fix)
 		return
 	}
-	parsed = &File{Syntax: f.Syntax}
+	parsed = &File{Syntax: f.Syntax, parsing: &parseState{files: []string{filepath.Clean(file)}, fix: fix, readFile: readFile}}
 
 	var errs ErrorList
-	var fs = f.Syntax
-	for _, x := range fs.Stmt {
+	parsed.parseStmts(&errs, f.Syntax.Stmt, strict)
+	parsed.parsing = nil
+	if len(errs) > 0 {
+		err = errors.NewWith(errs, `len(errs) > 0`, -1, ">", len(errs), 0)
+	}
+	return
+}
+
+func (f *File) parseStmts(errs *ErrorList, stmts []Expr, strict bool) {
+	for _, x := range stmts {
+		f.parseGenerates(errs, x)
 		switch x := x.(type) {
 		case *Line:
-			parsed.parseVerb(&errs, x.Token[0], x, x.Token[1:], strict)
+			f.parseVerb(errs, x.Token[0], x, x.Token[1:], strict)
 		case *LineBlock:
 			verb := x.Token[0]
 			for _, line := range x.Line {
-				parsed.parseVerb(&errs, verb, line, line.Token, strict)
+				f.parseVerb(errs, verb, line, line.Token, strict)
 			}
 		}
 	}
-	if len(errs) > 0 {
-		return nil, errors.NewWith(errs, `len(errs) > 0`, -1, ">", len(errs), 0)
-	}
-	return
 }
 
 func (f *File) parseVerb(errs *ErrorList, verb string, line *Line, args []string, strict bool) {
 	wrapError1 := func(err error) {
 		errs.Add(&Error{
-			Filename: f.Syntax.Name,
+			Filename: f.curFile(),
 			Pos:      line.Start,
 			Err:      err,
 		})
@@ -197,14 +348,39 @@ func (f *File) parseVerb(errs *ErrorList, verb string, line *Line, args []string
 		}
 		f.Gop = &Gop{Syntax: line}
 		f.Gop.Version = args[0]
+	case "compiler":
+		if f.Compiler != nil {
+			errorf("repeated compiler statement")
+			return
+		}
+		if len(args) != 2 {
+			errorf(usage("compiler"))
+			return
+		}
+		if !compilerNameRE.MatchString(args[0]) {
+			errorf("invalid compiler name '%s'", args[0])
+			return
+		}
+		if !compilerVerRE.MatchString(args[1]) {
+			errorf("invalid compiler version '%s': must match format 0.9 or v0.9.0", args[1])
+			return
+		}
+		f.Compiler = &Compiler{Name: args[0], Version: args[1], Syntax: line}
 	case "project":
+		var doc string
+		args, doc = splitDoc(args, isImportPath)
+		flags, args, err := parseClassFlags(args)
+		if err != nil {
+			wrapError(err)
+			return
+		}
 		if len(args) < 1 {
-			errorf("usage: project [.projExt ProjClass] classFilePkgPath ...")
+			errorf(usage("project"))
 			return
 		}
-		if isExt(args[0]) {
+		if isExtArg(args[0]) {
 			if len(args) < 3 || strings.Contains(args[1], "/") {
-				errorf("usage: project [.projExt ProjClass] classFilePkgPath ...")
+				errorf(usage("project"))
 				return
 			}
 			ext, err := parseExt(&args[0])
@@ -217,23 +393,25 @@ func (f *File) parseVerb(errs *ErrorList, verb string, line *Line, args []string
 				wrapError(err)
 				return
 			}
-			pkgPaths, err := parsePkgPaths(args[2:])
+			pkgPaths, pkgRefs, err := parsePkgRefs(args[2:])
 			if err != nil {
 				wrapError(err)
 				return
 			}
 			f.addProj(&Project{
-				Ext: ext, Class: class, PkgPaths: pkgPaths, Syntax: line,
+				Ext: ext, Class: class, PkgPaths: pkgPaths, PkgRefs: pkgRefs,
+				Prefix: flags.prefix, Embedded: flags.embed, Tags: flags.tags, Excludes: flags.excludes, Doc: doc, Syntax: line,
 			})
 			return
 		}
-		pkgPaths, err := parsePkgPaths(args)
+		pkgPaths, pkgRefs, err := parsePkgRefs(args)
 		if err != nil {
 			wrapError(err)
 			return
 		}
 		f.addProj(&Project{
-			PkgPaths: pkgPaths, Syntax: line,
+			PkgPaths: pkgPaths, PkgRefs: pkgRefs, Prefix: flags.prefix, Embedded: flags.embed, Tags: flags.tags, Excludes: flags.excludes,
+			Doc: doc, Syntax: line,
 		})
 	case "class":
 		proj := f.proj()
@@ -241,34 +419,56 @@ func (f *File) parseVerb(errs *ErrorList, verb string, line *Line, args []string
 			errorf("work class must declare after a project definition")
 			return
 		}
+		var doc string
+		args, doc = splitDoc(args, isSymbol)
+		flags, args, err := parseClassFlags(args)
+		if err != nil {
+			wrapError(err)
+			return
+		}
+		if flags.excludes != nil {
+			errorf("-exclude is only allowed in a project statement")
+			return
+		}
 		if len(args) < 2 {
-			errorf("usage: class .workExt WorkClass [ProjClass]")
+			errorf(usage("class"))
 			return
 		}
-		workExt, err := parseExt(&args[0])
+		workExts, args, err := parseExts(args)
 		if err != nil {
 			wrapError(err)
 			return
 		}
-		class, err := parseSymbol(&args[1])
+		if len(args) < 1 {
+			errorf(usage("class"))
+			return
+		}
+		class, err := parseSymbol(&args[0])
 		if err != nil {
 			wrapError(err)
 			return
 		}
 		projClass := ""
-		if len(args) > 2 {
-			projClass, err = parseSymbol(&args[2])
+		if len(args) > 1 {
+			projClass, err = parseSymbol(&args[1])
 			if err != nil {
 				wrapError(err)
 				return
 			}
 		}
-		proj.Works = append(proj.Works, &Class{
-			Ext:     workExt,
-			Class:   class,
-			Project: projClass,
-			Syntax:  line,
-		})
+		for i, workExt := range workExts {
+			proj.Works = append(proj.Works, &Class{
+				Ext:      workExt,
+				Class:    class,
+				Project:  projClass,
+				Prefix:   flags.prefix,
+				Embedded: flags.embed,
+				Tags:     flags.tags,
+				Doc:      doc,
+				ExtIndex: i,
+				Syntax:   line,
+			})
+		}
 	case "import":
 		proj := f.proj()
 		if proj == nil {
@@ -294,10 +494,89 @@ func (f *File) parseVerb(errs *ErrorList, verb string, line *Line, args []string
 			}
 			proj.Import = append(proj.Import, &Import{Name: name, Path: pkgPath, Syntax: line})
 		default:
-			errorf("usage: import [name] pkgPath")
+			errorf(usage("import"))
+			return
+		}
+	case "runner":
+		proj := f.proj()
+		if proj == nil {
+			errorf("runner must declare after a project definition")
+			return
+		}
+		if proj.Runner != nil {
+			errorf("repeated runner statement")
+			return
+		}
+		if len(args) < 2 {
+			errorf(usage("runner"))
+			return
+		}
+		pkgPath, err := parsePkgPath(&args[0])
+		if err != nil {
+			wrapError(err)
+			return
+		}
+		ver := strings.Join(args[1:], " ")
+		cons, err := ParseConstraint(ver)
+		if err == nil {
+			err = checkRunnerMajor(pkgPath, cons)
+		}
+		if err != nil {
+			wrapError(err)
+			return
+		}
+		proj.Runner = &Runner{Path: pkgPath, Version: ver, Constraint: cons, Syntax: line}
+	case "classfile":
+		if len(args) != 2 {
+			errorf(usage("classfile"))
+			return
+		}
+		modPath, err := parseString(&args[0])
+		if err == nil {
+			err = module.CheckPath(modPath)
+		}
+		if err != nil {
+			errorf("invalid module path %s: %v", args[0], err)
+			return
+		}
+		ver, err := parseString(&args[1])
+		if err == nil && module.CanonicalVersion(ver) != ver {
+			err = errors.New("must be of the form v1.2.3")
+		}
+		if err != nil {
+			errorf("invalid version %s of %s: %v", args[1], modPath, err)
+			return
+		}
+		if err = module.Check(modPath, ver); err != nil {
+			wrapError(err)
+			return
+		}
+		for _, c := range f.Classfiles {
+			if c.Mod.Path == modPath {
+				errorf("repeated classfile statement of %s", modPath)
+				return
+			}
+		}
+		f.Classfiles = append(f.Classfiles, &Classfile{Mod: module.Version{Path: modPath, Version: ver}, Syntax: line})
+	case "include":
+		if len(args) != 1 {
+			errorf(usage("include"))
+			return
+		}
+		path, err := parseString(&args[0])
+		if err != nil {
+			wrapError(err)
+			return
+		}
+		if err = f.include(errs, line, path, strict); err != nil {
+			wrapError(err)
 			return
 		}
 	default:
+		if IsExtension(verb) {
+			f.Extensions = append(f.Extensions, &Extension{Verb: verb, Args: args, Syntax: line})
+			return
+		}
 		if strict {
 			errorf("unknown directive: %s", verb)
 		}
@@ -329,26 +608,104 @@ func AutoQuote(s string) string {
 }
 
 var (
-	symbolRE = regexp.MustCompile("\\*?[A-Z]\\w*")
+	compilerNameRE = regexp.MustCompile(`^[a-z][a-z0-9_-]*$`)
+	compilerVerRE  = regexp.MustCompile(`^v?[0-9]+(\.[0-9]+)*([-+][0-9A-Za-z.-]+)?$`)
 )
 
-// TODO: to be optimized
 func parseSymbol(s *string) (t string, err error) {
 	t, err = parseString(s)
-	if err != nil {
-		goto failed
-	}
-	if symbolRE.MatchString(t) {
-		return
+	if err == nil {
+		if _, err = ParseSymbol(t); err == nil {
+			return
+		}
 	}
-	err = errors.New("invalid Go export symbol format")
-failed:
 	return "", &InvalidSymbolError{
 		Sym: *s,
 		Err: err,
 	}
 }
 
+type classFlags struct {
+	prefix   string
+	embed    bool
+	tags     []string
+	excludes []string // project only
+}
+
+var (
+	prefixRE = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+	tagRE    = regexp.MustCompile(`^[A-Za-z0-9_.]+$`)
+)
+
+// parseClassFlags parses leading flags of a class or project statement:
+//
+//	-embed           the class instance is embedded in the project
+//	-prefix=Xxx      method-name prefix of the class
+//	-tags=tag1,tag2  Go build tags required by the class
+//	-exclude=pattern file names excluded from the project (can be repeated)
+func parseClassFlags(args []string) (flags classFlags, rest []string, err error) {
+	for len(args) > 0 && strings.HasPrefix(args[0], "-") {
+		switch arg := args[0]; {
+		case arg == "-embed":
+			flags.embed = true
+		case strings.HasPrefix(arg, "-prefix="):
+			prefix := arg[len("-prefix="):]
+			if !prefixRE.MatchString(prefix) {
+				return flags, nil, fmt.Errorf("invalid prefix: %s", arg)
+			}
+			flags.prefix = prefix
+		case strings.HasPrefix(arg, "-tags="):
+			tags := arg[len("-tags="):]
+			for len(args) > 1 && (args[1] == "," || strings.HasSuffix(tags, ",")) { // commas are separate tokens
+				tags += args[1]
+				args = args[1:]
+			}
+			for _, tag := range strings.Split(tags, ",") {
+				if !tagRE.MatchString(tag) {
+					return flags, nil, fmt.Errorf("invalid build tag %q: -tags=%s", tag, tags)
+				}
+				flags.tags = append(flags.tags, tag)
+			}
+		case strings.HasPrefix(arg, "-exclude="):
+			pattern := arg[len("-exclude="):]
+			if _, e := path.Match(pattern, ""); e != nil || pattern == "" || strings.ContainsAny(pattern, `/\`) {
+				return flags, nil, fmt.Errorf("invalid exclude pattern: %s", arg)
+			}
+			flags.excludes = append(flags.excludes, pattern)
+		default:
+			return flags, nil, fmt.Errorf("unknown flag: %s", arg)
+		}
+		args = args[1:]
+	}
+	return flags, args, nil
+}
+
+// splitDoc splits the optional description from args of a class or project
+// statement. The description is the last argument written as a quoted string
+// which isn't a valid value at that position (checked by isValue), eg.
+//
+//	class .spx Sprite "A sprite in the game"
+//
+// A quoted last argument which is a valid value (eg. `class .spx Sprite "Game"`)
+// is read as the value, as it was before descriptions were supported.
+func splitDoc(args []string, isValue func(string) bool) ([]string, string) {
+	if n := len(args); n > 1 && strings.HasPrefix(args[n-1], `"`) {
+		if doc, err := strconv.Unquote(args[n-1]); err == nil && !isValue(doc) {
+			return args[:n-1], doc
+		}
+	}
+	return args, ""
+}
+
+func isSymbol(s string) bool {
+	_, err := ParseSymbol(s)
+	return err == nil
+}
+
+func isImportPath(s string) bool {
+	return module.CheckImportPath(s) == nil
+}
+
 func parseString(s *string) (string, error) {
 	t := *s
 	if strings.HasPrefix(t, `"`) {
@@ -377,16 +734,67 @@ func parsePkgPath(s *string) (path string, err error) {
 	return
 }
 
-func parsePkgPaths(args []string) (paths []string, err error) {
+// parsePkgRefs parses package paths with optional versions, eg.
+// `github.com/goplus/spx@v1.0.0 math`.
+func parsePkgRefs(args []string) (paths []string, refs []PkgRef, err error) {
 	paths = make([]string, len(args))
+	refs = make([]PkgRef, len(args))
 	for i := range args {
-		if paths[i], err = parsePkgPath(&args[i]); err != nil {
+		var ref PkgRef
+		if ref, err = parsePkgRef(&args[i]); err != nil {
+			return
+		}
+		paths[i], refs[i] = ref.Path, ref
+	}
+	return
+}
+
+func parsePkgRef(s *string) (ref PkgRef, err error) {
+	t, err := parseString(s)
+	if err != nil {
+		err = fmt.Errorf("invalid quoted string: %v", err)
+		return
+	}
+	if pos := strings.LastIndexByte(t, '@'); pos >= 0 {
+		ref.Version = t[pos+1:]
+		if !semver.IsValid(ref.Version) || module.CanonicalVersion(ref.Version) != ref.Version {
+			err = fmt.Errorf(`"%s" is not a canonical semantic version`, ref.Version)
 			return
 		}
+		t = t[:pos]
 	}
+	if !isPkgPath(t) {
+		err = fmt.Errorf(`"%s" is not a valid package path`, t)
+		return
+	}
+	if ref.Version != "" {
+		if err = checkPkgVersion(t, ref.Version); err != nil {
+			return
+		}
+	}
+	ref.Path = t
 	return
 }
 
+// checkPkgVersion checks that version can be a version of the module providing
+// package pkgPath, ie. that it matches the major version suffix of the module
+// path (eg. github.com/goplus/spx/v2@v1.0.0 is invalid). The module path is
+// taken as the longest prefix of pkgPath ending with a major version suffix, or
+// pkgPath itself if there is none.
+func checkPkgVersion(pkgPath, version string) error {
+	for modPath := pkgPath; ; {
+		if _, major, ok := module.SplitPathVersion(modPath); ok && major != "" {
+			return module.Check(modPath, version)
+		}
+		pos := strings.LastIndexByte(modPath, '/')
+		if pos < 0 {
+			break
+		}
+		modPath = modPath[:pos]
+	}
+	return module.Check(pkgPath, version)
+}
+
 func isPkgPath(s string) bool {
 	return s != "" && (s[0] != '.' && s[0] != '_')
 }
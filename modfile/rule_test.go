@@ -16,8 +16,13 @@
 package modfile
 
 import (
+	"os"
+	"path/filepath"
+	"strings"
 	"syscall"
 	"testing"
+
+	"github.com/qiniu/x/errors"
 )
 
 // -----------------------------------------------------------------------------
@@ -95,4 +100,506 @@ func TestMustQuote(t *testing.T) {
 	}
 }
 
+func TestParseCompiler(t *testing.T) {
+	f, err := Parse("/foo/gop.mod", []byte("gop 1.2\ncompiler llgo 0.9\n"), nil)
+	if err != nil {
+		t.Fatal("Parse:", err)
+	}
+	if cl := f.Compiler; cl == nil || cl.Name != "llgo" || cl.Version != "0.9" || cl.Syntax == nil {
+		t.Fatal("Parse compiler:", cl)
+	}
+	errs := []string{
+		"compiler llgo\n",
+		"compiler LLGo 0.9\n",
+		"compiler llgo latest\n",
+		"compiler llgo 0.9\ncompiler tinygo 0.32\n",
+	}
+	for _, text := range errs {
+		if _, err := Parse("/foo/gop.mod", []byte(text), nil); err == nil {
+			t.Fatal("Parse: no error?", text)
+		}
+	}
+}
+
+func TestParsePartial(t *testing.T) {
+	const gopmod = `
+gop 1.2
+
+project .gmx Game github.com/goplus/spx math
+class .spx sprite
+class .spx2 Sprite2
+
+project _yap.gox App github.com/goplus/yap
+`
+	if _, err := Parse("/foo/gop.mod", []byte(gopmod), nil); err == nil {
+		t.Fatal("Parse: no error?")
+	}
+	f, err := ParsePartial("/foo/gop.mod", []byte(gopmod), nil)
+	if err == nil {
+		t.Fatal("ParsePartial: no error?")
+	}
+	if f == nil || len(f.Projects) != 2 || len(f.Projects[0].Works) != 1 {
+		t.Fatal("ParsePartial:", f)
+	}
+	if f, err = ParsePartial("/foo/gop.mod", []byte("project (\n"), nil); f != nil || err == nil {
+		t.Fatal("ParsePartial: syntax error", f, err)
+	}
+}
+
+func TestParseDoc(t *testing.T) {
+	const gopmod = `
+gop 1.2
+
+project .gmx Game github.com/goplus/spx math "2D game engine"
+class .spx Sprite "A sprite in the game"
+class .spx2 Sprite2 "Game"
+class .spx3 Sprite3 Game "A sprite"
+
+project "github.com/goplus/yap"
+`
+	f, err := Parse("/foo/gop.mod", []byte(gopmod), nil)
+	if err != nil {
+		t.Fatal("Parse:", err)
+	}
+	proj := f.Projects[0]
+	if proj.Doc != "2D game engine" || len(proj.PkgPaths) != 2 {
+		t.Fatal("project doc:", proj.Doc, proj.PkgPaths)
+	}
+	if w := proj.Works[0]; w.Doc != "A sprite in the game" || w.Project != "" {
+		t.Fatal("class doc:", w)
+	}
+	if w := proj.Works[1]; w.Doc != "" || w.Project != "Game" {
+		t.Fatal("class doc:", w)
+	}
+	if w := proj.Works[2]; w.Doc != "A sprite" || w.Project != "Game" {
+		t.Fatal("class doc:", w)
+	}
+	if proj = f.Projects[1]; proj.Doc != "" || proj.PkgPaths[0] != "github.com/goplus/yap" {
+		t.Fatal("project doc:", proj.Doc, proj.PkgPaths)
+	}
+	if _, err = Parse("/foo/gop.mod", []byte("project .gmx Game \"no pkgPath\"\n"), nil); err == nil {
+		t.Fatal("Parse: no error?")
+	}
+
+	// quoted values are read as values, as they were before descriptions
+	f, err = Parse("/foo/gop.mod", []byte(`project .gmx Game "github.com/goplus/spx" "math"
+class .spx Sprite "Game"
+class .spx2 Sprite2 "Game" "A sprite"
+`), nil)
+	if err != nil {
+		t.Fatal("Parse quoted values:", err)
+	}
+	if proj = f.Projects[0]; proj.Doc != "" || len(proj.PkgPaths) != 2 || proj.PkgPaths[1] != "math" {
+		t.Fatal("quoted pkgPaths:", proj.Doc, proj.PkgPaths)
+	}
+	if w := proj.Works[0]; w.Doc != "" || w.Project != "Game" {
+		t.Fatal("quoted project class:", w)
+	}
+	if w := proj.Works[1]; w.Doc != "A sprite" || w.Project != "Game" {
+		t.Fatal("quoted project class with doc:", w)
+	}
+}
+
+func TestExtension(t *testing.T) {
+	const gopmod = `gop 1.2
+
+x-assets ./assets
+
+x-meta (
+	author "Foo Bar"
+)
+`
+	f, err := Parse("/foo/gop.mod", []byte(gopmod), nil)
+	if err != nil {
+		t.Fatal("Parse:", err)
+	}
+	if len(f.Extensions) != 2 {
+		t.Fatal("Extensions:", f.Extensions)
+	}
+	if e := f.Extensions[1]; e.Verb != "x-meta" || len(e.Args) != 2 || e.Args[1] != `"Foo Bar"` || e.Syntax.Start.Line != 6 {
+		t.Fatal("Extensions:", e)
+	}
+	if err = f.AddExtension("assets", "."); err == nil {
+		t.Fatal("AddExtension: no error?")
+	}
+	f.AddExtension("x-assets", "./my assets")
+	if exts := f.LookupExtensions("x-assets"); len(exts) != 2 || exts[1].Args[0] != `"./my assets"` {
+		t.Fatal("LookupExtensions:", exts)
+	}
+	if v := string(Format(f.Syntax)); v != gopmod+"\nx-assets \"./my assets\"\n" {
+		t.Fatal("Format:", v)
+	}
+	if _, err = Parse("/foo/gop.mod", []byte("x- foo\n"), nil); err == nil {
+		t.Fatal("Parse: no error?")
+	}
+}
+
+func TestParseClassFlags(t *testing.T) {
+	const gopmod = `gop 1.2
+
+project -prefix=On .gmx Game github.com/goplus/spx math
+class -embed .spx Sprite
+class -embed -prefix=Do .spx2 Sprite2 "A sprite"
+`
+	f, err := Parse("/foo/gop.mod", []byte(gopmod), nil)
+	if err != nil {
+		t.Fatal("Parse:", err)
+	}
+	proj := f.Projects[0]
+	if proj.Prefix != "On" || proj.Embedded || proj.Ext != ".gmx" {
+		t.Fatal("project flags:", proj)
+	}
+	if w := proj.Works[0]; !w.Embedded || w.Prefix != "" {
+		t.Fatal("class flags:", w)
+	}
+	if w := proj.Works[1]; !w.Embedded || w.Prefix != "Do" || w.Doc != "A sprite" {
+		t.Fatal("class flags:", w)
+	}
+	f, err = Parse("/foo/gop.mod", []byte("project -tags=js,wasm .gmx Game github.com/goplus/spx\nclass -tags=wasm .spx Sprite\n"), nil)
+	if err != nil {
+		t.Fatal("Parse -tags:", err)
+	}
+	if proj := f.Projects[0]; strings.Join(proj.Tags, ",") != "js,wasm" || len(proj.Works[0].Tags) != 1 {
+		t.Fatal("tags flag:", proj.Tags, proj.Works[0].Tags)
+	}
+	if cpy := f.Clone(); !Equal(cpy, f) || &cpy.Projects[0].Tags[0] == &f.Projects[0].Tags[0] {
+		t.Fatal("Clone tags:", cpy.Projects[0].Tags)
+	}
+	f, err = Parse("/foo/gop.mod", []byte("project -exclude=*_gen.spx -exclude=test_*.spx .gmx Game github.com/goplus/spx\nclass .spx Sprite\n"), nil)
+	if err != nil {
+		t.Fatal("Parse -exclude:", err)
+	}
+	proj = f.Projects[0]
+	if strings.Join(proj.Excludes, " ") != "*_gen.spx test_*.spx" {
+		t.Fatal("exclude flag:", proj.Excludes)
+	}
+	if !proj.IsExcluded("foo/Bar_gen.spx") || !proj.IsExcluded("test_a.spx") || proj.IsExcluded("Bar.spx") {
+		t.Fatal("IsExcluded")
+	}
+	if !proj.IsProj(".gmx", "a_gen.gmx") || (&Project{Ext: ".gmx", Excludes: []string{"*.gmx"}}).IsProj(".gmx", "a.gmx") {
+		t.Fatal("IsProj: excludes not honored")
+	}
+	cpy := f.Clone()
+	if !Equal(cpy, f) || &cpy.Projects[0].Excludes[0] == &proj.Excludes[0] {
+		t.Fatal("Clone excludes:", cpy.Projects[0].Excludes)
+	}
+	if cpy.Projects[0].Excludes = cpy.Projects[0].Excludes[:1]; Equal(cpy, f) {
+		t.Fatal("Equal: excludes ignored")
+	}
+	for _, src := range []string{
+		"project -exclude=[ .gmx Game github.com/goplus/spx\n",
+		"project -exclude=gen/*.spx .gmx Game github.com/goplus/spx\n",
+		"project .gmx Game github.com/goplus/spx\nclass -exclude=*_gen.spx .spx Sprite\n",
+		"project -tags=js,,wasm .gmx Game github.com/goplus/spx\n",
+		"project .gmx Game github.com/goplus/spx\nclass -foo .spx Sprite\n",
+		"project .gmx Game github.com/goplus/spx\nclass -prefix=1x .spx Sprite\n",
+		"project -embed\n",
+	} {
+		if _, err = Parse("/foo/gop.mod", []byte(src), nil); err == nil {
+			t.Fatal("Parse: no error?", src)
+		}
+	}
+}
+
+func TestDirectives(t *testing.T) {
+	names := make([]string, 0, len(Directives()))
+	for _, d := range Directives() {
+		if d.Doc == "" {
+			t.Fatal("Directive.Doc:", d.Name)
+		}
+		names = append(names, d.Name)
+	}
+	if v := strings.Join(names, " "); v != "gop compiler classfile include project class import runner" {
+		t.Fatal("Directives:", v)
+	}
+	d, ok := LookupDirective("class")
+	if !ok || d.String() != "class .workExt WorkClass [ProjClass]" || d.Parent != "project" || len(d.Flags) != 3 {
+		t.Fatal("LookupDirective class:", d)
+	}
+	if d, ok = LookupDirective("project"); !ok || len(d.Flags) != 4 || d.Flags[3].Name != "-exclude" {
+		t.Fatal("LookupDirective project:", d)
+	}
+	if _, ok := LookupDirective("require"); ok {
+		t.Fatal("LookupDirective require: ok?")
+	}
+}
+
 // -----------------------------------------------------------------------------
+
+func TestInclude(t *testing.T) {
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "classfiles"), 0777)
+	os.WriteFile(filepath.Join(dir, "classfiles", "spx.gopmod"), []byte(`project .gmx Game github.com/goplus/spx math
+class .spx Sprite
+include yap.gopmod
+`), 0666)
+	os.WriteFile(filepath.Join(dir, "classfiles", "yap.gopmod"), []byte(`
+project _yap.gox App github.com/goplus/yap
+`), 0666)
+	const gopmod = `gop 1.2
+
+include ./classfiles/spx.gopmod
+
+import github.com/goplus/spx/pkg/gdi
+`
+	f, err := Parse(filepath.Join(dir, "gop.mod"), []byte(gopmod), nil)
+	if err != nil {
+		t.Fatal("Parse:", err)
+	}
+	if len(f.Projects) != 2 || len(f.Projects[0].Works) != 1 || len(f.Projects[1].Import) != 1 {
+		t.Fatal("Parse:", f.Projects)
+	}
+	if pos := f.Projects[1].Syntax.Start; pos.Line != 2 {
+		t.Fatal("Parse: project position", pos)
+	}
+	if len(f.Includes) != 2 || f.Includes[1].File != filepath.Join(dir, "classfiles", "yap.gopmod") {
+		t.Fatal("Parse: includes", f.Includes)
+	}
+	if v := string(Format(f.Syntax)); v != gopmod {
+		t.Fatal("Format:", v)
+	}
+	if cpy := f.Clone(); cpy.Projects[1].Syntax == nil || cpy.Projects[1].Syntax == f.Projects[1].Syntax || !Equal(cpy, f) {
+		t.Fatal("Clone:", cpy.Projects[1])
+	}
+
+	os.WriteFile(filepath.Join(dir, "classfiles", "yap.gopmod"), []byte("include ./spx.gopmod\n"), 0666)
+	_, err = Parse(filepath.Join(dir, "gop.mod"), []byte(gopmod), nil)
+	if err == nil || !strings.Contains(err.Error(), "include cycle") {
+		t.Fatal("Parse cycle:", err)
+	}
+	os.WriteFile(filepath.Join(dir, "classfiles", "yap.gopmod"), []byte("project .gmx\n"), 0666)
+	_, err = Parse(filepath.Join(dir, "gop.mod"), []byte(gopmod), nil)
+	if e, ok := errors.Err(err).(errors.List); !ok || e[0].(*Error).Filename != filepath.Join(dir, "classfiles", "yap.gopmod") {
+		t.Fatal("Parse fragment error:", err)
+	}
+	for _, src := range []string{"include\n", "include ./nonexist.gopmod\n"} {
+		if _, err = Parse(filepath.Join(dir, "gop.mod"), []byte(src), nil); err == nil {
+			t.Fatal("Parse: no error?", src)
+		}
+	}
+
+	os.WriteFile(filepath.Join(dir, "secret.gopmod"), []byte("secret data\n"), 0666)
+	os.WriteFile(filepath.Join(dir, "classfiles", "yap.gopmod"), []byte("include ../secret.gopmod\n"), 0666)
+	if _, err = Parse(filepath.Join(dir, "gop.mod"), []byte(gopmod), nil); err == nil || !strings.Contains(err.Error(), "unknown directive: secret") {
+		t.Fatal("Parse nested fragment in module directory:", err) // included
+	}
+	sub := filepath.Join(dir, "sub")
+	os.MkdirAll(sub, 0777)
+	for _, path := range []string{"../secret.gopmod", "./a/../../secret.gopmod", "..", filepath.Join(dir, "secret.gopmod"), "/etc/passwd"} {
+		_, err = Parse(filepath.Join(sub, "gop.mod"), []byte("include "+path+"\n"), nil)
+		if err == nil || strings.Contains(err.Error(), "unknown directive") ||
+			!strings.Contains(err.Error(), "outside of module directory") && !strings.Contains(err.Error(), "absolute path not allowed") {
+			t.Fatal("Parse include", path, err)
+		}
+	}
+	os.WriteFile(filepath.Join(dir, "classfiles", "yap.gopmod"), []byte("include ../../secret.gopmod\n"), 0666)
+	if _, err = Parse(filepath.Join(dir, "gop.mod"), []byte(gopmod), nil); err == nil || !strings.Contains(err.Error(), "outside of module directory") {
+		t.Fatal("Parse nested include outside:", err)
+	}
+
+	outside := t.TempDir()
+	os.WriteFile(filepath.Join(outside, "secret.gopmod"), []byte("secret data\n"), 0666)
+	if err = os.Symlink(filepath.Join(outside, "secret.gopmod"), filepath.Join(dir, "classfiles", "link.gopmod")); err != nil {
+		t.Skip("symlink:", err)
+	}
+	if err = os.Symlink(outside, filepath.Join(dir, "linkdir")); err != nil {
+		t.Skip("symlink:", err)
+	}
+	for _, path := range []string{"./classfiles/link.gopmod", "./linkdir/secret.gopmod"} {
+		_, err = Parse(filepath.Join(dir, "gop.mod"), []byte("include "+path+"\n"), nil)
+		if err == nil || !strings.Contains(err.Error(), "outside of module directory") {
+			t.Fatal("Parse include symlink", path, err)
+		}
+	}
+}
+
+func TestGenerate(t *testing.T) {
+	const gopmod = `//gop:generate spxgen ./assets
+gop 1.2 //gop:generate ignored
+
+//gop:generated not an annotation
+
+project (
+	//gop:generate "gop" run "./cmd/gen tool"
+	.gmx Game github.com/goplus/spx
+)
+`
+	f, err := Parse("gop.mod", []byte(gopmod), nil)
+	if err != nil {
+		t.Fatal("Parse:", err)
+	}
+	if len(f.Generates) != 2 {
+		t.Fatal("Parse: generates", f.Generates)
+	}
+	if g := f.Generates[0]; g.Command != "spxgen" || len(g.Args) != 1 || g.Args[0] != "./assets" || g.Pos.Line != 1 || g.File != "gop.mod" {
+		t.Fatal("Parse: generate 0", g)
+	}
+	if g := f.Generates[1]; g.Command != "gop" || len(g.Args) != 2 || g.Args[1] != "./cmd/gen tool" || g.Pos.Line != 7 {
+		t.Fatal("Parse: generate 1", g)
+	}
+	if cpy := f.Clone(); len(cpy.Generates) != 2 || cpy.Generates[1] == f.Generates[1] {
+		t.Fatal("Clone:", cpy.Generates)
+	}
+	f.AddGenerate("echo", "hello world")
+	if v := string(Format(f.Syntax)); v != gopmod+"\n//gop:generate echo \"hello world\"\n" {
+		t.Fatal("Format:", v)
+	}
+	if g := f.Generates[2]; g.Command != "echo" || g.Args[0] != "hello world" {
+		t.Fatal("AddGenerate:", g)
+	}
+	for _, src := range []string{"//gop:generate\ngop 1.2\n", "//gop:generate \"foo\ngop 1.2\n"} {
+		if _, err = Parse("gop.mod", []byte(src), nil); err == nil {
+			t.Fatal("Parse: no error?", src)
+		}
+	}
+}
+
+func TestProjectCapabilities(t *testing.T) {
+	const gopmod = `gop 1.2
+
+project -prefix=On .gmx Game github.com/goplus/spx
+class .spx Sprite
+class -embed .spr SpriteImpl Game
+class -prefix=Do .spd Sprite2 Game
+class -embed -prefix=X .spe Sprite3
+
+project -embed _app.gox App github.com/goplus/yap
+class _yap.gox Handler
+class -prefix=Get _get.gox GetHandler App
+`
+	f, err := Parse("/foo/gop.mod", []byte(gopmod), nil)
+	if err != nil {
+		t.Fatal("Parse:", err)
+	}
+	spx, yap := f.Projects[0], f.Projects[1]
+	cases := []struct {
+		proj   *Project
+		ext    string
+		class  string
+		proto  bool
+		prefix string
+	}{
+		{spx, ".spx", "Sprite", false, "On"},
+		{spx, ".spr", "SpriteImpl", true, "On"},
+		{spx, ".spd", "Sprite2", true, "Do"},
+		{spx, ".spe", "Sprite3", false, "X"},
+		{spx, ".gmx", "", false, "On"},
+		{yap, "_yap.gox", "Handler", false, ""},
+		{yap, "_get.gox", "GetHandler", true, "Get"},
+		{yap, ".spx", "", false, ""},
+	}
+	for _, c := range cases {
+		w := c.proj.WorkForExt(c.ext)
+		if (w == nil) != (c.class == "") || (w != nil && w.Class != c.class) {
+			t.Fatal("WorkForExt:", c.ext, w)
+		}
+		if v := c.proj.HasPrototype(c.ext); v != c.proto {
+			t.Fatal("HasPrototype:", c.ext, v)
+		}
+		if v := c.proj.PrefixFor(c.ext); v != c.prefix {
+			t.Fatal("PrefixFor:", c.ext, v)
+		}
+	}
+	exts := func(works []*Class) (ret []string) {
+		for _, w := range works {
+			ret = append(ret, w.Ext)
+		}
+		return
+	}
+	if v := strings.Join(exts(spx.EmbeddedWorks()), " "); v != ".spr .spe" {
+		t.Fatal("EmbeddedWorks spx:", v)
+	}
+	if v := strings.Join(exts(yap.EmbeddedWorks()), " "); v != "_yap.gox _get.gox" {
+		t.Fatal("EmbeddedWorks yap:", v)
+	}
+	if works := (&Project{Ext: ".gsh"}).EmbeddedWorks(); works != nil {
+		t.Fatal("EmbeddedWorks gsh:", works)
+	}
+}
+
+func TestPkgRefs(t *testing.T) {
+	const gopmod = `gop 1.2
+
+project .spx Game github.com/goplus/spx/v2@v2.1.0 math
+
+project github.com/goplus/yap@v0.8.0
+
+project gopkg.in/yaml.v3/sub@v3.0.1 github.com/goplus/spx/v2/pkg@v2.1.0
+`
+	f, err := Parse("/foo/gop.mod", []byte(gopmod), nil)
+	if err != nil {
+		t.Fatal("Parse:", err)
+	}
+	spx, yap := f.Projects[0], f.Projects[1]
+	if strings.Join(spx.PkgPaths, " ") != "github.com/goplus/spx/v2 math" || len(spx.PkgRefs) != 2 ||
+		spx.PkgRefs[0].String() != "github.com/goplus/spx/v2@v2.1.0" || spx.PkgRefs[1].String() != "math" {
+		t.Fatal("Parse spx:", spx.PkgPaths, spx.PkgRefs)
+	}
+	if yap.PkgPaths[0] != "github.com/goplus/yap" || yap.PkgRefs[0].Version != "v0.8.0" {
+		t.Fatal("Parse yap:", yap.PkgPaths, yap.PkgRefs)
+	}
+	if v := string(Format(f.Syntax)); v != gopmod {
+		t.Fatal("Format:", v)
+	}
+	cpy := f.Clone()
+	if !Equal(cpy, f) || &cpy.Projects[0].PkgRefs[0] == &spx.PkgRefs[0] {
+		t.Fatal("Clone:", cpy.Projects[0].PkgRefs)
+	}
+	cpy.Projects[0].PkgRefs[0].Version = "v2.2.0"
+	if Equal(cpy, f) {
+		t.Fatal("Equal: versions differ")
+	}
+	for _, src := range []string{
+		"project .spx Game github.com/goplus/spx@v2\n",
+		"project .spx Game github.com/goplus/spx@latest\n",
+		"project .spx Game @v1.0.0\n",
+		"project .spx Game github.com/goplus/spx/v2@v1.0.0\n",
+		"project .spx Game github.com/goplus/spx/v2/pkg@v3.0.0\n",
+		"project .spx Game github.com/goplus/spx@v2.0.0\n",
+	} {
+		if _, err = Parse("/foo/gop.mod", []byte(src), nil); err == nil {
+			t.Fatal("Parse: no error?", src)
+		}
+	}
+}
+
+func TestSetGopVersion(t *testing.T) {
+	const gopmod = `gop 1.3
+
+project .gmx Game github.com/goplus/spx
+class .spx Sprite
+class -embed .spr SpriteImpl Game
+runner github.com/goplus/spx/cmd/spxrun v1.0.0
+`
+	f, err := Parse("/foo/gop.mod", []byte(gopmod), nil)
+	if err != nil {
+		t.Fatal("Parse:", err)
+	}
+	if _, err = f.SetGopVersion("1.x", false); err == nil {
+		t.Fatal("SetGopVersion 1.x: no error")
+	}
+	if warnings, err := f.SetGopVersion("1.2", true); err == nil || warnings != nil || f.Gop.Version != "1.3" {
+		t.Fatal("SetGopVersion 1.2 strict:", warnings, err)
+	} else if v := err.Error(); v != "/foo/gop.mod:5: -embed requires gop 1.3 or later, but gop version is 1.2\n"+
+		"/foo/gop.mod:5: class prototype requires gop 1.3 or later, but gop version is 1.2" {
+		t.Fatal("SetGopVersion 1.2 strict:", v)
+	}
+	warnings, err := f.SetGopVersion("1.1", false)
+	if err != nil || len(warnings) != 3 || warnings[0].Feature != "runner" || warnings[0].Pos.Line != 6 || f.Gop.Version != "1.1" {
+		t.Fatal("SetGopVersion 1.1:", warnings, err)
+	}
+	if warnings, err = f.SetGopVersion("1.4", true); err != nil || warnings != nil {
+		t.Fatal("SetGopVersion 1.4:", warnings, err)
+	}
+	if v := string(Format(f.Syntax)); !strings.HasPrefix(v, "gop 1.4\n") {
+		t.Fatal("Format:", v)
+	}
+
+	f = &File{Syntax: &FileSyntax{Name: "gop.mod"}}
+	if _, err = f.SetGopVersion("1.2", true); err != nil || f.Gop.Syntax == nil {
+		t.Fatal("SetGopVersion new:", err)
+	}
+	if v := string(Format(f.Syntax)); v != "gop 1.2\n" {
+		t.Fatal("Format new:", v)
+	}
+}
@@ -0,0 +1,260 @@
+/*
+ * Copyright (c) 2024 The GoPlus Authors (goplus.org). All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package modfile
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"golang.org/x/mod/module"
+	"golang.org/x/mod/semver"
+)
+
+// A Runner is the runner statement:
+//
+//	runner pkgPath constraint...
+//
+// eg.
+//
+//	runner github.com/goplus/spx/v2/cmd/spxrun v2.0.1
+//	runner github.com/goplus/spx/v2/cmd/spxrun >=v2.0.0 <v3
+//	runner github.com/goplus/spx/v2/cmd/spxrun ^v2.1.0
+type Runner struct {
+	Path       string      // package path of the runner
+	Version    string      // version constraint in source form, eg. ">=v2.0.0 <v3"
+	Constraint *Constraint // parsed form of Version
+	Syntax     *Line
+}
+
+// -----------------------------------------------------------------------------
+
+// A Comparison is a single version comparison, eg. ">=v2.0.0".
+type Comparison struct {
+	Op      string // one of "=", ">", ">=", "<", "<="
+	Version string // a semantic version, maybe incomplete (eg. "v3")
+}
+
+// Match checks if ver satisfies this comparison. An upper bound "<vX" doesn't
+// accept prereleases of vX, eg. "<v3" doesn't accept v3.0.0-rc1.
+func (c Comparison) Match(ver string) bool {
+	cmp := semver.Compare(ver, c.Version)
+	switch c.Op {
+	case "=":
+		return cmp == 0
+	case ">":
+		return cmp > 0
+	case ">=":
+		return cmp >= 0
+	case "<":
+		return cmp < 0 && !isPrereleaseOf(ver, c.Version)
+	case "<=":
+		return cmp <= 0
+	}
+	return false
+}
+
+// isPrereleaseOf checks if ver is a prerelease of the release version bound.
+func isPrereleaseOf(ver, bound string) bool {
+	pre := semver.Prerelease(ver)
+	return pre != "" && semver.Prerelease(bound) == "" &&
+		semver.Compare(strings.TrimSuffix(semver.Canonical(ver), pre), bound) == 0
+}
+
+func (c Comparison) String() string {
+	return c.Op + c.Version
+}
+
+// A Constraint is a version constraint which is satisfied when all of its
+// comparisons are satisfied.
+type Constraint struct {
+	Comparisons []Comparison
+}
+
+// ParseConstraint parses a version constraint. The following forms are
+// supported, and multiple forms separated by spaces are ANDed:
+//
+//	v1.2.3          exactly v1.2.3 (same as =v1.2.3)
+//	>v1.2.3 >=v1.2.3 <v2 <=v1.9
+//	^v1.2.3         >=v1.2.3 <v2.0.0 (<v0.3.0 for ^v0.2.3, <v0.0.4 for ^v0.0.3)
+//	~v1.2.3         >=v1.2.3 <v1.3.0
+//
+// An upper bound doesn't accept prereleases of the bound, eg. "<v3" doesn't
+// accept v3.0.0-rc1.
+func ParseConstraint(s string) (*Constraint, error) {
+	fields := strings.Fields(s)
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("empty version constraint")
+	}
+	ret := new(Constraint)
+	for _, f := range fields {
+		cmps, err := parseComparison(f)
+		if err != nil {
+			return nil, err
+		}
+		ret.Comparisons = append(ret.Comparisons, cmps...)
+	}
+	return ret, nil
+}
+
+func parseComparison(s string) (cmps []Comparison, err error) {
+	op, ver := "=", s
+	for _, prefix := range []string{">=", "<=", ">", "<", "=", "^", "~"} {
+		if strings.HasPrefix(s, prefix) {
+			op, ver = prefix, s[len(prefix):]
+			break
+		}
+	}
+	if !semver.IsValid(ver) {
+		return nil, fmt.Errorf("invalid version constraint %s: %s is not a semantic version", s, ver)
+	}
+	switch op {
+	case "^":
+		return []Comparison{{">=", ver}, {"<", nextVersion(ver, caretLevel(ver))}}, nil
+	case "~":
+		return []Comparison{{">=", ver}, {"<", nextVersion(ver, 1)}}, nil
+	}
+	return []Comparison{{op, ver}}, nil
+}
+
+// caretLevel returns which part (0 for major, 1 for minor and 2 for patch) of
+// ver a caret constraint can't change: the first non-zero part, or the last
+// specified part if all of them are zero, eg. 0 for v1.2.3, 1 for v0.2.3 and
+// v0.0, and 2 for v0.0.3.
+func caretLevel(ver string) int {
+	parts := versionParts(ver)
+	for i, part := range parts {
+		if part != "0" {
+			return i
+		}
+	}
+	return len(parts) - 1
+}
+
+// versionParts returns the specified numeric parts of ver, eg. ["1", "2"] for
+// v1.2 and ["1", "2", "3"] for v1.2.3-rc1.
+func versionParts(ver string) []string {
+	ver = strings.TrimSuffix(ver, semver.Build(ver))
+	ver = strings.TrimSuffix(ver, semver.Prerelease(ver))
+	return strings.Split(ver[1:], ".")
+}
+
+// nextVersion returns the release version following ver by incrementing its
+// major (level 0), minor (level 1) or patch (level 2) version, eg.
+// nextVersion("v1.2.3", 1) is v1.3.0.
+func nextVersion(ver string, level int) string {
+	parts := versionParts(semver.Canonical(ver))
+	n, _ := strconv.Atoi(parts[level])
+	parts[level] = strconv.Itoa(n + 1)
+	for i := level + 1; i < len(parts); i++ {
+		parts[i] = "0"
+	}
+	return "v" + strings.Join(parts, ".")
+}
+
+// Match checks if ver satisfies this constraint.
+func (p *Constraint) Match(ver string) bool {
+	if !semver.IsValid(ver) {
+		return false
+	}
+	for _, c := range p.Comparisons {
+		if !c.Match(ver) {
+			return false
+		}
+	}
+	return true
+}
+
+// Resolve returns the highest version in versions that satisfies this
+// constraint. Prerelease versions are chosen only if no release version
+// satisfies the constraint.
+func (p *Constraint) Resolve(versions []string) (ver string, ok bool) {
+	var pre string
+	for _, v := range versions {
+		if !p.Match(v) {
+			continue
+		}
+		if semver.Prerelease(v) != "" {
+			if pre == "" || semver.Compare(v, pre) > 0 {
+				pre = v
+			}
+		} else if ver == "" || semver.Compare(v, ver) > 0 {
+			ver = v
+		}
+	}
+	if ver == "" {
+		ver = pre
+	}
+	return ver, ver != ""
+}
+
+func (p *Constraint) String() string {
+	parts := make([]string, len(p.Comparisons))
+	for i, c := range p.Comparisons {
+		parts[i] = c.String()
+	}
+	return strings.Join(parts, " ")
+}
+
+// -----------------------------------------------------------------------------
+
+// checkRunnerMajor checks if versions of the runner constraint are compatible
+// with the major version suffix of the runner package path, eg.
+// `runner github.com/x/y/v2/cmd/run v1.0.0` is invalid.
+// An upper bound can be the next major version, eg. "<v3" for a v2 path.
+func checkRunnerMajor(pkgPath string, cons *Constraint) error {
+	pathMajor := pkgPathMajor(pkgPath)
+	for _, c := range cons.Comparisons {
+		if c.Op == "<" && semver.Canonical(c.Version) == nextMajor(pathMajor)+".0.0" {
+			continue
+		}
+		if err := module.CheckPathMajor(c.Version, pathMajor); err != nil {
+			return fmt.Errorf("runner %s: %v", pkgPath, err)
+		}
+	}
+	return nil
+}
+
+// pkgPathMajor returns the major version suffix (eg. "/v2", ".v1") of the
+// module which pkgPath belongs to, or "" if there isn't one.
+func pkgPathMajor(pkgPath string) string {
+	elems := strings.Split(pkgPath, "/")
+	if elems[0] == "gopkg.in" {
+		if len(elems) < 2 {
+			return ""
+		}
+		_, pathMajor, _ := module.SplitPathVersion(elems[0] + "/" + elems[1])
+		return pathMajor
+	}
+	for i := 1; i < len(elems); i++ {
+		if _, pathMajor, ok := module.SplitPathVersion(strings.Join(elems[:i+1], "/")); ok && pathMajor != "" {
+			return pathMajor
+		}
+	}
+	return ""
+}
+
+// nextMajor returns the major version following pathMajor, eg. "v3" for "/v2"
+// and "v2" for "" (v0 or v1).
+func nextMajor(pathMajor string) string {
+	if pathMajor == "" {
+		return "v2"
+	}
+	return semver.Major(nextVersion(pathMajor[1:], 0))
+}
+
+// -----------------------------------------------------------------------------
@@ -0,0 +1,145 @@
+/*
+ * Copyright (c) 2024 The GoPlus Authors (goplus.org). All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package modfile
+
+import (
+	"testing"
+)
+
+func TestConstraint(t *testing.T) {
+	versions := []string{"v1.0.0", "v1.2.0", "v1.2.5", "v1.3.0", "v2.0.0", "v2.1.0-rc1", "v2.1.0", "v3.0.0-pre"}
+	cases := []struct {
+		cons string
+		norm string
+		want string
+	}{
+		{"v1.2.0", "=v1.2.0", "v1.2.0"},
+		{">=v2.0.0 <v3", ">=v2.0.0 <v3", "v2.1.0"},
+		{"^v1.2.0", ">=v1.2.0 <v2.0.0", "v1.3.0"},
+		{"~v1.2.0", ">=v1.2.0 <v1.3.0", "v1.2.5"},
+		{"^v0.2.3", ">=v0.2.3 <v0.3.0", ""},
+		{">v2.1.0", ">v2.1.0", "v3.0.0-pre"},
+		{"<=v1.0.0", "<=v1.0.0", "v1.0.0"},
+		{"^v0.0.3", ">=v0.0.3 <v0.0.4", ""},
+		{"^v0.0", ">=v0.0 <v0.1.0", ""},
+		{"^v1", ">=v1 <v2.0.0", "v1.3.0"},
+		{"^v2.1.0-rc1", ">=v2.1.0-rc1 <v3.0.0", "v2.1.0"},
+		{"~v2.0.9", ">=v2.0.9 <v2.1.0", ""},
+		{">=v2.1.0 <v3", ">=v2.1.0 <v3", "v2.1.0"},
+		{">v2.1.0 <v3", ">v2.1.0 <v3", ""},
+		{">v2.1.0 <v3.0.0-pre", ">v2.1.0 <v3.0.0-pre", ""},
+		{">v2.1.0 <v3.0.0-rc1", ">v2.1.0 <v3.0.0-rc1", "v3.0.0-pre"},
+	}
+	for _, c := range cases {
+		cons, err := ParseConstraint(c.cons)
+		if err != nil {
+			t.Fatal("ParseConstraint:", c.cons, err)
+		}
+		if v := cons.String(); v != c.norm {
+			t.Fatalf("ParseConstraint(%s): %s\n", c.cons, v)
+		}
+		if ver, ok := cons.Resolve(versions); ver != c.want || ok != (c.want != "") {
+			t.Fatalf("Resolve(%s): %s %v\n", c.cons, ver, ok)
+		}
+	}
+	for _, c := range []struct {
+		cons string
+		ver  string
+		want bool
+	}{
+		{"<v3", "v3.0.0-rc1", false},
+		{"<v3", "v2.9.9-rc1", true},
+		{"<v3.0.0", "v3.0.0-rc1+build", false},
+		{"<=v3", "v3.0.0-rc1", true},
+		{"^v0.0.3", "v0.0.3", true},
+		{"^v0.0.3", "v0.0.4", false},
+		{"^v0.2.3", "v0.2.9", true},
+		{"^v0.2.3", "v0.3.0", false},
+		{"^v1.2.3", "v1.99.0", true},
+		{"^v1.2.3", "v2.0.0-rc1", false},
+	} {
+		cons, err := ParseConstraint(c.cons)
+		if err != nil {
+			t.Fatal("ParseConstraint:", c.cons, err)
+		}
+		if got := cons.Match(c.ver); got != c.want {
+			t.Fatalf("Match(%s, %s): %v\n", c.cons, c.ver, got)
+		}
+	}
+	for _, s := range []string{"", ">=1.0", "^latest"} {
+		if _, err := ParseConstraint(s); err == nil {
+			t.Fatal("ParseConstraint: no error?", s)
+		}
+	}
+}
+
+func TestParseRunner(t *testing.T) {
+	const gopmod = `
+gop 1.2
+
+project .gmx Game github.com/goplus/spx math
+runner github.com/goplus/spx/cmd/spxrun >=v1.0.0 <v2
+`
+	f, err := Parse("/foo/gop.mod", []byte(gopmod), nil)
+	if err != nil {
+		t.Fatal("Parse:", err)
+	}
+	r := f.proj().Runner
+	if r == nil || r.Path != "github.com/goplus/spx/cmd/spxrun" || r.Version != ">=v1.0.0 <v2" {
+		t.Fatal("Parse runner:", r)
+	}
+	if !r.Constraint.Match("v1.5.0") || r.Constraint.Match("v2.0.0") {
+		t.Fatal("runner.Constraint.Match")
+	}
+
+	errs := []string{
+		"gop 1.2\nrunner github.com/goplus/spx/cmd/spxrun v1.0.0\n",
+		"gop 1.2\nproject .gmx Game github.com/goplus/spx\nrunner github.com/goplus/spx/cmd/spxrun\n",
+		"gop 1.2\nproject .gmx Game github.com/goplus/spx\nrunner github.com/goplus/spx/cmd/spxrun v1\nrunner github.com/goplus/spx/cmd/spxrun v1\n",
+		"gop 1.2\nproject .gmx Game github.com/goplus/spx\nrunner .spxrun v1\n",
+		"gop 1.2\nproject .gmx Game github.com/goplus/spx\nrunner github.com/goplus/spx/cmd/spxrun 1.0\n",
+		"gop 1.2\nproject .gmx Game github.com/goplus/spx\nrunner github.com/goplus/spx/v2/cmd/spxrun v1.0.0\n",
+		"gop 1.2\nproject .gmx Game github.com/goplus/spx\nrunner github.com/goplus/spx/cmd/spxrun ^v2.0.0\n",
+		"gop 1.2\nproject .gmx Game github.com/goplus/spx\nrunner github.com/goplus/spx/v2/cmd/spxrun >=v2.0.0 <v4\n",
+		"gop 1.2\nproject .gmx Game github.com/goplus/spx\nrunner gopkg.in/spx.v1/cmd/spxrun v2.0.0\n",
+	}
+	for _, text := range errs {
+		if _, err := Parse("/foo/gop.mod", []byte(text), nil); err == nil {
+			t.Fatal("Parse: no error?", text)
+		}
+	}
+}
+
+func TestRunnerMajor(t *testing.T) {
+	for _, text := range []string{
+		"runner github.com/goplus/spx/v2/cmd/spxrun ^v2.1.0",
+		"runner github.com/goplus/spx/v2/cmd/spxrun >=v2.0.0 <v3",
+		"runner github.com/goplus/spx/cmd/spxrun ^v1.2.0",
+		"runner github.com/goplus/spx/cmd/spxrun ^v0.2.0",
+		"runner github.com/goplus/spx/cmd/spxrun v2.0.0+incompatible",
+		"runner gopkg.in/spx.v2/cmd/spxrun ~v2.1.0",
+	} {
+		gopmod := "gop 1.2\nproject .gmx Game github.com/goplus/spx\n" + text + "\n"
+		if _, err := Parse("/foo/gop.mod", []byte(gopmod), nil); err != nil {
+			t.Fatal("Parse:", text, err)
+		}
+	}
+	doTestParseErr(t, `gop.mod:3: runner github.com/goplus/spx/v2/cmd/spxrun: version "v1.0.0" invalid: should be v2, not v1`, `gop 1.2
+project .gmx Game github.com/goplus/spx
+runner github.com/goplus/spx/v2/cmd/spxrun v1.0.0
+`)
+}
@@ -0,0 +1,179 @@
+/*
+ * Copyright (c) 2021 The GoPlus Authors (goplus.org). All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package modfile
+
+import (
+	"strings"
+
+	"github.com/qiniu/x/errors"
+	"golang.org/x/mod/modfile"
+)
+
+// -----------------------------------------------------------------------------
+
+// ClassMarker is the suffix comment marking a require statement of go.mod as a
+// classfile module.
+const ClassMarker = "gop:class"
+
+// StripGop returns a vanilla view of a go.mod file: gop.mod directives (see
+// Directives), extension directives and `//gop:class` markers are removed, so
+// that the result can be handed to tools that choke on unknown directives.
+// Use MergeGop to bring the removed content back.
+func StripGop(data []byte) ([]byte, error) {
+	f, err := modfile.ParseLax("go.mod", data, nil)
+	if err != nil {
+		return nil, errors.NewWith(err, `modfile.ParseLax("go.mod", data, nil)`, -2, "modfile.ParseLax", "go.mod", data, nil)
+	}
+	stmts := f.Syntax.Stmt[:0]
+	for _, x := range f.Syntax.Stmt {
+		if isGopStmt(x) {
+			continue
+		}
+		eachRequire(x, func(path string, line *Line) {
+			line.Suffix = stripClassMarker(line.Suffix)
+		})
+		stmts = append(stmts, x)
+	}
+	f.Syntax.Stmt = stmts
+	return Format(f.Syntax), nil
+}
+
+// MergeGop is the reverse of StripGop: it returns the vanilla go.mod content
+// goData (maybe modified by other tools) with the Go+ specific content of
+// the original go.mod file orig merged back. Removed directives are appended
+// in their original order, and `//gop:class` markers are restored for
+// modules still required.
+func MergeGop(goData, orig []byte) ([]byte, error) {
+	f, err := modfile.ParseLax("go.mod", goData, nil)
+	if err != nil {
+		return nil, errors.NewWith(err, `modfile.ParseLax("go.mod", goData, nil)`, -2, "modfile.ParseLax", "go.mod", goData, nil)
+	}
+	o, err := modfile.ParseLax("go.mod", orig, nil)
+	if err != nil {
+		return nil, errors.NewWith(err, `modfile.ParseLax("go.mod", orig, nil)`, -2, "modfile.ParseLax", "go.mod", orig, nil)
+	}
+	classMods := make(map[string]bool)
+	for _, x := range o.Syntax.Stmt {
+		if isGopStmt(x) {
+			f.Syntax.Stmt = append(f.Syntax.Stmt, x)
+			continue
+		}
+		eachRequire(x, func(path string, line *Line) {
+			if hasClassMarker(line.Suffix) {
+				classMods[path] = true
+			}
+		})
+	}
+	for _, x := range f.Syntax.Stmt {
+		eachRequire(x, func(path string, line *Line) {
+			if classMods[path] && !hasClassMarker(line.Suffix) {
+				line.Suffix = addClassMarker(line.Suffix)
+			}
+		})
+	}
+	return Format(f.Syntax), nil
+}
+
+func isGopStmt(x Expr) bool {
+	var verb string
+	switch x := x.(type) {
+	case *Line:
+		verb = x.Token[0]
+	case *LineBlock:
+		verb = x.Token[0]
+	default:
+		return false
+	}
+	_, ok := LookupDirective(verb)
+	return ok || IsExtension(verb)
+}
+
+// eachRequire calls fn for each require statement of x with the module path.
+func eachRequire(x Expr, fn func(path string, line *Line)) {
+	switch x := x.(type) {
+	case *Line:
+		if x.Token[0] == "require" && len(x.Token) > 1 {
+			fn(x.Token[1], x)
+		}
+	case *LineBlock:
+		if x.Token[0] == "require" {
+			for _, line := range x.Line {
+				if len(line.Token) > 0 {
+					fn(line.Token[0], line)
+				}
+			}
+		}
+	}
+}
+
+// splitSuffix splits suffix comments into parts, eg. "// indirect; gop:class"
+// is split into "indirect" and "gop:class".
+func splitSuffix(suffix []Comment) (parts []string) {
+	for _, c := range suffix {
+		for _, part := range strings.Split(strings.TrimPrefix(c.Token, "//"), ";") {
+			if part = strings.TrimSpace(part); part != "" {
+				parts = append(parts, part)
+			}
+		}
+	}
+	return
+}
+
+func joinSuffix(parts []string) []Comment {
+	switch {
+	case parts == nil:
+		return nil
+	case len(parts) == 1 && parts[0] == ClassMarker:
+		return []Comment{{Token: "//" + ClassMarker, Suffix: true}}
+	}
+	return []Comment{{Token: "// " + strings.Join(parts, "; "), Suffix: true}}
+}
+
+// isClassMarker reports whether part of a suffix comment is ClassMarker,
+// optionally followed by arguments (eg. "gop:class foo"), but not another
+// word starting with it (eg. "gop:classfoo").
+func isClassMarker(part string) bool {
+	return part == ClassMarker || strings.HasPrefix(part, ClassMarker+" ")
+}
+
+func hasClassMarker(suffix []Comment) bool {
+	for _, part := range splitSuffix(suffix) {
+		if isClassMarker(part) {
+			return true
+		}
+	}
+	return false
+}
+
+func stripClassMarker(suffix []Comment) []Comment {
+	if !hasClassMarker(suffix) {
+		return suffix
+	}
+	var parts []string
+	for _, part := range splitSuffix(suffix) {
+		if !isClassMarker(part) {
+			parts = append(parts, part)
+		}
+	}
+	return joinSuffix(parts)
+}
+
+func addClassMarker(suffix []Comment) []Comment {
+	return joinSuffix(append(splitSuffix(suffix), ClassMarker))
+}
+
+// -----------------------------------------------------------------------------
@@ -0,0 +1,155 @@
+/*
+ * Copyright (c) 2021 The GoPlus Authors (goplus.org). All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package modfile
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/qiniu/x/errors"
+)
+
+// -----------------------------------------------------------------------------
+
+var errInvalidSymbol = errors.New("invalid Go export symbol format")
+
+// A Symbol is the parsed form of a class symbol, eg. "*pkg.Sprite[T]".
+type Symbol struct {
+	IsPtr        bool      // has a leading "*"
+	PkgQualifier string    // package name, maybe empty
+	Name         string    // type name, eg. "Sprite"
+	TypeArgs     []*Symbol // type arguments of a generic type (maybe nil)
+}
+
+// ParseSymbol parses a class symbol. The grammar is:
+//
+//	Symbol   = [ "*" ] [ PkgName "." ] Name [ TypeArgs ] .
+//	TypeArgs = "[" TypeArg { "," TypeArg } "]" .
+//	TypeArg  = [ "*" ] [ PkgName "." ] identifier [ TypeArgs ] .
+//
+// where Name is an exported identifier, eg. "Sprite", "*Sprite",
+// "pkg.Sprite", "Sprite[T]" and "*pkg.Sprite[int, *pkg.Game]".
+func ParseSymbol(s string) (sym *Symbol, err error) {
+	p := &symbolParser{s: s}
+	if sym = p.symbol(true); sym == nil || p.pos != len(s) {
+		return nil, errInvalidSymbol
+	}
+	return
+}
+
+// String returns the source form of this symbol.
+func (p *Symbol) String() string {
+	var b strings.Builder
+	p.writeTo(&b)
+	return b.String()
+}
+
+func (p *Symbol) writeTo(b *strings.Builder) {
+	if p.IsPtr {
+		b.WriteByte('*')
+	}
+	if p.PkgQualifier != "" {
+		b.WriteString(p.PkgQualifier)
+		b.WriteByte('.')
+	}
+	b.WriteString(p.Name)
+	if p.TypeArgs != nil {
+		b.WriteByte('[')
+		for i, arg := range p.TypeArgs {
+			if i > 0 {
+				b.WriteString(", ")
+			}
+			arg.writeTo(b)
+		}
+		b.WriteByte(']')
+	}
+}
+
+type symbolParser struct {
+	s   string
+	pos int
+}
+
+func (p *symbolParser) symbol(exported bool) *Symbol {
+	sym := new(Symbol)
+	if p.skip('*') {
+		sym.IsPtr = true
+	}
+	name := p.ident()
+	if name == "" {
+		return nil
+	}
+	if p.skip('.') {
+		sym.PkgQualifier = name
+		if name = p.ident(); name == "" {
+			return nil
+		}
+	}
+	if exported {
+		if r, _ := utf8.DecodeRuneInString(name); !unicode.IsUpper(r) {
+			return nil
+		}
+	}
+	sym.Name = name
+	if p.skip('[') {
+		for {
+			p.skipSpaces()
+			arg := p.symbol(false)
+			if arg == nil {
+				return nil
+			}
+			sym.TypeArgs = append(sym.TypeArgs, arg)
+			p.skipSpaces()
+			if p.skip(']') {
+				break
+			}
+			if !p.skip(',') {
+				return nil
+			}
+		}
+	}
+	return sym
+}
+
+func (p *symbolParser) ident() string {
+	start := p.pos
+	for p.pos < len(p.s) {
+		r, n := utf8.DecodeRuneInString(p.s[p.pos:])
+		if !(unicode.IsLetter(r) || r == '_' || (p.pos > start && unicode.IsDigit(r))) {
+			break
+		}
+		p.pos += n
+	}
+	return p.s[start:p.pos]
+}
+
+func (p *symbolParser) skip(c byte) bool {
+	if p.pos < len(p.s) && p.s[p.pos] == c {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *symbolParser) skipSpaces() {
+	for p.pos < len(p.s) && p.s[p.pos] == ' ' {
+		p.pos++
+	}
+}
+
+// -----------------------------------------------------------------------------
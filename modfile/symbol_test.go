@@ -0,0 +1,63 @@
+/*
+ * Copyright (c) 2021 The GoPlus Authors (goplus.org). All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package modfile
+
+import (
+	"testing"
+)
+
+func TestParseSymbol(t *testing.T) {
+	for _, s := range []string{
+		"Sprite", "*Sprite", "pkg.Sprite", "*pkg.Sprite", "Sprite[T]",
+		"*pkg.Sprite[int, *pkg.Game]", "Map[string, List[*T]]", "Σprite",
+	} {
+		sym, err := ParseSymbol(s)
+		if err != nil {
+			t.Fatal("ParseSymbol:", s, err)
+		}
+		if v := sym.String(); v != s {
+			t.Fatal("Symbol.String:", s, v)
+		}
+	}
+	sym, err := ParseSymbol("*spx.Sprite[T,int]")
+	if err != nil || !sym.IsPtr || sym.PkgQualifier != "spx" || sym.Name != "Sprite" || len(sym.TypeArgs) != 2 ||
+		sym.TypeArgs[0].Name != "T" || sym.TypeArgs[1].Name != "int" {
+		t.Fatal("ParseSymbol:", sym, err)
+	}
+	for _, s := range []string{
+		"", "sprite", "pkg.sprite", "*", "**Sprite", "Sprite[", "Sprite[]", "Sprite[T", "Sprite[T,]",
+		"pkg.", ".Sprite", "a.b.Sprite", "Sprite]", "1Sprite", "Sprite-2",
+	} {
+		if _, err := ParseSymbol(s); err == nil {
+			t.Fatal("ParseSymbol: no error?", s)
+		}
+	}
+}
+
+func TestParseGenericClass(t *testing.T) {
+	f, err := Parse("gop.mod", []byte(`gop 1.2
+project .gmx spx.Game github.com/goplus/spx
+class .spx "*Sprite[Game]" spx.Game
+`), nil)
+	if err != nil {
+		t.Fatal("Parse:", err)
+	}
+	proj := f.Projects[0]
+	if proj.Class != "spx.Game" || proj.Works[0].Class != "*Sprite[Game]" || proj.Works[0].Project != "spx.Game" {
+		t.Fatal("Parse:", proj.Class, proj.Works[0])
+	}
+}
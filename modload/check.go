@@ -0,0 +1,288 @@
+/*
+ * Copyright (c) 2024 The GoPlus Authors (goplus.org). All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package modload
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/goplus/mod"
+	"github.com/goplus/mod/modcache"
+	"github.com/goplus/mod/modfile"
+	"golang.org/x/mod/module"
+	"golang.org/x/mod/semver"
+
+	gomodfile "golang.org/x/mod/modfile"
+)
+
+// -----------------------------------------------------------------------------
+
+// A FindingKind is the kind of a consistency issue found by CheckConsistency.
+type FindingKind int
+
+const (
+	// FindingGoVersion: the go directive of go.mod is lower than the minimum
+	// Go version supported by the gop version of gop.mod.
+	FindingGoVersion FindingKind = iota + 1
+
+	// FindingClassMarker: a classfile module is required without the
+	// `//gop:class` marker.
+	FindingClassMarker
+
+	// FindingMissingRequire: a project of gop.mod references a package of a
+	// module that isn't required by go.mod.
+	FindingMissingRequire
+
+	// FindingSelfRequire: go.mod requires the module itself.
+	FindingSelfRequire
+
+	// FindingReplaceSelf: go.mod replaces the module itself, or replaces a
+	// module with the module itself (its path or its root directory).
+	FindingReplaceSelf
+
+	// FindingReplaceCycle: module replacements of go.mod form a cycle, eg.
+	// `replace a => b` and `replace b => a`.
+	FindingReplaceCycle
+
+	// FindingReplaceNotFound: a module is replaced with a local directory
+	// which doesn't exist or doesn't contain a go.mod file.
+	FindingReplaceNotFound
+)
+
+// A Finding is a consistency issue between go.mod and gop.mod.
+type Finding struct {
+	Kind FindingKind
+	File string // go.mod or gop.mod file the issue is reported on
+	Pos  modfile.Position
+	Mod  string // module or package path concerned, if any
+	Msg  string
+}
+
+func (p *Finding) String() string {
+	if p.File == "" {
+		return p.Msg
+	}
+	return fmt.Sprintf("%s:%d: %s", p.File, p.Pos.Line, p.Msg)
+}
+
+// minGoVersions is the minimum Go version supported by each gop version
+// (major.minor), that is, the go directive of go.mod of module
+// github.com/goplus/gop at the first release of the minor version (eg. the
+// go.mod of tag v1.2.0 declares `go 1.18`).
+var minGoVersions = map[string]string{
+	"1.0": "1.16",
+	"1.1": "1.18",
+	"1.2": "1.18",
+	"1.3": "1.19",
+}
+
+// minGoVersion returns the minimum Go version supported by gop version gopVer,
+// eg. "1.2", "1.2.0" or "v1.2.1".
+func minGoVersion(gopVer string) (min string, ok bool) {
+	if !strings.HasPrefix(gopVer, "v") {
+		gopVer = "v" + gopVer
+	}
+	mm := semver.MajorMinor(gopVer)
+	if mm == "" {
+		return
+	}
+	min, ok = minGoVersions[mm[1:]]
+	return
+}
+
+// CheckConsistency checks consistency between go.mod and gop.mod of this
+// module, and returns all issues found (nil if none). Classfile modules are
+// only recognized if they are in GOMODCACHE: nothing is downloaded.
+func (p Module) CheckConsistency() (findings []*Finding) {
+	if p.File == nil {
+		return
+	}
+	add := func(kind FindingKind, file string, line *modfile.Line, mod, format string, args ...interface{}) {
+		f := &Finding{Kind: kind, File: file, Mod: mod, Msg: fmt.Sprintf(format, args...)}
+		if line != nil {
+			f.Pos = line.Start
+		}
+		findings = append(findings, f)
+	}
+	gomod := p.Modfile()
+	opt := p.Opt
+	if opt != nil && opt.Gop != nil {
+		if min, ok := minGoVersion(opt.Gop.Version); ok {
+			if goVer := p.GoVersion(); compareGoVersion(goVer, min) < 0 {
+				var line *modfile.Line
+				if p.Go != nil {
+					line = p.Go.Syntax
+				}
+				add(FindingGoVersion, gomod, line, "",
+					"go %s is lower than go %s required by gop %s", goVer, min, opt.Gop.Version)
+			}
+		}
+	}
+	for _, r := range p.Require {
+		if !isClass(r) && (opt == nil || lookupClassfile(opt, r.Mod.Path) == nil) && isClassMod(r.Mod) {
+			add(FindingClassMarker, gomod, r.Syntax, r.Mod.Path,
+				"classfile module %s is required without //gop:class", r.Mod.Path)
+		}
+	}
+	if opt == nil {
+		return
+	}
+	gopmod := ""
+	if opt.Syntax != nil {
+		gopmod = opt.Syntax.Name
+	}
+	check := func(pkgPath string, line *modfile.Line) {
+		if !p.providesPkg(pkgPath) {
+			add(FindingMissingRequire, gopmod, line, pkgPath,
+				"no required module provides package %s", pkgPath)
+		}
+	}
+	for _, proj := range opt.Projects {
+		for _, pkgPath := range proj.PkgPaths {
+			check(pkgPath, proj.Syntax)
+		}
+		for _, imp := range proj.Import {
+			check(imp.Path, imp.Syntax)
+		}
+	}
+	return
+}
+
+// Validate checks require and replace statements of go.mod for mistakes the go
+// command only reports later as confusing lookup failures: requiring the
+// module itself, replacing the module itself (or replacing a module with it),
+// replacements forming a cycle and replacements with missing local
+// directories. It returns all issues found (nil if none).
+func (p Module) Validate() (findings []*Finding) {
+	if p.File == nil {
+		return
+	}
+	gomod, self, root := p.Modfile(), p.Path(), p.Root()
+	add := func(kind FindingKind, line *modfile.Line, mod, format string, args ...interface{}) {
+		f := &Finding{Kind: kind, File: gomod, Mod: mod, Msg: fmt.Sprintf(format, args...)}
+		if line != nil {
+			f.Pos = line.Start
+		}
+		findings = append(findings, f)
+	}
+	for _, r := range p.Require {
+		if self != "" && r.Mod.Path == self {
+			add(FindingSelfRequire, r.Syntax, self, "module %s requires itself", self)
+		}
+	}
+	next := make(map[string]*gomodfile.Replace) // module replacements: old path => replace
+	for _, r := range p.Replace {
+		switch {
+		case self != "" && r.Old.Path == self:
+			add(FindingReplaceSelf, r.Syntax, self, "module %s replaces itself", self)
+			continue
+		case r.New.Version != "": // replaced with a module
+			if self != "" && r.New.Path == self {
+				add(FindingReplaceSelf, r.Syntax, r.Old.Path, "%s is replaced with module %s itself", r.Old.Path, self)
+			} else if r.New.Path != r.Old.Path {
+				next[r.Old.Path] = r
+			}
+			continue
+		}
+		if root == "" {
+			continue
+		}
+		dir := canonicalDir(root, r.New.Path)
+		if dir == root {
+			add(FindingReplaceSelf, r.Syntax, r.Old.Path, "%s is replaced with module %s itself", r.Old.Path, self)
+		} else if _, err := p.overlay.ReadFile(filepath.Join(dir, "go.mod")); err != nil {
+			add(FindingReplaceNotFound, r.Syntax, r.Old.Path, "replacement directory %s of %s doesn't contain a go.mod file", r.New.Path, r.Old.Path)
+		}
+	}
+	reported := make(map[string]bool)
+	for _, r := range p.Replace {
+		if next[r.Old.Path] != r || reported[r.Old.Path] {
+			continue
+		}
+		var chain []string
+		seen := make(map[string]int) // path => index in chain
+		for path := r.Old.Path; ; {
+			if i, ok := seen[path]; ok {
+				if i == 0 { // r starts a cycle, which is reported only once
+					add(FindingReplaceCycle, r.Syntax, r.Old.Path, "replacements form a cycle: %s => %s", strings.Join(chain, " => "), path)
+					for _, v := range chain {
+						reported[v] = true
+					}
+				}
+				break
+			}
+			nr, ok := next[path]
+			if !ok {
+				break
+			}
+			seen[path] = len(chain)
+			chain = append(chain, path)
+			path = nr.New.Path
+		}
+	}
+	return
+}
+
+// providesPkg checks if pkgPath is a standard package, a package of this
+// module, or a package of a required (or replaced) module.
+func (p Module) providesPkg(pkgPath string) bool {
+	elem := pkgPath
+	if pos := strings.IndexByte(elem, '/'); pos > 0 {
+		elem = elem[:pos]
+	}
+	if !strings.Contains(elem, ".") { // standard package
+		return true
+	}
+	if isPkgOf(pkgPath, p.Path()) {
+		return true
+	}
+	for _, r := range p.Require {
+		if isPkgOf(pkgPath, r.Mod.Path) {
+			return true
+		}
+	}
+	for _, r := range p.Replace {
+		if isPkgOf(pkgPath, r.Old.Path) {
+			return true
+		}
+	}
+	if opt := p.Opt; opt != nil {
+		for _, c := range opt.Classfiles {
+			if isPkgOf(pkgPath, c.Mod.Path) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func isPkgOf(pkgPath, modPath string) bool {
+	return modPath != "" && (pkgPath == modPath || strings.HasPrefix(pkgPath, modPath+"/"))
+}
+
+// isClassMod checks if v is a classfile module. It only consults GOMODCACHE.
+func isClassMod(v module.Version) bool {
+	dir, err := modcache.Path(v)
+	if err != nil {
+		return false
+	}
+	m, err := LoadFromStrict(filepath.Join(dir, "go.mod"), filepath.Join(dir, mod.GoxModfile), modcache.ReadFile)
+	return err == nil && m.HasProject()
+}
+
+// -----------------------------------------------------------------------------
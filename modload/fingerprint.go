@@ -0,0 +1,81 @@
+/*
+ * Copyright (c) 2024 The GoPlus Authors (goplus.org). All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package modload
+
+import (
+	"bytes"
+	"io"
+	"path/filepath"
+
+	"golang.org/x/mod/sumdb/dirhash"
+)
+
+// -----------------------------------------------------------------------------
+
+// Fingerprint returns a hash (in the "h1:" form of go.sum) of the contents of
+// go.mod, gop.mod (or gox.mod), go.sum and go.work (if used, see Workspace) of
+// this module, as they were when the module was loaded. It is a stable key of
+// the module state for caches derived from the module, eg. type information
+// of packages. Files that don't exist are skipped. It returns "" if the module
+// isn't loaded from files (eg. created by Create or NewDefault).
+func (p Module) Fingerprint() string {
+	return p.fingerprint
+}
+
+// recordReads returns a readFile function which records contents of files
+// successfully read by readFile in files.
+func recordReads(readFile func(string) ([]byte, error), files map[string][]byte) func(string) ([]byte, error) {
+	return func(name string) ([]byte, error) {
+		data, err := readFile(name)
+		if err == nil {
+			files[name] = data
+		}
+		return data, err
+	}
+}
+
+// fingerprintOf computes Fingerprint of a module just loaded. files are
+// contents of go.mod and gop.mod read by the loader, and go.sum and go.work
+// are read by readFile.
+func (p Module) fingerprintOf(files map[string][]byte, readFile func(string) ([]byte, error)) string {
+	contents := map[string][]byte{"go.mod": files[p.Modfile()]}
+	if p.hasGopMod && !p.embedded {
+		gopmod := p.Opt.Syntax.Name
+		contents[filepath.Base(gopmod)] = files[gopmod]
+	}
+	if data, err := readFile(p.sumFile()); err == nil {
+		contents["go.sum"] = data
+	}
+	if ws := p.Workspace(); ws.File != "" && ws.Err == nil {
+		if data, err := readFile(ws.File); err == nil {
+			contents["go.work"] = data
+		}
+	}
+	names := make([]string, 0, len(contents))
+	for name := range contents {
+		names = append(names, name)
+	}
+	h, err := dirhash.Hash1(names, func(name string) (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(contents[name])), nil
+	})
+	if err != nil {
+		return ""
+	}
+	return h
+}
+
+// -----------------------------------------------------------------------------
@@ -0,0 +1,142 @@
+/*
+ * Copyright (c) 2024 The GoPlus Authors (goplus.org). All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package modload
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/goplus/mod/modcache"
+	"golang.org/x/mod/module"
+	"golang.org/x/mod/semver"
+
+	gomodfile "golang.org/x/mod/modfile"
+)
+
+// -----------------------------------------------------------------------------
+
+// GoVersion returns the effective Go language version of this module:
+//   - the version of the go directive, if any;
+//   - otherwise, the version of the toolchain directive (eg. "1.21.0" for
+//     "toolchain go1.21.0"), if any;
+//   - otherwise, the default Go version.
+func (p Module) GoVersion() string {
+	if f := p.File; f != nil {
+		if f.Go != nil && f.Go.Version != "" {
+			return f.Go.Version
+		}
+		if tc := f.Toolchain; tc != nil && strings.HasPrefix(tc.Name, "go") {
+			ver := tc.Name[2:]
+			if pos := strings.IndexByte(ver, '-'); pos > 0 { // go1.21.0-custom
+				ver = ver[:pos]
+			}
+			if gomodfile.GoVersionRE.MatchString(ver) {
+				return ver
+			}
+		}
+	}
+	return defaultGoVer
+}
+
+// A GoVersionTooLowError is returned by SetGoVersion if a required module
+// needs a newer Go version.
+type GoVersionTooLowError struct {
+	Version  string         // the Go version to set
+	Required string         // the Go version required by Mod
+	Mod      module.Version // the required module
+}
+
+func (e *GoVersionTooLowError) Error() string {
+	return fmt.Sprintf("go %s is lower than go %s required by %v", e.Version, e.Required, e.Mod)
+}
+
+// SetGoVersion sets the go directive of this module. It fails if a required
+// module (whose go.mod is found in GOMODCACHE) needs a newer Go version.
+func (p Module) SetGoVersion(ver string) error {
+	if !gomodfile.GoVersionRE.MatchString(ver) {
+		return fmt.Errorf("invalid go version '%s': must match format 1.23", ver)
+	}
+	for _, r := range p.File.Require {
+		if req, ok := depGoVersion(r.Mod); ok && compareGoVersion(req, ver) > 0 {
+			return &GoVersionTooLowError{Version: ver, Required: req, Mod: r.Mod}
+		}
+	}
+	return p.File.AddGoStmt(ver)
+}
+
+// SyncGoVersion bumps the go directive of this module to the highest Go
+// version required by required modules (whose go.mod is found in GOMODCACHE),
+// like the go command does. It returns the modules requiring a newer Go
+// version than the current one, or nil if the go directive isn't changed.
+func (p Module) SyncGoVersion() (by []module.Version, err error) {
+	cur := p.GoVersion()
+	ver := cur
+	for _, r := range p.File.Require {
+		if req, ok := depGoVersion(r.Mod); ok && compareGoVersion(req, cur) > 0 {
+			if compareGoVersion(req, ver) > 0 {
+				ver = req
+			}
+			by = append(by, r.Mod)
+		}
+	}
+	if by == nil {
+		return
+	}
+	if err = p.File.AddGoStmt(ver); err != nil {
+		return nil, err
+	}
+	return
+}
+
+// depGoVersion returns the go directive of a depended module. It only
+// consults GOMODCACHE and never downloads anything.
+func depGoVersion(mod module.Version) (ver string, ok bool) {
+	zipFile, err := modcache.DownloadCachePath(mod)
+	if err != nil {
+		return
+	}
+	modFile := strings.TrimSuffix(zipFile, ".zip") + ".mod"
+	data, err := modcache.ReadFile(modFile)
+	if err != nil {
+		return
+	}
+	f, err := gomodfile.ParseLax(modFile, data, nil)
+	if err != nil || f.Go == nil {
+		return
+	}
+	return f.Go.Version, true
+}
+
+// compareGoVersion compares two Go versions, eg. "1.21", "1.21.0", "1.21rc1".
+func compareGoVersion(a, b string) int {
+	return semver.Compare(goSemver(a), goSemver(b))
+}
+
+func goSemver(v string) string {
+	for _, pre := range []string{"rc", "beta"} {
+		if pos := strings.Index(v, pre); pos > 0 {
+			base := v[:pos]
+			if strings.Count(base, ".") == 1 {
+				base += ".0"
+			}
+			return "v" + base + "-" + v[pos:]
+		}
+	}
+	return "v" + v
+}
+
+// -----------------------------------------------------------------------------
@@ -0,0 +1,128 @@
+/*
+ * Copyright (c) 2024 The GoPlus Authors (goplus.org). All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package modload
+
+import (
+	"os"
+	"sync"
+)
+
+// -----------------------------------------------------------------------------
+
+// A SaveHook is called with the serialized content of go.mod, gop.mod or
+// go.work before it's written to file path. It returns the content to write
+// actually (eg. reformatted, or with a license header added), or an error to
+// abort saving (eg. a banned module is required).
+type SaveHook func(path string, data []byte) ([]byte, error)
+
+// A PostSaveHook is called with the content written to file path (go.mod,
+// gop.mod or go.work) after it's written, eg. to run a linter or notify a
+// file watcher. An error returned by it is returned by the saving method, but
+// the file is kept as written.
+type PostSaveHook func(path string, data []byte) error
+
+// A saveHook is a registered SaveHook or PostSaveHook.
+type saveHook struct {
+	pre  SaveHook
+	post PostSaveHook
+}
+
+var (
+	saveHooksMu sync.RWMutex
+	saveHooks   []*saveHook
+)
+
+// RegisterSaveHook registers a hook which is run by Save, SaveTo and other
+// methods writing go.mod, gop.mod or go.work. Hooks are run in the order they
+// are registered, each one is fed the content returned by the previous one.
+// Calling the returned unregister function removes the hook.
+func RegisterSaveHook(hook SaveHook) (unregister func()) {
+	return registerSaveHook(&saveHook{pre: hook})
+}
+
+// RegisterPostSaveHook registers a hook which is run after Save, SaveTo and
+// other methods write go.mod, gop.mod or go.work. Hooks are run in the order
+// they are registered. Calling the returned unregister function removes the
+// hook.
+func RegisterPostSaveHook(hook PostSaveHook) (unregister func()) {
+	return registerSaveHook(&saveHook{post: hook})
+}
+
+func registerSaveHook(h *saveHook) func() {
+	saveHooksMu.Lock()
+	defer saveHooksMu.Unlock()
+	saveHooks = append(saveHooks, h)
+	return func() {
+		saveHooksMu.Lock()
+		defer saveHooksMu.Unlock()
+		hooks := make([]*saveHook, 0, len(saveHooks)) // saveHooks may be in use
+		for _, v := range saveHooks {
+			if v != h {
+				hooks = append(hooks, v)
+			}
+		}
+		saveHooks = hooks
+	}
+}
+
+// runSaveHooks runs all registered save hooks on data to be written to path.
+func runSaveHooks(path string, data []byte) ([]byte, error) {
+	saveHooksMu.RLock()
+	hooks := saveHooks
+	saveHooksMu.RUnlock()
+	for _, hook := range hooks {
+		if hook.pre == nil {
+			continue
+		}
+		var err error
+		if data, err = hook.pre(path, data); err != nil {
+			return nil, err
+		}
+	}
+	return data, nil
+}
+
+// runPostSaveHooks runs all registered post-save hooks on data written to path.
+func runPostSaveHooks(path string, data []byte) error {
+	saveHooksMu.RLock()
+	hooks := saveHooks
+	saveHooksMu.RUnlock()
+	for _, hook := range hooks {
+		if hook.post == nil {
+			continue
+		}
+		if err := hook.post(path, data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeFile runs save hooks on data, writes the result to path and then runs
+// post-save hooks.
+func writeFile(path string, data []byte, perm os.FileMode) error {
+	data, err := runSaveHooks(path, data)
+	if err != nil {
+		return err
+	}
+	if err = os.WriteFile(path, data, perm); err != nil {
+		return err
+	}
+	return runPostSaveHooks(path, data)
+}
+
+// -----------------------------------------------------------------------------
@@ -0,0 +1,230 @@
+/*
+ * Copyright (c) 2024 The GoPlus Authors (goplus.org). All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package modload
+
+import (
+	"encoding/json"
+
+	"github.com/goplus/mod/modfile"
+	"golang.org/x/mod/module"
+)
+
+// -----------------------------------------------------------------------------
+
+// A ModuleJSON is the machine-readable form of a module (go.mod and gop.mod),
+// eg. for `gop mod edit -json`. Its schema is stable: fields may be added but
+// won't be removed or renamed.
+type ModuleJSON struct {
+	Module    string
+	Go        string           `json:",omitempty"`
+	Toolchain string           `json:",omitempty"`
+	Gop       string           `json:",omitempty"`
+	Compiler  *CompilerJSON    `json:",omitempty"`
+	Require   []RequireJSON    `json:",omitempty"`
+	Exclude   []module.Version `json:",omitempty"`
+	Replace   []ReplaceJSON    `json:",omitempty"`
+	Retract   []RetractJSON    `json:",omitempty"`
+	Projects  []ProjectJSON    `json:",omitempty"`
+
+	Classfiles []module.Version `json:",omitempty"` // classfile statements of gop.mod
+	Includes   []IncludeJSON    `json:",omitempty"` // include statements of gop.mod
+	Extensions []ExtensionJSON  `json:",omitempty"` // extension directives of gop.mod
+	Generates  []GenerateJSON   `json:",omitempty"` // generate annotations of gop.mod
+}
+
+// An IncludeJSON is the machine-readable form of an include statement.
+type IncludeJSON struct {
+	Path string // the path as written
+	File string `json:",omitempty"` // name of the fragment file
+}
+
+// An ExtensionJSON is the machine-readable form of an extension directive.
+type ExtensionJSON struct {
+	Verb string
+	Args []string `json:",omitempty"` // raw tokens (maybe quoted)
+}
+
+// A GenerateJSON is the machine-readable form of a generate annotation.
+type GenerateJSON struct {
+	Command string
+	Args    []string `json:",omitempty"`
+	File    string   `json:",omitempty"`
+	Line    int      `json:",omitempty"`
+}
+
+// A CompilerJSON is the machine-readable form of the compiler statement.
+type CompilerJSON struct {
+	Name    string
+	Version string
+}
+
+// A RequireJSON is the machine-readable form of a require statement.
+type RequireJSON struct {
+	Path     string
+	Version  string
+	Indirect bool `json:",omitempty"` // marked by `// indirect`
+	Class    bool `json:",omitempty"` // marked by `//gop:class`
+}
+
+// A ReplaceJSON is the machine-readable form of a replace statement.
+type ReplaceJSON struct {
+	Old module.Version
+	New module.Version
+}
+
+// A RetractJSON is the machine-readable form of a retract statement.
+type RetractJSON struct {
+	Low       string
+	High      string
+	Rationale string `json:",omitempty"`
+}
+
+// A ProjectJSON is the machine-readable form of a project statement.
+type ProjectJSON struct {
+	Ext      string `json:",omitempty"`
+	Class    string `json:",omitempty"`
+	PkgPaths []string
+	PkgRefs  []PkgRefJSON `json:",omitempty"` // PkgPaths with their versions (nil if no version is specified)
+	Works    []ClassJSON  `json:",omitempty"`
+	Import   []ImportJSON `json:",omitempty"`
+	Runner   *RunnerJSON  `json:",omitempty"`
+	Prefix   string       `json:",omitempty"`
+	Embedded bool         `json:",omitempty"`
+	Tags     []string     `json:",omitempty"`
+	Excludes []string     `json:",omitempty"`
+	Doc      string       `json:",omitempty"`
+}
+
+// A PkgRefJSON is the machine-readable form of a package path of a project
+// statement with an optional version, eg. `github.com/goplus/spx@v1.0.0`.
+type PkgRefJSON struct {
+	Path    string
+	Version string `json:",omitempty"`
+}
+
+// A ClassJSON is the machine-readable form of a work class statement.
+type ClassJSON struct {
+	Ext      string
+	Class    string
+	Project  string   `json:",omitempty"`
+	Prefix   string   `json:",omitempty"`
+	Embedded bool     `json:",omitempty"`
+	Tags     []string `json:",omitempty"`
+	Doc      string   `json:",omitempty"`
+}
+
+// An ImportJSON is the machine-readable form of an import statement.
+type ImportJSON struct {
+	Name string `json:",omitempty"`
+	Path string
+}
+
+// A RunnerJSON is the machine-readable form of a runner statement.
+type RunnerJSON struct {
+	Path    string
+	Version string
+}
+
+// JSON returns the machine-readable form of this module.
+func (p Module) JSON() *ModuleJSON {
+	ret := &ModuleJSON{Module: p.Path()}
+	if f := p.File; f != nil {
+		if f.Go != nil {
+			ret.Go = f.Go.Version
+		}
+		if f.Toolchain != nil {
+			ret.Toolchain = f.Toolchain.Name
+		}
+		for _, r := range f.Require {
+			ret.Require = append(ret.Require, RequireJSON{
+				Path: r.Mod.Path, Version: r.Mod.Version, Indirect: r.Indirect, Class: isClass(r),
+			})
+		}
+		for _, x := range f.Exclude {
+			ret.Exclude = append(ret.Exclude, x.Mod)
+		}
+		for _, r := range f.Replace {
+			ret.Replace = append(ret.Replace, ReplaceJSON{Old: r.Old, New: r.New})
+		}
+		for _, r := range f.Retract {
+			ret.Retract = append(ret.Retract, RetractJSON{Low: r.Low, High: r.High, Rationale: r.Rationale})
+		}
+	}
+	if opt := p.Opt; opt != nil {
+		if opt.Gop != nil {
+			ret.Gop = opt.Gop.Version
+		}
+		if c := opt.Compiler; c != nil {
+			ret.Compiler = &CompilerJSON{Name: c.Name, Version: c.Version}
+		}
+		for _, c := range opt.Classfiles {
+			ret.Classfiles = append(ret.Classfiles, c.Mod)
+		}
+		for _, inc := range opt.Includes {
+			ret.Includes = append(ret.Includes, IncludeJSON{Path: inc.Path, File: inc.File})
+		}
+		for _, ext := range opt.Extensions {
+			ret.Extensions = append(ret.Extensions, ExtensionJSON{Verb: ext.Verb, Args: ext.Args})
+		}
+		for _, g := range opt.Generates {
+			ret.Generates = append(ret.Generates, GenerateJSON{Command: g.Command, Args: g.Args, File: g.File, Line: g.Pos.Line})
+		}
+		for _, proj := range opt.Projects {
+			pj := ProjectJSON{
+				Ext: proj.Ext, Class: proj.Class, PkgPaths: proj.PkgPaths,
+				Prefix: proj.Prefix, Embedded: proj.Embedded, Tags: proj.Tags, Excludes: proj.Excludes, Doc: proj.Doc,
+			}
+			pj.PkgRefs = pkgRefsJSON(proj.PkgRefs)
+			for _, w := range proj.Works {
+				pj.Works = append(pj.Works, ClassJSON{
+					Ext: w.Ext, Class: w.Class, Project: w.Project,
+					Prefix: w.Prefix, Embedded: w.Embedded, Tags: w.Tags, Doc: w.Doc,
+				})
+			}
+			for _, imp := range proj.Import {
+				pj.Import = append(pj.Import, ImportJSON{Name: imp.Name, Path: imp.Path})
+			}
+			if r := proj.Runner; r != nil {
+				pj.Runner = &RunnerJSON{Path: r.Path, Version: r.Version}
+			}
+			ret.Projects = append(ret.Projects, pj)
+		}
+	}
+	return ret
+}
+
+// pkgRefsJSON returns the machine-readable form of refs, or nil if none of
+// them has a version.
+func pkgRefsJSON(refs []modfile.PkgRef) (ret []PkgRefJSON) {
+	for _, ref := range refs {
+		if ref.Version != "" {
+			ret = make([]PkgRefJSON, len(refs))
+			for i, ref := range refs {
+				ret[i] = PkgRefJSON{Path: ref.Path, Version: ref.Version}
+			}
+			return
+		}
+	}
+	return
+}
+
+// MarshalJSON implements json.Marshaler. See ModuleJSON for its schema.
+func (p Module) MarshalJSON() ([]byte, error) {
+	return json.Marshal(p.JSON())
+}
+
+// -----------------------------------------------------------------------------
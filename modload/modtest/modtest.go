@@ -18,11 +18,31 @@ package modtest
 
 import (
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/goplus/mod/modload"
 )
 
+// Main runs tests of m with GOFLAGS=-modfile pointing to a scratch go.mod in
+// a temporary directory, so that `go get` run by tests (eg. to download a
+// classfile module) never changes go.mod and go.sum of this repository.
+func Main(m *testing.M) int {
+	dir, err := os.MkdirTemp("", "modtest-*")
+	if err != nil {
+		panic(err)
+	}
+	defer os.RemoveAll(dir)
+	gomod := filepath.Join(dir, "go.mod")
+	if err = os.WriteFile(gomod, []byte("module modtest\n"), 0666); err != nil {
+		panic(err)
+	}
+	flags := strings.TrimSpace(os.Getenv("GOFLAGS") + " -modfile=" + gomod)
+	os.Setenv("GOFLAGS", flags)
+	return m.Run()
+}
+
 func LoadFrom(gomod, gopmod string, gomodText, gopmodText string) (mod modload.Module, err error) {
 	return modload.LoadFromEx(gomod, gopmod, func(s string) ([]byte, error) {
 		if s == gomod {
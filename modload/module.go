@@ -20,6 +20,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 
 	"github.com/goplus/mod"
@@ -28,6 +29,7 @@ import (
 	"github.com/goplus/mod/sumfile"
 	"github.com/qiniu/x/errors"
 	"golang.org/x/mod/module"
+	"golang.org/x/mod/semver"
 
 	gomodfile "golang.org/x/mod/modfile"
 )
@@ -36,11 +38,28 @@ var (
 	ErrNoModDecl   = errors.New("no module declaration in a .mod file")
 	ErrNoModRoot   = errors.New("go.mod file not found in current directory or any parent directory")
 	ErrSaveDefault = errors.New("attemp to save default project")
+	ErrSaveOverlay = errors.New("attempt to save a module loaded with an overlay")
 )
 
+// A Module is a loaded (or created) module, ie. go.mod and gop.mod of it.
+// Besides the exported fields, it records how it's loaded, so a Module should
+// be created by Load, Create or NewModule rather than a composite literal:
+// an unkeyed literal like Module{f, opt} doesn't compile.
 type Module struct {
 	*gomodfile.File
-	Opt *modfile.File
+	Opt *modfile.File // nil if gop.mod doesn't exist and the module is loaded by LoadStrict
+
+	hasGopMod bool
+	embedded  bool    // gop.mod is embedded in go.mod, see modfile.ParseEmbedded
+	overlay   Overlay // see LoadOverlay
+
+	fingerprint string // see Fingerprint
+}
+
+// NewModule creates a module from parsed go.mod f and gop.mod opt, which may
+// be nil. opt is treated as loaded from a file (see HasGopMod) if it isn't nil.
+func NewModule(f *gomodfile.File, opt *modfile.File) Module {
+	return Module{File: f, Opt: opt, hasGopMod: opt != nil}
 }
 
 // HasModfile returns if this module exists or not.
@@ -56,14 +75,6 @@ func (p Module) Modfile() string {
 	return ""
 }
 
-func (p Module) workFile() string {
-	if syn := p.Syntax; syn != nil {
-		dir, _ := filepath.Split(syn.Name)
-		return dir + "go.work"
-	}
-	return ""
-}
-
 func (p Module) sumFile() string {
 	if syn := p.Syntax; syn != nil {
 		dir, _ := filepath.Split(syn.Name)
@@ -91,23 +102,31 @@ func (p Module) Path() string {
 // DepMods returns all depended modules.
 // If a depended module path is replace to be a local path, it will be canonical to an absolute path.
 func (p Module) DepMods() map[string]module.Version {
+	return p.DepModsEx(false)
+}
+
+// DepModsEx returns all depended modules, except excluded module versions.
+// If a depended module path is replace to be a local path, it will be canonical to
+// an absolute path, unless keepRel is true and the local path is a relative one.
+func (p Module) DepModsEx(keepRel bool) map[string]module.Version {
 	vers := make(map[string]module.Version)
 	for _, r := range p.Require {
-		if r.Mod.Path != "" {
+		if r.Mod.Path != "" && !p.IsExcluded(r.Mod) {
 			vers[r.Mod.Path] = r.Mod
 		}
 	}
+	if opt := p.Opt; opt != nil {
+		for _, c := range opt.Classfiles { // the higher version wins, like MVS
+			if v, ok := vers[c.Mod.Path]; (!ok || semver.Compare(c.Mod.Version, v.Version) > 0) && !p.IsExcluded(c.Mod) {
+				vers[c.Mod.Path] = c.Mod
+			}
+		}
+	}
 	for _, r := range p.Replace {
 		if r.Old.Path != "" {
 			real := r.New
-			if real.Version == "" {
-				if strings.HasPrefix(real.Path, ".") {
-					dir, _ := filepath.Split(p.Modfile())
-					real.Path = dir + real.Path
-				}
-				if a, err := filepath.Abs(real.Path); err == nil {
-					real.Path = a
-				}
+			if real.Version == "" && !(keepRel && isRelPath(real.Path)) {
+				real.Path = canonicalDir(p.Root(), real.Path)
 			}
 			vers[r.Old.Path] = real
 		}
@@ -115,6 +134,26 @@ func (p Module) DepMods() map[string]module.Version {
 	return vers
 }
 
+// isRelPath checks if path is a relative local path, eg. "./foo", "..\foo".
+func isRelPath(path string) bool {
+	return path == "." || path == ".." ||
+		strings.HasPrefix(path, "./") || strings.HasPrefix(path, "../") ||
+		strings.HasPrefix(path, ".\\") || strings.HasPrefix(path, "..\\")
+}
+
+// canonicalDir returns the absolute form of a local replacement path, which
+// is relative to the module root if it isn't an absolute path.
+func canonicalDir(root, path string) string {
+	path = filepath.FromSlash(path)
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(root, path)
+	}
+	if a, err := filepath.Abs(path); err == nil {
+		return a
+	}
+	return filepath.Clean(path)
+}
+
 // Create creates a new module in `dir`.
 // You should call `Save` manually to save this module.
 func Create(dir string, modPath, goVer, gopVer string) (p Module, err error) {
@@ -128,11 +167,22 @@ func Create(dir string, modPath, goVer, gopVer string) (p Module, err error) {
 		return Module{}, fmt.Errorf("gop: %s already exists", gomod)
 	}
 
-	gopmod := filepath.Join(dir, "gop.mod")
-	if _, err := os.Stat(gopmod); err == nil {
+	gopmod, found := mod.ResolveModfile(dir)
+	if found {
 		return Module{}, fmt.Errorf("gop: %s already exists", gopmod)
 	}
 
+	return newModule(gomod, gopmod, modPath, goVer, gopVer), nil
+}
+
+// CreateInMemory creates a new module in memory without touching the file
+// system, eg. for code generation or tests. The module isn't bound to any
+// directory: call SaveTo to save it.
+func CreateInMemory(modPath, goVer, gopVer string) Module {
+	return newModule("", "", modPath, goVer, gopVer)
+}
+
+func newModule(gomod, gopmod string, modPath, goVer, gopVer string) Module {
 	if goVer == "" {
 		goVer = defaultGoVer
 	}
@@ -141,7 +191,7 @@ func Create(dir string, modPath, goVer, gopVer string) (p Module, err error) {
 	}
 	mod := newGoMod(gomod, modPath, goVer)
 	opt := newGopMod(gopmod, gopVer)
-	return Module{mod, opt}, nil
+	return Module{File: mod, Opt: opt}
 }
 
 func newGoMod(gomod, modPath, goVer string) *gomodfile.File {
@@ -177,7 +227,8 @@ func Load(dir string) (p Module, err error) {
 		err = errors.NewWith(err, `mod.FindGoMod(dir)`, -2, "mod.FindGoMod", dir)
 		return
 	}
-	return LoadFrom(gomod, filepath.Join(dir, "gop.mod"))
+	gopmod, _ := mod.ResolveModfile(dir)
+	return LoadFrom(gomod, gopmod)
 }
 
 // LoadFrom loads a module from specified go.mod file and an optional gop.mod file.
@@ -187,7 +238,91 @@ func LoadFrom(gomod, gopmod string) (p Module, err error) {
 
 // LoadFromEx loads a module from specified go.mod file and an optional gop.mod file.
 // It can specify a customized `readFile` to read file content.
+//
+// If gopmod (eg. dir/gop.mod) doesn't exist, the other gop.mod files in its
+// directory (eg. dir/gox.mod) are tried, see mod.ModfileCandidates.
+//
+// gop.mod must be in the directory of go.mod (the module root), otherwise a
+// *GopModDirError is returned. Use LoadFromAnyDir to load a gop.mod file
+// elsewhere.
 func LoadFromEx(gomod, gopmod string, readFile func(string) ([]byte, error)) (p Module, err error) {
+	return loadFrom(gomod, gopmod, readFile, 0)
+}
+
+// LoadFromAnyDir is like LoadFromEx, but gop.mod can be in any directory.
+// Note that Save writes gop.mod back to where it's loaded from.
+func LoadFromAnyDir(gomod, gopmod string, readFile func(string) ([]byte, error)) (p Module, err error) {
+	return loadFrom(gomod, gopmod, readFile, loadAnyDir)
+}
+
+// A GopModDirError is returned if gop.mod isn't in the module root, that is,
+// the directory of go.mod.
+type GopModDirError struct {
+	GoMod  string
+	GopMod string
+}
+
+func (e *GopModDirError) Error() string {
+	return fmt.Sprintf("%s isn't in the module root %s", e.GopMod, filepath.Dir(e.GoMod))
+}
+
+// checkGopModDir checks if gop.mod is in the directory of go.mod.
+func checkGopModDir(gomod, gopmod string) error {
+	if gopmod == "" || absDir(gomod) == absDir(gopmod) {
+		return nil
+	}
+	return &GopModDirError{GoMod: gomod, GopMod: gopmod}
+}
+
+func absDir(file string) string {
+	dir := filepath.Dir(file)
+	if a, err := filepath.Abs(dir); err == nil {
+		return a
+	}
+	return filepath.Clean(dir)
+}
+
+// LoadStrict loads a module from specified directory in read-only mode.
+// Unlike Load, it doesn't synthesize a default gop.mod object if gop.mod
+// doesn't exist: Opt is left nil in that case, even if go.mod requires
+// classfile modules (marked by `//gop:class`), which are still reported by
+// Module.Requires and Module.ClassModPaths. See also Module.HasXGoMod.
+func LoadStrict(dir string) (p Module, err error) {
+	dir, gomod, err := mod.FindGoMod(dir)
+	if err != nil {
+		err = errors.NewWith(err, `mod.FindGoMod(dir)`, -2, "mod.FindGoMod", dir)
+		return
+	}
+	gopmod, _ := mod.ResolveModfile(dir)
+	return LoadFromStrict(gomod, gopmod, os.ReadFile)
+}
+
+// LoadFromStrict is like LoadFromEx but leaves Opt nil if gop.mod doesn't
+// exist, see LoadStrict.
+func LoadFromStrict(gomod, gopmod string, readFile func(string) ([]byte, error)) (p Module, err error) {
+	return loadFrom(gomod, gopmod, readFile, loadStrict)
+}
+
+const (
+	loadStrict = 1 << iota // leave Opt nil if gop.mod doesn't exist
+	loadAnyDir             // gop.mod can be in any directory
+)
+
+func loadFrom(gomod, gopmod string, readFile func(string) ([]byte, error), flags int) (p Module, err error) {
+	files := make(map[string][]byte)
+	if p, err = loadModule(gomod, gopmod, recordReads(readFile, files), flags); err != nil {
+		return
+	}
+	p.fingerprint = p.fingerprintOf(files, readFile)
+	return
+}
+
+func loadModule(gomod, gopmod string, readFile func(string) ([]byte, error), flags int) (p Module, err error) {
+	if flags&loadAnyDir == 0 {
+		if err = checkGopModDir(gomod, gopmod); err != nil {
+			return
+		}
+	}
 	data, err := readFile(gomod)
 	if err != nil {
 		err = errors.NewWith(err, `readFile(gomod)`, -2, "readFile", gomod)
@@ -197,6 +332,7 @@ func LoadFromEx(gomod, gopmod string, readFile func(string) ([]byte, error)) (p
 	var fixed bool
 	fix := fixVersion(&fixed)
 	// it is go.mod file, so we need to use "Parse" parse it
+	gomodData := data
 	f, err := gomodfile.Parse(gomod, data, fix)
 	if err != nil {
 		err = errors.NewWith(err, `gomodfile.Parse(gomod, data, fix)`, -2, "gomodfile.Parse", gomod, data, fix)
@@ -212,24 +348,120 @@ func LoadFromEx(gomod, gopmod string, readFile func(string) ([]byte, error)) (p
 		mod.Mod.Path = "" // the Go std module
 	}
 
-	var opt *modfile.File
-	if gopmod != "" {
-		if data, err = readFile(gopmod); err == nil {
-			opt, err = modfile.ParseLax(gopmod, data, fix)
-			if err != nil {
-				err = errors.NewWith(err, `modfile.Parse(gopmod, data, fix)`, -2, "modfile.Parse", gopmod, data, fix)
-				return
-			}
-		}
+	opt, err := loadGopMod(gopmod, readFile, fix)
+	if err != nil {
+		return
 	}
+	var embedded bool
 	if opt == nil {
+		if opt, err = modfile.ParseEmbedded(gomod, gomodData, fix); err != nil {
+			err = errors.NewWith(err, `modfile.ParseEmbedded(gomod, gomodData, fix)`, -2, "modfile.ParseEmbedded", gomod, gomodData, fix)
+			return
+		}
+		embedded = opt != nil
+	}
+	hasGopMod := opt != nil
+	if !hasGopMod {
+		if flags&loadStrict != 0 {
+			return Module{File: f}, nil
+		}
 		opt = newGopMod(gopmod, defaultGopVer)
 	}
 	importClassfileFromGoMod(opt, f)
-	if cl := getGoCompiler(f); cl != nil {
-		opt.Compiler = cl
+	if opt.Compiler == nil { // compiler statement of gop.mod takes precedence
+		opt.Compiler = getGoCompiler(f)
+	}
+	return Module{File: f, Opt: opt, hasGopMod: hasGopMod, embedded: embedded}, nil
+}
+
+// loadGopMod loads the first existing file of mod.ModfileCandidates(gopmod).
+// It returns nil if none of them exists.
+func loadGopMod(gopmod string, readFile func(string) ([]byte, error), fix modfile.VersionFixer) (*modfile.File, error) {
+	if gopmod == "" {
+		return nil, nil
+	}
+	for _, file := range mod.ModfileCandidates(gopmod) {
+		if data, err := readFile(file); err == nil {
+			opt, err := modfile.ParseLax(file, data, fix)
+			if err != nil {
+				return nil, errors.NewWith(err, `modfile.ParseLax(file, data, fix)`, -2, "modfile.ParseLax", file, data, fix)
+			}
+			return opt, nil
+		}
 	}
-	return Module{f, opt}, nil
+	return nil, nil
+}
+
+// HasGopMod reports whether gop.mod of this module was loaded from a file.
+func (p Module) HasGopMod() bool {
+	return p.hasGopMod
+}
+
+// HasXGoMod reports whether gox.mod (or gop.mod) of this module was loaded
+// from a file. It's the same as HasGopMod.
+func (p Module) HasXGoMod() bool {
+	return p.hasGopMod
+}
+
+// ModfileName returns the name of the gop.mod file actually loaded, ie.
+// "gox.mod" or "gop.mod" (see mod.ModfileNames), "go.mod" if gop.mod is
+// embedded in go.mod, or "" if gop.mod doesn't exist.
+func (p Module) ModfileName() string {
+	if !p.hasGopMod {
+		return ""
+	}
+	return filepath.Base(p.Opt.Syntax.Name)
+}
+
+// Clone returns a deep copy of this module, including syntax trees of go.mod
+// and gop.mod. It's safe to make speculative edits to the copy (eg. preview
+// of adding a require) without affecting the original module.
+func (p Module) Clone() Module {
+	ret := Module{hasGopMod: p.hasGopMod, embedded: p.embedded, overlay: p.overlay, fingerprint: p.fingerprint}
+	if p.File != nil {
+		ret.File = cloneGoMod(p.File)
+	}
+	if p.Opt != nil {
+		ret.Opt = p.Opt.Clone()
+	}
+	return ret
+}
+
+func cloneGoMod(f *gomodfile.File) *gomodfile.File {
+	syn, lineOf := modfile.CloneSyntax(f.Syntax)
+	ret := &gomodfile.File{Syntax: syn}
+	if f.Module != nil {
+		ret.Module = &gomodfile.Module{
+			Mod: f.Module.Mod, Deprecated: f.Module.Deprecated, Syntax: lineOf(f.Module.Syntax),
+		}
+	}
+	if f.Go != nil {
+		ret.Go = &gomodfile.Go{Version: f.Go.Version, Syntax: lineOf(f.Go.Syntax)}
+	}
+	if f.Toolchain != nil {
+		ret.Toolchain = &gomodfile.Toolchain{Name: f.Toolchain.Name, Syntax: lineOf(f.Toolchain.Syntax)}
+	}
+	for _, v := range f.Godebug {
+		ret.Godebug = append(ret.Godebug, &gomodfile.Godebug{Key: v.Key, Value: v.Value, Syntax: lineOf(v.Syntax)})
+	}
+	for _, v := range f.Require {
+		ret.Require = append(ret.Require, &gomodfile.Require{Mod: v.Mod, Indirect: v.Indirect, Syntax: lineOf(v.Syntax)})
+	}
+	for _, v := range f.Exclude {
+		ret.Exclude = append(ret.Exclude, &gomodfile.Exclude{Mod: v.Mod, Syntax: lineOf(v.Syntax)})
+	}
+	for _, v := range f.Replace {
+		ret.Replace = append(ret.Replace, &gomodfile.Replace{Old: v.Old, New: v.New, Syntax: lineOf(v.Syntax)})
+	}
+	for _, v := range f.Retract {
+		ret.Retract = append(ret.Retract, &gomodfile.Retract{
+			VersionInterval: v.VersionInterval, Rationale: v.Rationale, Syntax: lineOf(v.Syntax),
+		})
+	}
+	for _, v := range f.Tool {
+		ret.Tool = append(ret.Tool, &gomodfile.Tool{Path: v.Path, Syntax: lineOf(v.Syntax)})
+	}
+	return ret
 }
 
 // AddCompiler adds a custom Go compiler to this module.
@@ -239,7 +471,9 @@ func (p Module) AddCompiler(compiler, ver string) {
 		f.AddGoStmt(defaultGoVer)
 	}
 	addCompiler(p.Opt, f.Go, compiler, ver)
-	p.Opt.Compiler = &modfile.Compiler{Name: compiler, Version: ver}
+	if p.Opt != nil {
+		p.Opt.Compiler = &modfile.Compiler{Name: compiler, Version: ver}
+	}
 }
 
 func addCompiler(opt *modfile.File, r *gomodfile.Go, compiler, ver string) {
@@ -248,25 +482,84 @@ func addCompiler(opt *modfile.File, r *gomodfile.Go, compiler, ver string) {
 			Token:  "// " + compiler + " " + ver,
 			Suffix: true,
 		}}
-		opt.Compiler = &modfile.Compiler{Name: compiler, Version: ver}
+		if opt != nil {
+			opt.Compiler = &modfile.Compiler{Name: compiler, Version: ver}
+		}
+	}
+}
+
+// Godebugs returns all godebug settings (key => value) declared in go.mod.
+func (p Module) Godebugs() map[string]string {
+	ret := make(map[string]string, len(p.Godebug))
+	for _, g := range p.Godebug {
+		ret[g.Key] = g.Value
+	}
+	return ret
+}
+
+// GodebugEnv returns godebug settings declared in go.mod in the form of the
+// GODEBUG environment variable, eg. "panicnil=1,asynctimerchan=0".
+func (p Module) GodebugEnv() string {
+	var b strings.Builder
+	for i, g := range p.Godebug {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(g.Key)
+		b.WriteByte('=')
+		b.WriteString(g.Value)
 	}
+	return b.String()
+}
+
+// SetGodebug sets a godebug setting (`godebug key=value`) in go.mod.
+func (p Module) SetGodebug(key, value string) error {
+	return p.File.AddGodebug(key, value)
 }
 
-// AddRequire adds a require package to this module.
-func (p Module) AddRequire(path, vers string, hasProj bool) error {
+// DeleteGodebug deletes a godebug setting from go.mod.
+func (p Module) DeleteGodebug(key string) (err error) {
 	f := p.File
-	f.AddRequire(path, vers)
-	if hasProj {
-		for _, r := range f.Require {
-			if r.Mod.Path == path {
-				if !isClass(r) {
-					addClass(p.Opt, r)
-				}
-				break
-			}
+	if err = f.DropGodebug(key); err == nil {
+		f.Cleanup()
+	}
+	return
+}
+
+// AddExclude adds an exclude statement of the module version to go.mod.
+func (p Module) AddExclude(path, vers string) error {
+	return p.File.AddExclude(path, vers)
+}
+
+// DropExclude removes the exclude statement of the module version from go.mod.
+func (p Module) DropExclude(path, vers string) (err error) {
+	f := p.File
+	if err = f.DropExclude(path, vers); err == nil {
+		f.Cleanup()
+	}
+	return
+}
+
+// IsExcluded reports whether the module version is excluded by go.mod.
+func (p Module) IsExcluded(mod module.Version) bool {
+	for _, x := range p.Exclude {
+		if x.Mod == mod {
+			return true
 		}
 	}
-	return nil
+	return false
+}
+
+// AddRequire adds a require package to this module. Hashes of the required
+// module are also added to go.sum if this module exists on disk, unless noSum
+// is true. The hashes are read from GOMODCACHE if possible, and are computed
+// by downloading from the module proxy otherwise.
+//
+// If path is already required, its version is only upgraded, never
+// downgraded (see UpdateRequire).
+func (p Module) AddRequire(path, vers string, hasProj bool, noSum ...bool) error {
+	_, err := p.UpdateRequire(path, vers, hasProj, noSum == nil || !noSum[0], false)
+	return err
 }
 
 func importClassfileFromGoMod(opt *modfile.File, f *gomodfile.File) {
@@ -275,26 +568,36 @@ func importClassfileFromGoMod(opt *modfile.File, f *gomodfile.File) {
 			opt.ClassMods = append(opt.ClassMods, r.Mod.Path)
 		}
 	}
+	for _, c := range opt.Classfiles {
+		if !hasClassMod(opt.ClassMods, c.Mod.Path) {
+			opt.ClassMods = append(opt.ClassMods, c.Mod.Path)
+		}
+	}
+}
+
+func hasClassMod(classMods []string, path string) bool {
+	for _, v := range classMods {
+		if v == path {
+			return true
+		}
+	}
+	return false
 }
 
 func addClass(opt *modfile.File, r *gomodfile.Require) {
 	if line := r.Syntax; line != nil {
-		line.Suffix = append(line.Suffix, modfile.Comment{
-			Token:  "//gop:class", // without trailing newline
-			Suffix: true,          // an end of line (not whole line) comment
-		})
-		opt.ClassMods = append(opt.ClassMods, r.Mod.Path)
+		m := parseMarkers(line)
+		m.class = true
+		line.Suffix = m.suffix()
+		if opt != nil {
+			opt.ClassMods = append(opt.ClassMods, r.Mod.Path)
+		}
 	}
 }
 
 func isClass(r *gomodfile.Require) bool {
 	if line := r.Syntax; line != nil {
-		for _, c := range line.Suffix {
-			text := strings.TrimLeft(c.Token[2:], " \t")
-			if strings.HasPrefix(text, "gop:class") {
-				return true
-			}
-		}
+		return parseMarkers(line).class
 	}
 	return false
 }
@@ -327,38 +630,106 @@ func getGoCompiler(f *gomodfile.File) *modfile.Compiler {
 
 // -----------------------------------------------------------------------------
 
+// Projects returns classfile projects declared in gop.mod. The returned
+// projects are copies (see modfile.Project.Clone), so changing them doesn't
+// change this module.
 func (p Module) Projects() []*modfile.Project {
-	return p.Opt.Projects
+	if p.Opt == nil || p.Opt.Projects == nil {
+		return nil
+	}
+	ret := make([]*modfile.Project, len(p.Opt.Projects))
+	for i, proj := range p.Opt.Projects {
+		ret[i] = proj.Clone()
+	}
+	return ret
 }
 
 func (p Module) HasProject() bool {
-	return len(p.Opt.Projects) > 0
+	return hasGopExtended(p.Opt)
 }
 
 func hasGopExtended(opt *modfile.File) bool {
-	return len(opt.Projects) > 0
+	return opt != nil && len(opt.Projects) > 0
 }
 
-// Save saves all changes of this module.
+// GoOnlyModfile returns content of go.mod of this module without Go+
+// specific content (eg. `//gop:class` markers), see modfile.StripGop.
+func (p Module) GoOnlyModfile() ([]byte, error) {
+	data, err := p.Format()
+	if err != nil {
+		return nil, err
+	}
+	return modfile.StripGop(data)
+}
+
+// Save saves all changes of this module. Save hooks (see RegisterSaveHook)
+// are run on go.mod and gop.mod before any of them is written, and post-save
+// hooks (see RegisterPostSaveHook) after both of them are written.
 func (p Module) Save() (err error) {
 	modf := p.Modfile()
 	if modf == "" {
 		return ErrSaveDefault
 	}
+	if p.overlay != nil {
+		return ErrSaveOverlay
+	}
 	data, err := p.Format()
 	if err != nil {
 		return
 	}
-	err = os.WriteFile(modf, data, 0644)
-	if err != nil {
+	if p.embedded {
+		if data, err = modfile.FormatEmbedded(data, p.Opt); err != nil {
+			return
+		}
+	}
+	if data, err = runSaveHooks(modf, data); err != nil {
+		return
+	}
+	var gopData []byte
+	opt := p.Opt
+	saveGop := !p.embedded && hasGopExtended(opt)
+	if saveGop {
+		if gopData, err = runSaveHooks(opt.Syntax.Name, modfile.Format(opt.Syntax)); err != nil {
+			return
+		}
+	}
+	if err = os.WriteFile(modf, data, 0644); err != nil {
 		return
 	}
+	if saveGop {
+		if err = os.WriteFile(opt.Syntax.Name, gopData, 0644); err != nil {
+			return
+		}
+	}
+	if err = runPostSaveHooks(modf, data); err != nil || !saveGop {
+		return
+	}
+	return runPostSaveHooks(opt.Syntax.Name, gopData)
+}
 
-	if opt := p.Opt; hasGopExtended(opt) {
-		data := modfile.Format(opt.Syntax)
-		err = os.WriteFile(opt.Syntax.Name, data, 0644)
+// SaveTo binds this module to directory dir (go.mod and gop.mod of this
+// module will be dir/go.mod and dir/gop.mod) and saves it. Existing files are
+// overwritten. It's typically used to save a module created by CreateInMemory.
+func (p Module) SaveTo(dir string) (err error) {
+	if p.Syntax == nil {
+		return ErrSaveDefault
 	}
-	return
+	if dir, err = filepath.Abs(dir); err != nil {
+		return
+	}
+	p.Syntax.Name = filepath.Join(dir, "go.mod")
+	if opt := p.Opt; opt != nil && opt.Syntax != nil {
+		if p.embedded {
+			opt.Syntax.Name = p.Syntax.Name
+		} else {
+			name := filepath.Base(opt.Syntax.Name)
+			if !mod.IsModfileName(name) {
+				name = mod.GopModfile
+			}
+			opt.Syntax.Name = filepath.Join(dir, name)
+		}
+	}
+	return p.Save()
 }
 
 func (p Module) checkGopDeps() (flags int) {
@@ -379,15 +750,6 @@ func (p Module) checkGopDeps() (flags int) {
 	return
 }
 
-func findReplaceGopMod(work *gomodfile.WorkFile) bool {
-	for _, r := range work.Replace {
-		if r.Old.Path == gopMod {
-			return true
-		}
-	}
-	return false
-}
-
 const (
 	gopMod = "github.com/goplus/gop"
 	xMod   = "github.com/qiniu/x"
@@ -411,9 +773,81 @@ func (p Module) SaveWithGopMod(gop *env.Gop, flags int) (err error) {
 	return p.Save()
 }
 
-func (p Module) updateWorkfile(gop *env.Gop, gopVer string) (err error) {
+// SaveWithDeps requires modules deps (unless the same or a newer version is
+// already required), adds their go.sum lines, and saves all changes of this
+// module. It's a generalized SaveWithGopMod, eg. to inject an alternative
+// runtime like llgo.
+//
+// replace maps module paths to local directories or "path@version" targets,
+// which are added to go.work (in the module root) as replace directives.
+// Modules already replaced in go.work are kept as is, unless the replace
+// directives are stale (eg. their local directories don't exist anymore).
+func (p Module) SaveWithDeps(deps []module.Version, replace map[string]string) (err error) {
+	vers := make(map[string]string, len(deps))
+	for _, dep := range deps {
+		vers[dep.Path] = dep.Version
+		if r := p.lookupRequire(dep.Path); r != nil && semver.Compare(r.Mod.Version, dep.Version) >= 0 {
+			continue
+		}
+		if err = p.File.AddRequire(dep.Path, dep.Version); err != nil {
+			return
+		}
+		if _, ok := replace[dep.Path]; !ok { // replaced modules needn't go.sum lines
+			if err = p.addSum(dep); err != nil {
+				return
+			}
+		}
+	}
+	if len(replace) > 0 {
+		paths := make([]string, 0, len(replace))
+		for path := range replace {
+			paths = append(paths, path)
+		}
+		sort.Strings(paths)
+		replaces := make([]workReplace, len(paths))
+		for i, path := range paths {
+			replaces[i] = workReplace{
+				Old: module.Version{Path: path, Version: vers[path]},
+				New: parseReplaceTarget(replace[path]),
+			}
+		}
+		if err = p.updateWorkfile(replaces...); err != nil {
+			return
+		}
+	}
+	return p.Save()
+}
+
+type workReplace struct {
+	Old, New module.Version
+}
+
+// parseReplaceTarget parses a replacement of module, which is a local
+// directory or "path@version".
+func parseReplaceTarget(s string) module.Version {
+	if !gomodfile.IsDirectoryPath(s) {
+		if pos := strings.LastIndexByte(s, '@'); pos > 0 {
+			return module.Version{Path: s[:pos], Version: s[pos+1:]}
+		}
+	}
+	return module.Version{Path: s}
+}
+
+// updateWorkfile adds `use .` and replace directives to go.work (see
+// Workspace). Modules which are already replaced in go.work are skipped, unless
+// all their replace directives are stale (see isStaleReplace), in which case
+// the stale ones are rewritten, eg. when the gop root has moved. It does
+// nothing if GOWORK=off.
+func (p Module) updateWorkfile(replaces ...workReplace) (err error) {
 	var work *gomodfile.WorkFile
-	var workFile = p.workFile()
+	if p.overlay != nil {
+		return ErrSaveOverlay
+	}
+	ws := p.Workspace()
+	if ws.Err != nil || ws.Mode == WorkOff {
+		return ws.Err
+	}
+	workFile, workDir := ws.File, filepath.Dir(ws.File)
 	b, err := os.ReadFile(workFile)
 	if err != nil {
 		if os.IsNotExist(err) {
@@ -427,24 +861,71 @@ func (p Module) updateWorkfile(gop *env.Gop, gopVer string) (err error) {
 	if work, err = gomodfile.ParseWork(workFile, b, fix); err != nil {
 		return
 	}
-	if findReplaceGopMod(work) {
+	var adds []workReplace
+	var drops []module.Version
+	for _, r := range replaces {
+		olds, stale := workReplacesOf(work, workDir, r.Old)
+		if olds == nil || stale {
+			adds, drops = append(adds, r), append(drops, olds...)
+		}
+	}
+	if adds == nil {
 		return
 	}
-	work.AddUse(".", p.Path())
-	work.AddReplace(gopMod, gopVer, gop.Root, "")
-	return os.WriteFile(workFile, gomodfile.Format(work.Syntax), 0666)
+	for _, old := range drops {
+		if err = work.DropReplace(old.Path, old.Version); err != nil {
+			return
+		}
+	}
+	work.AddUse(workRelPath(p.Root(), workDir, "."), p.Path())
+	for _, r := range adds {
+		if err = work.AddReplace(r.Old.Path, r.Old.Version, r.New.Path, r.New.Version); err != nil {
+			return
+		}
+	}
+	work.Cleanup()
+	return writeFile(workFile, gomodfile.Format(work.Syntax), 0666)
+}
+
+// workReplacesOf returns the replaced modules (with versions in go.work) of
+// module old.Path in go.work (in directory root), and whether all of them are
+// stale.
+func workReplacesOf(work *gomodfile.WorkFile, root string, old module.Version) (olds []module.Version, stale bool) {
+	stale = true
+	for _, r := range work.Replace {
+		if r.Old.Path == old.Path {
+			olds = append(olds, r.Old)
+			if !isStaleReplace(r, root, old.Version) {
+				stale = false
+			}
+		}
+	}
+	return
+}
+
+// isStaleReplace reports whether a replace directive of go.work (in directory
+// root) doesn't work anymore: it only replaces a version other than vers, or
+// its target is a local directory which doesn't contain go.mod.
+func isStaleReplace(r *gomodfile.Replace, root, vers string) bool {
+	if r.Old.Version != "" && vers != "" && r.Old.Version != vers {
+		return true
+	}
+	return r.New.Version == "" && !hasFile(filepath.Join(canonicalDir(root, r.New.Path), "go.mod"))
 }
 
 // requireGop adds require for the github.com/goplus/gop module.
 func (p Module) requireGop(gop *env.Gop, gopVer string, old, flags int) {
 	if (flags&FlagDepModGop) != 0 && (old&FlagDepModGop) == 0 {
 		p.File.AddRequire(gopMod, gopVer)
-		p.updateWorkfile(gop, gopVer)
+		p.updateWorkfile(workReplace{
+			Old: module.Version{Path: gopMod, Version: gopVer},
+			New: module.Version{Path: gop.Root},
+		})
 	}
 	if (flags&FlagDepModX) != 0 && (old&FlagDepModX) == 0 { // depends module github.com/qiniu/x
 		if x, xsum, ok := getXVer(gop); ok {
 			p.File.AddRequire(x.Path, x.Version)
-			if sumf, err := sumfile.Load(p.sumFile()); err == nil && sumf.Lookup(xMod) == nil {
+			if sumf, err := sumfile.LoadEx(p.sumFile(), p.overlay.ReadFile); err == nil && sumf.Lookup(xMod) == nil {
 				sumf.Add(xsum)
 				sumf.Save()
 			}
@@ -480,15 +961,31 @@ const (
 	defaultGopVer = "1.2"
 )
 
-// Default represents the default gop.mod object.
-var Default = Module{
-	File: &gomodfile.File{
-		Module: &gomodfile.Module{},
-		Go:     &gomodfile.Go{Version: defaultGoVer},
-	},
-	Opt: &modfile.File{
-		Gop: &modfile.Gop{Version: defaultGopVer},
-	},
+// NewDefault returns a new default module, ie. a module without go.mod and
+// gop.mod, of Go version goVer and Go+ version gopVer (empty versions mean the
+// default ones). Unlike Default, the returned module can be modified freely.
+func NewDefault(goVer, gopVer string) Module {
+	if goVer == "" {
+		goVer = defaultGoVer
+	}
+	if gopVer == "" {
+		gopVer = defaultGopVer
+	}
+	return Module{
+		File: &gomodfile.File{
+			Module: &gomodfile.Module{},
+			Go:     &gomodfile.Go{Version: goVer},
+		},
+		Opt: &modfile.File{
+			Gop: &modfile.Gop{Version: gopVer},
+		},
+	}
 }
 
+// Default represents the default gop.mod object. It's shared by all users and
+// must be treated as read-only: use NewDefault (or Default.Clone) to get a
+// module that can be modified. Its accessors (eg. Requires, Projects and
+// DepMods) return copies, which can be modified freely.
+var Default = NewDefault("", "")
+
 // -----------------------------------------------------------------------------
@@ -18,13 +18,18 @@ package modload
 
 import (
 	"encoding/json"
+	"fmt"
 	"log"
 	"os"
+	"path/filepath"
+	"reflect"
 	"runtime"
+	"strings"
 	"testing"
 
 	"github.com/goplus/mod"
 	"github.com/goplus/mod/env"
+	"github.com/goplus/mod/modcache"
 	"github.com/goplus/mod/modfile"
 	"github.com/qiniu/x/errors"
 	gomodfile "golang.org/x/mod/modfile"
@@ -32,9 +37,7 @@ import (
 )
 
 func TestCheckGopDeps(t *testing.T) {
-	mod := Default
-	file := *mod.File
-	mod.File = &file
+	mod := NewDefault("", "")
 	mod.File.Module = &gomodfile.Module{Mod: module.Version{
 		Path: "github.com/qiniu/x",
 	}}
@@ -184,7 +187,7 @@ replace github.com/goplus/yap v0.7.2 => ../
 }
 
 func TestSaveDefault(t *testing.T) {
-	if v := Default.workFile(); v != "" {
+	if v := Default.Workspace().File; v != "" {
 		t.Fatal("Default.workFile:", v)
 	}
 	if v := Default.sumFile(); v != "" {
@@ -214,14 +217,14 @@ func TestSaveDefault(t *testing.T) {
 }
 
 func TestSave(t *testing.T) {
-	dir := ".gop/_tempdir"
-	os.RemoveAll(".gop")
+	gopRoot := filepath.Join(t.TempDir(), ".gop")
+	dir := filepath.Join(gopRoot, "_tempdir")
 	os.MkdirAll(dir, 0777)
 	mod, err := Create(dir, "github.com/foo/bar", "", "")
 	if err != nil {
 		t.Fatal("Create:", err)
 	}
-	if err = mod.AddRequire("github.com/goplus/yap", "v0.5.0", true); err != nil {
+	if err = mod.AddRequire("github.com/goplus/yap", "v0.5.0", true, true); err != nil {
 		t.Fatal("mod.AddRequire:", err)
 	}
 	mod.Save()
@@ -246,7 +249,7 @@ require (
 ` {
 		t.Fatal("SaveWithGopMod:", v)
 	}
-	b, err := os.ReadFile(mod.workFile())
+	b, err := os.ReadFile(mod.Workspace().File)
 	if err != nil {
 		t.Fatal("read workFile:", err)
 	}
@@ -260,7 +263,7 @@ replace github.com/goplus/gop v1.2.0 => /foo/bar/gop
 	}
 
 	// SaveWithGopMod with FlagDepModX
-	os.WriteFile(".gop/go.mod", []byte(`
+	os.WriteFile(filepath.Join(gopRoot, "go.mod"), []byte(`
 module github.com/goplus/gop
 
 go 1.18
@@ -269,7 +272,7 @@ require (
 	github.com/qiniu/x v1.13.0
 )
 `), 0666)
-	if err = mod.SaveWithGopMod(&env.Gop{Version: "v1.2.0 devel", Root: ".gop"}, FlagDepModGop|FlagDepModX); err != nil {
+	if err = mod.SaveWithGopMod(&env.Gop{Version: "v1.2.0 devel", Root: gopRoot}, FlagDepModGop|FlagDepModX); err != nil {
 		t.Fatal("mod.SaveWithGopMod 2:", err)
 	}
 	if b, err := mod.File.Format(); err != nil {
@@ -291,11 +294,11 @@ require (
 	}
 
 	// SaveWithGopMod again. noop.
-	if err = mod.SaveWithGopMod(&env.Gop{Version: "v1.2.0 devel", Root: ".gop"}, FlagDepModGop|FlagDepModX); err != nil {
+	if err = mod.SaveWithGopMod(&env.Gop{Version: "v1.2.0 devel", Root: gopRoot}, FlagDepModGop|FlagDepModX); err != nil {
 		log.Fatal("mod.SaveWithGopMod 3:", err)
 	}
 
-	if err = mod.updateWorkfile(&env.Gop{Version: "v1.2.0 devel", Root: ".gop"}, ""); err != nil {
+	if err = mod.updateWorkfile(workReplace{Old: module.Version{Path: gopMod}, New: module.Version{Path: gopRoot}}); err != nil {
 		log.Fatal("updateWorkfile:", err)
 	}
 
@@ -319,3 +322,1344 @@ var (
 		PkgPaths: []string{"github.com/goplus/spx", "math"},
 	}
 )
+
+func TestGodebug(t *testing.T) {
+	mod, err := Create("/foo/bar", "github.com/foo/bar", "1.21", "")
+	if err != nil {
+		t.Fatal("Create failed:", err)
+	}
+	if v := mod.GodebugEnv(); v != "" {
+		t.Fatal("GodebugEnv:", v)
+	}
+	if err = mod.SetGodebug("panicnil", "1"); err != nil {
+		t.Fatal("SetGodebug:", err)
+	}
+	mod.SetGodebug("asynctimerchan", "0")
+	if v := mod.GodebugEnv(); v != "panicnil=1,asynctimerchan=0" {
+		t.Fatal("GodebugEnv:", v)
+	}
+	if v := mod.Godebugs(); len(v) != 2 || v["panicnil"] != "1" {
+		t.Fatal("Godebugs:", v)
+	}
+	mod.DeleteGodebug("panicnil")
+	if v := mod.GodebugEnv(); v != "asynctimerchan=0" {
+		t.Fatal("DeleteGodebug:", v)
+	}
+}
+
+func TestNewModule(t *testing.T) {
+	f, err := gomodfile.Parse("/foo/go.mod", []byte("module github.com/foo/bar\n"), nil)
+	if err != nil {
+		t.Fatal("gomodfile.Parse:", err)
+	}
+	mod := NewModule(f, nil)
+	if mod.Path() != "github.com/foo/bar" || mod.Opt != nil || mod.HasGopMod() {
+		t.Fatal("NewModule:", mod)
+	}
+	opt := modfile.New("/foo/gop.mod", "1.2")
+	if mod = NewModule(f, opt); mod.Opt != opt || !mod.HasGopMod() || mod.ModfileName() != "gop.mod" {
+		t.Fatal("NewModule gop.mod:", mod)
+	}
+}
+
+func TestLoadStrict(t *testing.T) {
+	gomod := "module github.com/foo/bar\n\nrequire github.com/goplus/yap v0.5.0 //gop:class\n"
+	readFile := func(name string) ([]byte, error) {
+		if name == "/foo/go.mod" {
+			return []byte(gomod), nil
+		}
+		return nil, os.ErrNotExist
+	}
+	m, err := LoadFromStrict("/foo/go.mod", "/foo/gop.mod", readFile)
+	if err != nil {
+		t.Fatal("LoadFromStrict:", err)
+	}
+	if m.Opt != nil || m.HasXGoMod() || m.HasProject() {
+		t.Fatal("LoadFromStrict: classfile requires", m.Opt)
+	}
+	if mods := m.ClassModPaths(); len(mods) != 1 || mods[0] != "github.com/goplus/yap" {
+		t.Fatal("LoadFromStrict: ClassModPaths", mods)
+	}
+	if reqs := m.Requires(); len(reqs) != 1 || !reqs[0].IsClass {
+		t.Fatal("LoadFromStrict: Requires", reqs)
+	}
+	gomod = "module github.com/foo/bar\n\nrequire github.com/goplus/yap v0.5.0\n"
+	if m, err = LoadFromStrict("/foo/go.mod", "/foo/gop.mod", readFile); err != nil {
+		t.Fatal("LoadFromStrict:", err)
+	}
+	if m.Opt != nil || m.HasGopMod() || m.HasProject() {
+		t.Fatal("LoadFromStrict: Opt != nil?")
+	}
+	m.AddCompiler("llgo", "0.9")
+	m.AddRequire("github.com/goplus/spx", "v1.0.0", true)
+	if hasGopExtended(m.Opt) {
+		t.Fatal("hasGopExtended?")
+	}
+
+	mod2, err := LoadFromEx("/foo/go.mod", "/foo/gop.mod", readFile)
+	if err != nil {
+		t.Fatal("LoadFromEx:", err)
+	}
+	if mod2.Opt == nil || mod2.HasGopMod() || mod2.HasXGoMod() {
+		t.Fatal("LoadFromEx: HasGopMod?")
+	}
+	if mods := mod2.ClassModPaths(); len(mods) != 0 {
+		t.Fatal("LoadFromEx: ClassModPaths", mods)
+	}
+	if _, err = LoadStrict("/path/not-found"); errors.Err(err) != mod.ErrNotFound {
+		t.Fatal("LoadStrict:", err)
+	}
+}
+
+func TestGopModDir(t *testing.T) {
+	readFile := func(name string) ([]byte, error) {
+		switch filepath.ToSlash(name) {
+		case "/foo/go.mod":
+			return []byte("module github.com/foo/bar\n"), nil
+		case "/bar/gop.mod":
+			return []byte("gop 1.2\n\nproject .gmx Game github.com/goplus/spx\n"), nil
+		}
+		return nil, os.ErrNotExist
+	}
+	_, err := LoadFromEx("/foo/go.mod", "/foo/sub/../../bar/gop.mod", readFile)
+	if e, ok := err.(*GopModDirError); !ok || e.GopMod != "/foo/sub/../../bar/gop.mod" {
+		t.Fatal("LoadFromEx:", err)
+	}
+	if _, err = LoadFromStrict("/foo/go.mod", "/bar/gop.mod", readFile); err == nil || !strings.Contains(err.Error(), "isn't in the module root") {
+		t.Fatal("LoadFromStrict:", err)
+	}
+	if _, err = LoadFromEx("/foo/go.mod", "/foo/sub/../gop.mod", readFile); err != nil {
+		t.Fatal("LoadFromEx same dir:", err)
+	}
+	m, err := LoadFromAnyDir("/foo/go.mod", "/bar/gop.mod", readFile)
+	if err != nil || !m.HasGopMod() || len(m.Projects()) != 1 {
+		t.Fatal("LoadFromAnyDir:", err)
+	}
+}
+
+func TestGoVersion(t *testing.T) {
+	mod, err := Create("/foo/bar", "github.com/foo/bar", "1.20", "")
+	if err != nil {
+		t.Fatal("Create failed:", err)
+	}
+	if v := mod.GoVersion(); v != "1.20" {
+		t.Fatal("GoVersion:", v)
+	}
+	mod.DropGoStmt()
+	if v := mod.GoVersion(); v != defaultGoVer {
+		t.Fatal("GoVersion default:", v)
+	}
+	mod.AddToolchainStmt("go1.21.3")
+	if v := mod.GoVersion(); v != "1.21.3" {
+		t.Fatal("GoVersion toolchain:", v)
+	}
+
+	mod.AddRequire("golang.org/x/mod", "v0.20.0", false)
+	if err = mod.SetGoVersion("1.17"); err == nil {
+		t.Fatal("SetGoVersion 1.17: no error?")
+	} else if e, ok := err.(*GoVersionTooLowError); !ok || e.Required != "1.18" {
+		t.Fatal("SetGoVersion 1.17:", err)
+	}
+	if err = mod.SetGoVersion("go1.21"); err == nil {
+		t.Fatal("SetGoVersion go1.21: no error?")
+	}
+	if err = mod.SetGoVersion("1.21"); err != nil {
+		t.Fatal("SetGoVersion 1.21:", err)
+	}
+	if v := mod.GoVersion(); v != "1.21" {
+		t.Fatal("GoVersion:", v)
+	}
+	mod.AddGoStmt("1.17")
+	if by, err := mod.SyncGoVersion(); err != nil || len(by) != 1 || by[0].Path != "golang.org/x/mod" {
+		t.Fatal("SyncGoVersion:", by, err)
+	}
+	if v := mod.GoVersion(); v != "1.18" {
+		t.Fatal("SyncGoVersion: GoVersion", v)
+	}
+	if by, err := mod.SyncGoVersion(); err != nil || by != nil {
+		t.Fatal("SyncGoVersion again:", by, err)
+	}
+	if compareGoVersion("1.21rc1", "1.21.0") >= 0 || compareGoVersion("1.9", "1.18") >= 0 {
+		t.Fatal("compareGoVersion")
+	}
+}
+
+func TestDepModsEx(t *testing.T) {
+	mod, err := Create("/foo/bar", "github.com/foo/bar", "", "")
+	if err != nil {
+		t.Fatal("Create failed:", err)
+	}
+	mod.AddRequire("github.com/foo/a", "v1.0.0", false)
+	mod.AddRequire("github.com/foo/b", "v1.0.0", false)
+	mod.AddReplace("github.com/foo/a", "", "../a", "")
+	mod.AddReplace("github.com/foo/b", "", "./b/../c", "")
+	deps := mod.DepModsEx(true)
+	if v := deps["github.com/foo/a"].Path; v != "../a" {
+		t.Fatal("DepModsEx:", v)
+	}
+	deps = mod.DepMods()
+	root := mod.Root()
+	if v := deps["github.com/foo/a"].Path; v != filepath.Join(filepath.Dir(root), "a") {
+		t.Fatal("DepMods a:", v)
+	}
+	if v := deps["github.com/foo/b"].Path; v != filepath.Join(root, "c") {
+		t.Fatal("DepMods b:", v)
+	}
+	if runtime.GOOS == "windows" {
+		if v := canonicalDir(`C:\foo\bar`, `..\a`); v != `C:\foo\a` {
+			t.Fatal("canonicalDir:", v)
+		}
+		if v := canonicalDir(`C:\foo\bar`, `D:\a`); v != `D:\a` {
+			t.Fatal("canonicalDir:", v)
+		}
+	} else {
+		if v := canonicalDir("/foo/bar", "/a/../b"); v != "/b" {
+			t.Fatal("canonicalDir:", v)
+		}
+	}
+	if !isRelPath(`..\a`) || !isRelPath(".") || isRelPath("/a") || isRelPath(".a") {
+		t.Fatal("isRelPath")
+	}
+}
+
+func TestGopModCompiler(t *testing.T) {
+	readFile := func(name string) ([]byte, error) {
+		switch name {
+		case "/foo/go.mod":
+			return []byte("module github.com/foo/bar\n\ngo 1.18 // tinygo 0.32\n"), nil
+		case "/foo/gop.mod":
+			return []byte("gop 1.2\n\ncompiler llgo 0.9\n"), nil
+		}
+		return nil, os.ErrNotExist
+	}
+	mod, err := LoadFromEx("/foo/go.mod", "/foo/gop.mod", readFile)
+	if err != nil {
+		t.Fatal("LoadFromEx:", err)
+	}
+	if cl := mod.Opt.Compiler; cl == nil || cl.Name != "llgo" {
+		t.Fatal("mod.Opt.Compiler:", cl)
+	}
+}
+
+func TestRequires(t *testing.T) {
+	mod, err := Create("/foo/bar", "github.com/foo/bar", "", "")
+	if err != nil {
+		t.Fatal("Create failed:", err)
+	}
+	mod.AddRequire("github.com/goplus/yap", "v0.7.2", true)
+	mod.AddRequire("github.com/qiniu/x", "v1.13.2", false)
+	if err = mod.SetRequireFlags("github.com/qiniu/y", true, false); err != ErrNotRequired {
+		t.Fatal("SetRequireFlags:", err)
+	}
+	mod.SetRequireFlags("github.com/goplus/yap", true, true)
+	mod.SetRequireFlags("github.com/qiniu/x", false, true)
+	b, err := mod.File.Format()
+	if err != nil {
+		t.Fatal("Format:", err)
+	}
+	if v := string(b); v != `module github.com/foo/bar
+
+go 1.18
+
+require (
+	github.com/goplus/yap v0.7.2 // indirect; gop:class
+	github.com/qiniu/x v1.13.2 //gop:class
+)
+` {
+		t.Fatal("SetRequireFlags:", v)
+	}
+	if v := mod.Opt.ClassMods; len(v) != 2 {
+		t.Fatal("mod.Opt.ClassMods:", v)
+	}
+
+	mod2, err := LoadFromEx("/foo/bar/go.mod", "", func(string) ([]byte, error) { return b, nil })
+	if err != nil {
+		t.Fatal("LoadFromEx:", err)
+	}
+	reqs := mod2.Requires()
+	if len(reqs) != 2 || !reqs[0].Indirect || !reqs[0].IsClass || reqs[1].Indirect || !reqs[1].IsClass {
+		t.Fatal("Requires:", reqs)
+	}
+	mod2.SetRequireFlags("github.com/goplus/yap", false, false)
+	if reqs = mod2.Requires(); reqs[0].Indirect || reqs[0].IsClass || len(mod2.Opt.ClassMods) != 1 {
+		t.Fatal("Requires:", reqs)
+	}
+
+	b = []byte("module github.com/foo/bar\n\nrequire github.com/qiniu/x v1.13.2 // gop:classfoo\n")
+	mod3, err := LoadFromEx("/foo/bar/go.mod", "", func(string) ([]byte, error) { return b, nil })
+	if err != nil {
+		t.Fatal("LoadFromEx:", err)
+	}
+	if reqs = mod3.Requires(); len(reqs) != 1 || reqs[0].IsClass {
+		t.Fatal("Requires gop:classfoo:", reqs)
+	}
+}
+
+func TestClone(t *testing.T) {
+	readFile := func(name string) ([]byte, error) {
+		switch name {
+		case "/foo/go.mod":
+			return []byte("module github.com/foo/bar\n\ngo 1.21\n\nrequire github.com/qiniu/x v1.13.2 // indirect\n"), nil
+		case "/foo/gop.mod":
+			return []byte("gop 1.2\n\nproject .gmx Game github.com/goplus/spx math\n\nclass .spx Sprite\n"), nil
+		}
+		return nil, os.ErrNotExist
+	}
+	mod, err := LoadFromEx("/foo/go.mod", "/foo/gop.mod", readFile)
+	if err != nil {
+		t.Fatal("LoadFromEx:", err)
+	}
+	old, _ := mod.File.Format()
+	cpy := mod.Clone()
+	if !cpy.HasGopMod() || cpy.Path() != "github.com/foo/bar" || len(cpy.Projects()) != 1 {
+		t.Fatal("Clone:", cpy.Path(), cpy.Projects())
+	}
+	cpy.AddRequire("github.com/goplus/yap", "v0.7.2", true)
+	cpy.SetRequireFlags("github.com/qiniu/x", false, true)
+	cpy.Opt.Projects[0].Works[0].Class = "Sprite2"
+	cpy.Opt.Projects[0].PkgPaths[1] = "fmt"
+	if b, _ := mod.File.Format(); string(b) != string(old) {
+		t.Fatal("Clone: original go.mod changed:", string(b))
+	}
+	if b, _ := cpy.File.Format(); string(b) == string(old) {
+		t.Fatal("Clone: go.mod of copy unchanged")
+	}
+	proj := mod.Opt.Projects[0]
+	if proj.Works[0].Class != "Sprite" || proj.PkgPaths[1] != "math" || len(mod.Opt.ClassMods) != 0 {
+		t.Fatal("Clone: original gop.mod changed:", proj.Works[0], proj.PkgPaths, mod.Opt.ClassMods)
+	}
+	if cpy.Opt.Projects[0].Syntax == proj.Syntax || cpy.Opt.Projects[0].Syntax == nil {
+		t.Fatal("Clone: syntax not copied")
+	}
+
+	projs := mod.Projects()
+	projs[0].PkgPaths[1] = "fmt"
+	projs[0].Works[0].Class = "Modified"
+	if proj.Works[0].Class != "Sprite" || proj.PkgPaths[1] != "math" || mod.Projects()[0].Works[0].Class != "Sprite" {
+		t.Fatal("Projects: not a copy:", proj.Works[0], proj.PkgPaths)
+	}
+	deps := Default.DepMods()
+	deps["example.com/foo"] = module.Version{Path: "example.com/foo", Version: "v1.0.0"}
+	if len(Default.DepMods()) != 0 || len(Default.Requires()) != 0 {
+		t.Fatal("Default: modified by accessors")
+	}
+
+	if def := NewDefault("1.21", "1.3"); def.File == Default.File || def.GoVersion() != "1.21" || def.Opt.Gop.Version != "1.3" {
+		t.Fatal("NewDefault:", def)
+	}
+	def := Default.Clone()
+	if def.File == Default.File || def.Opt == Default.Opt || def.Path() != Default.Path() {
+		t.Fatal("Clone Default:", def)
+	}
+}
+
+func TestMarkClass(t *testing.T) {
+	mod, err := Create("/foo/bar", "github.com/foo/bar", "", "")
+	if err != nil {
+		t.Fatal("Create failed:", err)
+	}
+	mod.AddRequire("github.com/goplus/yap", "v0.7.2", false)
+	if err = mod.MarkClass("github.com/qiniu/x"); err != ErrNotRequired {
+		t.Fatal("MarkClass:", err)
+	}
+	if err = mod.UnmarkClass("github.com/qiniu/x"); err != ErrNotRequired {
+		t.Fatal("UnmarkClass:", err)
+	}
+	if err = mod.MarkClass("github.com/goplus/yap"); err != nil {
+		t.Fatal("MarkClass:", err)
+	}
+	mod.MarkClass("github.com/goplus/yap")
+	if v := mod.Opt.ClassMods; len(v) != 1 || v[0] != "github.com/goplus/yap" {
+		t.Fatal("MarkClass ClassMods:", v)
+	}
+	if reqs := mod.Requires(); !reqs[0].IsClass || reqs[0].Indirect {
+		t.Fatal("MarkClass:", reqs)
+	}
+	if b, err := mod.GoOnlyModfile(); err != nil || strings.Contains(string(b), "gop:class") {
+		t.Fatal("GoOnlyModfile:", string(b), err)
+	}
+	mod.AddRequire("github.com/goplus/spx", "v1.0.0", true)
+	held := mod.Opt.ClassMods
+	if err = mod.UnmarkClass("github.com/goplus/yap"); err != nil {
+		t.Fatal("UnmarkClass:", err)
+	}
+	if reqs := mod.Requires(); reqs[0].IsClass || len(mod.Opt.ClassMods) != 1 || mod.Opt.ClassMods[0] != "github.com/goplus/spx" {
+		t.Fatal("UnmarkClass:", reqs, mod.Opt.ClassMods)
+	}
+	if len(held) != 2 || held[0] != "github.com/goplus/yap" || held[1] != "github.com/goplus/spx" {
+		t.Fatal("UnmarkClass: ClassMods held by caller changed", held)
+	}
+}
+
+func TestUpdateRequire(t *testing.T) {
+	mod, err := Create("/foo/bar", "github.com/foo/bar", defaultGoVer, defaultGopVer)
+	if err != nil {
+		t.Fatal("Create failed:", err)
+	}
+	steps := []struct {
+		vers   string
+		force  bool
+		action RequireAction
+		want   string
+	}{
+		{"v0.7.2", false, RequireAdded, "v0.7.2"},
+		{"v0.7.2", false, RequireUnchanged, "v0.7.2"},
+		{"v0.8.0", false, RequireUpgraded, "v0.8.0"},
+		{"v0.7.2", false, RequireUnchanged, "v0.8.0"},
+		{"v0.7.2", true, RequireDowngraded, "v0.7.2"},
+	}
+	for _, step := range steps {
+		action, err := mod.UpdateRequire("github.com/goplus/yap", step.vers, true, false, step.force)
+		if err != nil || action != step.action {
+			t.Fatal("UpdateRequire:", step.vers, action, err)
+		}
+		if reqs := mod.Requires(); len(reqs) != 1 || reqs[0].Mod.Version != step.want || !reqs[0].IsClass {
+			t.Fatal("UpdateRequire:", step.vers, reqs)
+		}
+	}
+	if err = mod.AddRequire("github.com/goplus/yap", "v0.5.0", false); err != nil {
+		t.Fatal("AddRequire:", err)
+	}
+	if reqs := mod.Requires(); reqs[0].Mod.Version != "v0.7.2" {
+		t.Fatal("AddRequire downgraded:", reqs)
+	}
+	if v := RequireUpgraded.String(); v != "upgraded" {
+		t.Fatal("RequireAction.String:", v)
+	}
+	if v := RequireAction(100).String(); v != "RequireAction(100)" {
+		t.Fatal("RequireAction.String:", v)
+	}
+}
+
+func TestSyncProjectRequires(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "go.mod"), []byte(`module github.com/foo/bar
+
+go 1.18
+
+require github.com/goplus/spx/v2 v2.0.0
+`), 0666)
+	os.WriteFile(filepath.Join(dir, "gop.mod"), []byte(`gop 1.2
+
+project .spx Game github.com/goplus/spx/v2/game@v2.1.0 math
+
+project _yap.gox App github.com/goplus/yap@v0.8.0
+`), 0666)
+	mod, err := Load(dir)
+	if err != nil {
+		t.Fatal("Load:", err)
+	}
+	if err = mod.Save(); err != nil {
+		t.Fatal("Save:", err)
+	}
+	if b, _ := os.ReadFile(filepath.Join(dir, "go.mod")); !strings.Contains(string(b), "require github.com/goplus/spx/v2 v2.0.0\n") {
+		t.Fatal("Save synced requires:", string(b))
+	}
+	changed, err := mod.SyncProjectRequires()
+	if err != nil || len(changed) != 2 || changed[0].String() != "github.com/goplus/spx/v2@v2.1.0" ||
+		changed[1].String() != "github.com/goplus/yap@v0.8.0" {
+		t.Fatal("SyncProjectRequires:", changed, err)
+	}
+	if changed, err = mod.SyncProjectRequires(); err != nil || changed != nil {
+		t.Fatal("SyncProjectRequires again:", changed, err)
+	}
+	if err = mod.Save(); err != nil {
+		t.Fatal("Save:", err)
+	}
+	b, _ := os.ReadFile(filepath.Join(dir, "go.mod"))
+	if v := string(b); v != `module github.com/foo/bar
+
+go 1.18
+
+require (
+	github.com/goplus/spx/v2 v2.1.0
+	github.com/goplus/yap v0.8.0
+)
+` {
+		t.Fatal("go.mod:", v)
+	}
+	mod.Opt.Projects[1].PkgRefs[0] = modfile.PkgRef{Path: "github.com/goplus/gsh", Version: "v2.0.0"}
+	if _, err = mod.SyncProjectRequires(); err == nil {
+		t.Fatal("SyncProjectRequires: no error for invalid module version")
+	}
+}
+
+func TestAddRequireSum(t *testing.T) {
+	cache := modcache.GOMODCACHE
+	defer func() {
+		modcache.GOMODCACHE = cache
+	}()
+	modcache.GOMODCACHE = t.TempDir()
+	download := filepath.Join(modcache.GOMODCACHE, "cache", "download", "example.com", "foo", "@v")
+	os.MkdirAll(download, 0777)
+	os.WriteFile(filepath.Join(download, "v1.0.0.ziphash"), []byte("h1:zip=\n"), 0666)
+	os.WriteFile(filepath.Join(download, "v1.0.0.mod"), []byte("module example.com/foo\n"), 0666)
+
+	dir := t.TempDir()
+	mod, err := Create(dir, "github.com/foo/bar", "", "")
+	if err != nil {
+		t.Fatal("Create:", err)
+	}
+	if err = mod.AddRequire("example.com/foo", "v1.0.0", false, true); err != nil {
+		t.Fatal("AddRequire noSum:", err)
+	}
+	if _, err = os.Stat(filepath.Join(dir, "go.sum")); !os.IsNotExist(err) {
+		t.Fatal("AddRequire noSum changed go.sum:", err)
+	}
+	if err = mod.AddRequire("example.com/foo", "v1.0.0", false); err != nil {
+		t.Fatal("AddRequire:", err)
+	}
+	b, err := os.ReadFile(filepath.Join(dir, "go.sum"))
+	if err != nil {
+		t.Fatal("ReadFile:", err)
+	}
+	if v := string(b); v != `example.com/foo v1.0.0 h1:zip=
+example.com/foo v1.0.0/go.mod h1:tJ2YS1a8pyA3nrypRdbsq6Ias2I/0YUVbjNBUoLstcw=
+` {
+		t.Fatal("go.sum:", v)
+	}
+	if err = mod.AddRequire("example.com/foo", "v1.0.0", false); err != nil {
+		t.Fatal("AddRequire again:", err)
+	}
+	if b2, _ := os.ReadFile(filepath.Join(dir, "go.sum")); string(b2) != string(b) {
+		t.Fatal("go.sum:", string(b2))
+	}
+}
+
+func TestVerifySums(t *testing.T) {
+	cache := modcache.GOMODCACHE
+	defer func() {
+		modcache.GOMODCACHE = cache
+	}()
+	modcache.GOMODCACHE = t.TempDir()
+	download := filepath.Join(modcache.GOMODCACHE, "cache", "download", "example.com", "foo", "@v")
+	os.MkdirAll(download, 0777)
+	os.WriteFile(filepath.Join(download, "v1.0.0.ziphash"), []byte("h1:zip=\n"), 0666)
+	os.WriteFile(filepath.Join(download, "v1.0.0.mod"), []byte("module example.com/foo\n"), 0666)
+
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "go.mod"), []byte(`module github.com/foo/bar
+
+go 1.18
+
+require (
+	example.com/foo v1.0.0
+	example.com/bar v1.2.0 // indirect
+	example.com/baz v1.0.0
+	example.com/local v1.0.0
+)
+
+replace example.com/baz => example.com/baz2 v1.1.0
+
+replace example.com/local => ../local
+`), 0666)
+	os.WriteFile(filepath.Join(dir, "go.sum"), []byte(`example.com/bar v1.2.0/go.mod h1:bar=
+example.com/baz2 v1.1.0 h1:baz=
+example.com/foo v1.0.0 h1:bad=
+example.com/foo v1.0.0/go.mod h1:tJ2YS1a8pyA3nrypRdbsq6Ias2I/0YUVbjNBUoLstcw=
+`), 0666)
+	mod, err := Load(dir)
+	if err != nil {
+		t.Fatal("Load:", err)
+	}
+	ret, err := mod.VerifySums()
+	if err != nil || ret.OK() || len(ret.Mods) != 3 || ret.Mods[2].String() != "example.com/baz2@v1.1.0" {
+		t.Fatal("VerifySums:", ret, err)
+	}
+	var problems []string
+	for _, p := range ret.Problems {
+		problems = append(problems, p.String())
+	}
+	if v := strings.Join(problems, "\n"); v != `example.com/foo v1.0.0: checksum mismatch
+	go.sum:     h1:bad=
+	downloaded: h1:zip=
+example.com/baz2 v1.1.0/go.mod: missing go.sum entry` {
+		t.Fatal("VerifySums:", v)
+	}
+
+	os.WriteFile(filepath.Join(dir, "go.sum"), []byte(`example.com/bar v1.2.0/go.mod h1:bar=
+example.com/baz2 v1.1.0 h1:baz=
+example.com/baz2 v1.1.0/go.mod h1:baz=
+example.com/foo v1.0.0 h1:zip=
+example.com/foo v1.0.0/go.mod h1:tJ2YS1a8pyA3nrypRdbsq6Ias2I/0YUVbjNBUoLstcw=
+`), 0666)
+	if ret, err = mod.VerifySums(); err != nil || !ret.OK() {
+		t.Fatal("VerifySums:", ret.Problems, err)
+	}
+}
+
+func TestCheckConsistency(t *testing.T) {
+	cache := modcache.GOMODCACHE
+	defer func() {
+		modcache.GOMODCACHE = cache
+	}()
+	modcache.GOMODCACHE = t.TempDir()
+	cls := filepath.Join(modcache.GOMODCACHE, "example.com", "cls@v1.0.0")
+	os.MkdirAll(cls, 0777)
+	os.WriteFile(filepath.Join(cls, "go.mod"), []byte("module example.com/cls\n"), 0666)
+	os.WriteFile(filepath.Join(cls, "gop.mod"), []byte("gop 1.2\n\nproject .gmx Game example.com/cls\n"), 0666)
+
+	readFile := func(name string) ([]byte, error) {
+		switch name {
+		case "/foo/go.mod":
+			return []byte(`module github.com/foo/bar
+
+go 1.18
+
+require (
+	example.com/cls v1.0.0
+	example.com/other v1.0.0
+)
+`), nil
+		case "/foo/gop.mod":
+			return []byte(`gop 1.3
+
+project .gmx Game example.com/cls github.com/foo/bar/util math
+
+import example.com/missing/pkg
+`), nil
+		}
+		return nil, os.ErrNotExist
+	}
+	mod, err := LoadFromEx("/foo/go.mod", "/foo/gop.mod", readFile)
+	if err != nil {
+		t.Fatal("LoadFromEx:", err)
+	}
+	findings := mod.CheckConsistency()
+	if len(findings) != 3 {
+		t.Fatal("CheckConsistency:", findings)
+	}
+	if f := findings[0]; f.Kind != FindingGoVersion || f.String() != "/foo/go.mod:3: go 1.18 is lower than go 1.19 required by gop 1.3" {
+		t.Fatal("CheckConsistency:", f)
+	}
+	if f := findings[1]; f.Kind != FindingClassMarker || f.Mod != "example.com/cls" || f.Pos.Line != 6 {
+		t.Fatal("CheckConsistency:", f)
+	}
+	if f := findings[2]; f.Kind != FindingMissingRequire || f.Mod != "example.com/missing/pkg" || f.File != "/foo/gop.mod" {
+		t.Fatal("CheckConsistency:", f)
+	}
+
+	mod.MarkClass("example.com/cls")
+	mod.SetGoVersion("1.21")
+	mod.AddRequire("example.com/missing", "v1.0.0", false)
+	if findings = mod.CheckConsistency(); findings != nil {
+		t.Fatal("CheckConsistency:", findings)
+	}
+}
+
+func TestMinGoVersion(t *testing.T) {
+	for gopVer, want := range map[string]string{
+		"1.2":    "1.18",
+		"1.2.0":  "1.18",
+		"1.3.1":  "1.19",
+		"v1.3.0": "1.19",
+		"1.9":    "",
+		"bad":    "",
+		"":       "",
+	} {
+		if min, ok := minGoVersion(gopVer); min != want || ok != (want != "") {
+			t.Fatal("minGoVersion:", gopVer, min, ok)
+		}
+	}
+
+	mod := CreateInMemory("github.com/foo/bar", "1.18", "1.3.1")
+	findings := mod.CheckConsistency()
+	if len(findings) != 1 || findings[0].Kind != FindingGoVersion ||
+		findings[0].Msg != "go 1.18 is lower than go 1.19 required by gop 1.3.1" {
+		t.Fatal("CheckConsistency gop 1.3.1:", findings)
+	}
+}
+
+func TestExclude(t *testing.T) {
+	mod, err := Create("/foo/bar", "github.com/foo/bar", "", "")
+	if err != nil {
+		t.Fatal("Create failed:", err)
+	}
+	mod.AddRequire("github.com/foo/a", "v1.0.0", false)
+	mod.AddRequire("github.com/foo/b", "v1.0.0", false)
+	if err = mod.AddExclude("github.com/foo/a", "v1.0.0"); err != nil {
+		t.Fatal("AddExclude:", err)
+	}
+	mod.AddExclude("github.com/foo/b", "v0.9.0")
+	if err = mod.AddExclude("github.com/foo/c", "latest"); err == nil {
+		t.Fatal("AddExclude: no error?")
+	}
+	deps := mod.DepMods()
+	if _, ok := deps["github.com/foo/a"]; ok || len(deps) != 1 {
+		t.Fatal("DepMods:", deps)
+	}
+	if err = mod.DropExclude("github.com/foo/a", "v1.0.0"); err != nil {
+		t.Fatal("DropExclude:", err)
+	}
+	if deps = mod.DepMods(); len(deps) != 2 {
+		t.Fatal("DepMods:", deps)
+	}
+	b, err := mod.File.Format()
+	if err != nil {
+		t.Fatal("Format:", err)
+	}
+	if v := string(b); v != `module github.com/foo/bar
+
+go 1.18
+
+require (
+	github.com/foo/a v1.0.0
+	github.com/foo/b v1.0.0
+)
+
+exclude github.com/foo/b v0.9.0
+` {
+		t.Fatal("Format:", v)
+	}
+}
+
+func TestLoadOverlay(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "go.mod"), []byte("module example.com/foo\n\ngo 1.18\n"), 0666)
+	sub := filepath.Join(dir, "sub")
+	overlay := Overlay{
+		filepath.Join(sub, "go.mod"):  []byte("module example.com/bar\n\ngo 1.21\n"),
+		filepath.Join(sub, "gop.mod"): []byte("gop 1.2\n\nproject .gmx Game example.com/bar\n"),
+	}
+	mod, err := LoadOverlay(filepath.Join(sub, "a", "b"), overlay)
+	if err != nil {
+		t.Fatal("LoadOverlay:", err)
+	}
+	if mod.Path() != "example.com/bar" || mod.Go.Version != "1.21" || !mod.HasGopMod() || len(mod.Projects()) != 1 {
+		t.Fatal("LoadOverlay:", mod.Path(), mod.Projects())
+	}
+	if err = mod.Save(); err != ErrSaveOverlay {
+		t.Fatal("Save:", err)
+	}
+	if mod, err = LoadOverlay(dir, nil); err != nil || mod.Path() != "example.com/foo" {
+		t.Fatal("LoadOverlay:", mod.Path(), err)
+	}
+	if err = mod.Save(); err != ErrSaveOverlay {
+		t.Fatal("Save:", err)
+	}
+}
+
+func TestLoadOverlayFingerprint(t *testing.T) {
+	t.Setenv("GOWORK", "off")
+	gomod := []byte("module example.com/foo\n\ngo 1.18\n")
+	gosum := []byte("example.com/bar v1.0.0/go.mod h1:Kq4oqY2fYzNVtWS2yixnJ1wa7aR8j3ZZ6cR+x9ZygIw=\n")
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "go.mod"), gomod, 0666)
+	os.WriteFile(filepath.Join(dir, "go.sum"), nil, 0666)
+	mod, err := LoadOverlay(dir, Overlay{filepath.Join(dir, "go.sum"): gosum})
+	if err != nil {
+		t.Fatal("LoadOverlay:", err)
+	}
+	disk := t.TempDir()
+	os.WriteFile(filepath.Join(disk, "go.mod"), gomod, 0666)
+	os.WriteFile(filepath.Join(disk, "go.sum"), gosum, 0666)
+	want, err := Load(disk)
+	if err != nil {
+		t.Fatal("Load:", err)
+	}
+	if fp := mod.Fingerprint(); fp == "" || fp != want.Fingerprint() {
+		t.Fatal("Fingerprint:", fp, want.Fingerprint())
+	}
+}
+
+func TestSaveWithDeps(t *testing.T) {
+	cache := modcache.GOMODCACHE
+	defer func() {
+		modcache.GOMODCACHE = cache
+	}()
+	modcache.GOMODCACHE = t.TempDir()
+	download := filepath.Join(modcache.GOMODCACHE, "cache", "download", "example.com", "foo", "@v")
+	os.MkdirAll(download, 0777)
+	os.WriteFile(filepath.Join(download, "v1.0.0.ziphash"), []byte("h1:zip=\n"), 0666)
+	os.WriteFile(filepath.Join(download, "v1.0.0.mod"), []byte("module example.com/foo\n"), 0666)
+
+	dir := t.TempDir()
+	mod, err := Create(dir, "github.com/foo/bar", "1.18", "")
+	if err != nil {
+		t.Fatal("Create:", err)
+	}
+	mod.File.AddRequire("example.com/rt", "v1.2.0")
+	deps := []module.Version{
+		{Path: "example.com/foo", Version: "v1.0.0"},
+		{Path: "example.com/llgo", Version: "v0.9.0"},
+		{Path: "example.com/rt", Version: "v1.1.0"}, // older than the required one
+	}
+	if err = mod.SaveWithDeps(deps, map[string]string{"example.com/llgo": "/llgo"}); err != nil {
+		t.Fatal("SaveWithDeps:", err)
+	}
+	b, err := os.ReadFile(filepath.Join(dir, "go.mod"))
+	if err != nil {
+		t.Fatal("ReadFile:", err)
+	}
+	if v := string(b); v != `module github.com/foo/bar
+
+go 1.18
+
+require (
+	example.com/rt v1.2.0
+	example.com/foo v1.0.0
+	example.com/llgo v0.9.0
+)
+` {
+		t.Fatal("go.mod:", v)
+	}
+	if b, _ = os.ReadFile(filepath.Join(dir, "go.sum")); len(b) == 0 {
+		t.Fatal("go.sum: empty")
+	}
+	if b, _ = os.ReadFile(filepath.Join(dir, "go.work")); string(b) != `go 1.18
+
+use .
+
+replace example.com/llgo v0.9.0 => /llgo
+` {
+		t.Fatal("go.work:", string(b))
+	}
+}
+
+func TestStaleWorkReplace(t *testing.T) {
+	dir := t.TempDir()
+	newRoot := filepath.Join(dir, "gop-new")
+	os.MkdirAll(newRoot, 0777)
+	os.WriteFile(filepath.Join(newRoot, "go.mod"), []byte("module github.com/goplus/gop\n"), 0666)
+	modDir := filepath.Join(dir, "foo")
+	mod, err := Create(modDir, "github.com/foo/bar", "1.18", "")
+	if err != nil {
+		t.Fatal("Create:", err)
+	}
+	mod.File.AddRequire(gopMod, "v1.2.0")
+	os.MkdirAll(modDir, 0777)
+	os.WriteFile(filepath.Join(modDir, "go.work"), []byte(`go 1.18
+
+use .
+
+replace github.com/goplus/gop v1.2.0 => /nonexist/gop-old
+
+replace example.com/foo v0.1.0 => ../gop-new
+
+replace example.com/bar => ../bar
+`), 0666)
+	err = mod.updateWorkfile(workReplace{
+		Old: module.Version{Path: gopMod, Version: "v1.2.0"},
+		New: module.Version{Path: newRoot},
+	})
+	if err != nil {
+		t.Fatal("updateWorkfile:", err)
+	}
+	b, _ := os.ReadFile(filepath.Join(modDir, "go.work"))
+	if v := string(b); !strings.Contains(v, "replace github.com/goplus/gop v1.2.0 => "+newRoot) || strings.Contains(v, "gop-old") {
+		t.Fatal("updateWorkfile: stale replace not rewritten", v)
+	}
+	if err = mod.PruneWorkReplace(); err != nil {
+		t.Fatal("PruneWorkReplace:", err)
+	}
+	b, _ = os.ReadFile(filepath.Join(modDir, "go.work"))
+	if v := string(b); !strings.Contains(v, "example.com/foo v0.1.0") || strings.Contains(v, "example.com/bar") {
+		t.Fatal("PruneWorkReplace:", v)
+	}
+	if err = mod.DropWorkReplace(gopMod); err != nil {
+		t.Fatal("DropWorkReplace:", err)
+	}
+	b, _ = os.ReadFile(filepath.Join(modDir, "go.work"))
+	if v := string(b); v != `go 1.18
+
+use .
+
+replace example.com/foo v0.1.0 => ../gop-new
+` {
+		t.Fatal("DropWorkReplace:", v)
+	}
+}
+
+func TestEmbeddedGopMod(t *testing.T) {
+	dir := t.TempDir()
+	gomod := filepath.Join(dir, "go.mod")
+	os.WriteFile(gomod, []byte(`module example.com/foo
+
+go 1.18
+
+//gop:begin
+// gop 1.2
+// project .gmx Game github.com/goplus/spx
+//gop:end
+`), 0666)
+	mod, err := Load(dir)
+	if err != nil {
+		t.Fatal("Load:", err)
+	}
+	if !mod.HasGopMod() || len(mod.Projects()) != 1 {
+		t.Fatal("Load:", mod.Projects())
+	}
+	mod.Opt.Projects[0].Syntax.Token[2] = "Game2"
+	mod.File.AddRequire("github.com/goplus/spx", "v1.0.0")
+	if err = mod.Save(); err != nil {
+		t.Fatal("Save:", err)
+	}
+	if _, err = os.Stat(filepath.Join(dir, "gop.mod")); !os.IsNotExist(err) {
+		t.Fatal("Save: gop.mod is written")
+	}
+	if b, _ := os.ReadFile(gomod); string(b) != `module example.com/foo
+
+go 1.18
+
+//gop:begin
+// gop 1.2
+//
+// project .gmx Game2 github.com/goplus/spx
+//gop:end
+
+require github.com/goplus/spx v1.0.0
+` {
+		t.Fatal("Save:", string(b))
+	}
+}
+
+func TestMarshalJSON(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "go.mod"), []byte(`module example.com/foo
+
+go 1.21
+
+require (
+	github.com/goplus/yap v0.8.0 //gop:class
+	github.com/qiniu/x v1.13.0 // indirect
+)
+
+replace github.com/qiniu/x => ../x
+`), 0666)
+	os.WriteFile(filepath.Join(dir, "gop.mod"), []byte(`gop 1.2
+
+compiler llgo 0.9
+
+project .gmx Game github.com/goplus/spx math
+class -embed .spx Sprite "A sprite"
+import gdi github.com/goplus/spx/pkg/gdi
+runner github.com/goplus/spx/cmd/spxrun ^v1.0.0
+`), 0666)
+	mod, err := Load(dir)
+	if err != nil {
+		t.Fatal("Load:", err)
+	}
+	b, err := json.Marshal(mod)
+	if err != nil {
+		t.Fatal("json.Marshal:", err)
+	}
+	if v := string(b); v != `{"Module":"example.com/foo","Go":"1.21","Gop":"1.2","Compiler":{"Name":"llgo","Version":"0.9"},`+
+		`"Require":[{"Path":"github.com/goplus/yap","Version":"v0.8.0","Class":true},{"Path":"github.com/qiniu/x","Version":"v1.13.0","Indirect":true}],`+
+		`"Replace":[{"Old":{"Path":"github.com/qiniu/x"},"New":{"Path":"../x"}}],`+
+		`"Projects":[{"Ext":".gmx","Class":"Game","PkgPaths":["github.com/goplus/spx","math"],`+
+		`"Works":[{"Ext":".spx","Class":"Sprite","Embedded":true,"Doc":"A sprite"}],`+
+		`"Import":[{"Name":"gdi","Path":"github.com/goplus/spx/pkg/gdi"}],`+
+		`"Runner":{"Path":"github.com/goplus/spx/cmd/spxrun","Version":"^v1.0.0"}}]}` {
+		t.Fatal("json.Marshal:", v)
+	}
+}
+
+func TestMarshalJSONRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "go.mod"), []byte("module example.com/foo\n\ngo 1.21\n"), 0666)
+	os.WriteFile(filepath.Join(dir, "spx.gopmod"), []byte("import github.com/goplus/spx/pkg/gdi\n"), 0666)
+	os.WriteFile(filepath.Join(dir, "gop.mod"), []byte(`gop 1.3
+
+//gop:generate spxgen ./assets
+project -tags=js,wasm -exclude=*_gen.spx .gmx Game github.com/goplus/spx@v1.0.0 math
+class -tags=wasm .spx Sprite
+include ./spx.gopmod
+
+x-assets ./assets
+`), 0666)
+	mod, err := Load(dir)
+	if err != nil {
+		t.Fatal("Load:", err)
+	}
+	b, err := json.Marshal(mod)
+	if err != nil {
+		t.Fatal("json.Marshal:", err)
+	}
+	var ret ModuleJSON
+	if err = json.Unmarshal(b, &ret); err != nil {
+		t.Fatal("json.Unmarshal:", err)
+	}
+	if !reflect.DeepEqual(&ret, mod.JSON()) {
+		t.Fatal("round trip:", string(b))
+	}
+	if len(ret.Projects) != 1 {
+		t.Fatal("Projects:", ret.Projects)
+	}
+	proj := ret.Projects[0]
+	if strings.Join(proj.Tags, ",") != "js,wasm" || strings.Join(proj.Excludes, ",") != "*_gen.spx" ||
+		len(proj.Works) != 1 || strings.Join(proj.Works[0].Tags, ",") != "wasm" ||
+		len(proj.Import) != 1 || proj.Import[0].Path != "github.com/goplus/spx/pkg/gdi" {
+		t.Fatal("Projects:", proj)
+	}
+	if !reflect.DeepEqual(proj.PkgRefs, []PkgRefJSON{{Path: "github.com/goplus/spx", Version: "v1.0.0"}, {Path: "math"}}) {
+		t.Fatal("PkgRefs:", proj.PkgRefs)
+	}
+	if len(ret.Includes) != 1 || ret.Includes[0].Path != "./spx.gopmod" || ret.Includes[0].File != filepath.Join(dir, "spx.gopmod") {
+		t.Fatal("Includes:", ret.Includes)
+	}
+	if len(ret.Extensions) != 1 || ret.Extensions[0].Verb != "x-assets" || strings.Join(ret.Extensions[0].Args, " ") != "./assets" {
+		t.Fatal("Extensions:", ret.Extensions)
+	}
+	if len(ret.Generates) != 1 || ret.Generates[0].Command != "spxgen" || ret.Generates[0].Line != 3 {
+		t.Fatal("Generates:", ret.Generates)
+	}
+}
+
+func TestCreateInMemory(t *testing.T) {
+	mod := CreateInMemory("example.com/foo", "", "")
+	if mod.Path() != "example.com/foo" || mod.Go.Version != defaultGoVer || mod.Opt.Gop.Version != defaultGopVer {
+		t.Fatal("CreateInMemory:", mod.Path())
+	}
+	if mod.Modfile() != "" {
+		t.Fatal("CreateInMemory: Modfile", mod.Modfile())
+	}
+	if err := mod.Save(); err != ErrSaveDefault {
+		t.Fatal("Save:", err)
+	}
+	mod.Opt.Projects = append(mod.Opt.Projects, spxProject)
+	dir := t.TempDir()
+	if err := mod.SaveTo(dir); err != nil {
+		t.Fatal("SaveTo:", err)
+	}
+	if mod.Modfile() != filepath.Join(dir, "go.mod") {
+		t.Fatal("SaveTo: Modfile", mod.Modfile())
+	}
+	loaded, err := Load(dir)
+	if err != nil || loaded.Path() != "example.com/foo" || !loaded.HasGopMod() {
+		t.Fatal("Load:", err)
+	}
+	if err = Default.SaveTo(dir); err != ErrSaveDefault {
+		t.Fatal("Default.SaveTo:", err)
+	}
+}
+
+func TestModfileName(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "go.mod"), []byte("module example.com/foo\n"), 0666)
+	m, err := Load(dir)
+	if err != nil || m.ModfileName() != "" {
+		t.Fatal("Load:", m.ModfileName(), err)
+	}
+	os.WriteFile(filepath.Join(dir, "gop.mod"), []byte("gop 1.2\n"), 0666)
+	if m, err = Load(dir); err != nil || m.ModfileName() != "gop.mod" {
+		t.Fatal("Load gop.mod:", m.ModfileName(), err)
+	}
+	os.WriteFile(filepath.Join(dir, "gox.mod"), []byte("gop 1.3\n"), 0666)
+	if m, err = Load(dir); err != nil || m.ModfileName() != "gox.mod" || m.Opt.Gop.Version != "1.3" {
+		t.Fatal("Load gox.mod:", m.ModfileName(), err)
+	}
+	if m, err = LoadFrom(filepath.Join(dir, "go.mod"), filepath.Join(dir, "gop.mod")); err != nil || m.ModfileName() != "gop.mod" {
+		t.Fatal("LoadFrom gop.mod:", m.ModfileName(), err)
+	}
+	if m.Opt.Gop.Version != "1.2" {
+		t.Fatal("LoadFrom gop.mod: gop", m.Opt.Gop.Version)
+	}
+	os.Rename(filepath.Join(dir, "gop.mod"), filepath.Join(dir, "gop.mod.bak"))
+	if m, err = LoadFrom(filepath.Join(dir, "go.mod"), filepath.Join(dir, "gop.mod")); err != nil || m.ModfileName() != "gox.mod" {
+		t.Fatal("LoadFrom gox.mod fallback:", m.ModfileName(), err)
+	}
+	if v := mod.ModfileCandidates(filepath.Join(dir, "gop.mod")); len(v) != 2 || v[0] != filepath.Join(dir, "gop.mod") || v[1] != filepath.Join(dir, "gox.mod") {
+		t.Fatal("ModfileCandidates:", v)
+	}
+	if v := mod.ModfileCandidates(filepath.Join(dir, "x.mod")); len(v) != 1 {
+		t.Fatal("ModfileCandidates:", v)
+	}
+	names := mod.ModfileNames()
+	names[0] = "x.mod"
+	if mod.IsModfileName("x.mod") || mod.ModfileNames()[0] != "gox.mod" {
+		t.Fatal("ModfileNames: shared slice")
+	}
+	if file, err := mod.GOPMOD(dir); err != nil || file != filepath.Join(dir, "gox.mod") {
+		t.Fatal("GOPMOD:", file, err)
+	}
+	if _, err = Create(dir, "example.com/bar", "", ""); err == nil {
+		t.Fatal("Create: no error")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "sub"), 0777)
+	os.WriteFile(filepath.Join(dir, "sub", "go.mod"), []byte("module example.com/sub\n"), 0666)
+	gomod := filepath.Join(dir, "go.mod")
+	os.WriteFile(gomod, []byte(`module example.com/foo
+
+go 1.18
+
+require example.com/foo v1.0.0
+
+replace (
+	example.com/foo => ../foo
+	example.com/self => ./
+	example.com/sub => ./sub
+	example.com/missing => ./missing
+	example.com/a => example.com/b v1.0.0
+	example.com/b => example.com/c v1.0.0
+	example.com/c => example.com/a v1.0.0
+	example.com/d => example.com/a v1.0.0
+	example.com/e => example.com/foo v1.0.0
+)
+`), 0666)
+	m, err := LoadFrom(gomod, "")
+	if err != nil {
+		t.Fatal("LoadFrom:", err)
+	}
+	var ret []string
+	for _, f := range m.Validate() {
+		ret = append(ret, fmt.Sprint(f.Kind, " ", f.Pos.Line, " ", f.Msg))
+	}
+	if got := strings.Join(ret, "\n"); got != `4 5 module example.com/foo requires itself
+5 8 module example.com/foo replaces itself
+5 9 example.com/self is replaced with module example.com/foo itself
+7 11 replacement directory ./missing of example.com/missing doesn't contain a go.mod file
+5 16 example.com/e is replaced with module example.com/foo itself
+6 12 replacements form a cycle: example.com/a => example.com/b => example.com/c => example.com/a` {
+		t.Fatal("Validate:\n" + got)
+	}
+	if findings := Default.Validate(); findings != nil {
+		t.Fatal("Default.Validate:", findings)
+	}
+}
+
+func TestClassfileStmt(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "go.mod"), []byte(`module example.com/foo
+
+go 1.18
+
+require github.com/goplus/spx v1.0.0
+`), 0666)
+	os.WriteFile(filepath.Join(dir, "gop.mod"), []byte(`gop 1.2
+
+classfile github.com/goplus/yap v0.8.0
+classfile github.com/goplus/spx v1.1.0
+`), 0666)
+	m, err := Load(dir)
+	if err != nil {
+		t.Fatal("Load:", err)
+	}
+	if v := strings.Join(m.Opt.ClassMods, " "); v != "github.com/goplus/yap github.com/goplus/spx" {
+		t.Fatal("ClassMods:", v)
+	}
+	deps := m.DepMods()
+	if deps["github.com/goplus/yap"].Version != "v0.8.0" || deps["github.com/goplus/spx"].Version != "v1.1.0" {
+		t.Fatal("DepMods:", deps)
+	}
+	if err = m.UnmarkClass("github.com/goplus/spx"); err != nil || len(m.Opt.ClassMods) != 2 {
+		t.Fatal("UnmarkClass:", m.Opt.ClassMods, err)
+	}
+	if js := m.JSON(); len(js.Classfiles) != 2 {
+		t.Fatal("JSON:", js.Classfiles)
+	}
+}
+
+func TestWork(t *testing.T) {
+	root := t.TempDir()
+	dir := filepath.Join(root, "foo")
+	for _, name := range []string{"foo", "bar", "baz"} {
+		os.MkdirAll(filepath.Join(root, name), 0777)
+		os.WriteFile(filepath.Join(root, name, "go.mod"), []byte("module example.com/"+name+"\n\ngo 1.18\n"), 0666)
+	}
+	os.WriteFile(filepath.Join(dir, "go.mod"), []byte(`module example.com/foo
+
+go 1.18
+
+replace (
+	example.com/bar => ../bar
+	example.com/baz => ../baz
+	example.com/missing => ../missing
+)
+`), 0666)
+	m, err := Load(dir)
+	if err != nil {
+		t.Fatal("Load:", err)
+	}
+	if err = m.InitWork("../bar"); err != nil {
+		t.Fatal("InitWork:", err)
+	}
+	if err = m.InitWork(); errors.Err(err) != ErrWorkExists {
+		t.Fatal("InitWork again:", err)
+	}
+	if err = m.SyncWork(); err != nil {
+		t.Fatal("SyncWork:", err)
+	}
+	b, _ := os.ReadFile(filepath.Join(dir, "go.work"))
+	if string(b) != `go 1.18
+
+use (
+	.
+	../bar
+	../baz
+)
+` {
+		t.Fatal("SyncWork:", string(b))
+	}
+}
+
+func TestWorkEnv(t *testing.T) {
+	root := t.TempDir()
+	dir := filepath.Join(root, "foo")
+	for _, name := range []string{"foo", "bar", "baz", "ws"} {
+		os.MkdirAll(filepath.Join(root, name), 0777)
+		os.WriteFile(filepath.Join(root, name, "go.mod"), []byte("module example.com/"+name+"\n\ngo 1.18\n"), 0666)
+	}
+	os.WriteFile(filepath.Join(dir, "go.mod"), []byte("module example.com/foo\n\ngo 1.18\n\nreplace example.com/baz => ../baz\n"), 0666)
+	m, err := Load(dir)
+	if err != nil {
+		t.Fatal("Load:", err)
+	}
+	if ws := m.Workspace(); ws.Mode != WorkAuto || ws.File != filepath.Join(dir, "go.work") {
+		t.Fatal("Workspace:", ws)
+	}
+
+	t.Setenv("GOWORK", "off")
+	if ws := m.Workspace(); ws.Mode != WorkOff || ws.String() != "GOWORK=off: workspace mode disabled" {
+		t.Fatal("Workspace off:", ws)
+	}
+	if err = m.InitWork(); errors.Err(err) != ErrWorkOff {
+		t.Fatal("InitWork off:", err)
+	}
+	if err = m.DropWorkReplace("example.com/baz"); err != nil {
+		t.Fatal("DropWorkReplace off:", err)
+	}
+
+	t.Setenv("GOWORK", "go.work")
+	if err = m.SyncWork(); err == nil || m.Workspace().Err == nil {
+		t.Fatal("SyncWork relative GOWORK:", err)
+	}
+
+	gowork := filepath.Join(root, "ws", "go.work")
+	t.Setenv("GOWORK", gowork)
+	if ws := m.Workspace(); ws.Mode != WorkPath || ws.File != gowork {
+		t.Fatal("Workspace path:", ws)
+	}
+	if err = m.InitWork("../bar"); err != nil {
+		t.Fatal("InitWork:", err)
+	}
+	if err = m.SyncWork(); err != nil {
+		t.Fatal("SyncWork:", err)
+	}
+	b, _ := os.ReadFile(gowork)
+	if string(b) != `go 1.18
+
+use (
+	../foo
+	../bar
+	../baz
+)
+` {
+		t.Fatal("SyncWork:", string(b))
+	}
+	if hasFile(filepath.Join(dir, "go.work")) {
+		t.Fatal("go.work created in the module root")
+	}
+}
+
+func TestFingerprint(t *testing.T) {
+	t.Setenv("GOWORK", "")
+	dir := t.TempDir()
+	fingerprint := func(name, text string) string {
+		if name != "" {
+			os.WriteFile(filepath.Join(dir, name), []byte(text), 0666)
+		}
+		m, err := Load(dir)
+		if err != nil {
+			t.Fatal("Load:", err)
+		}
+		if fp := m.Clone().Fingerprint(); fp != m.Fingerprint() {
+			t.Fatal("Clone:", fp)
+		}
+		return m.Fingerprint()
+	}
+	fp := fingerprint("go.mod", "module example.com/foo\n\ngo 1.18\n")
+	if !strings.HasPrefix(fp, "h1:") || fingerprint("", "") != fp {
+		t.Fatal("Fingerprint:", fp)
+	}
+	seen := map[string]bool{fp: true}
+	for _, step := range []struct{ name, text string }{
+		{"gop.mod", "gop 1.2\n"},
+		{"go.sum", "example.com/bar v1.0.0/go.mod h1:Kq4oqY2fYzNVtWS2yixnJ1wa7aR8j3ZZ6cR+x9ZygIw=\n"},
+		{"go.work", "go 1.18\n\nuse .\n"},
+		{"go.mod", "module example.com/foo\n\ngo 1.19\n"},
+	} {
+		if fp = fingerprint(step.name, step.text); seen[fp] {
+			t.Fatal("Fingerprint unchanged:", step.name)
+		}
+		seen[fp] = true
+	}
+	t.Setenv("GOWORK", "off")
+	if fingerprint("", "") == fp {
+		t.Fatal("Fingerprint GOWORK=off: go.work is used")
+	}
+	if fp = CreateInMemory("example.com/foo", "1.18", "1.2").Fingerprint(); fp != "" {
+		t.Fatal("CreateInMemory:", fp)
+	}
+}
+
+func TestSaveHook(t *testing.T) {
+	var paths, written []string
+	unregister := RegisterSaveHook(func(path string, data []byte) ([]byte, error) {
+		paths = append(paths, filepath.Base(path))
+		return append([]byte("// Code managed by policy.\n\n"), data...), nil
+	})
+	defer unregister()
+	unregisterPost := RegisterPostSaveHook(func(path string, data []byte) error {
+		if b, err := os.ReadFile(path); err != nil || string(b) != string(data) {
+			t.Fatal("PostSaveHook: file not written", path, err)
+		}
+		written = append(written, filepath.Base(path))
+		return nil
+	})
+	defer unregisterPost()
+	dir := t.TempDir()
+	mod, err := Create(dir, "github.com/foo/bar", "", "")
+	if err != nil {
+		t.Fatal("Create:", err)
+	}
+	if err = mod.Save(); err != nil {
+		t.Fatal("Save:", err)
+	}
+	b, _ := os.ReadFile(filepath.Join(dir, "go.mod"))
+	if !strings.HasPrefix(string(b), "// Code managed by policy.\n\nmodule github.com/foo/bar\n") {
+		t.Fatal("Save:", string(b))
+	}
+	if v := strings.Join(paths, " "); v != "go.mod" {
+		t.Fatal("SaveHook paths:", v)
+	}
+	if v := strings.Join(written, " "); v != "go.mod" {
+		t.Fatal("PostSaveHook paths:", v)
+	}
+
+	banned := errors.New("banned module")
+	unregisterBanned := RegisterSaveHook(func(path string, data []byte) ([]byte, error) {
+		if strings.Contains(string(data), "example.com/banned") {
+			return nil, banned
+		}
+		return data, nil
+	})
+	mod.AddRequire("example.com/banned", "v1.0.0", false, true)
+	if err = mod.Save(); err != banned {
+		t.Fatal("Save banned:", err)
+	}
+	if b2, _ := os.ReadFile(filepath.Join(dir, "go.mod")); string(b2) != string(b) {
+		t.Fatal("Save banned: go.mod changed")
+	}
+	if v := strings.Join(written, " "); v != "go.mod" {
+		t.Fatal("PostSaveHook run on aborted Save:", v)
+	}
+
+	unregisterBanned()
+	unregister()
+	lint := errors.New("lint failed")
+	unregisterLint := RegisterPostSaveHook(func(path string, data []byte) error {
+		return lint
+	})
+	defer unregisterLint()
+	if err = mod.Save(); err != lint {
+		t.Fatal("Save lint:", err)
+	}
+	b, _ = os.ReadFile(filepath.Join(dir, "go.mod"))
+	if v := string(b); !strings.HasPrefix(v, "module github.com/foo/bar\n") || !strings.Contains(v, "example.com/banned") {
+		t.Fatal("Save after unregister:", v)
+	}
+}
@@ -0,0 +1,100 @@
+/*
+ * Copyright (c) 2024 The GoPlus Authors (goplus.org). All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package modload
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/goplus/mod"
+	"github.com/qiniu/x/errors"
+)
+
+// -----------------------------------------------------------------------------
+
+// An Overlay maps absolute file paths to their contents, which take precedence
+// over the files on disk, eg. unsaved go.mod/gop.mod buffers of an editor.
+type Overlay map[string][]byte
+
+// ReadFile reads the named file from the overlay, or from disk if the file
+// isn't in the overlay.
+func (p Overlay) ReadFile(name string) ([]byte, error) {
+	if data, ok := p.lookup(name); ok {
+		return data, nil
+	}
+	return os.ReadFile(name)
+}
+
+func (p Overlay) lookup(name string) (data []byte, ok bool) {
+	if p == nil {
+		return
+	}
+	if abs, err := filepath.Abs(name); err == nil {
+		name = abs
+	}
+	data, ok = p[name]
+	return
+}
+
+// findGoMod is like mod.FindGoMod but also finds go.mod in the overlay.
+func (p Overlay) findGoMod(dirFrom string) (dir, file string, err error) {
+	if dirFrom == "" {
+		dirFrom = "."
+	}
+	if dir, err = filepath.Abs(dirFrom); err != nil {
+		return
+	}
+	for dir != "" {
+		file = filepath.Join(dir, "go.mod")
+		if _, ok := p.lookup(file); ok {
+			return
+		}
+		if fi, e := os.Lstat(file); e == nil && !fi.IsDir() {
+			return
+		}
+		if dir, file = filepath.Split(strings.TrimRight(dir, "/\\")); file == "" {
+			break
+		}
+	}
+	err = mod.ErrNotFound
+	return
+}
+
+// LoadOverlay loads a module from specified directory like Load, but reads
+// go.mod, gop.mod, go.sum and go.work from the overlay first. The module is
+// read-only: Save fails with ErrSaveOverlay, and AddRequire doesn't
+// update go.sum.
+func LoadOverlay(dir string, overlay Overlay) (p Module, err error) {
+	if overlay == nil {
+		overlay = Overlay{}
+	}
+	dir, gomod, err := overlay.findGoMod(dir)
+	if err != nil {
+		err = errors.NewWith(err, `overlay.findGoMod(dir)`, -2, "overlay.findGoMod", dir)
+		return
+	}
+	files := make(map[string][]byte)
+	if p, err = loadModule(gomod, filepath.Join(dir, mod.GoxModfile), recordReads(overlay.ReadFile, files), 0); err != nil {
+		return
+	}
+	p.overlay = overlay
+	p.fingerprint = p.fingerprintOf(files, overlay.ReadFile)
+	return
+}
+
+// -----------------------------------------------------------------------------
@@ -25,6 +25,10 @@ import (
 	"golang.org/x/mod/module"
 )
 
+func TestMain(m *testing.M) {
+	os.Exit(modtest.Main(m))
+}
+
 func TestGopClass(t *testing.T) {
 	modtest.GopClass(t)
 }
@@ -0,0 +1,340 @@
+/*
+ * Copyright (c) 2024 The GoPlus Authors (goplus.org). All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package modload
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/goplus/mod/modfetch"
+	"github.com/goplus/mod/modfile"
+	"github.com/goplus/mod/sumfile"
+	"github.com/qiniu/x/errors"
+	"golang.org/x/mod/module"
+	"golang.org/x/mod/semver"
+
+	gomodfile "golang.org/x/mod/modfile"
+)
+
+var (
+	ErrNotRequired = errors.New("module is not required")
+)
+
+// -----------------------------------------------------------------------------
+
+// A Require is a typed view of a require statement of go.mod.
+type Require struct {
+	Mod      module.Version
+	Indirect bool // marked by `// indirect`
+	IsClass  bool // marked by `//gop:class`
+}
+
+// Requires returns all require statements of go.mod.
+func (p Module) Requires() []Require {
+	ret := make([]Require, 0, len(p.Require))
+	for _, r := range p.Require {
+		ret = append(ret, Require{Mod: r.Mod, Indirect: r.Indirect, IsClass: isClass(r)})
+	}
+	return ret
+}
+
+// ClassModPaths returns paths of classfile modules of this module, that is,
+// Opt.ClassMods. If Opt is nil (see LoadStrict), paths of require statements
+// marked by `//gop:class` are returned.
+func (p Module) ClassModPaths() []string {
+	if opt := p.Opt; opt != nil {
+		return append([]string(nil), opt.ClassMods...)
+	}
+	var ret []string
+	for _, r := range p.Require {
+		if isClass(r) {
+			ret = append(ret, r.Mod.Path)
+		}
+	}
+	return ret
+}
+
+// SetRequireFlags sets the `// indirect` and `//gop:class` markers of the
+// require statement of module path, and keeps Opt.ClassMods in sync.
+func (p Module) SetRequireFlags(path string, indirect, isClass bool) error {
+	r := p.lookupRequire(path)
+	if r == nil {
+		return ErrNotRequired
+	}
+	r.Indirect = indirect
+	if line := r.Syntax; line != nil {
+		m := parseMarkers(line)
+		m.indirect, m.class = indirect, isClass
+		line.Suffix = m.suffix()
+	}
+	if opt := p.Opt; opt != nil {
+		opt.ClassMods = removeClassMod(opt.ClassMods, path)
+		if isClass || lookupClassfile(opt, path) != nil { // classfile statement of gop.mod
+			opt.ClassMods = append(opt.ClassMods, path)
+		}
+	}
+	return nil
+}
+
+// MarkClass adds the `//gop:class` marker to the require statement of module
+// path, which makes the module a classfile provider of this module.
+func (p Module) MarkClass(path string) error {
+	return p.setClassMarker(path, true)
+}
+
+// UnmarkClass removes the `//gop:class` marker from the require statement of
+// module path.
+func (p Module) UnmarkClass(path string) error {
+	return p.setClassMarker(path, false)
+}
+
+func (p Module) setClassMarker(path string, isClass bool) error {
+	r := p.lookupRequire(path)
+	if r == nil {
+		return ErrNotRequired
+	}
+	return p.SetRequireFlags(path, r.Indirect, isClass)
+}
+
+func (p Module) lookupRequire(path string) *gomodfile.Require {
+	for _, r := range p.Require {
+		if r.Mod.Path == path {
+			return r
+		}
+	}
+	return nil
+}
+
+// A RequireAction describes what UpdateRequire did to a require statement.
+type RequireAction int
+
+const (
+	RequireUnchanged  RequireAction = iota // the required version is kept
+	RequireAdded                           // a new require statement is added
+	RequireUpgraded                        // the required version is upgraded
+	RequireDowngraded                      // the required version is downgraded (force only)
+)
+
+var requireActions = [...]string{
+	RequireUnchanged:  "unchanged",
+	RequireAdded:      "added",
+	RequireUpgraded:   "upgraded",
+	RequireDowngraded: "downgraded",
+}
+
+func (a RequireAction) String() string {
+	if a >= 0 && int(a) < len(requireActions) {
+		return requireActions[a]
+	}
+	return "RequireAction(" + strconv.Itoa(int(a)) + ")"
+}
+
+// UpdateRequire requires module path@vers. If path is already required, the
+// higher version (in semver order) of the existing one and vers is kept,
+// unless force is true, in which case vers is always used. hasProj is the same
+// as AddRequire, and go.sum is updated like AddRequire if withSum is true. It
+// returns what action is taken.
+func (p Module) UpdateRequire(path, vers string, hasProj, withSum, force bool) (action RequireAction, err error) {
+	f := p.File
+	action = RequireAdded
+	if r := p.lookupRequire(path); r != nil {
+		switch cmp := semver.Compare(vers, r.Mod.Version); {
+		case cmp > 0:
+			action = RequireUpgraded
+		case cmp < 0 && force:
+			action = RequireDowngraded
+		default:
+			action, vers = RequireUnchanged, r.Mod.Version
+		}
+	}
+	if action != RequireUnchanged {
+		if err = f.AddRequire(path, vers); err != nil {
+			return
+		}
+	}
+	if hasProj {
+		if r := p.lookupRequire(path); r != nil && !isClass(r) {
+			addClass(p.Opt, r)
+		}
+	}
+	if !withSum {
+		return
+	}
+	err = p.addSum(module.Version{Path: path, Version: vers})
+	return
+}
+
+// SyncProjectRequires makes sure every versioned package path of project
+// statements in gop.mod (eg. `project .spx Game github.com/goplus/spx@v1.2.0`)
+// is required at that version at least: the required module containing the
+// package (the innermost one) is upgraded if needed, or the package path is
+// required as a module path if no required module contains it. It returns
+// modules required or upgraded. go.sum isn't changed. Save doesn't call it,
+// call it explicitly before Save to persist the requires.
+func (p Module) SyncProjectRequires() (changed []module.Version, err error) {
+	opt := p.Opt
+	if opt == nil {
+		return
+	}
+	for _, proj := range opt.Projects {
+		for _, ref := range proj.PkgRefs {
+			if ref.Version == "" {
+				continue
+			}
+			modPath := p.requireOf(ref.Path)
+			if modPath == "" {
+				if err = module.Check(ref.Path, ref.Version); err != nil {
+					return
+				}
+				modPath = ref.Path
+			}
+			action, e := p.UpdateRequire(modPath, ref.Version, false, false, false)
+			if e != nil {
+				return changed, e
+			}
+			if action != RequireUnchanged {
+				changed = append(changed, module.Version{Path: modPath, Version: ref.Version})
+			}
+		}
+	}
+	return
+}
+
+// requireOf returns the required module (the innermost one) containing the
+// package pkgPath, or "" if there is none.
+func (p Module) requireOf(pkgPath string) (modPath string) {
+	for _, r := range p.Require {
+		path := r.Mod.Path
+		if len(path) > len(modPath) && (pkgPath == path || strings.HasPrefix(pkgPath, path+"/")) {
+			modPath = path
+		}
+	}
+	return
+}
+
+// addSum adds go.sum lines of mod if they don't exist yet. It does nothing if
+// this module doesn't exist on disk or is loaded with an overlay.
+func (p Module) addSum(mod module.Version) error {
+	gosum := p.sumFile()
+	if gosum == "" || p.overlay != nil || !semver.IsValid(mod.Version) {
+		return nil
+	}
+	if _, err := os.Stat(filepath.Dir(gosum)); err != nil {
+		return nil
+	}
+	sumf, err := sumfile.Load(gosum)
+	if err != nil {
+		return err
+	}
+	var hasZip, hasGoMod bool
+	for _, e := range sumf.LookupEntries(mod.Path) {
+		if e.Version == mod.Version {
+			if e.IsGoMod {
+				hasGoMod = true
+			} else {
+				hasZip = true
+			}
+		}
+	}
+	if hasZip && hasGoMod {
+		return nil
+	}
+	h1, goModH1, err := modfetch.Hashes(context.Background(), mod)
+	if err != nil {
+		return errors.NewWith(err, `modfetch.Hashes(context.Background(), mod)`, -2, "modfetch.Hashes", mod)
+	}
+	sumf.AddEntries(
+		sumfile.Entry{Mod: mod.Path, Version: mod.Version, Hash: h1},
+		sumfile.Entry{Mod: mod.Path, Version: mod.Version, Hash: goModH1, IsGoMod: true},
+	)
+	return sumf.Save()
+}
+
+// lookupClassfile returns the classfile statement of module path in gop.mod.
+func lookupClassfile(opt *modfile.File, path string) *modfile.Classfile {
+	for _, c := range opt.Classfiles {
+		if c.Mod.Path == path {
+			return c
+		}
+	}
+	return nil
+}
+
+// removeClassMod returns classMods without path. The backing array of
+// classMods isn't modified, since it may be held by callers.
+func removeClassMod(classMods []string, path string) []string {
+	ret := make([]string, 0, len(classMods))
+	for _, v := range classMods {
+		if v != path {
+			ret = append(ret, v)
+		}
+	}
+	return ret
+}
+
+// -----------------------------------------------------------------------------
+
+// markers represents suffix comments of a require statement, eg.
+//
+//	github.com/goplus/yap v0.5.0 //gop:class
+//	github.com/goplus/yap v0.5.0 // indirect; gop:class
+type markers struct {
+	indirect bool
+	class    bool
+	others   []string // other comment text
+}
+
+func parseMarkers(line *modfile.Line) (m markers) {
+	for _, c := range line.Suffix {
+		for _, part := range strings.Split(c.Token[2:], ";") {
+			switch text := strings.TrimSpace(part); {
+			case text == "indirect":
+				m.indirect = true
+			case text == modfile.ClassMarker || strings.HasPrefix(text, modfile.ClassMarker+" "):
+				m.class = true
+			case text != "":
+				m.others = append(m.others, text)
+			}
+		}
+	}
+	return
+}
+
+// suffix returns suffix comments in the form the go command recognizes:
+// "indirect" must be the first part of the first suffix comment.
+func (m markers) suffix() []modfile.Comment {
+	var parts []string
+	if m.indirect {
+		parts = append(parts, "indirect")
+	}
+	if m.class {
+		if parts == nil && m.others == nil {
+			return []modfile.Comment{{Token: "//gop:class", Suffix: true}}
+		}
+		parts = append(parts, "gop:class")
+	}
+	parts = append(parts, m.others...)
+	if parts == nil {
+		return nil
+	}
+	return []modfile.Comment{{Token: "// " + strings.Join(parts, "; "), Suffix: true}}
+}
+
+// -----------------------------------------------------------------------------
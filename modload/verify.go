@@ -0,0 +1,143 @@
+/*
+ * Copyright (c) 2024 The GoPlus Authors (goplus.org). All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package modload
+
+import (
+	"fmt"
+
+	"github.com/goplus/mod/modfetch"
+	"github.com/goplus/mod/sumfile"
+	"github.com/qiniu/x/errors"
+	"golang.org/x/mod/module"
+)
+
+// -----------------------------------------------------------------------------
+
+// A SumProblemKind is the kind of a go.sum issue found by VerifySums.
+type SumProblemKind int
+
+const (
+	// SumMissing: go.sum has no line of a required module (or its go.mod).
+	SumMissing SumProblemKind = iota + 1
+
+	// SumMismatch: the hash of a go.sum line differs from the hash of the
+	// module (or its go.mod) in GOMODCACHE.
+	SumMismatch
+)
+
+// A SumProblem is a go.sum issue of a required module.
+type SumProblem struct {
+	Kind    SumProblemKind
+	Mod     module.Version // the module go.sum lines are about (replacement applied)
+	IsGoMod bool           // the issue is about the go.mod line ("<version>/go.mod")
+	Sum     string         // hash in go.sum (empty if missing)
+	Cached  string         // hash of the module in GOMODCACHE (empty if not cached)
+}
+
+func (p *SumProblem) String() string {
+	vers := p.Mod.Version
+	if p.IsGoMod {
+		vers += "/go.mod"
+	}
+	if p.Kind == SumMissing {
+		return fmt.Sprintf("%s %s: missing go.sum entry", p.Mod.Path, vers)
+	}
+	return fmt.Sprintf("%s %s: checksum mismatch\n\tgo.sum:     %s\n\tdownloaded: %s", p.Mod.Path, vers, p.Sum, p.Cached)
+}
+
+// A SumReport is the result of VerifySums.
+type SumReport struct {
+	Mods     []module.Version // all modules verified (replacements applied)
+	Problems []*SumProblem
+}
+
+// OK reports whether no problem is found.
+func (p *SumReport) OK() bool {
+	return len(p.Problems) == 0
+}
+
+// VerifySums cross-checks every require statement of go.mod against go.sum:
+//   - the go.mod line of each required module must be present;
+//   - the module zip line must be present for requires not marked
+//     `// indirect` (the go command may omit it for indirect ones);
+//   - if the module (or its go.mod) is in GOMODCACHE, the hashes must match.
+//
+// Modules replaced with local directories are skipped. Nothing is downloaded.
+func (p Module) VerifySums() (ret *SumReport, err error) {
+	ret = new(SumReport)
+	gosum := p.sumFile()
+	if gosum == "" {
+		return
+	}
+	sumf, err := sumfile.LoadEx(gosum, p.overlay.ReadFile)
+	if err != nil {
+		return nil, errors.NewWith(err, `sumfile.LoadEx(gosum, p.overlay.ReadFile)`, -2, "sumfile.LoadEx", gosum, p.overlay.ReadFile)
+	}
+	for _, r := range p.Require {
+		mod := p.replacementOf(r.Mod)
+		if mod.Version == "" { // replaced with a local directory
+			continue
+		}
+		ret.Mods = append(ret.Mods, mod)
+		var sum, goModSum string
+		for _, e := range sumf.LookupEntries(mod.Path) {
+			if e.Version == mod.Version {
+				if e.IsGoMod {
+					goModSum = e.Hash
+				} else {
+					sum = e.Hash
+				}
+			}
+		}
+		h1, goModH1 := modfetch.CachedHashes(mod)
+		ret.check(mod, false, sum, h1, !r.Indirect)
+		ret.check(mod, true, goModSum, goModH1, true)
+	}
+	return
+}
+
+func (p *SumReport) check(mod module.Version, isGoMod bool, sum, cached string, required bool) {
+	switch {
+	case sum == "":
+		if required {
+			p.Problems = append(p.Problems, &SumProblem{Kind: SumMissing, Mod: mod, IsGoMod: isGoMod, Cached: cached})
+		}
+	case cached != "" && cached != sum:
+		p.Problems = append(p.Problems, &SumProblem{Kind: SumMismatch, Mod: mod, IsGoMod: isGoMod, Sum: sum, Cached: cached})
+	}
+}
+
+// replacementOf returns the module replacing mod (by a replace statement of
+// go.mod), or mod itself if it isn't replaced. A replacement of the specific
+// version wins over a replacement of all versions, like the go command does.
+func (p Module) replacementOf(mod module.Version) module.Version {
+	ret, found := mod, false
+	for _, r := range p.Replace {
+		if r.Old.Path != mod.Path {
+			continue
+		}
+		if r.Old.Version == mod.Version {
+			return r.New
+		}
+		if r.Old.Version == "" && !found {
+			ret, found = r.New, true
+		}
+	}
+	return ret
+}
+
+// -----------------------------------------------------------------------------
@@ -0,0 +1,285 @@
+/*
+ * Copyright (c) 2024 The GoPlus Authors (goplus.org). All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package modload
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/qiniu/x/errors"
+
+	gomodfile "golang.org/x/mod/modfile"
+)
+
+var (
+	ErrWorkExists = errors.New("go.work already exists")
+	ErrWorkOff    = errors.New("workspace mode is disabled by GOWORK=off")
+)
+
+// -----------------------------------------------------------------------------
+
+// A WorkMode is how the go.work file of this module is decided by the GOWORK
+// environment variable.
+type WorkMode int
+
+const (
+	WorkAuto WorkMode = iota // GOWORK is empty or "auto": go.work in the module root
+	WorkOff                  // GOWORK=off: workspace mode is disabled
+	WorkPath                 // GOWORK=/path/to/go.work: the specified go.work file
+)
+
+// A Workspace describes the effective go.work file of a module, see
+// Module.Workspace.
+type Workspace struct {
+	Mode WorkMode
+	File string // the go.work file (empty if Mode is WorkOff or the module has no go.mod file)
+	Env  string // value of GOWORK
+	Err  error  // invalid GOWORK, eg. a relative path
+}
+
+func (p Workspace) String() string {
+	switch {
+	case p.Err != nil:
+		return p.Err.Error()
+	case p.Mode == WorkOff:
+		return "GOWORK=off: workspace mode disabled"
+	case p.Mode == WorkPath:
+		return "GOWORK=" + p.Env + ": " + p.File
+	case p.File == "":
+		return "no go.work: module not on disk"
+	}
+	return "go.work in module root: " + p.File
+}
+
+// Workspace returns which go.work file is read and written by workspace APIs
+// (InitWork, SyncWork, DropWorkReplace, PruneWorkReplace and Save if the
+// module depends on gop), decided by GOWORK like the go command does:
+//   - GOWORK=off disables workspace mode: InitWork and SyncWork fail with
+//     ErrWorkOff, and go.work isn't changed by other APIs;
+//   - GOWORK=/path/to/go.work uses the specified file, which must be an
+//     absolute path, and relative paths in it are relative to its directory;
+//   - otherwise (GOWORK is empty or "auto"), go.work in the module root is
+//     used. Note that go.work in parent directories isn't searched.
+func (p Module) Workspace() (ret Workspace) {
+	ret.Env = os.Getenv("GOWORK")
+	switch ret.Env {
+	case "off":
+		ret.Mode = WorkOff
+	case "", "auto":
+		if syn := p.Syntax; syn != nil {
+			ret.File = filepath.Join(filepath.Dir(syn.Name), "go.work")
+		}
+	default:
+		ret.Mode = WorkPath
+		if !filepath.IsAbs(ret.Env) {
+			ret.Err = fmt.Errorf("invalid GOWORK %q: not an absolute path", ret.Env)
+			return
+		}
+		ret.File = filepath.Clean(ret.Env)
+	}
+	return
+}
+
+// -----------------------------------------------------------------------------
+
+// InitWork creates go.work (see Workspace), which uses this module and the
+// module directories dirs (relative to the module root, or absolute), like
+// `go work init`. It fails with ErrWorkExists if go.work already exists.
+func (p Module) InitWork(dirs ...string) (err error) {
+	work, workFile, err := p.loadWork()
+	if err != nil {
+		return
+	}
+	if hasFile(workFile) {
+		return errors.NewWith(ErrWorkExists, `hasFile(workFile)`, -2, "hasFile", workFile)
+	}
+	root, workDir := p.Root(), filepath.Dir(workFile)
+	work.AddUse(workRelPath(root, workDir, "."), p.Path())
+	for _, dir := range dirs {
+		modPath, e := modulePathOf(canonicalDir(root, dir))
+		if e != nil {
+			return e
+		}
+		work.AddUse(workRelPath(root, workDir, dir), modPath)
+	}
+	return writeFile(workFile, gomodfile.Format(work.Syntax), 0666)
+}
+
+// SyncWork makes go.work (see Workspace, which is created if it doesn't exist)
+// use this module and every local directory that a module is replaced
+// with in go.mod, so that these modules can be developed together in the
+// workspace. Replacement directories without go.mod are skipped.
+func (p Module) SyncWork() (err error) {
+	work, workFile, err := p.loadWork()
+	if err != nil {
+		return
+	}
+	root, workDir := p.Root(), filepath.Dir(workFile)
+	used := make(map[string]bool)
+	for _, u := range work.Use {
+		used[canonicalDir(workDir, u.Path)] = true
+	}
+	changed := false
+	if !used[root] {
+		work.AddUse(workRelPath(root, workDir, "."), p.Path())
+		used[root], changed = true, true
+	}
+	for _, r := range p.Replace {
+		if r.New.Version != "" { // not a local directory
+			continue
+		}
+		dir := canonicalDir(root, r.New.Path)
+		if used[dir] {
+			continue
+		}
+		modPath, e := modulePathOf(dir)
+		if e != nil {
+			continue
+		}
+		work.AddUse(workRelPath(root, workDir, r.New.Path), modPath)
+		used[dir], changed = true, true
+	}
+	if !changed {
+		return
+	}
+	work.Cleanup()
+	return writeFile(workFile, gomodfile.Format(work.Syntax), 0666)
+}
+
+// DropWorkReplace removes replace directives of module path (of all versions)
+// from go.work (see Workspace). It does nothing if go.work doesn't exist or
+// GOWORK=off.
+func (p Module) DropWorkReplace(path string) (err error) {
+	return p.dropWorkReplaces(func(r *gomodfile.Replace, _ string) bool {
+		return r.Old.Path == path
+	})
+}
+
+// PruneWorkReplace removes stale replace directives from go.work (see
+// Workspace): the ones replacing a version other than the required one, or
+// whose target is a local directory without go.mod (eg. an old gop root). It
+// does nothing if go.work doesn't exist or GOWORK=off.
+func (p Module) PruneWorkReplace() (err error) {
+	return p.dropWorkReplaces(func(r *gomodfile.Replace, workDir string) bool {
+		vers := ""
+		if req := p.lookupRequire(r.Old.Path); req != nil {
+			vers = req.Mod.Version
+		}
+		return isStaleReplace(r, workDir, vers)
+	})
+}
+
+func (p Module) dropWorkReplaces(cond func(r *gomodfile.Replace, workDir string) bool) (err error) {
+	work, workFile, err := p.loadWork()
+	if err == ErrWorkOff {
+		return nil
+	}
+	if err != nil || !hasFile(workFile) {
+		return
+	}
+	workDir := filepath.Dir(workFile)
+	changed := false
+	for _, r := range append([]*gomodfile.Replace(nil), work.Replace...) {
+		if cond(r, workDir) {
+			if err = work.DropReplace(r.Old.Path, r.Old.Version); err != nil {
+				return
+			}
+			changed = true
+		}
+	}
+	if !changed {
+		return
+	}
+	work.Cleanup()
+	return writeFile(workFile, gomodfile.Format(work.Syntax), 0666)
+}
+
+// loadWork loads go.work (see Workspace), or creates an empty one (in memory)
+// if it doesn't exist.
+func (p Module) loadWork() (work *gomodfile.WorkFile, workFile string, err error) {
+	if p.overlay != nil {
+		return nil, "", ErrSaveOverlay
+	}
+	ws := p.Workspace()
+	switch {
+	case ws.Err != nil:
+		return nil, "", ws.Err
+	case ws.Mode == WorkOff:
+		return nil, "", ErrWorkOff
+	case ws.File == "":
+		return nil, "", ErrSaveDefault
+	}
+	workFile = ws.File
+	b, err := os.ReadFile(workFile)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			return
+		}
+		b = []byte(`go ` + p.GoVersion())
+	}
+	work, err = gomodfile.ParseWork(workFile, b, nil)
+	return
+}
+
+// modulePathOf returns the module path declared by go.mod in dir.
+func modulePathOf(dir string) (string, error) {
+	gomod := filepath.Join(dir, "go.mod")
+	b, err := os.ReadFile(gomod)
+	if err != nil {
+		return "", errors.NewWith(err, `os.ReadFile(gomod)`, -2, "os.ReadFile", gomod)
+	}
+	modPath := gomodfile.ModulePath(b)
+	if modPath == "" {
+		return "", fmt.Errorf("%s: %w", gomod, ErrNoModDecl)
+	}
+	return modPath, nil
+}
+
+// workRelPath returns path (relative to the module root, or absolute) as a path
+// of go.work in directory workDir.
+func workRelPath(root, workDir, path string) string {
+	if workDir == root || filepath.IsAbs(path) {
+		return workUsePath(path)
+	}
+	dir := canonicalDir(root, path)
+	if rel, err := filepath.Rel(workDir, dir); err == nil {
+		return workUsePath(rel)
+	}
+	return dir
+}
+
+// workUsePath returns the path of a use directive of go.work: relative paths
+// are always in the "./dir" form, like the go command writes.
+func workUsePath(dir string) string {
+	if filepath.IsAbs(dir) {
+		return dir
+	}
+	dir = filepath.ToSlash(filepath.Clean(dir))
+	if dir == "." || dir == ".." || strings.HasPrefix(dir, "../") {
+		return dir
+	}
+	return "./" + dir
+}
+
+func hasFile(name string) bool {
+	_, err := os.Stat(name)
+	return err == nil
+}
+
+// -----------------------------------------------------------------------------
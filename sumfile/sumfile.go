@@ -17,28 +17,122 @@
 package sumfile
 
 import (
+	"errors"
+	"fmt"
 	"os"
+	"path/filepath"
 	"sort"
 	"strings"
+
+	"golang.org/x/mod/module"
+)
+
+// -----------------------------------------------------------------------------
+
+// An Entry is a parsed line of a go.sum file, eg.
+//
+//	github.com/qiniu/x v1.13.10 h1:J4Z3XugYzAq85SlyAfqlKVrbf05glMbAOh+QncsDQpE=
+//	github.com/qiniu/x v1.13.10/go.mod h1:INZ2TSWSJVWO/RuELQROERcslOXVjrxQubr3Yvo/o1I=
+type Entry struct {
+	Mod     string // module path
+	Version string // module version (without the "/go.mod" suffix)
+	Hash    string // eg. "h1:J4Z3XugYzAq85SlyAfqlKVrbf05glMbAOh+QncsDQpE="
+	IsGoMod bool   // hash of the go.mod file (not the whole module)
+}
+
+// String returns the go.sum line form of this entry.
+func (e Entry) String() string {
+	ver := e.Version
+	if e.IsGoMod {
+		ver += "/go.mod"
+	}
+	return e.Mod + " " + ver + " " + e.Hash
+}
+
+var (
+	ErrInvalidLine = errors.New("malformed go.sum line")
 )
 
+// A ParseError describes an invalid line of a go.sum file.
+type ParseError struct {
+	File string
+	Line int
+	Err  error
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("%s:%d: %v", e.File, e.Line, e.Err)
+}
+
+func (e *ParseError) Unwrap() error { return e.Err }
+
+// ParseLine parses a go.sum line into an Entry.
+func ParseLine(line string) (e Entry, err error) {
+	f := strings.Fields(line)
+	if len(f) != 3 {
+		err = ErrInvalidLine
+		return
+	}
+	e.Mod, e.Version, e.Hash = f[0], f[1], f[2]
+	if strings.HasSuffix(e.Version, "/go.mod") {
+		e.Version, e.IsGoMod = e.Version[:len(e.Version)-7], true
+	}
+	if err = module.Check(e.Mod, e.Version); err != nil {
+		return
+	}
+	if pos := strings.IndexByte(e.Hash, ':'); pos <= 0 || pos == len(e.Hash)-1 {
+		err = fmt.Errorf("%w: invalid hash %q", ErrInvalidLine, e.Hash)
+	}
+	return
+}
+
+// Parse parses content of a go.sum (or go.work.sum) file.
+// Blank lines are ignored.
+func Parse(file string, data []byte) (entries []Entry, err error) {
+	for i, line := range strings.Split(string(data), "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		e, err := ParseLine(line)
+		if err != nil {
+			return nil, &ParseError{File: file, Line: i + 1, Err: err}
+		}
+		entries = append(entries, e)
+	}
+	return
+}
+
+// -----------------------------------------------------------------------------
+
 type File struct {
-	lines []string
-	gosum string
+	lines  []string
+	gosum  string
+	lineNo map[string]int // line numbers of lines in the loaded file, see Entries
 }
 
 func Load(gosum string) (sumf *File, err error) {
-	var lines []string
-	b, err := os.ReadFile(gosum)
+	return LoadEx(gosum, os.ReadFile)
+}
+
+// LoadEx is like Load but reads the go.sum file by a customized `readFile`.
+func LoadEx(gosum string, readFile func(string) ([]byte, error)) (sumf *File, err error) {
+	sumf = &File{gosum: gosum}
+	b, err := readFile(gosum)
 	if err != nil {
 		if !os.IsNotExist(err) {
-			return
+			return nil, err
 		}
-	} else {
-		text := string(b)
-		lines = strings.Split(strings.TrimRight(text, "\n"), "\n")
+		return sumf, nil
 	}
-	return &File{lines, gosum}, nil
+	text := string(b)
+	sumf.lines = strings.Split(strings.TrimRight(text, "\n"), "\n")
+	sumf.lineNo = make(map[string]int, len(sumf.lines))
+	for i, line := range sumf.lines {
+		if _, ok := sumf.lineNo[line]; !ok {
+			sumf.lineNo[line] = i + 1
+		}
+	}
+	return sumf, nil
 }
 
 func (p *File) Save() (err error) {
@@ -78,3 +172,120 @@ func (p *File) Add(lines []string) {
 	p.lines = append(p.lines, lines...)
 	sort.Strings(p.lines)
 }
+
+// Name returns the file path of this go.sum file.
+func (p *File) Name() string {
+	return p.gosum
+}
+
+// Entries returns all entries of this go.sum file. The line number of a
+// ParseError is the line of the malformed line in the loaded file.
+func (p *File) Entries() (entries []Entry, err error) {
+	for _, line := range p.lines {
+		if line == "" {
+			continue
+		}
+		e, err := ParseLine(line)
+		if err != nil {
+			return nil, &ParseError{File: p.gosum, Line: p.lineNo[line], Err: err}
+		}
+		entries = append(entries, e)
+	}
+	return
+}
+
+// LookupEntries returns all entries of the specified module.
+func (p *File) LookupEntries(modPath string) (entries []Entry) {
+	for _, line := range p.Lookup(modPath) {
+		if e, err := ParseLine(line); err == nil {
+			entries = append(entries, e)
+		}
+	}
+	return
+}
+
+// AddEntries adds entries that don't exist yet.
+func (p *File) AddEntries(entries ...Entry) {
+	exists := make(map[string]bool, len(p.lines))
+	for _, line := range p.lines {
+		exists[line] = true
+	}
+	var lines []string
+	for _, e := range entries {
+		if line := e.String(); !exists[line] {
+			exists[line] = true
+			lines = append(lines, line)
+		}
+	}
+	if lines != nil {
+		p.Add(lines)
+	}
+}
+
+// -----------------------------------------------------------------------------
+
+// A Workspace is a pair of go.sum and go.work.sum files.
+// Tools working in workspace mode should keep both of them in sync.
+type Workspace struct {
+	Sum     *File // go.sum of the main module
+	WorkSum *File // go.work.sum of the workspace
+}
+
+// LoadWorkspace loads go.sum in modRoot and go.work.sum next to the gowork file.
+// Missing files are treated as empty.
+func LoadWorkspace(modRoot, gowork string) (ws *Workspace, err error) {
+	sum, err := Load(filepath.Join(modRoot, "go.sum"))
+	if err != nil {
+		return
+	}
+	worksum, err := Load(WorkSumFile(gowork))
+	if err != nil {
+		return
+	}
+	return &Workspace{sum, worksum}, nil
+}
+
+// WorkSumFile returns path of the go.work.sum file of the specified go.work file.
+func WorkSumFile(gowork string) string {
+	return gowork + ".sum"
+}
+
+// Lookup lookups lines of the specified module in go.sum and then go.work.sum.
+func (p *Workspace) Lookup(modPath string) []string {
+	if lines := p.Sum.Lookup(modPath); lines != nil {
+		return lines
+	}
+	return p.WorkSum.Lookup(modPath)
+}
+
+// Add adds lines to go.sum, and removes them from go.work.sum to avoid duplicates.
+func (p *Workspace) Add(lines []string) {
+	p.Sum.Add(lines)
+	dup := make(map[string]bool, len(lines))
+	for _, line := range lines {
+		dup[line] = true
+	}
+	kept := p.WorkSum.lines[:0]
+	for _, line := range p.WorkSum.lines {
+		if !dup[line] {
+			kept = append(kept, line)
+		}
+	}
+	p.WorkSum.lines = kept
+}
+
+// Save saves both go.sum and go.work.sum.
+// An empty go.work.sum is not created if it doesn't exist.
+func (p *Workspace) Save() (err error) {
+	if err = p.Sum.Save(); err != nil {
+		return
+	}
+	if len(p.WorkSum.lines) == 0 {
+		if _, e := os.Stat(p.WorkSum.gosum); os.IsNotExist(e) {
+			return
+		}
+	}
+	return p.WorkSum.Save()
+}
+
+// -----------------------------------------------------------------------------
@@ -0,0 +1,163 @@
+/*
+ * Copyright (c) 2024 The GoPlus Authors (goplus.org). All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package sumfile
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const (
+	xLine      = "github.com/qiniu/x v1.13.10 h1:J4Z3XugYzAq85SlyAfqlKVrbf05glMbAOh+QncsDQpE="
+	xGoModLine = "github.com/qiniu/x v1.13.10/go.mod h1:INZ2TSWSJVWO/RuELQROERcslBwVgFG7MkTfEdaQz9E="
+	modLine    = "golang.org/x/mod v0.20.0 h1:utOm6MM3R3dnawAiJgn0y+xvuYRsm1RKM/4giyfDgV0="
+)
+
+func TestParseLine(t *testing.T) {
+	cases := []struct {
+		line string
+		want Entry
+		ok   bool
+	}{
+		{xLine, Entry{"github.com/qiniu/x", "v1.13.10", "h1:J4Z3XugYzAq85SlyAfqlKVrbf05glMbAOh+QncsDQpE=", false}, true},
+		{"  " + xGoModLine + "\t", Entry{"github.com/qiniu/x", "v1.13.10", "h1:INZ2TSWSJVWO/RuELQROERcslBwVgFG7MkTfEdaQz9E=", true}, true},
+		{"", Entry{}, false},
+		{"github.com/qiniu/x v1.13.10", Entry{}, false},
+		{xLine + " extra", Entry{}, false},
+		{"github.com/qiniu/x 1.13.10 h1:abc=", Entry{}, false},
+		{"github.com/qiniu/x/v2 v1.13.10 h1:abc=", Entry{}, false},
+		{"github.com/qiniu/x v1.13.10 abc", Entry{}, false},
+		{"github.com/qiniu/x v1.13.10 h1:", Entry{}, false},
+		{"github.com/qiniu/x v1.13.10 :abc", Entry{}, false},
+	}
+	for _, c := range cases {
+		e, err := ParseLine(c.line)
+		if (err == nil) != c.ok || (c.ok && e != c.want) {
+			t.Fatalf("ParseLine(%q): %v, %v", c.line, e, err)
+		}
+		if c.ok && e.String() != strings.TrimSpace(c.line) {
+			t.Fatal("Entry.String:", e)
+		}
+	}
+	if _, err := ParseLine("a b"); err != ErrInvalidLine {
+		t.Fatal("ParseLine: fields", err)
+	}
+	if _, err := ParseLine("github.com/qiniu/x v1.13.10 h1"); !errors.Is(err, ErrInvalidLine) {
+		t.Fatal("ParseLine: hash", err)
+	}
+}
+
+func TestParse(t *testing.T) {
+	entries, err := Parse("go.sum", []byte(xLine+"\n\n"+xGoModLine+"\n"))
+	if err != nil || len(entries) != 2 || !entries[1].IsGoMod {
+		t.Fatal("Parse:", entries, err)
+	}
+	_, err = Parse("go.sum", []byte(xLine+"\n\nbad line\n"))
+	var e *ParseError
+	if !errors.As(err, &e) || e.File != "go.sum" || e.Line != 3 || !errors.Is(err, ErrInvalidLine) {
+		t.Fatal("Parse: malformed", err)
+	}
+	if err.Error() != "go.sum:3: malformed go.sum line" {
+		t.Fatal("ParseError:", err)
+	}
+}
+
+func TestFile(t *testing.T) {
+	dir := t.TempDir()
+	gosum := filepath.Join(dir, "go.sum")
+	sumf, err := Load(gosum)
+	if err != nil || sumf.Name() != gosum || sumf.Lookup("github.com/qiniu/x") != nil {
+		t.Fatal("Load: missing file", sumf, err)
+	}
+	if _, err = Load(dir); err == nil {
+		t.Fatal("Load: directory")
+	}
+
+	os.WriteFile(gosum, []byte(xLine+"\n"+xGoModLine+"\nbad line\n"), 0666)
+	if sumf, err = Load(gosum); err != nil {
+		t.Fatal("Load:", err)
+	}
+	if lines := sumf.Lookup("github.com/qiniu/x"); !reflect.DeepEqual(lines, []string{xLine, xGoModLine}) {
+		t.Fatal("Lookup:", lines)
+	}
+	if sumf.Lookup("github.com/qiniu") != nil || sumf.Lookup("golang.org/x/mod") != nil {
+		t.Fatal("Lookup: not found")
+	}
+	sumf.AddEntries(
+		Entry{Mod: "golang.org/x/mod", Version: "v0.20.0", Hash: "h1:utOm6MM3R3dnawAiJgn0y+xvuYRsm1RKM/4giyfDgV0="},
+		Entry{Mod: "github.com/qiniu/x", Version: "v1.13.10", Hash: "h1:J4Z3XugYzAq85SlyAfqlKVrbf05glMbAOh+QncsDQpE="},
+	)
+	_, err = sumf.Entries()
+	var e *ParseError
+	if !errors.As(err, &e) || e.Line != 3 { // the line number in the file, though lines are sorted by AddEntries
+		t.Fatal("Entries:", err)
+	}
+	if entries := sumf.LookupEntries("golang.org/x/mod"); len(entries) != 1 || entries[0].String() != modLine {
+		t.Fatal("LookupEntries:", entries)
+	}
+	if err = sumf.Save(); err != nil {
+		t.Fatal("Save:", err)
+	}
+	b, _ := os.ReadFile(gosum)
+	if want := "bad line\n" + xLine + "\n" + xGoModLine + "\n" + modLine + "\n"; string(b) != want {
+		t.Fatal("Save:", string(b))
+	}
+}
+
+func TestWorkspace(t *testing.T) {
+	dir := t.TempDir()
+	gowork := filepath.Join(dir, "go.work")
+	os.WriteFile(filepath.Join(dir, "go.sum"), []byte(xLine+"\n"), 0666)
+	ws, err := LoadWorkspace(dir, gowork)
+	if err != nil {
+		t.Fatal("LoadWorkspace:", err)
+	}
+	if ws.Lookup("golang.org/x/mod") != nil || len(ws.Lookup("github.com/qiniu/x")) != 1 {
+		t.Fatal("Lookup")
+	}
+	ws.Add([]string{modLine})
+	if err = ws.Save(); err != nil {
+		t.Fatal("Save:", err)
+	}
+	if _, err = os.Stat(WorkSumFile(gowork)); !os.IsNotExist(err) {
+		t.Fatal("Save: empty go.work.sum created", err)
+	}
+
+	os.WriteFile(WorkSumFile(gowork), []byte(xGoModLine+"\n"+modLine+"\n"), 0666)
+	if ws, err = LoadWorkspace(dir, gowork); err != nil {
+		t.Fatal("LoadWorkspace:", err)
+	}
+	if lines := ws.Lookup("github.com/qiniu/x"); len(lines) != 1 || lines[0] != xLine {
+		t.Fatal("Lookup go.sum first:", lines)
+	}
+	ws.Add([]string{xGoModLine})
+	if err = ws.Save(); err != nil {
+		t.Fatal("Save:", err)
+	}
+	b, _ := os.ReadFile(WorkSumFile(gowork))
+	if string(b) != modLine+"\n" {
+		t.Fatal("Save go.work.sum:", string(b))
+	}
+	b, _ = os.ReadFile(filepath.Join(dir, "go.sum"))
+	if string(b) != xLine+"\n"+xGoModLine+"\n"+modLine+"\n" {
+		t.Fatal("Save go.sum:", string(b))
+	}
+}